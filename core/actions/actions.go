@@ -1,11 +1,17 @@
 package actions
 
-import "fmt"
+import (
+	"context"
+	"fmt"
+)
 
 const (
 	NumberActionKeyType = ActionKeyT(0)
 	StringActionKeyType = ActionKeyT(1)
 	FloatActionKeyType  = ActionKeyT(2)
+	ListActionKeyType   = ActionKeyT(3)
+	ObjectActionKeyType = ActionKeyT(4)
+	BoolActionKeyType   = ActionKeyT(5)
 )
 
 type (
@@ -23,6 +29,23 @@ type (
 		KeyType ActionKeyT
 	}
 
+	// SecretGetter returns the value of one of the user's secrets by name
+	SecretGetter func(name string) (value string, err error)
+
+	// SecretActionExecutor is implemented by actions which read secrets by
+	// their name, so that the secret values aren't part of their input
+	SecretActionExecutor interface {
+		ActionExecutor
+		ExecuteWithSecrets(Input, SecretGetter) (Output, error)
+	}
+
+	// ContextActionExecutor is implemented by actions which stop their work
+	// once the context is done. The context's deadline is the job's timeout.
+	ContextActionExecutor interface {
+		ActionExecutor
+		ExecuteContext(context.Context, Input, SecretGetter) (Output, error)
+	}
+
 	BaseAction struct{}
 )
 
@@ -45,3 +68,181 @@ func (baseAction BaseAction) Execute(action ActionExecutor, input Input) (output
 	}
 	return
 }
+
+// ExecuteWithSecrets executes the action with access to the user's secrets
+// when the action reads secrets by name
+func (baseAction BaseAction) ExecuteWithSecrets(action ActionExecutor, input Input, getSecret SecretGetter) (output Output, err error) {
+	secretAction, isSecretAction := action.(SecretActionExecutor)
+	if !isSecretAction {
+		return baseAction.Execute(action, input)
+	}
+	if err = baseAction.Validate(action, input); err != nil {
+		return
+	}
+	if output, err = secretAction.ExecuteWithSecrets(input, getSecret); err != nil {
+		return
+	}
+	return
+}
+
+// ExecuteContext executes the action with the context of the job when the
+// action supports it, with access to the user's secrets otherwise
+func (baseAction BaseAction) ExecuteContext(ctx context.Context, action ActionExecutor, input Input, getSecret SecretGetter) (output Output, err error) {
+	contextAction, isContextAction := action.(ContextActionExecutor)
+	if !isContextAction {
+		return baseAction.ExecuteWithSecrets(action, input, getSecret)
+	}
+	if err = baseAction.Validate(action, input); err != nil {
+		return
+	}
+	if output, err = contextAction.ExecuteContext(ctx, input, getSecret); err != nil {
+		return
+	}
+	return
+}
+
+// GetSecret returns the value of the secret named by the string at the key
+func (getSecret SecretGetter) GetSecret(input Input, key string, isRequired bool) (value string, err error) {
+	var (
+		name string
+	)
+	if name, err = input.GetString(key, isRequired); err != nil || name == "" {
+		return
+	}
+	if getSecret == nil {
+		err = fmt.Errorf("Secret %s can't be resolved outside of a job", name)
+		return
+	}
+	if value, err = getSecret(name); err != nil {
+		return
+	}
+	return
+}
+
+// ==========================================================
+// Input helpers
+
+// GetString returns the string at the key. Missing keys are only
+// an error when the key is required.
+func (input Input) GetString(key string, isRequired bool) (val string, err error) {
+	rawVal, isPresent := input[key]
+	if !isPresent || rawVal == nil {
+		if isRequired {
+			err = fmt.Errorf("Key %s not present in the input", key)
+		}
+		return
+	}
+	var isString bool
+	if val, isString = rawVal.(string); !isString {
+		err = fmt.Errorf("Key %s should be a string", key)
+		return
+	}
+	return
+}
+
+// GetNumber returns the number at the key and 0 when it's missing
+func (input Input) GetNumber(key string) (val float64, err error) {
+	rawVal, isPresent := input[key]
+	if !isPresent || rawVal == nil {
+		return
+	}
+	switch typedVal := rawVal.(type) {
+	case float64:
+		val = typedVal
+	case float32:
+		val = float64(typedVal)
+	case int:
+		val = float64(typedVal)
+	case int64:
+		val = float64(typedVal)
+	default:
+		err = fmt.Errorf("Key %s should be a number", key)
+		return
+	}
+	return
+}
+
+// GetBool returns the boolean at the key or the default value when it's missing
+func (input Input) GetBool(key string, defaultVal bool) (val bool, err error) {
+	rawVal, isPresent := input[key]
+	if !isPresent || rawVal == nil {
+		val = defaultVal
+		return
+	}
+	var isBool bool
+	if val, isBool = rawVal.(bool); !isBool {
+		err = fmt.Errorf("Key %s should be a boolean", key)
+		return
+	}
+	return
+}
+
+// GetObject returns the object at the key and nil when it's missing
+func (input Input) GetObject(key string) (val map[string]interface{}, err error) {
+	rawVal, isPresent := input[key]
+	if !isPresent || rawVal == nil {
+		return
+	}
+	switch typedVal := rawVal.(type) {
+	case map[string]interface{}:
+		val = typedVal
+	case Input:
+		val = typedVal
+	default:
+		err = fmt.Errorf("Key %s should be an object", key)
+		return
+	}
+	return
+}
+
+// GetStringMap returns the object at the key with all its values converted
+// to strings, eg. for headers. Lists of values are returned as is.
+func (input Input) GetStringMap(key string) (val map[string][]string, err error) {
+	var (
+		obj map[string]interface{}
+	)
+	if obj, err = input.GetObject(key); err != nil || obj == nil {
+		return
+	}
+	val = make(map[string][]string)
+	for mKey, mVal := range obj {
+		switch typedVal := mVal.(type) {
+		case nil:
+			continue
+		case []interface{}:
+			for _, elem := range typedVal {
+				val[mKey] = append(val[mKey], fmt.Sprint(elem))
+			}
+		case map[string]interface{}:
+			err = fmt.Errorf("Key %s.%s should be a string or a list of strings", key, mKey)
+			return
+		default:
+			val[mKey] = append(val[mKey], fmt.Sprint(typedVal))
+		}
+	}
+	return
+}
+
+// GetStringList returns the list of strings at the key. Numbers and booleans
+// in the list are converted to strings.
+func (input Input) GetStringList(key string) (val []string, err error) {
+	rawVal, isPresent := input[key]
+	if !isPresent || rawVal == nil {
+		return
+	}
+	list, isList := rawVal.([]interface{})
+	if !isList {
+		err = fmt.Errorf("Key %s should be a list of strings", key)
+		return
+	}
+	for _, elem := range list {
+		switch elem.(type) {
+		case string, float64, bool:
+			val = append(val, fmt.Sprint(elem))
+		default:
+			err = fmt.Errorf("Key %s should be a list of strings", key)
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,33 @@
+package actions
+
+import (
+	"context"
+)
+
+type (
+	// RegistryCredentials is a login to a container registry
+	RegistryCredentials struct {
+		Registry string
+		Username string
+		Password string
+	}
+
+	// RegistryCredentialsGetter returns the registry credentials which
+	// Docker jobs refer to by name
+	RegistryCredentialsGetter func(name string) (*RegistryCredentials, error)
+
+	registryCredentialsKey struct{}
+)
+
+// ContextWithRegistryCredentials returns a context carrying the registry
+// credentials the Docker jobs executed with it can use, eg. the user's ones
+func ContextWithRegistryCredentials(ctx context.Context, getCredentials RegistryCredentialsGetter) context.Context {
+	return context.WithValue(ctx, registryCredentialsKey{}, getCredentials)
+}
+
+// registryCredentialsFromContext returns the registry credentials getter
+// of the context, nil when it has none
+func registryCredentialsFromContext(ctx context.Context) RegistryCredentialsGetter {
+	getCredentials, _ := ctx.Value(registryCredentialsKey{}).(RegistryCredentialsGetter)
+	return getCredentials
+}
@@ -0,0 +1,134 @@
+package actions
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/cronny/core/config"
+	"github.com/cronny/core/helpers"
+)
+
+type (
+	dockerLimitsKey struct{}
+)
+
+// AdminDockerLimits returns the limits set by the admin, which are the most
+// resources any Docker job can use
+func AdminDockerLimits() helpers.DockerLimits {
+	return helpers.DockerLimits{
+		Cpus:           config.DockerMaxCpus,
+		MemoryMB:       config.DockerMaxMemoryMB,
+		Pids:           config.DockerMaxPids,
+		DiskMB:         config.DockerMaxDiskMB,
+		NetworkMode:    config.DockerDefaultNetwork,
+		User:           config.DockerUser,
+		ReadOnlyRootfs: !config.DockerWritableRootfs,
+	}
+}
+
+// ContextWithDockerLimits returns a context carrying the most resources
+// the Docker jobs executed with it can use, eg. the limits of the user's plan
+func ContextWithDockerLimits(ctx context.Context, limits helpers.DockerLimits) context.Context {
+	return context.WithValue(ctx, dockerLimitsKey{}, limits)
+}
+
+// dockerLimitsFromContext returns the limits of the context, the admin's
+// limits when it has none
+func dockerLimitsFromContext(ctx context.Context) helpers.DockerLimits {
+	if limits, isPresent := ctx.Value(dockerLimitsKey{}).(helpers.DockerLimits); isPresent {
+		return limits
+	}
+	return AdminDockerLimits()
+}
+
+// MinDockerLimit returns the lowest of the limits, where 0 is unlimited
+func MinDockerLimit[T int64 | float64](limit, other T) T {
+	if limit == 0 || (other > 0 && other < limit) {
+		return other
+	}
+	return limit
+}
+
+// parseLimits parses the limits requested by the job, eg. {"cpus": 0.5, "memory_mb": 128, "network": "bridge"}.
+// The limits which aren't requested are the max limits, which can't be exceeded.
+func (dockerAction DockerRegistryAction) parseLimits(input Input, maxLimits helpers.DockerLimits) (limits helpers.DockerLimits, err error) {
+	var (
+		num float64
+	)
+	limits = maxLimits
+	if num, err = input.GetNumber("cpus"); err != nil {
+		return
+	}
+	if limits.Cpus, err = dockerLimit("cpus", num, maxLimits.Cpus); err != nil {
+		return
+	}
+	for _, intLimit := range []struct {
+		key      string
+		limit    *int64
+		maxLimit int64
+	}{
+		{"memory_mb", &limits.MemoryMB, maxLimits.MemoryMB},
+		{"pids", &limits.Pids, maxLimits.Pids},
+		{"disk_mb", &limits.DiskMB, maxLimits.DiskMB},
+	} {
+		if num, err = input.GetNumber(intLimit.key); err != nil {
+			return
+		}
+		if num != float64(int64(num)) {
+			err = fmt.Errorf("%s should be a whole number", intLimit.key)
+			return
+		}
+		if *intLimit.limit, err = dockerLimit(intLimit.key, int64(num), intLimit.maxLimit); err != nil {
+			return
+		}
+	}
+
+	if limits.NetworkMode, err = input.GetString("network", false); err != nil {
+		return
+	}
+	if limits.NetworkMode == "" {
+		limits.NetworkMode = maxLimits.NetworkMode
+	} else if !slices.Contains(config.DockerAllowedNetworks, limits.NetworkMode) {
+		err = fmt.Errorf("network %s isn't allowed", limits.NetworkMode)
+		return
+	}
+
+	if limits.User, err = input.GetString("user", false); err != nil {
+		return
+	}
+	if limits.User == "" {
+		limits.User = maxLimits.User
+	} else if isRootUser(limits.User) {
+		err = fmt.Errorf("Containers can't run as root")
+		return
+	}
+	return
+}
+
+// dockerLimit returns the requested limit, the max limit when it's not
+// requested. Requesting more than the max limit is an error.
+func dockerLimit[T int64 | float64](key string, requested, maxLimit T) (limit T, err error) {
+	if requested < 0 {
+		err = fmt.Errorf("%s should be positive", key)
+		return
+	}
+	if requested == 0 {
+		limit = maxLimit
+		return
+	}
+	if maxLimit > 0 && requested > maxLimit {
+		err = fmt.Errorf("%s can't be more than %v", key, maxLimit)
+		return
+	}
+	limit = requested
+	return
+}
+
+// isRootUser checks if the user, a name or uid with an optional group, is
+// root. An empty name is the image's user, which is usually root.
+func isRootUser(user string) bool {
+	name, _, _ := strings.Cut(user, ":")
+	return name == "root" || strings.TrimLeft(name, "0") == ""
+}
@@ -1,12 +1,48 @@
 package actions
 
 import (
+	"context"
 	"fmt"
+	"log"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
 
+	"github.com/docker/docker/api/types/mount"
+
+	"github.com/cronny/core/config"
 	"github.com/cronny/core/helpers"
 )
 
+var (
+	dockerDigestRegex = regexp.MustCompile(`^sha256:[a-f0-9]{64}$`)
+)
+
 type (
+	// DockerActionReq is the container run by a Docker job
+	DockerActionReq struct {
+		Image    string
+		Registry string
+		// RegistryCredentials is the name of the user's registry credentials
+		RegistryCredentials string
+		// RegistryUsername and RegistryPassword are the deprecated plaintext
+		// credentials, which are moved to stored ones by
+		// models.MigrateRegistryCredentials
+		RegistryUsername string
+		RegistryPassword string
+		Digest           string
+		PullPolicy       helpers.DockerPullPolicy
+
+		Cmd        []string
+		Entrypoint []string
+		Env        []string
+		WorkingDir string
+		Mounts     []helpers.DockerMount
+		Limits     helpers.DockerLimits
+	}
+
 	DockerRegistryAction struct{}
 )
 
@@ -21,85 +57,348 @@ func (dockerAction DockerRegistryAction) RequiredKeys() (keys []ActionKey) {
 func (dockerAction DockerRegistryAction) OptionalKeys() (keys []ActionKey) {
 	keys = []ActionKey{
 		{"registry", StringActionKeyType},
+		{"registry_credentials", StringActionKeyType},
+		// Deprecated in favour of registry_credentials
 		{"registry_username", StringActionKeyType},
 		{"registry_password", StringActionKeyType},
+		{"digest", StringActionKeyType},
+		{"pull_policy", StringActionKeyType},
+		{"command", ListActionKeyType},
+		{"entrypoint", ListActionKeyType},
+		{"env", ObjectActionKeyType},
+		{"workdir", StringActionKeyType},
+		{"mounts", ListActionKeyType},
+		{"cpus", FloatActionKeyType},
+		{"memory_mb", NumberActionKeyType},
+		{"pids", NumberActionKeyType},
+		{"disk_mb", NumberActionKeyType},
+		{"network", StringActionKeyType},
+		{"user", StringActionKeyType},
 	}
 	return
 }
 
 func (dockerAction DockerRegistryAction) Validate(input Input) (err error) {
+	_, err = dockerAction.parse(input, AdminDockerLimits())
+	return
+}
+
+// parse parses the container of the job, whose limits can't exceed maxLimits
+func (dockerAction DockerRegistryAction) parse(input Input, maxLimits helpers.DockerLimits) (dockerReq *DockerActionReq, err error) {
+	dockerReq = &DockerActionReq{}
 	// Check required keys
 	if _, exists := input["image"]; !exists {
-		return fmt.Errorf("missing required field: image")
+		err = fmt.Errorf("missing required field: image")
+		return
+	}
+	if dockerReq.Image, err = input.GetString("image", true); err != nil {
+		return
+	}
+	if dockerReq.Registry, err = input.GetString("registry", false); err != nil {
+		return
+	}
+	if dockerReq.RegistryCredentials, err = input.GetString("registry_credentials", false); err != nil {
+		return
+	}
+	if dockerReq.RegistryUsername, err = input.GetString("registry_username", false); err != nil {
+		return
+	}
+	if dockerReq.RegistryPassword, err = input.GetString("registry_password", false); err != nil {
+		return
+	}
+	_, hasUsername := input["registry_username"]
+	_, hasPassword := input["registry_password"]
+	if (hasUsername || hasPassword) && dockerReq.RegistryCredentials != "" {
+		err = fmt.Errorf("registry_credentials can't be used with registry_username and registry_password")
+		return
 	}
-
 	// If registry credentials are provided, validate them
 	if _, hasRegistry := input["registry"]; hasRegistry {
-		// If registry is provided, check if both username and password are provided or neither
-		hasUsername := false
-		hasPassword := false
-
-		if _, exists := input["registry_username"]; exists {
-			hasUsername = true
-		}
-
-		if _, exists := input["registry_password"]; exists {
-			hasPassword = true
-		}
-
 		// If one credential is provided but not the other, return an error
 		if (hasUsername && !hasPassword) || (!hasUsername && hasPassword) {
-			return fmt.Errorf("when providing registry credentials, both username and password must be provided")
+			err = fmt.Errorf("when providing registry credentials, both username and password must be provided")
+			return
 		}
 	}
+	if err = dockerAction.parseImagePull(input, dockerReq); err != nil {
+		return
+	}
 
-	return nil
+	// A command string runs in a shell like the shell form of a Dockerfile's CMD
+	if command, isString := input["command"].(string); isString {
+		dockerReq.Cmd = []string{"/bin/sh", "-c", command}
+	} else if dockerReq.Cmd, err = input.GetStringList("command"); err != nil {
+		return
+	}
+	if entrypoint, isString := input["entrypoint"].(string); isString {
+		dockerReq.Entrypoint = []string{entrypoint}
+	} else if dockerReq.Entrypoint, err = input.GetStringList("entrypoint"); err != nil {
+		return
+	}
+	if dockerReq.Env, err = parseEnv(input); err != nil {
+		return
+	}
+	if dockerReq.WorkingDir, err = input.GetString("workdir", false); err != nil {
+		return
+	}
+	if dockerReq.WorkingDir != "" && !path.IsAbs(dockerReq.WorkingDir) {
+		err = fmt.Errorf("workdir should be an absolute path")
+		return
+	}
+	if dockerReq.Mounts, err = dockerAction.parseMounts(input); err != nil {
+		return
+	}
+	if dockerReq.Limits, err = dockerAction.parseLimits(input, maxLimits); err != nil {
+		return
+	}
+	return
 }
 
-func (dockerAction DockerRegistryAction) Execute(input Input) (output Output, err error) {
+// parseImagePull parses the digest pinning the image and the pull policy,
+// which defaults to pulling the image on every run unless it's pinned
+func (dockerAction DockerRegistryAction) parseImagePull(input Input, dockerReq *DockerActionReq) (err error) {
 	var (
-		dockerExecutor *helpers.DockerExecutor
-		image          string
-		registry       string
-		username       string
-		password       string
+		pullPolicy string
 	)
+	if dockerReq.Digest, err = input.GetString("digest", false); err != nil {
+		return
+	}
+	if dockerReq.Digest != "" {
+		if !dockerDigestRegex.MatchString(dockerReq.Digest) {
+			err = fmt.Errorf("digest should be a sha256 digest, eg. sha256:0123...")
+			return
+		}
+		if strings.Contains(dockerReq.Image, "@") {
+			err = fmt.Errorf("image is already pinned to a digest")
+			return
+		}
+	}
+	if pullPolicy, err = input.GetString("pull_policy", false); err != nil {
+		return
+	}
+	dockerReq.PullPolicy = helpers.DockerPullPolicy(pullPolicy)
+	switch dockerReq.PullPolicy {
+	case "":
+		// Pinned images never change once they're on the host
+		dockerReq.PullPolicy = helpers.PullAlways
+		if dockerReq.Digest != "" || strings.Contains(dockerReq.Image, "@") {
+			dockerReq.PullPolicy = helpers.PullIfNotPresent
+		}
+	case helpers.PullAlways, helpers.PullIfNotPresent, helpers.PullNever:
+	default:
+		err = fmt.Errorf("Unsupported pull_policy %s", pullPolicy)
+		return
+	}
+	return
+}
 
-	if err = dockerAction.Validate(input); err != nil {
+// registryCredentials resolves the registry credentials of the job which
+// are only sent to the registry they're for. The deprecated plaintext
+// credentials of the input are still used as they are.
+func (dockerAction DockerRegistryAction) registryCredentials(ctx context.Context, dockerReq *DockerActionReq) (credentials *RegistryCredentials, err error) {
+	if dockerReq.RegistryUsername != "" || dockerReq.RegistryPassword != "" {
+		log.Printf("Docker job of %s uses the deprecated registry_username and registry_password, refer to stored credentials with registry_credentials", dockerReq.Image)
+		credentials = &RegistryCredentials{
+			Registry: dockerReq.Registry,
+			Username: dockerReq.RegistryUsername,
+			Password: dockerReq.RegistryPassword,
+		}
+		return
+	}
+	if dockerReq.RegistryCredentials == "" {
+		return
+	}
+	getCredentials := registryCredentialsFromContext(ctx)
+	if getCredentials == nil {
+		err = fmt.Errorf("Registry credentials aren't available")
+		return
+	}
+	if credentials, err = getCredentials(dockerReq.RegistryCredentials); err != nil {
+		return
+	}
+	if dockerReq.Registry == "" {
+		dockerReq.Registry = credentials.Registry
+	} else if dockerReq.Registry != credentials.Registry {
+		err = fmt.Errorf("Registry credentials %s are for %s and not %s", dockerReq.RegistryCredentials, credentials.Registry, dockerReq.Registry)
 		return
 	}
+	return
+}
 
-	// Extract required and optional parameters
-	image = input["image"].(string)
+// parseEnv parses the env object, eg. {"LOG_LEVEL": "debug", "RETRIES": 3}, into sorted KEY=VALUE pairs
+func parseEnv(input Input) (env []string, err error) {
+	var (
+		envObj map[string]interface{}
+	)
+	if envObj, err = input.GetObject("env"); err != nil || envObj == nil {
+		return
+	}
+	for key, val := range envObj {
+		if key == "" || strings.Contains(key, "=") {
+			err = fmt.Errorf("Invalid env variable name %q", key)
+			return
+		}
+		switch val.(type) {
+		case string, float64, bool:
+			env = append(env, key+"="+fmt.Sprint(val))
+		default:
+			err = fmt.Errorf("env: %s should be a string", key)
+			return
+		}
+	}
+	sort.Strings(env)
+	return
+}
+
+// parseMounts parses the mounts list, eg. [{"type": "volume", "source": "cache", "target": "/cache"},
+// {"type": "bind", "source": "/srv/data", "target": "/data", "read_only": true}]. Bind mounts are only
+// allowed for the host directories set by the admin.
+func (dockerAction DockerRegistryAction) parseMounts(input Input) (mounts []helpers.DockerMount, err error) {
+	rawMounts, isPresent := input["mounts"]
+	if !isPresent || rawMounts == nil {
+		return
+	}
+	mountList, isList := rawMounts.([]interface{})
+	if !isList {
+		err = fmt.Errorf("mounts should be a list of objects")
+		return
+	}
+	for idx, rawMount := range mountList {
+		var (
+			mountType string
+			dockerMnt helpers.DockerMount
+		)
+		mountObj, isObj := rawMount.(map[string]interface{})
+		if !isObj {
+			err = fmt.Errorf("mounts should be a list of objects")
+			return
+		}
+		mountInput := Input(mountObj)
+		if mountType, err = mountInput.GetString("type", false); err != nil {
+			return
+		}
+		if dockerMnt.Source, err = mountInput.GetString("source", false); err != nil {
+			return
+		}
+		if dockerMnt.Target, err = mountInput.GetString("target", true); err != nil {
+			err = fmt.Errorf("mounts[%d]: %w", idx, err)
+			return
+		}
+		if dockerMnt.ReadOnly, err = mountInput.GetBool("read_only", false); err != nil {
+			return
+		}
+		if !path.IsAbs(dockerMnt.Target) {
+			err = fmt.Errorf("mounts[%d]: target should be an absolute path", idx)
+			return
+		}
 
-	// Extract optional registry information if provided
-	if regVal, exists := input["registry"]; exists && regVal != nil {
-		registry = regVal.(string)
+		dockerMnt.Type = mount.Type(mountType)
+		switch dockerMnt.Type {
+		case "":
+			dockerMnt.Type = mount.TypeVolume
+			fallthrough
+		case mount.TypeVolume:
+			if dockerMnt.Source == "" {
+				err = fmt.Errorf("mounts[%d]: source is required for volume mounts", idx)
+				return
+			}
+		case mount.TypeBind:
+			if !isAllowedMountSource(dockerMnt.Source) {
+				err = fmt.Errorf("mounts[%d]: bind mounting %s isn't allowed", idx, dockerMnt.Source)
+				return
+			}
+		case mount.TypeTmpfs:
+			if dockerMnt.Source != "" {
+				err = fmt.Errorf("mounts[%d]: tmpfs mounts have no source", idx)
+				return
+			}
+		default:
+			err = fmt.Errorf("Unsupported mount type %s", mountType)
+			return
+		}
+		mounts = append(mounts, dockerMnt)
 	}
+	return
+}
 
-	if regUser, exists := input["registry_username"]; exists && regUser != nil {
-		username = regUser.(string)
+// isAllowedMountSource checks that the host path is within one of the
+// directories the admin allows bind mounting
+func isAllowedMountSource(source string) bool {
+	if !filepath.IsAbs(source) {
+		return false
+	}
+	source = filepath.Clean(source)
+	for _, allowed := range config.DockerAllowedMountSources {
+		rel, err := filepath.Rel(filepath.Clean(allowed), source)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
 	}
+	return false
+}
+
+func (dockerAction DockerRegistryAction) Execute(input Input) (output Output, err error) {
+	return dockerAction.ExecuteContext(context.Background(), input, nil)
+}
 
-	if regPass, exists := input["registry_password"]; exists && regPass != nil {
-		password = regPass.(string)
+// ExecuteContext runs the container until it exits or the job times out,
+// within the limits carried by the context. The output has the exit code,
+// stdout and stderr of the container.
+func (dockerAction DockerRegistryAction) ExecuteContext(ctx context.Context, input Input, getSecret SecretGetter) (output Output, err error) {
+	var (
+		dockerExecutor *helpers.DockerExecutor
+		dockerReq      *DockerActionReq
+		credentials    *RegistryCredentials
+		result         *helpers.DockerResult
+	)
+	if dockerReq, err = dockerAction.parse(input, dockerLimitsFromContext(ctx)); err != nil {
+		return
+	}
+	if credentials, err = dockerAction.registryCredentials(ctx, dockerReq); err != nil {
+		return
 	}
 
 	// Create Docker executor with all parameters
-	if dockerExecutor, err = helpers.NewDockerExecutor(image, registry, username, password); err != nil {
+	var username, password string
+	if credentials != nil {
+		username, password = credentials.Username, credentials.Password
+	}
+	if dockerExecutor, err = helpers.NewDockerExecutor(dockerReq.Image, dockerReq.Registry, username, password); err != nil {
 		return
 	}
+	dockerExecutor.Digest = dockerReq.Digest
+	dockerExecutor.PullPolicy = dockerReq.PullPolicy
+	dockerExecutor.Cmd = dockerReq.Cmd
+	dockerExecutor.Entrypoint = dockerReq.Entrypoint
+	dockerExecutor.Env = dockerReq.Env
+	dockerExecutor.WorkingDir = dockerReq.WorkingDir
+	dockerExecutor.Mounts = dockerReq.Mounts
+	dockerExecutor.Limits = dockerReq.Limits
+	dockerExecutor.MaxOutputBytes = config.MaxDockerOutputBytes
+	if _, hasDeadline := ctx.Deadline(); hasDeadline {
+		// The job's timeout applies
+		dockerExecutor.Timeout = 0
+	}
 
-	// Execute the Docker container
-	if _, err = dockerExecutor.Execute(); err != nil {
+	// Execute the Docker container, a container exiting with a non-zero code
+	// has a result so that its logs are recorded with the error
+	if result, err = dockerExecutor.Execute(ctx); result == nil {
 		return
 	}
 
-	// Prepare successful output
+	status := "success"
+	if err != nil {
+		status = "failed"
+	}
 	output = Output{
-		"status":   "success",
-		"image":    image,
-		"registry": registry,
+		"status":    status,
+		"image":     dockerReq.Image,
+		"registry":  dockerReq.Registry,
+		"digest":    result.ImageDigest,
+		"image_id":  result.ImageID,
+		"exit_code": result.ExitCode,
+		"stdout":    result.Stdout,
+		"stderr":    result.Stderr,
 	}
 
 	return
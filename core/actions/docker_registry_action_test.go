@@ -1,7 +1,15 @@
 package actions
 
 import (
+	"context"
+	"fmt"
+	"strings"
 	"testing"
+
+	"github.com/cronny/core/config"
+	"github.com/cronny/core/helpers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestDockerAction_RequiredKeys(t *testing.T) {
@@ -23,16 +31,28 @@ func TestDockerAction_OptionalKeys(t *testing.T) {
 	dockerAction := DockerRegistryAction{}
 	optionalKeys := dockerAction.OptionalKeys()
 
-	// Should have three optional keys
-	if len(optionalKeys) != 3 {
-		t.Errorf("Expected 3 optional keys, got %d", len(optionalKeys))
-	}
-
 	// Check each of the expected optional keys
 	expectedKeys := []ActionKey{
 		{"registry", StringActionKeyType},
+		{"registry_credentials", StringActionKeyType},
 		{"registry_username", StringActionKeyType},
 		{"registry_password", StringActionKeyType},
+		{"digest", StringActionKeyType},
+		{"pull_policy", StringActionKeyType},
+		{"command", ListActionKeyType},
+		{"entrypoint", ListActionKeyType},
+		{"env", ObjectActionKeyType},
+		{"workdir", StringActionKeyType},
+		{"mounts", ListActionKeyType},
+		{"cpus", FloatActionKeyType},
+		{"memory_mb", NumberActionKeyType},
+		{"pids", NumberActionKeyType},
+		{"disk_mb", NumberActionKeyType},
+		{"network", StringActionKeyType},
+		{"user", StringActionKeyType},
+	}
+	if len(optionalKeys) != len(expectedKeys) {
+		t.Errorf("Expected %d optional keys, got %d", len(expectedKeys), len(optionalKeys))
 	}
 
 	for i, key := range optionalKeys {
@@ -67,10 +87,11 @@ func TestDockerAction_Validate(t *testing.T) {
 		{
 			name: "valid with all fields",
 			input: Input{
-				"image":             "nginx",
-				"registry":          "registry.example.com",
-				"registry_username": "user",
-				"registry_password": "pass",
+				"image":                "nginx",
+				"registry":             "registry.example.com",
+				"registry_credentials": "REGISTRY",
+				"digest":               "sha256:" + strings.Repeat("a", 64),
+				"pull_policy":          "if-not-present",
 			},
 			wantErr: false,
 		},
@@ -81,6 +102,16 @@ func TestDockerAction_Validate(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "valid with deprecated credentials",
+			input: Input{
+				"image":             "nginx",
+				"registry":          "registry.example.com",
+				"registry_username": "user",
+				"registry_password": "pass",
+			},
+			wantErr: false,
+		},
 		{
 			name: "username without password",
 			input: Input{
@@ -99,6 +130,40 @@ func TestDockerAction_Validate(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "deprecated and stored credentials",
+			input: Input{
+				"image":                "nginx",
+				"registry_credentials": "REGISTRY",
+				"registry_username":    "user",
+				"registry_password":    "pass",
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid digest",
+			input: Input{
+				"image":  "nginx",
+				"digest": "latest",
+			},
+			wantErr: true,
+		},
+		{
+			name: "digest of a pinned image",
+			input: Input{
+				"image":  "nginx@sha256:" + strings.Repeat("a", 64),
+				"digest": "sha256:" + strings.Repeat("b", 64),
+			},
+			wantErr: true,
+		},
+		{
+			name: "unsupported pull policy",
+			input: Input{
+				"image":       "nginx",
+				"pull_policy": "sometimes",
+			},
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -112,3 +177,174 @@ func TestDockerAction_Validate(t *testing.T) {
 		})
 	}
 }
+
+func TestDockerAction_Parse(t *testing.T) {
+	prevSources := config.DockerAllowedMountSources
+	config.DockerAllowedMountSources = []string{"/srv/cronny"}
+	defer func() { config.DockerAllowedMountSources = prevSources }()
+
+	dockerReq, err := DockerRegistryAction{}.parse(Input{
+		"image":      "alpine",
+		"command":    "echo $GREETING > /out/greeting",
+		"entrypoint": "/entrypoint.sh",
+		"env":        map[string]interface{}{"GREETING": "hello", "RETRIES": float64(3)},
+		"workdir":    "/app",
+		"mounts": []interface{}{
+			map[string]interface{}{"source": "cache", "target": "/cache"},
+			map[string]interface{}{"type": "bind", "source": "/srv/cronny/reports", "target": "/out", "read_only": true},
+			map[string]interface{}{"type": "tmpfs", "target": "/tmp"},
+		},
+	}, AdminDockerLimits())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/bin/sh", "-c", "echo $GREETING > /out/greeting"}, dockerReq.Cmd)
+	assert.Equal(t, []string{"/entrypoint.sh"}, dockerReq.Entrypoint)
+	assert.Equal(t, []string{"GREETING=hello", "RETRIES=3"}, dockerReq.Env)
+	assert.Equal(t, "/app", dockerReq.WorkingDir)
+	require.Len(t, dockerReq.Mounts, 3)
+	assert.Equal(t, "volume", string(dockerReq.Mounts[0].Type))
+	assert.True(t, dockerReq.Mounts[1].ReadOnly)
+
+	dockerReq, err = DockerRegistryAction{}.parse(Input{"image": "alpine", "command": []interface{}{"ls", "-l"}}, AdminDockerLimits())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"ls", "-l"}, dockerReq.Cmd)
+}
+
+func TestDockerAction_Parse_InvalidInput(t *testing.T) {
+	prevSources := config.DockerAllowedMountSources
+	config.DockerAllowedMountSources = []string{"/srv/cronny"}
+	defer func() { config.DockerAllowedMountSources = prevSources }()
+
+	testCases := []struct {
+		name  string
+		input Input
+	}{
+		{name: "Invalid command", input: Input{"image": "alpine", "command": []interface{}{map[string]interface{}{}}}},
+		{name: "Invalid env name", input: Input{"image": "alpine", "env": map[string]interface{}{"A=B": "c"}}},
+		{name: "Nested env value", input: Input{"image": "alpine", "env": map[string]interface{}{"A": []interface{}{}}}},
+		{name: "Relative workdir", input: Input{"image": "alpine", "workdir": "app"}},
+		{name: "Relative mount target", input: Input{"image": "alpine", "mounts": []interface{}{map[string]interface{}{"source": "cache", "target": "cache"}}}},
+		{name: "Volume without source", input: Input{"image": "alpine", "mounts": []interface{}{map[string]interface{}{"target": "/cache"}}}},
+		{name: "Bind mount outside the allowed sources", input: Input{"image": "alpine", "mounts": []interface{}{
+			map[string]interface{}{"type": "bind", "source": "/var/run/docker.sock", "target": "/sock"}}}},
+		{name: "Bind mount escaping the allowed sources", input: Input{"image": "alpine", "mounts": []interface{}{
+			map[string]interface{}{"type": "bind", "source": "/srv/cronny/../../etc", "target": "/etc2"}}}},
+		{name: "Unsupported mount type", input: Input{"image": "alpine", "mounts": []interface{}{
+			map[string]interface{}{"type": "npipe", "source": "x", "target": "/x"}}}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Error(t, DockerRegistryAction{}.Validate(tc.input))
+		})
+	}
+}
+
+func TestDockerAction_ParseLimits(t *testing.T) {
+	maxLimits := helpers.DockerLimits{Cpus: 1, MemoryMB: 512, Pids: 256, NetworkMode: "none", User: "65534:65534", ReadOnlyRootfs: true}
+
+	// The limits which aren't requested are the max limits
+	limits, err := DockerRegistryAction{}.parseLimits(Input{"image": "alpine"}, maxLimits)
+	require.NoError(t, err)
+	assert.Equal(t, maxLimits, limits)
+
+	limits, err = DockerRegistryAction{}.parseLimits(Input{
+		"cpus":      0.25,
+		"memory_mb": float64(64),
+		"disk_mb":   float64(100),
+		"network":   "bridge",
+		"user":      "1000",
+	}, maxLimits)
+	require.NoError(t, err)
+	assert.Equal(t, helpers.DockerLimits{Cpus: 0.25, MemoryMB: 64, Pids: 256, DiskMB: 100,
+		NetworkMode: "bridge", User: "1000", ReadOnlyRootfs: true}, limits)
+}
+
+func TestDockerAction_ParseLimits_InvalidInput(t *testing.T) {
+	maxLimits := helpers.DockerLimits{Cpus: 1, MemoryMB: 512, Pids: 256, NetworkMode: "none"}
+	prevNetworks := config.DockerAllowedNetworks
+	config.DockerAllowedNetworks = []string{"none", "bridge"}
+	defer func() { config.DockerAllowedNetworks = prevNetworks }()
+
+	testCases := []struct {
+		name  string
+		input Input
+	}{
+		{name: "More cpus than allowed", input: Input{"cpus": float64(2)}},
+		{name: "More memory than allowed", input: Input{"memory_mb": float64(1024)}},
+		{name: "More pids than allowed", input: Input{"pids": float64(1000)}},
+		{name: "Negative limit", input: Input{"memory_mb": float64(-1)}},
+		{name: "Fractional memory", input: Input{"memory_mb": 1.5}},
+		{name: "Disallowed network", input: Input{"network": "host"}},
+		{name: "Root user", input: Input{"user": "root"}},
+		{name: "Root uid", input: Input{"user": "0:0"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := DockerRegistryAction{}.parseLimits(tc.input, maxLimits)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestDockerLimitsFromContext(t *testing.T) {
+	assert.Equal(t, AdminDockerLimits(), dockerLimitsFromContext(context.Background()))
+
+	planLimits := helpers.DockerLimits{Cpus: 0.5, MemoryMB: 256}
+	assert.Equal(t, planLimits, dockerLimitsFromContext(ContextWithDockerLimits(context.Background(), planLimits)))
+}
+
+func TestDockerAction_Parse_PullPolicy(t *testing.T) {
+	digest := "sha256:" + strings.Repeat("a", 64)
+	testCases := []struct {
+		name       string
+		input      Input
+		wantPolicy helpers.DockerPullPolicy
+	}{
+		{name: "Tags are pulled on every run", input: Input{"image": "nginx:latest"}, wantPolicy: helpers.PullAlways},
+		{name: "Pinned images are pulled once", input: Input{"image": "nginx", "digest": digest}, wantPolicy: helpers.PullIfNotPresent},
+		{name: "Images with a digest are pulled once", input: Input{"image": "nginx@" + digest}, wantPolicy: helpers.PullIfNotPresent},
+		{name: "Explicit policy", input: Input{"image": "nginx", "digest": digest, "pull_policy": "never"}, wantPolicy: helpers.PullNever},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dockerReq, err := DockerRegistryAction{}.parse(tc.input, AdminDockerLimits())
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantPolicy, dockerReq.PullPolicy)
+		})
+	}
+}
+
+func TestDockerAction_RegistryCredentials(t *testing.T) {
+	getCredentials := RegistryCredentialsGetter(func(name string) (*RegistryCredentials, error) {
+		if name != "GHCR" {
+			return nil, fmt.Errorf("failed to get registry credential %s", name)
+		}
+		return &RegistryCredentials{Registry: "ghcr.io", Username: "cronny", Password: "s3cr3t"}, nil
+	})
+	ctx := ContextWithRegistryCredentials(context.Background(), getCredentials)
+
+	// The registry defaults to the one of the credentials
+	dockerReq := &DockerActionReq{Image: "cronny/app", RegistryCredentials: "GHCR"}
+	credentials, err := DockerRegistryAction{}.registryCredentials(ctx, dockerReq)
+	require.NoError(t, err)
+	assert.Equal(t, "s3cr3t", credentials.Password)
+	assert.Equal(t, "ghcr.io", dockerReq.Registry)
+
+	// No credentials are needed for public images
+	credentials, err = DockerRegistryAction{}.registryCredentials(context.Background(), &DockerActionReq{Image: "alpine"})
+	require.NoError(t, err)
+	assert.Nil(t, credentials)
+
+	_, err = DockerRegistryAction{}.registryCredentials(ctx, &DockerActionReq{Image: "app", Registry: "evil.example.com", RegistryCredentials: "GHCR"})
+	assert.ErrorContains(t, err, "are for ghcr.io", "The credentials shouldn't be sent to another registry")
+
+	_, err = DockerRegistryAction{}.registryCredentials(ctx, &DockerActionReq{Image: "app", RegistryCredentials: "MISSING"})
+	assert.Error(t, err)
+
+	_, err = DockerRegistryAction{}.registryCredentials(context.Background(), &DockerActionReq{Image: "app", RegistryCredentials: "GHCR"})
+	assert.Error(t, err)
+
+	// The deprecated plaintext credentials are used as they are
+	credentials, err = DockerRegistryAction{}.registryCredentials(context.Background(), &DockerActionReq{Image: "app", Registry: "registry.example.com", RegistryUsername: "user", RegistryPassword: "pass"})
+	require.NoError(t, err)
+	assert.Equal(t, &RegistryCredentials{Registry: "registry.example.com", Username: "user", Password: "pass"}, credentials)
+}
@@ -0,0 +1,664 @@
+package actions
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	htmltemplate "html/template"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"path/filepath"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/cronny/core/config"
+)
+
+const (
+	StartTlsSmtpTls = "starttls"
+	ImplicitSmtpTls = "tls"
+	NoSmtpTls       = "none"
+)
+
+var (
+	// smtpRootCAs verifies the certificates of SMTP servers, the host's
+	// root CAs are used when it's nil
+	smtpRootCAs *x509.CertPool
+)
+
+type (
+	// SmtpServer is the server an email is sent through
+	SmtpServer struct {
+		Host     string
+		Port     int
+		Username string
+		// PasswordSecret is the name of the user's secret with the password,
+		// Password is set once it's resolved
+		PasswordSecret string
+		Password       string
+		Tls            string
+	}
+
+	EmailAttachment struct {
+		Filename    string
+		ContentType string
+		Content     []byte
+	}
+
+	EmailActionReq struct {
+		Smtp    *SmtpServer
+		From    *mail.Address
+		ReplyTo *mail.Address
+		To      []*mail.Address
+		Cc      []*mail.Address
+		Bcc     []*mail.Address
+
+		Subject     string
+		Text        string
+		Html        string
+		Attachments []*EmailAttachment
+	}
+
+	// EmailAction sends mail through the admin's SMTP server, or the job's
+	EmailAction struct{}
+)
+
+func (emailAction EmailAction) RequiredKeys() (keys []ActionKey) {
+	keys = []ActionKey{
+		{"to", ListActionKeyType},
+		{"subject", StringActionKeyType},
+	}
+	return
+}
+
+func (emailAction EmailAction) OptionalKeys() (keys []ActionKey) {
+	keys = []ActionKey{
+		{"cc", ListActionKeyType},
+		{"bcc", ListActionKeyType},
+		{"reply_to", StringActionKeyType},
+		{"text", StringActionKeyType},
+		{"html", StringActionKeyType},
+		{"data", ObjectActionKeyType},
+		{"attachments", ListActionKeyType},
+		{"smtp", ObjectActionKeyType},
+		{"from", StringActionKeyType},
+	}
+	return
+}
+
+func (emailAction EmailAction) Validate(input Input) (err error) {
+	_, err = emailAction.parse(input)
+	return
+}
+
+func (emailAction EmailAction) parse(input Input) (emailReq *EmailActionReq, err error) {
+	var (
+		from    string
+		replyTo string
+	)
+	emailReq = &EmailActionReq{}
+	if emailReq.Smtp, err = emailAction.parseSmtp(input); err != nil {
+		return
+	}
+
+	// Only the job's own server can send mail from any address
+	if from, err = input.GetString("from", false); err != nil {
+		return
+	}
+	if from != "" && input["smtp"] == nil {
+		err = fmt.Errorf("from can only be set along with smtp")
+		return
+	}
+	if from == "" && input["smtp"] != nil {
+		err = fmt.Errorf("from is required along with smtp")
+		return
+	}
+	if from == "" {
+		from = config.SmtpFrom
+	}
+	if emailReq.From, err = mail.ParseAddress(from); err != nil {
+		err = fmt.Errorf("Invalid from address %s: %w", from, err)
+		return
+	}
+	if replyTo, err = input.GetString("reply_to", false); err != nil {
+		return
+	}
+	if replyTo != "" {
+		if emailReq.ReplyTo, err = mail.ParseAddress(replyTo); err != nil {
+			err = fmt.Errorf("Invalid reply_to address %s: %w", replyTo, err)
+			return
+		}
+	}
+
+	if emailReq.To, err = parseAddresses(input, "to"); err != nil {
+		return
+	}
+	if len(emailReq.To) == 0 {
+		err = fmt.Errorf("missing required field: to")
+		return
+	}
+	if emailReq.Cc, err = parseAddresses(input, "cc"); err != nil {
+		return
+	}
+	if emailReq.Bcc, err = parseAddresses(input, "bcc"); err != nil {
+		return
+	}
+
+	if err = emailAction.parseContent(input, emailReq); err != nil {
+		return
+	}
+	if emailReq.Attachments, err = emailAction.parseAttachments(input); err != nil {
+		return
+	}
+	return
+}
+
+// parseSmtp parses the job's server, eg. {"host": "smtp.example.com", "port": 465, "tls": "tls",
+// "username": "...", "password_secret": "NAME"}. The admin's server is used when it's not set.
+func (emailAction EmailAction) parseSmtp(input Input) (smtpServer *SmtpServer, err error) {
+	var (
+		smtpObj map[string]interface{}
+		port    float64
+	)
+	if smtpObj, err = input.GetObject("smtp"); err != nil {
+		return
+	}
+	if smtpObj == nil {
+		if config.SmtpHost == "" {
+			err = fmt.Errorf("SMTP isn't configured, smtp is required")
+			return
+		}
+		smtpServer = &SmtpServer{
+			Host:     config.SmtpHost,
+			Port:     int(config.SmtpPort),
+			Username: config.SmtpUsername,
+			Password: config.SmtpPassword,
+			Tls:      config.SmtpTls,
+		}
+		return
+	}
+
+	smtpInput := Input(smtpObj)
+	smtpServer = &SmtpServer{}
+	if smtpServer.Host, err = smtpInput.GetString("host", true); err != nil {
+		err = fmt.Errorf("smtp: %w", err)
+		return
+	}
+	if port, err = smtpInput.GetNumber("port"); err != nil {
+		return
+	}
+	if port == 0 {
+		port = 587
+	}
+	if port != float64(int(port)) || port < 1 || port > 65535 {
+		err = fmt.Errorf("smtp: port should be between 1 and 65535")
+		return
+	}
+	smtpServer.Port = int(port)
+	if smtpServer.Username, err = smtpInput.GetString("username", false); err != nil {
+		return
+	}
+	if smtpServer.PasswordSecret, err = smtpInput.GetString("password_secret", false); err != nil {
+		return
+	}
+	if smtpServer.Username != "" && smtpServer.PasswordSecret == "" {
+		err = fmt.Errorf("smtp: password_secret is required along with username")
+		return
+	}
+	if smtpServer.Tls, err = smtpInput.GetString("tls", false); err != nil {
+		return
+	}
+	switch smtpServer.Tls {
+	case "":
+		smtpServer.Tls = StartTlsSmtpTls
+	case StartTlsSmtpTls, ImplicitSmtpTls, NoSmtpTls:
+	default:
+		err = fmt.Errorf("smtp: Unsupported tls %s", smtpServer.Tls)
+		return
+	}
+	return
+}
+
+// parseAddresses parses a list of addresses or a comma separated string
+func parseAddresses(input Input, key string) (addresses []*mail.Address, err error) {
+	var (
+		rawAddresses []string
+	)
+	if addressList, isString := input[key].(string); isString {
+		rawAddresses = []string{addressList}
+	} else if rawAddresses, err = input.GetStringList(key); err != nil {
+		return
+	}
+	for _, rawAddress := range rawAddresses {
+		var parsed []*mail.Address
+		if parsed, err = mail.ParseAddressList(rawAddress); err != nil {
+			err = fmt.Errorf("Invalid %s address %s: %w", key, rawAddress, err)
+			return
+		}
+		addresses = append(addresses, parsed...)
+	}
+	return
+}
+
+// parseContent renders the subject, the text and the HTML of the email,
+// which are templates of the data, eg. {"subject": "{{ .failed }} jobs failed", "data": {"failed": 2}}.
+// The data is escaped in the HTML.
+func (emailAction EmailAction) parseContent(input Input, emailReq *EmailActionReq) (err error) {
+	var (
+		data    map[string]interface{}
+		subject string
+		text    string
+		html    string
+	)
+	if data, err = input.GetObject("data"); err != nil {
+		return
+	}
+	if subject, err = input.GetString("subject", true); err != nil {
+		return
+	}
+	if text, err = input.GetString("text", false); err != nil {
+		return
+	}
+	if html, err = input.GetString("html", false); err != nil {
+		return
+	}
+	if text == "" && html == "" {
+		err = fmt.Errorf("Either text or html should be provided")
+		return
+	}
+
+	if emailReq.Subject, err = renderTextTemplate("subject", subject, data); err != nil {
+		return
+	}
+	if emailReq.Text, err = renderTextTemplate("text", text, data); err != nil {
+		return
+	}
+	if html == "" {
+		return
+	}
+	var htmlTmpl *htmltemplate.Template
+	if htmlTmpl, err = htmltemplate.New("html").Option("missingkey=error").Parse(html); err != nil {
+		err = fmt.Errorf("Invalid html template: %w", err)
+		return
+	}
+	htmlBuf := &bytes.Buffer{}
+	if err = htmlTmpl.Execute(htmlBuf, data); err != nil {
+		err = fmt.Errorf("Failed to render html: %w", err)
+		return
+	}
+	emailReq.Html = htmlBuf.String()
+	return
+}
+
+func renderTextTemplate(name, text string, data map[string]interface{}) (rendered string, err error) {
+	var (
+		tmpl *texttemplate.Template
+	)
+	if tmpl, err = texttemplate.New(name).Option("missingkey=error").Parse(text); err != nil {
+		err = fmt.Errorf("Invalid %s template: %w", name, err)
+		return
+	}
+	buf := &bytes.Buffer{}
+	if err = tmpl.Execute(buf, data); err != nil {
+		err = fmt.Errorf("Failed to render %s: %w", name, err)
+		return
+	}
+	rendered = buf.String()
+	return
+}
+
+// parseAttachments parses the attachments list, eg. [{"filename": "report.csv", "content": "..."}].
+// Content which isn't a string, like the output of a previous job, is attached as JSON and binary
+// content can be base64 encoded along with "encoding": "base64".
+func (emailAction EmailAction) parseAttachments(input Input) (attachments []*EmailAttachment, err error) {
+	var (
+		totalBytes int
+	)
+	rawAttachments, isPresent := input["attachments"]
+	if !isPresent || rawAttachments == nil {
+		return
+	}
+	attachmentList, isList := rawAttachments.([]interface{})
+	if !isList {
+		err = fmt.Errorf("attachments should be a list of objects")
+		return
+	}
+	for idx, rawAttachment := range attachmentList {
+		var (
+			encoding   string
+			attachment = &EmailAttachment{}
+		)
+		attachmentObj, isObj := rawAttachment.(map[string]interface{})
+		if !isObj {
+			err = fmt.Errorf("attachments should be a list of objects")
+			return
+		}
+		attachmentInput := Input(attachmentObj)
+		if attachment.Filename, err = attachmentInput.GetString("filename", true); err != nil {
+			err = fmt.Errorf("attachments[%d]: %w", idx, err)
+			return
+		}
+		if attachment.ContentType, err = attachmentInput.GetString("content_type", false); err != nil {
+			return
+		}
+		if encoding, err = attachmentInput.GetString("encoding", false); err != nil {
+			return
+		}
+		switch content := attachmentObj["content"].(type) {
+		case nil:
+		case string:
+			attachment.Content = []byte(content)
+		default:
+			if attachment.Content, err = json.MarshalIndent(content, "", "  "); err != nil {
+				return
+			}
+			if attachment.ContentType == "" {
+				attachment.ContentType = "application/json"
+			}
+		}
+		switch encoding {
+		case "":
+		case "base64":
+			if attachment.Content, err = base64.StdEncoding.DecodeString(string(attachment.Content)); err != nil {
+				err = fmt.Errorf("attachments[%d]: Invalid base64 content: %w", idx, err)
+				return
+			}
+		default:
+			err = fmt.Errorf("attachments[%d]: Unsupported encoding %s", idx, encoding)
+			return
+		}
+		if attachment.ContentType == "" {
+			attachment.ContentType = mime.TypeByExtension(filepath.Ext(attachment.Filename))
+		}
+		if attachment.ContentType == "" {
+			attachment.ContentType = "application/octet-stream"
+		}
+		if totalBytes += len(attachment.Content); totalBytes > config.MaxEmailAttachmentsBytes {
+			err = fmt.Errorf("Attachments can't be more than %d bytes", config.MaxEmailAttachmentsBytes)
+			return
+		}
+		attachments = append(attachments, attachment)
+	}
+	return
+}
+
+// recipients returns the addresses of the recipients, including Bcc
+func (emailReq *EmailActionReq) recipients() (recipients []string) {
+	for _, addresses := range [][]*mail.Address{emailReq.To, emailReq.Cc, emailReq.Bcc} {
+		for _, address := range addresses {
+			recipients = append(recipients, address.Address)
+		}
+	}
+	return
+}
+
+// Message returns the MIME message of the email, its text and HTML are
+// alternatives followed by the attachments
+func (emailReq *EmailActionReq) Message(messageID string, date time.Time) (msg []byte, err error) {
+	var (
+		contentHeader textproto.MIMEHeader
+		content       []byte
+	)
+	if contentHeader, content, err = emailReq.contentPart(); err != nil {
+		return
+	}
+	if len(emailReq.Attachments) > 0 {
+		if contentHeader, content, err = emailReq.withAttachments(contentHeader, content); err != nil {
+			return
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	writeHeader := func(key, val string) {
+		buf.WriteString(key + ": " + val + "\r\n")
+	}
+	writeHeader("From", emailReq.From.String())
+	writeHeader("To", joinAddresses(emailReq.To))
+	if len(emailReq.Cc) > 0 {
+		writeHeader("Cc", joinAddresses(emailReq.Cc))
+	}
+	if emailReq.ReplyTo != nil {
+		writeHeader("Reply-To", emailReq.ReplyTo.String())
+	}
+	writeHeader("Subject", mime.QEncoding.Encode("utf-8", emailReq.Subject))
+	writeHeader("Date", date.Format(time.RFC1123Z))
+	writeHeader("Message-ID", messageID)
+	writeHeader("MIME-Version", "1.0")
+	for _, key := range []string{"Content-Type", "Content-Transfer-Encoding"} {
+		if val := contentHeader.Get(key); val != "" {
+			writeHeader(key, val)
+		}
+	}
+	buf.WriteString("\r\n")
+	buf.Write(content)
+	msg = buf.Bytes()
+	return
+}
+
+func joinAddresses(addresses []*mail.Address) string {
+	formatted := make([]string, 0, len(addresses))
+	for _, address := range addresses {
+		formatted = append(formatted, address.String())
+	}
+	return strings.Join(formatted, ", ")
+}
+
+// contentPart returns the text and the HTML, as alternatives when both are set
+func (emailReq *EmailActionReq) contentPart() (header textproto.MIMEHeader, content []byte, err error) {
+	var parts []textproto.MIMEHeader
+	var contents [][]byte
+	for _, body := range []struct {
+		contentType string
+		content     string
+	}{
+		{"text/plain; charset=utf-8", emailReq.Text},
+		{"text/html; charset=utf-8", emailReq.Html},
+	} {
+		if body.content == "" {
+			continue
+		}
+		buf := &bytes.Buffer{}
+		qpWriter := quotedprintable.NewWriter(buf)
+		if _, err = qpWriter.Write([]byte(body.content)); err != nil {
+			return
+		}
+		if err = qpWriter.Close(); err != nil {
+			return
+		}
+		parts = append(parts, textproto.MIMEHeader{
+			"Content-Type":              {body.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		contents = append(contents, buf.Bytes())
+	}
+	if len(parts) == 1 {
+		header, content = parts[0], contents[0]
+		return
+	}
+	return writeMultipart("multipart/alternative", parts, contents)
+}
+
+// withAttachments returns the content followed by the attachments
+func (emailReq *EmailActionReq) withAttachments(contentHeader textproto.MIMEHeader, content []byte) (header textproto.MIMEHeader, mixed []byte, err error) {
+	parts := []textproto.MIMEHeader{contentHeader}
+	contents := [][]byte{content}
+	for _, attachment := range emailReq.Attachments {
+		parts = append(parts, textproto.MIMEHeader{
+			"Content-Type":              {mime.FormatMediaType(attachment.ContentType, map[string]string{"name": attachment.Filename})},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Filename})},
+			"Content-Transfer-Encoding": {"base64"},
+		})
+		contents = append(contents, base64Lines(attachment.Content))
+	}
+	return writeMultipart("multipart/mixed", parts, contents)
+}
+
+func writeMultipart(contentType string, parts []textproto.MIMEHeader, contents [][]byte) (header textproto.MIMEHeader, content []byte, err error) {
+	buf := &bytes.Buffer{}
+	multipartWriter := multipart.NewWriter(buf)
+	for idx, part := range parts {
+		var partWriter interface{ Write([]byte) (int, error) }
+		if partWriter, err = multipartWriter.CreatePart(part); err != nil {
+			return
+		}
+		if _, err = partWriter.Write(contents[idx]); err != nil {
+			return
+		}
+	}
+	if err = multipartWriter.Close(); err != nil {
+		return
+	}
+	header = textproto.MIMEHeader{
+		"Content-Type": {mime.FormatMediaType(contentType, map[string]string{"boundary": multipartWriter.Boundary()})},
+	}
+	content = buf.Bytes()
+	return
+}
+
+// base64Lines encodes the content in lines of 76 characters as MIME requires
+func base64Lines(content []byte) []byte {
+	encoded := base64.StdEncoding.EncodeToString(content)
+	buf := &bytes.Buffer{}
+	for len(encoded) > 76 {
+		buf.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	buf.WriteString(encoded)
+	return buf.Bytes()
+}
+
+func newMessageID(from *mail.Address) string {
+	randomB := make([]byte, 16)
+	rand.Read(randomB)
+	domain := "localhost"
+	if at := strings.LastIndex(from.Address, "@"); at >= 0 {
+		domain = from.Address[at+1:]
+	}
+	return "<" + hex.EncodeToString(randomB) + "@" + domain + ">"
+}
+
+// send delivers the message through the server. Authenticating requires
+// the connection to be encrypted unless the server is on the local host.
+func (smtpServer *SmtpServer) send(ctx context.Context, from string, recipients []string, msg []byte) (err error) {
+	var (
+		conn       net.Conn
+		client     *smtp.Client
+		dataWriter interface {
+			Write([]byte) (int, error)
+			Close() error
+		}
+	)
+	addr := net.JoinHostPort(smtpServer.Host, strconv.Itoa(smtpServer.Port))
+	dialer := &net.Dialer{}
+	if conn, err = dialer.DialContext(ctx, "tcp", addr); err != nil {
+		err = fmt.Errorf("Failed to connect to %s: %w", addr, err)
+		return
+	}
+	if deadline, hasDeadline := ctx.Deadline(); hasDeadline {
+		conn.SetDeadline(deadline)
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	tlsConfig := &tls.Config{ServerName: smtpServer.Host, RootCAs: smtpRootCAs}
+	if smtpServer.Tls == ImplicitSmtpTls {
+		conn = tls.Client(conn, tlsConfig)
+	}
+	if client, err = smtp.NewClient(conn, smtpServer.Host); err != nil {
+		conn.Close()
+		err = fmt.Errorf("Failed to connect to %s: %w", addr, err)
+		return
+	}
+	defer client.Close()
+	if smtpServer.Tls == StartTlsSmtpTls {
+		if hasStartTls, _ := client.Extension("STARTTLS"); !hasStartTls {
+			err = fmt.Errorf("%s doesn't support STARTTLS", addr)
+			return
+		}
+		if err = client.StartTLS(tlsConfig); err != nil {
+			err = fmt.Errorf("Failed to start TLS with %s: %w", addr, err)
+			return
+		}
+	}
+	if smtpServer.Username != "" {
+		if err = client.Auth(smtp.PlainAuth("", smtpServer.Username, smtpServer.Password, smtpServer.Host)); err != nil {
+			err = fmt.Errorf("Failed to authenticate with %s: %w", addr, err)
+			return
+		}
+	}
+
+	if err = client.Mail(from); err != nil {
+		return
+	}
+	for _, recipient := range recipients {
+		if err = client.Rcpt(recipient); err != nil {
+			err = fmt.Errorf("Recipient %s was rejected: %w", recipient, err)
+			return
+		}
+	}
+	if dataWriter, err = client.Data(); err != nil {
+		return
+	}
+	if _, err = dataWriter.Write(msg); err != nil {
+		return
+	}
+	if err = dataWriter.Close(); err != nil {
+		return
+	}
+	return client.Quit()
+}
+
+func (emailAction EmailAction) Execute(input Input) (output Output, err error) {
+	return emailAction.ExecuteContext(context.Background(), input, nil)
+}
+
+// ExecuteContext sends the email. The password of the job's server is read
+// from the user's secrets.
+func (emailAction EmailAction) ExecuteContext(ctx context.Context, input Input, getSecret SecretGetter) (output Output, err error) {
+	var (
+		emailReq *EmailActionReq
+		msg      []byte
+	)
+	if emailReq, err = emailAction.parse(input); err != nil {
+		return
+	}
+	if emailReq.Smtp.PasswordSecret != "" {
+		if getSecret == nil {
+			err = fmt.Errorf("Secret %s can't be resolved outside of a job", emailReq.Smtp.PasswordSecret)
+			return
+		}
+		if emailReq.Smtp.Password, err = getSecret(emailReq.Smtp.PasswordSecret); err != nil {
+			return
+		}
+	}
+
+	messageID := newMessageID(emailReq.From)
+	if msg, err = emailReq.Message(messageID, time.Now()); err != nil {
+		return
+	}
+	recipients := emailReq.recipients()
+	if err = emailReq.Smtp.send(ctx, emailReq.From.Address, recipients, msg); err != nil {
+		err = fmt.Errorf("Failed to send email: %w", err)
+		return
+	}
+
+	output = Output{
+		"sent":       true,
+		"message_id": messageID,
+		"recipients": len(recipients),
+	}
+	return
+}
@@ -0,0 +1,425 @@
+package actions
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"io"
+	"math/big"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cronny/core/config"
+)
+
+type testSmtpMessage struct {
+	from       string
+	recipients []string
+	data       string
+	username   string
+	password   string
+	tls        bool
+}
+
+// testSmtpServer accepts the mail sent to it on the local host. It offers
+// STARTTLS unless it's started with implicit TLS, and AUTH PLAIN.
+type testSmtpServer struct {
+	addr        string
+	tlsConfig   *tls.Config
+	implicitTls bool
+
+	mu       sync.Mutex
+	messages []*testSmtpMessage
+}
+
+// newTestSmtpServer starts the server with a self-signed certificate, which
+// is trusted for the duration of the test
+func newTestSmtpServer(t *testing.T, implicitTls bool) *testSmtpServer {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	certDer, err := x509.CreateCertificate(rand.Reader, template, template, &privateKey.PublicKey, privateKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(certDer)
+	require.NoError(t, err)
+
+	prevRootCAs := smtpRootCAs
+	smtpRootCAs = x509.NewCertPool()
+	smtpRootCAs.AddCert(cert)
+	t.Cleanup(func() { smtpRootCAs = prevRootCAs })
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := &testSmtpServer{
+		addr: listener.Addr().String(),
+		tlsConfig: &tls.Config{Certificates: []tls.Certificate{{
+			Certificate: [][]byte{certDer},
+			PrivateKey:  privateKey,
+		}}},
+		implicitTls: implicitTls,
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serveConn(conn)
+		}
+	}()
+	t.Cleanup(func() { listener.Close() })
+	return server
+}
+
+func (server *testSmtpServer) serveConn(conn net.Conn) {
+	msg := &testSmtpMessage{}
+	if server.implicitTls {
+		conn = tls.Server(conn, server.tlsConfig)
+		msg.tls = true
+	}
+	defer func() { conn.Close() }()
+	textConn := textproto.NewConn(conn)
+	textConn.PrintfLine("220 127.0.0.1 ESMTP")
+	for {
+		line, err := textConn.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			textConn.PrintfLine("250-127.0.0.1")
+			if !msg.tls {
+				textConn.PrintfLine("250-STARTTLS")
+			}
+			textConn.PrintfLine("250 AUTH PLAIN")
+		case "STARTTLS":
+			textConn.PrintfLine("220 Ready to start TLS")
+			conn = tls.Server(conn, server.tlsConfig)
+			textConn = textproto.NewConn(conn)
+			msg.tls = true
+		case "AUTH":
+			_, initialResponse, _ := strings.Cut(arg, " ")
+			credentials, _ := base64.StdEncoding.DecodeString(initialResponse)
+			parts := strings.Split(string(credentials), "\x00")
+			if len(parts) != 3 || parts[2] != "hunter2" {
+				textConn.PrintfLine("535 Authentication failed")
+				continue
+			}
+			msg.username, msg.password = parts[1], parts[2]
+			textConn.PrintfLine("235 Authenticated")
+		case "MAIL":
+			msg.from = strings.Trim(strings.TrimPrefix(arg, "FROM:"), "<>")
+			textConn.PrintfLine("250 OK")
+		case "RCPT":
+			recipient := strings.Trim(strings.TrimPrefix(arg, "TO:"), "<>")
+			if strings.HasPrefix(recipient, "rejected@") {
+				textConn.PrintfLine("550 No such user")
+				continue
+			}
+			msg.recipients = append(msg.recipients, recipient)
+			textConn.PrintfLine("250 OK")
+		case "DATA":
+			textConn.PrintfLine("354 Go ahead")
+			data, err := textConn.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			msg.data = string(data)
+			server.mu.Lock()
+			server.messages = append(server.messages, msg)
+			server.mu.Unlock()
+			textConn.PrintfLine("250 Queued")
+		case "QUIT":
+			textConn.PrintfLine("221 Bye")
+			return
+		default:
+			textConn.PrintfLine("250 OK")
+		}
+	}
+}
+
+func (server *testSmtpServer) sent() []*testSmtpMessage {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	return server.messages
+}
+
+func (server *testSmtpServer) smtpInput(tls string) map[string]interface{} {
+	host, port, _ := net.SplitHostPort(server.addr)
+	portNum, _ := strconv.Atoi(port)
+	return map[string]interface{}{
+		"host":            host,
+		"port":            float64(portNum),
+		"username":        "cronny",
+		"password_secret": "SMTP_PASSWORD",
+		"tls":             tls,
+	}
+}
+
+// readTestMessage returns the headers of the message and its parts by content type
+func readTestMessage(t *testing.T, data string) (header mail.Header, parts map[string]string) {
+	msg, err := mail.ReadMessage(strings.NewReader(data))
+	require.NoError(t, err)
+	header = msg.Header
+	parts = map[string]string{}
+
+	var readParts func(contentType string, body io.Reader, encoding string)
+	readParts = func(contentType string, body io.Reader, encoding string) {
+		mediaType, params, err := mime.ParseMediaType(contentType)
+		require.NoError(t, err)
+		if !strings.HasPrefix(mediaType, "multipart/") {
+			content, err := io.ReadAll(body)
+			require.NoError(t, err)
+			if encoding == "base64" {
+				content, err = base64.StdEncoding.DecodeString(strings.ReplaceAll(string(content), "\r\n", ""))
+				require.NoError(t, err)
+			}
+			parts[mediaType] = string(content)
+			return
+		}
+		reader := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				return
+			}
+			require.NoError(t, err)
+			readParts(part.Header.Get("Content-Type"), part, part.Header.Get("Content-Transfer-Encoding"))
+		}
+	}
+	readParts(header.Get("Content-Type"), bufio.NewReader(msg.Body), header.Get("Content-Transfer-Encoding"))
+	// DATA ends the body of single part messages with a line break
+	for contentType, content := range parts {
+		parts[contentType] = strings.TrimSuffix(content, "\n")
+	}
+	return
+}
+
+// ==========================================================
+// TestEmailAction_Execute
+
+func TestEmailAction_Execute_StartTls(t *testing.T) {
+	server := newTestSmtpServer(t, false)
+	getSecret := testSecretGetter(map[string]string{"SMTP_PASSWORD": "hunter2"})
+
+	output, err := EmailAction{}.ExecuteContext(context.Background(), Input{
+		"smtp":    server.smtpInput(StartTlsSmtpTls),
+		"from":    "Cronny <jobs@example.com>",
+		"to":      "ops@example.com, Dev Team <dev@example.com>",
+		"bcc":     []interface{}{"audit@example.com"},
+		"subject": "{{ .failed }} jobs failed",
+		"text":    "Failed jobs: {{ .failed }}",
+		"html":    "<p>{{ .name }}</p>",
+		"data":    map[string]interface{}{"failed": float64(2), "name": "<backup>"},
+		"attachments": []interface{}{
+			map[string]interface{}{"filename": "report.json", "content": map[string]interface{}{"failed": float64(2)}},
+			map[string]interface{}{"filename": "logo.png", "content": base64.StdEncoding.EncodeToString([]byte("\x89PNG")), "encoding": "base64"},
+		},
+	}, getSecret)
+	require.NoError(t, err)
+	assert.Equal(t, true, output["sent"])
+	assert.Equal(t, 3, output["recipients"])
+
+	sent := server.sent()
+	require.Len(t, sent, 1)
+	assert.True(t, sent[0].tls)
+	assert.Equal(t, "cronny", sent[0].username)
+	assert.Equal(t, "jobs@example.com", sent[0].from)
+	assert.Equal(t, []string{"ops@example.com", "dev@example.com", "audit@example.com"}, sent[0].recipients)
+
+	header, parts := readTestMessage(t, sent[0].data)
+	assert.Equal(t, "2 jobs failed", header.Get("Subject"))
+	assert.Equal(t, `"Cronny" <jobs@example.com>`, header.Get("From"))
+	assert.Equal(t, `<ops@example.com>, "Dev Team" <dev@example.com>`, header.Get("To"))
+	assert.Empty(t, header.Get("Bcc"), "Bcc recipients shouldn't be in the headers")
+	assert.Equal(t, output["message_id"], header.Get("Message-ID"))
+	assert.Equal(t, "Failed jobs: 2", parts["text/plain"])
+	assert.Equal(t, "<p>&lt;backup&gt;</p>", parts["text/html"], "The data should be escaped in the HTML")
+	assert.JSONEq(t, `{"failed": 2}`, parts["application/json"])
+	assert.Equal(t, "\x89PNG", parts["image/png"])
+}
+
+func TestEmailAction_Execute_ImplicitTls(t *testing.T) {
+	server := newTestSmtpServer(t, true)
+	getSecret := testSecretGetter(map[string]string{"SMTP_PASSWORD": "hunter2"})
+
+	_, err := EmailAction{}.ExecuteContext(context.Background(), Input{
+		"smtp":    server.smtpInput(ImplicitSmtpTls),
+		"from":    "jobs@example.com",
+		"to":      []interface{}{"ops@example.com"},
+		"subject": "Backup done",
+		"text":    "Done",
+	}, getSecret)
+	require.NoError(t, err)
+
+	sent := server.sent()
+	require.Len(t, sent, 1)
+	assert.True(t, sent[0].tls)
+	_, parts := readTestMessage(t, sent[0].data)
+	assert.Equal(t, "Done", parts["text/plain"])
+}
+
+func TestEmailAction_Execute_AdminSmtp(t *testing.T) {
+	server := newTestSmtpServer(t, false)
+	host, port, _ := net.SplitHostPort(server.addr)
+	portNum, _ := strconv.ParseInt(port, 10, 64)
+	prevHost, prevPort, prevUsername, prevPassword := config.SmtpHost, config.SmtpPort, config.SmtpUsername, config.SmtpPassword
+	prevFrom, prevTls := config.SmtpFrom, config.SmtpTls
+	config.SmtpHost, config.SmtpPort, config.SmtpUsername, config.SmtpPassword = host, portNum, "admin", "hunter2"
+	config.SmtpFrom, config.SmtpTls = "Cronny <cronny@example.com>", StartTlsSmtpTls
+	t.Cleanup(func() {
+		config.SmtpHost, config.SmtpPort, config.SmtpUsername, config.SmtpPassword = prevHost, prevPort, prevUsername, prevPassword
+		config.SmtpFrom, config.SmtpTls = prevFrom, prevTls
+	})
+
+	_, err := EmailAction{}.Execute(Input{
+		"to":      "ops@example.com",
+		"subject": "Backup done",
+		"html":    "<b>Done</b>",
+	})
+	require.NoError(t, err)
+
+	sent := server.sent()
+	require.Len(t, sent, 1)
+	assert.Equal(t, "admin", sent[0].username)
+	assert.Equal(t, "cronny@example.com", sent[0].from)
+	_, parts := readTestMessage(t, sent[0].data)
+	assert.Equal(t, "<b>Done</b>", parts["text/html"])
+
+	// The admin's server only sends mail from the admin's address
+	err = EmailAction{}.Validate(Input{
+		"to":      "ops@example.com",
+		"from":    "ceo@example.com",
+		"subject": "Backup done",
+		"text":    "Done",
+	})
+	assert.EqualError(t, err, "from can only be set along with smtp")
+}
+
+func TestEmailAction_Execute_RequiresStartTls(t *testing.T) {
+	server := newTestSmtpServer(t, true)
+	getSecret := testSecretGetter(map[string]string{"SMTP_PASSWORD": "hunter2"})
+
+	// The server expects TLS from the start so STARTTLS can't be negotiated
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_, err := EmailAction{}.ExecuteContext(ctx, Input{
+		"smtp":    server.smtpInput(StartTlsSmtpTls),
+		"from":    "jobs@example.com",
+		"to":      "ops@example.com",
+		"subject": "Backup done",
+		"text":    "Done",
+	}, getSecret)
+	assert.ErrorContains(t, err, "Failed to send email")
+	assert.Empty(t, server.sent())
+}
+
+func TestEmailAction_Execute_RejectedRecipient(t *testing.T) {
+	server := newTestSmtpServer(t, false)
+	getSecret := testSecretGetter(map[string]string{"SMTP_PASSWORD": "hunter2"})
+
+	_, err := EmailAction{}.ExecuteContext(context.Background(), Input{
+		"smtp":    server.smtpInput(StartTlsSmtpTls),
+		"from":    "jobs@example.com",
+		"to":      "ops@example.com, rejected@example.com",
+		"subject": "Backup done",
+		"text":    "Done",
+	}, getSecret)
+	assert.ErrorContains(t, err, "Recipient rejected@example.com was rejected")
+	assert.Empty(t, server.sent())
+}
+
+// ==========================================================
+// TestEmailAction_Validate
+
+func TestEmailAction_Validate_InvalidInput(t *testing.T) {
+	valid := Input{
+		"smtp":    map[string]interface{}{"host": "smtp.example.com", "username": "cronny", "password_secret": "SMTP_PASSWORD"},
+		"from":    "jobs@example.com",
+		"to":      "ops@example.com",
+		"subject": "Backup done",
+		"text":    "Done",
+	}
+	require.NoError(t, EmailAction{}.Validate(valid))
+
+	with := func(key string, val interface{}) Input {
+		input := Input{}
+		for k, v := range valid {
+			input[k] = v
+		}
+		if val == nil {
+			delete(input, key)
+		} else {
+			input[key] = val
+		}
+		return input
+	}
+	testCases := []struct {
+		name  string
+		input Input
+	}{
+		{name: "Missing to", input: with("to", nil)},
+		{name: "Invalid to", input: with("to", "not an address")},
+		{name: "Missing from", input: with("from", nil)},
+		{name: "Missing body", input: with("text", nil)},
+		{name: "Invalid template", input: with("subject", "{{ .failed")},
+		{name: "Missing template data", input: with("subject", "{{ .failed }} jobs failed")},
+		{name: "Missing smtp host", input: with("smtp", map[string]interface{}{"port": float64(465)})},
+		{name: "Missing smtp password", input: with("smtp", map[string]interface{}{"host": "smtp.example.com", "username": "cronny"})},
+		{name: "Unsupported smtp tls", input: with("smtp", map[string]interface{}{"host": "smtp.example.com", "tls": "ssl"})},
+		{name: "Missing attachment filename", input: with("attachments", []interface{}{map[string]interface{}{"content": "a,b"}})},
+		{name: "Invalid attachment base64", input: with("attachments", []interface{}{
+			map[string]interface{}{"filename": "logo.png", "content": "not base64!", "encoding": "base64"},
+		})},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Error(t, EmailAction{}.Validate(tc.input))
+		})
+	}
+}
+
+func TestEmailAction_Validate_AttachmentsLimit(t *testing.T) {
+	prevMax := config.MaxEmailAttachmentsBytes
+	config.MaxEmailAttachmentsBytes = 8
+	t.Cleanup(func() { config.MaxEmailAttachmentsBytes = prevMax })
+
+	err := EmailAction{}.Validate(Input{
+		"smtp":    map[string]interface{}{"host": "smtp.example.com"},
+		"from":    "jobs@example.com",
+		"to":      "ops@example.com",
+		"subject": "Report",
+		"text":    "Attached",
+		"attachments": []interface{}{
+			map[string]interface{}{"filename": "a.csv", "content": "a,b,c"},
+			map[string]interface{}{"filename": "b.csv", "content": "d,e,f"},
+		},
+	})
+	assert.EqualError(t, err, "Attachments can't be more than 8 bytes")
+}
@@ -1 +1,513 @@
 package actions
+
+import (
+	"bytes"
+	"context"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// Github Operations
+	WorkflowDispatchGithubOperation = GithubOperationT("workflow_dispatch")
+	CreateIssueGithubOperation      = GithubOperationT("create_issue")
+	CreateCommentGithubOperation    = GithubOperationT("create_comment")
+	CreateStatusGithubOperation     = GithubOperationT("create_status")
+	GetReleaseGithubOperation       = GithubOperationT("get_release")
+
+	DefaultGithubBaseUrl = "https://api.github.com"
+	githubApiVersion     = "2022-11-28"
+
+	// githubTokenExpiryDelta refreshes installation tokens slightly before
+	// they expire
+	githubTokenExpiryDelta = time.Minute
+)
+
+var (
+	githubStatusStates = map[string]bool{
+		"error":   true,
+		"failure": true,
+		"pending": true,
+		"success": true,
+	}
+
+	githubInstallationTokens = &githubTokenCache{
+		tokens: make(map[string]*oauth2Token),
+	}
+)
+
+type (
+	GithubOperationT string
+
+	// GithubApp authenticates as an installation of a GitHub App
+	GithubApp struct {
+		AppID          string
+		InstallationID string
+		// PrivateKey is read from the secret named by private_key_secret
+		// when the job is executed
+		PrivateKey *rsa.PrivateKey
+	}
+
+	GithubActionReq struct {
+		Operation GithubOperationT
+		BaseUrl   string
+		Owner     string
+		Repo      string
+
+		// Either the token or the app is set, the token is read from the
+		// secret named by token_secret when the job is executed
+		Token string
+		App   *GithubApp
+
+		Method string
+		Path   string
+		Body   map[string]interface{}
+	}
+
+	// githubTokenCache keeps the installation tokens of GitHub Apps until
+	// they expire
+	githubTokenCache struct {
+		mu     sync.Mutex
+		tokens map[string]*oauth2Token
+	}
+
+	GithubAction struct{}
+)
+
+func (githubAction GithubAction) RequiredKeys() (keys []ActionKey) {
+	keys = []ActionKey{
+		{"operation", StringActionKeyType},
+		{"owner", StringActionKeyType},
+		{"repo", StringActionKeyType},
+	}
+	return
+}
+
+func (githubAction GithubAction) Validate(input Input) (githubReq *GithubActionReq, err error) {
+	var (
+		operation   string
+		tokenSecret string
+	)
+	githubReq = &GithubActionReq{}
+	if operation, err = input.GetString("operation", true); err != nil {
+		return
+	}
+	githubReq.Operation = GithubOperationT(operation)
+	if githubReq.Owner, err = input.GetString("owner", true); err != nil {
+		return
+	}
+	if githubReq.Repo, err = input.GetString("repo", true); err != nil {
+		return
+	}
+	if githubReq.BaseUrl, err = input.GetString("base_url", false); err != nil {
+		return
+	}
+	if githubReq.BaseUrl == "" {
+		githubReq.BaseUrl = DefaultGithubBaseUrl
+	}
+	if _, err = url.ParseRequestURI(githubReq.BaseUrl); err != nil {
+		err = fmt.Errorf("Invalid base_url %s", githubReq.BaseUrl)
+		return
+	}
+	githubReq.BaseUrl = strings.TrimSuffix(githubReq.BaseUrl, "/")
+
+	// The token would be stored along with the job and its executions
+	if _, isPresent := input["token"]; isPresent {
+		err = fmt.Errorf("token can't be part of the input, set token_secret to the name of a secret")
+		return
+	}
+	if tokenSecret, err = input.GetString("token_secret", false); err != nil {
+		return
+	}
+	if githubReq.App, err = githubAction.parseApp(input); err != nil {
+		return
+	}
+	if (tokenSecret == "") == (githubReq.App == nil) {
+		err = fmt.Errorf("Either token_secret or app is required")
+		return
+	}
+
+	repoPath := "/repos/" + url.PathEscape(githubReq.Owner) + "/" + url.PathEscape(githubReq.Repo)
+	switch githubReq.Operation {
+	case WorkflowDispatchGithubOperation:
+		err = githubReq.workflowDispatch(input, repoPath)
+	case CreateIssueGithubOperation:
+		err = githubReq.createIssue(input, repoPath)
+	case CreateCommentGithubOperation:
+		err = githubReq.createComment(input, repoPath)
+	case CreateStatusGithubOperation:
+		err = githubReq.createStatus(input, repoPath)
+	case GetReleaseGithubOperation:
+		err = githubReq.getRelease(input, repoPath)
+	default:
+		err = fmt.Errorf("Unsupported github operation %s", operation)
+	}
+	return
+}
+
+// parseApp parses the app object, eg. {"app_id": "123", "installation_id": "456", "private_key_secret": "GITHUB_APP_KEY"}
+func (githubAction GithubAction) parseApp(input Input) (app *GithubApp, err error) {
+	var (
+		appObj map[string]interface{}
+	)
+	if appObj, err = input.GetObject("app"); err != nil || appObj == nil {
+		return
+	}
+	appInput := Input(appObj)
+	app = &GithubApp{}
+	if app.AppID, err = githubID(appInput, "app_id"); err != nil {
+		return
+	}
+	if app.InstallationID, err = githubID(appInput, "installation_id"); err != nil {
+		return
+	}
+	if _, isPresent := appInput["private_key"]; isPresent {
+		err = fmt.Errorf("app: private_key can't be part of the input, set private_key_secret to the name of a secret")
+		return
+	}
+	if _, err = appInput.GetString("private_key_secret", true); err != nil {
+		err = fmt.Errorf("app: %w", err)
+		return
+	}
+	return
+}
+
+// resolveCredentials reads the token, or the private key of the app, from
+// the user's secrets
+func (githubReq *GithubActionReq) resolveCredentials(input Input, getSecret SecretGetter) (err error) {
+	var (
+		appObj     map[string]interface{}
+		privateKey string
+	)
+	if githubReq.App == nil {
+		githubReq.Token, err = getSecret.GetSecret(input, "token_secret", true)
+		return
+	}
+	if appObj, err = input.GetObject("app"); err != nil {
+		return
+	}
+	if privateKey, err = getSecret.GetSecret(Input(appObj), "private_key_secret", true); err != nil {
+		err = fmt.Errorf("app: %w", err)
+		return
+	}
+	if githubReq.App.PrivateKey, err = jwt.ParseRSAPrivateKeyFromPEM([]byte(privateKey)); err != nil {
+		err = fmt.Errorf("app: invalid private_key_secret: %w", err)
+		return
+	}
+	return
+}
+
+// githubID reads an ID which is either a number or a string of digits
+func githubID(input Input, key string) (id string, err error) {
+	switch val := input[key].(type) {
+	case float64:
+		id = strconv.FormatInt(int64(val), 10)
+	case string:
+		id = val
+	}
+	if _, convErr := strconv.ParseUint(id, 10, 64); convErr != nil {
+		err = fmt.Errorf("%s should be a number", key)
+		return
+	}
+	return
+}
+
+// workflowDispatch triggers a workflow, identified by its ID or file name, on a ref
+func (githubReq *GithubActionReq) workflowDispatch(input Input, repoPath string) (err error) {
+	var (
+		workflow string
+		ref      string
+		inputs   map[string]interface{}
+	)
+	if workflow, err = githubString(input, "workflow"); err != nil {
+		return
+	}
+	if ref, err = input.GetString("ref", true); err != nil {
+		return
+	}
+	if inputs, err = input.GetObject("inputs"); err != nil {
+		return
+	}
+	githubReq.Method = http.MethodPost
+	githubReq.Path = repoPath + "/actions/workflows/" + url.PathEscape(workflow) + "/dispatches"
+	githubReq.Body = map[string]interface{}{"ref": ref}
+	if inputs != nil {
+		githubReq.Body["inputs"] = inputs
+	}
+	return
+}
+
+func (githubReq *GithubActionReq) createIssue(input Input, repoPath string) (err error) {
+	var (
+		title string
+	)
+	if title, err = input.GetString("title", true); err != nil {
+		return
+	}
+	githubReq.Method = http.MethodPost
+	githubReq.Path = repoPath + "/issues"
+	githubReq.Body = map[string]interface{}{"title": title}
+	for _, key := range []string{"body", "labels", "assignees", "milestone"} {
+		if val, isPresent := input[key]; isPresent && val != nil {
+			githubReq.Body[key] = val
+		}
+	}
+	return
+}
+
+func (githubReq *GithubActionReq) createComment(input Input, repoPath string) (err error) {
+	var (
+		issueNumber string
+		body        string
+	)
+	if issueNumber, err = githubID(input, "issue_number"); err != nil {
+		return
+	}
+	if body, err = input.GetString("body", true); err != nil {
+		return
+	}
+	githubReq.Method = http.MethodPost
+	githubReq.Path = repoPath + "/issues/" + issueNumber + "/comments"
+	githubReq.Body = map[string]interface{}{"body": body}
+	return
+}
+
+// createStatus sets the status of a commit. Statuses with the same context
+// replace the previous one, which is how a pending status is updated.
+func (githubReq *GithubActionReq) createStatus(input Input, repoPath string) (err error) {
+	var (
+		sha   string
+		state string
+	)
+	if sha, err = input.GetString("sha", true); err != nil {
+		return
+	}
+	if state, err = input.GetString("state", true); err != nil {
+		return
+	}
+	if !githubStatusStates[state] {
+		err = fmt.Errorf("Unsupported status state %s", state)
+		return
+	}
+	githubReq.Method = http.MethodPost
+	githubReq.Path = repoPath + "/statuses/" + url.PathEscape(sha)
+	githubReq.Body = map[string]interface{}{"state": state}
+	for _, key := range []string{"target_url", "description", "context"} {
+		var val string
+		if val, err = input.GetString(key, false); err != nil {
+			return
+		}
+		if val != "" {
+			githubReq.Body[key] = val
+		}
+	}
+	return
+}
+
+// getRelease fetches the release of a tag, or the latest release when no tag is set
+func (githubReq *GithubActionReq) getRelease(input Input, repoPath string) (err error) {
+	var (
+		tag string
+	)
+	if tag, err = input.GetString("tag", false); err != nil {
+		return
+	}
+	githubReq.Method = http.MethodGet
+	githubReq.Path = repoPath + "/releases/latest"
+	if tag != "" {
+		githubReq.Path = repoPath + "/releases/tags/" + url.PathEscape(tag)
+	}
+	return
+}
+
+// githubString reads a string, or a number like a workflow ID, as a string
+func githubString(input Input, key string) (val string, err error) {
+	if num, isNumber := input[key].(float64); isNumber {
+		val = strconv.FormatInt(int64(num), 10)
+		return
+	}
+	return input.GetString(key, true)
+}
+
+// ==========================================================
+// GitHub App
+
+// appJwt returns the JWT authenticating as the app, valid for 9 minutes
+// with its issue time set in the past to allow for clock drift
+func (app *GithubApp) appJwt() (signed string, err error) {
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.RegisteredClaims{
+		Issuer:    app.AppID,
+		IssuedAt:  jwt.NewNumericDate(now.Add(-60 * time.Second)),
+		ExpiresAt: jwt.NewNumericDate(now.Add(9 * time.Minute)),
+	})
+	return token.SignedString(app.PrivateKey)
+}
+
+// cacheKey has the hash of the private key so that the installation token
+// is only reused by the jobs which could create it
+func (app *GithubApp) cacheKey(baseUrl string) string {
+	keyHash := sha256.Sum256(x509.MarshalPKCS1PrivateKey(app.PrivateKey))
+	return baseUrl + "|" + app.AppID + "|" + app.InstallationID + "|" + hex.EncodeToString(keyHash[:])
+}
+
+// fetchInstallationToken creates an installation access token for the app
+func (app *GithubApp) fetchInstallationToken(ctx context.Context, baseUrl string) (token *oauth2Token, err error) {
+	var (
+		appJwt    string
+		tokenResp struct {
+			Token     string    `json:"token"`
+			ExpiresAt time.Time `json:"expires_at"`
+		}
+	)
+	if appJwt, err = app.appJwt(); err != nil {
+		return
+	}
+	path := "/app/installations/" + app.InstallationID + "/access_tokens"
+	if err = githubDo(ctx, baseUrl, http.MethodPost, path, appJwt, nil, &tokenResp); err != nil {
+		err = fmt.Errorf("failed to create GitHub App installation token: %w", err)
+		return
+	}
+	if tokenResp.Token == "" {
+		err = fmt.Errorf("GitHub App installation token response has no token")
+		return
+	}
+	token = &oauth2Token{AccessToken: tokenResp.Token, ExpiresAt: tokenResp.ExpiresAt}
+	return
+}
+
+// Get returns the cached installation token of the app, creating a new one
+// when it's missing or about to expire
+func (cache *githubTokenCache) Get(ctx context.Context, baseUrl string, app *GithubApp) (accessToken string, err error) {
+	var (
+		token *oauth2Token
+	)
+	key := app.cacheKey(baseUrl)
+	cache.mu.Lock()
+	token = cache.tokens[key]
+	cache.mu.Unlock()
+	if token != nil && (token.ExpiresAt.IsZero() || time.Now().Add(githubTokenExpiryDelta).Before(token.ExpiresAt)) {
+		accessToken = token.AccessToken
+		return
+	}
+
+	if token, err = app.fetchInstallationToken(ctx, baseUrl); err != nil {
+		return
+	}
+	cache.mu.Lock()
+	removeExpiredTokens(cache.tokens)
+	cache.tokens[key] = token
+	cache.mu.Unlock()
+	accessToken = token.AccessToken
+	return
+}
+
+// ==========================================================
+// GitHub API
+
+// githubDo sends a request to the GitHub API and decodes the JSON response
+// into respVal. Responses which aren't 2xx are returned as errors along
+// with GitHub's message.
+func githubDo(ctx context.Context, baseUrl, method, path, token string, body interface{}, respVal interface{}) (err error) {
+	var (
+		req      *http.Request
+		resp     *http.Response
+		reqBody  io.Reader
+		respBody []byte
+	)
+	if body != nil {
+		var bodyB []byte
+		if bodyB, err = json.Marshal(body); err != nil {
+			return
+		}
+		reqBody = bytes.NewReader(bodyB)
+	}
+	if req, err = http.NewRequestWithContext(ctx, method, baseUrl+path, reqBody); err != nil {
+		return
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("X-GitHub-Api-Version", githubApiVersion)
+	req.Header.Set("User-Agent", "cronny")
+	req.Header.Set("Authorization", "Bearer "+token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	if resp, err = httpClient.Do(req); err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if respBody, err = io.ReadAll(resp.Body); err != nil {
+		return
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var errResp struct {
+			Message string `json:"message"`
+		}
+		if jsonErr := json.Unmarshal(respBody, &errResp); jsonErr != nil || errResp.Message == "" {
+			errResp.Message = http.StatusText(resp.StatusCode)
+		}
+		err = fmt.Errorf("GitHub API returned status %d: %s", resp.StatusCode, errResp.Message)
+		return
+	}
+	if respVal == nil || len(respBody) == 0 {
+		return
+	}
+	if err = json.Unmarshal(respBody, respVal); err != nil {
+		err = fmt.Errorf("failed to parse GitHub API response: %w", err)
+		return
+	}
+	return
+}
+
+func (githubAction GithubAction) Execute(input Input) (output Output, err error) {
+	return githubAction.ExecuteContext(context.Background(), input, nil)
+}
+
+// ExecuteContext runs the operation until the job times out. The output is
+// the object returned by GitHub, eg. the issue with its number and html_url,
+// while workflow dispatches, which GitHub doesn't respond to with a body,
+// output dispatched.
+func (githubAction GithubAction) ExecuteContext(ctx context.Context, input Input, getSecret SecretGetter) (output Output, err error) {
+	var (
+		githubReq *GithubActionReq
+		token     string
+	)
+	if githubReq, err = githubAction.Validate(input); err != nil {
+		return
+	}
+	if err = githubReq.resolveCredentials(input, getSecret); err != nil {
+		return
+	}
+	token = githubReq.Token
+	if githubReq.App != nil {
+		if token, err = githubInstallationTokens.Get(ctx, githubReq.BaseUrl, githubReq.App); err != nil {
+			return
+		}
+		// The installation token isn't one of the user's secrets
+		redactSecret(ctx, token)
+	}
+
+	output = make(Output)
+	if err = githubDo(ctx, githubReq.BaseUrl, githubReq.Method, githubReq.Path, token, githubReq.Body, &output); err != nil {
+		output = nil
+		return
+	}
+	if githubReq.Operation == WorkflowDispatchGithubOperation {
+		output["dispatched"] = true
+	}
+	return
+}
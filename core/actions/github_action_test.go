@@ -0,0 +1,339 @@
+package actions
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func githubInput(baseUrl, operation string, extra Input) Input {
+	input := Input{
+		"operation":    operation,
+		"owner":        "cronny",
+		"repo":         "core",
+		"token_secret": "GITHUB_TOKEN",
+		"base_url":     baseUrl,
+	}
+	for key, val := range extra {
+		input[key] = val
+	}
+	return input
+}
+
+// executeGithub executes the action with the tokens of githubTestSecrets
+func executeGithub(input Input) (Output, error) {
+	return GithubAction{}.ExecuteContext(context.Background(), input, testSecretGetter(githubTestSecrets))
+}
+
+var githubTestSecrets = map[string]string{
+	"GITHUB_TOKEN":       "ghp_test",
+	"GITHUB_WRONG_TOKEN": "ghp_wrong",
+}
+
+// newTestGithubServer serves a single API route and checks that requests
+// are authenticated with ghp_test
+func newTestGithubServer(t *testing.T, method, path string, handler func(body map[string]interface{}) (int, interface{})) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/vnd.github+json", r.Header.Get("Accept"))
+		if r.Header.Get("Authorization") != "Bearer ghp_test" {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]interface{}{"message": "Bad credentials"})
+			return
+		}
+		if r.Method != method || r.URL.Path != path {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]interface{}{"message": "Not Found"})
+			return
+		}
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		status, resp := handler(body)
+		w.WriteHeader(status)
+		if resp != nil {
+			json.NewEncoder(w).Encode(resp)
+		}
+	}))
+}
+
+// ==========================================================
+// TestGithubAction_Execute
+
+func TestGithubAction_Execute_WorkflowDispatch(t *testing.T) {
+	server := newTestGithubServer(t, "POST", "/api/v3/repos/cronny/core/actions/workflows/deploy.yml/dispatches",
+		func(body map[string]interface{}) (int, interface{}) {
+			assert.Equal(t, "main", body["ref"])
+			assert.Equal(t, map[string]interface{}{"env": "prod"}, body["inputs"])
+			return http.StatusNoContent, nil
+		})
+	defer server.Close()
+
+	// GitHub Enterprise serves the API under /api/v3
+	output, err := executeGithub(githubInput(server.URL+"/api/v3/", "workflow_dispatch", Input{
+		"workflow": "deploy.yml",
+		"ref":      "main",
+		"inputs":   map[string]interface{}{"env": "prod"},
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, true, output["dispatched"])
+}
+
+func TestGithubAction_Execute_CreateIssueAndComment(t *testing.T) {
+	issueServer := newTestGithubServer(t, "POST", "/repos/cronny/core/issues", func(body map[string]interface{}) (int, interface{}) {
+		assert.Equal(t, "Nightly build failed", body["title"])
+		assert.Equal(t, []interface{}{"ci"}, body["labels"])
+		return http.StatusCreated, map[string]interface{}{"number": 42, "html_url": "https://github.com/cronny/core/issues/42"}
+	})
+	defer issueServer.Close()
+
+	output, err := executeGithub(githubInput(issueServer.URL, "create_issue", Input{
+		"title":  "Nightly build failed",
+		"body":   "See the logs",
+		"labels": []interface{}{"ci"},
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, float64(42), output["number"])
+	assert.Equal(t, "https://github.com/cronny/core/issues/42", output["html_url"])
+
+	commentServer := newTestGithubServer(t, "POST", "/repos/cronny/core/issues/42/comments", func(body map[string]interface{}) (int, interface{}) {
+		assert.Equal(t, "Fixed", body["body"])
+		return http.StatusCreated, map[string]interface{}{"id": 1}
+	})
+	defer commentServer.Close()
+
+	// The issue number is usually the output of a previous job
+	output, err = executeGithub(githubInput(commentServer.URL, "create_comment", Input{
+		"issue_number": output["number"],
+		"body":         "Fixed",
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, float64(1), output["id"])
+}
+
+func TestGithubAction_Execute_CreateStatus(t *testing.T) {
+	server := newTestGithubServer(t, "POST", "/repos/cronny/core/statuses/abc123", func(body map[string]interface{}) (int, interface{}) {
+		assert.Equal(t, map[string]interface{}{
+			"state":       "success",
+			"context":     "cronny/smoke",
+			"description": "All checks passed",
+		}, body)
+		return http.StatusCreated, map[string]interface{}{"id": 7, "state": "success"}
+	})
+	defer server.Close()
+
+	output, err := executeGithub(githubInput(server.URL, "create_status", Input{
+		"sha":         "abc123",
+		"state":       "success",
+		"context":     "cronny/smoke",
+		"description": "All checks passed",
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, "success", output["state"])
+}
+
+func TestGithubAction_Execute_GetRelease(t *testing.T) {
+	release := map[string]interface{}{"tag_name": "v1.2.0", "assets": []interface{}{}}
+	latestServer := newTestGithubServer(t, "GET", "/repos/cronny/core/releases/latest", func(body map[string]interface{}) (int, interface{}) {
+		return http.StatusOK, release
+	})
+	defer latestServer.Close()
+	tagServer := newTestGithubServer(t, "GET", "/repos/cronny/core/releases/tags/v1.2.0", func(body map[string]interface{}) (int, interface{}) {
+		return http.StatusOK, release
+	})
+	defer tagServer.Close()
+
+	output, err := executeGithub(githubInput(latestServer.URL, "get_release", nil))
+	require.NoError(t, err)
+	assert.Equal(t, "v1.2.0", output["tag_name"])
+
+	output, err = executeGithub(githubInput(tagServer.URL, "get_release", Input{"tag": "v1.2.0"}))
+	require.NoError(t, err)
+	assert.Equal(t, "v1.2.0", output["tag_name"])
+}
+
+func TestGithubAction_Execute_ReturnsErrors(t *testing.T) {
+	server := newTestGithubServer(t, "GET", "/repos/cronny/core/releases/latest", func(body map[string]interface{}) (int, interface{}) {
+		return http.StatusOK, nil
+	})
+	defer server.Close()
+
+	input := githubInput(server.URL, "get_release", nil)
+	input["token_secret"] = "GITHUB_WRONG_TOKEN"
+	_, err := executeGithub(input)
+	assert.ErrorContains(t, err, "status 401: Bad credentials")
+
+	_, err = executeGithub(githubInput(server.URL, "get_release", Input{"tag": "v0"}))
+	assert.ErrorContains(t, err, "status 404: Not Found")
+}
+
+func TestGithubAction_Execute_AppAuth(t *testing.T) {
+	githubInstallationTokens = &githubTokenCache{tokens: make(map[string]*oauth2Token)}
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	privateKeyPem := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)})
+
+	var tokensCreated int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if r.URL.Path == "/app/installations/456/access_tokens" {
+			claims := &jwt.RegisteredClaims{}
+			_, err := jwt.ParseWithClaims(auth, claims, func(token *jwt.Token) (interface{}, error) {
+				return &privateKey.PublicKey, nil
+			}, jwt.WithValidMethods([]string{"RS256"}))
+			require.NoError(t, err)
+			assert.Equal(t, "123", claims.Issuer)
+			atomic.AddInt32(&tokensCreated, 1)
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"token":      "ghs_installation",
+				"expires_at": time.Now().Add(time.Hour).Format(time.RFC3339),
+			})
+			return
+		}
+		assert.Equal(t, "ghs_installation", auth)
+		json.NewEncoder(w).Encode(map[string]interface{}{"tag_name": "v1.0.0"})
+	}))
+	defer server.Close()
+
+	input := githubInput(server.URL, "get_release", nil)
+	delete(input, "token_secret")
+	input["app"] = map[string]interface{}{
+		"app_id":             float64(123),
+		"installation_id":    "456",
+		"private_key_secret": "GITHUB_APP_KEY",
+	}
+	getSecret := testSecretGetter(map[string]string{"GITHUB_APP_KEY": string(privateKeyPem)})
+	for idx := 0; idx < 2; idx++ {
+		var redacted []string
+		ctx := ContextWithSecretRedactor(context.Background(), func(value string) { redacted = append(redacted, value) })
+		output, err := GithubAction{}.ExecuteContext(ctx, input, getSecret)
+		require.NoError(t, err)
+		assert.Equal(t, "v1.0.0", output["tag_name"])
+		assert.Equal(t, []string{"ghs_installation"}, redacted, "The installation token should be redacted")
+	}
+	assert.Equal(t, int32(1), tokensCreated, "The installation token should be reused until it expires")
+}
+
+func TestGithubTokenCache_Get_KeyedByPrivateKey(t *testing.T) {
+	githubInstallationTokens = &githubTokenCache{tokens: make(map[string]*oauth2Token)}
+	server := newTestGithubServer(t, "POST", "/app/installations/456/access_tokens", func(body map[string]interface{}) (int, interface{}) {
+		return http.StatusOK, nil
+	})
+	defer server.Close()
+	ownerKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	owner := &GithubApp{AppID: "123", InstallationID: "456", PrivateKey: ownerKey}
+	githubInstallationTokens.tokens[owner.cacheKey(server.URL)] = &oauth2Token{AccessToken: "ghs_owner", ExpiresAt: time.Now().Add(time.Hour)}
+	token, err := githubInstallationTokens.Get(context.Background(), server.URL, owner)
+	require.NoError(t, err)
+	assert.Equal(t, "ghs_owner", token)
+
+	// Another key for the same installation has to create its own token,
+	// which GitHub refuses
+	other := &GithubApp{AppID: "123", InstallationID: "456", PrivateKey: otherKey}
+	token, err = githubInstallationTokens.Get(context.Background(), server.URL, other)
+	assert.ErrorContains(t, err, "status 401")
+	assert.Empty(t, token)
+}
+
+func TestGithubTokenCache_Get_RemovesExpiredTokens(t *testing.T) {
+	githubInstallationTokens = &githubTokenCache{tokens: make(map[string]*oauth2Token)}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"token":      "ghs_installation",
+			"expires_at": time.Now().Add(time.Hour).Format(time.RFC3339),
+		})
+	}))
+	defer server.Close()
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	githubInstallationTokens.tokens["expired"] = &oauth2Token{AccessToken: "ghs_old", ExpiresAt: time.Now().Add(-time.Minute)}
+	app := &GithubApp{AppID: "123", InstallationID: "456", PrivateKey: privateKey}
+	_, err = githubInstallationTokens.Get(context.Background(), server.URL, app)
+	require.NoError(t, err)
+
+	assert.Len(t, githubInstallationTokens.tokens, 1, "The expired token should have been removed")
+	assert.NotNil(t, githubInstallationTokens.tokens[app.cacheKey(server.URL)])
+}
+
+func TestGithubAction_ExecuteContext_InvalidAppPrivateKey(t *testing.T) {
+	input := Input{"operation": "get_release", "owner": "cronny", "repo": "core",
+		"app": map[string]interface{}{"app_id": "1", "installation_id": "2", "private_key_secret": "GITHUB_APP_KEY"}}
+	_, err := GithubAction{}.ExecuteContext(context.Background(), input, testSecretGetter(map[string]string{"GITHUB_APP_KEY": "key"}))
+	assert.ErrorContains(t, err, "invalid private_key_secret")
+
+	_, err = GithubAction{}.Execute(input)
+	assert.ErrorContains(t, err, "can't be resolved outside of a job")
+}
+
+func TestGithubAction_ExecuteContext_StopsWhenDone(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The connection is watched for the client going away once the body is read
+		io.Copy(io.Discard, r.Body)
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := GithubAction{}.ExecuteContext(ctx, githubInput(server.URL, "get_release", nil), testSecretGetter(githubTestSecrets))
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
+
+// ==========================================================
+// TestGithubAction_Validate
+
+func TestGithubAction_Validate_InvalidInput(t *testing.T) {
+	testCases := []struct {
+		name  string
+		input Input
+	}{
+		{name: "Unsupported operation", input: githubInput("", "delete_repo", nil)},
+		{name: "Missing token and app", input: Input{"operation": "get_release", "owner": "cronny", "repo": "core"}},
+		{name: "Invalid base URL", input: githubInput("api.github.com", "get_release", nil)},
+		{name: "Dispatch without ref", input: githubInput("", "workflow_dispatch", Input{"workflow": "deploy.yml"})},
+		{name: "Issue without title", input: githubInput("", "create_issue", nil)},
+		{name: "Comment without issue number", input: githubInput("", "create_comment", Input{"body": "hi"})},
+		{name: "Invalid status state", input: githubInput("", "create_status", Input{"sha": "abc", "state": "done"})},
+		{
+			name:  "Plaintext token",
+			input: Input{"operation": "get_release", "owner": "cronny", "repo": "core", "token": "ghp_test"},
+		},
+		{
+			name: "Plaintext app private key",
+			input: Input{"operation": "get_release", "owner": "cronny", "repo": "core",
+				"app": map[string]interface{}{"app_id": "1", "installation_id": "2", "private_key": "key"}},
+		},
+		{
+			name: "App without private key secret",
+			input: Input{"operation": "get_release", "owner": "cronny", "repo": "core",
+				"app": map[string]interface{}{"app_id": "1", "installation_id": "2"}},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := GithubAction{}.Validate(tc.input)
+			assert.Error(t, err)
+		})
+	}
+}
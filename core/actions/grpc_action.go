@@ -0,0 +1,228 @@
+package actions
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+type (
+	// GrpcActionReq is the unary call made by a gRPC job
+	GrpcActionReq struct {
+		Target  string
+		Service string
+		Method  string
+		// Request is the JSON of the request message
+		Request  []byte
+		Metadata metadata.MD
+		// DescriptorSet is the base64 encoded FileDescriptorSet with the
+		// service, the server reflection is used when it's not set
+		DescriptorSet string
+		// TLS is nil for plaintext connections
+		TLS *HttpTLSConfig
+	}
+
+	// GrpcAction calls a unary method of a gRPC service. The request and the
+	// response are converted from and to JSON using the descriptors of the
+	// service.
+	GrpcAction struct{}
+)
+
+func (grpcAction GrpcAction) RequiredKeys() (keys []ActionKey) {
+	keys = []ActionKey{
+		{"target", StringActionKeyType},
+		{"method", StringActionKeyType},
+	}
+	return
+}
+
+func (grpcAction GrpcAction) OptionalKeys() (keys []ActionKey) {
+	keys = []ActionKey{
+		{"request", ObjectActionKeyType},
+		{"metadata", ObjectActionKeyType},
+		{"descriptor_set", StringActionKeyType},
+		{"tls", ObjectActionKeyType},
+	}
+	return
+}
+
+func (grpcAction GrpcAction) Validate(input Input) (err error) {
+	_, err = grpcAction.parse(input)
+	return
+}
+
+func (grpcAction GrpcAction) parse(input Input) (grpcReq *GrpcActionReq, err error) {
+	var (
+		method   string
+		metadata map[string][]string
+	)
+	grpcReq = &GrpcActionReq{}
+	if grpcReq.Target, err = input.GetString("target", true); err != nil {
+		return
+	}
+	if method, err = input.GetString("method", true); err != nil {
+		return
+	}
+	// The method is package.Service/Method, like the path of the call
+	var isFullMethod bool
+	grpcReq.Service, grpcReq.Method, isFullMethod = strings.Cut(strings.TrimPrefix(method, "/"), "/")
+	if !isFullMethod || grpcReq.Service == "" || grpcReq.Method == "" {
+		err = fmt.Errorf("method should be package.Service/Method")
+		return
+	}
+
+	switch request := input["request"].(type) {
+	case nil:
+		grpcReq.Request = []byte("{}")
+	case string:
+		// The request can be the JSON output of a previous job
+		if !json.Valid([]byte(request)) {
+			err = fmt.Errorf("request should be an object or JSON")
+			return
+		}
+		grpcReq.Request = []byte(request)
+	default:
+		if grpcReq.Request, err = json.Marshal(request); err != nil {
+			return
+		}
+	}
+
+	if metadata, err = input.GetStringMap("metadata"); err != nil {
+		return
+	}
+	grpcReq.Metadata = make(map[string][]string, len(metadata))
+	for key, vals := range metadata {
+		grpcReq.Metadata.Append(key, vals...)
+	}
+	if grpcReq.DescriptorSet, err = input.GetString("descriptor_set", false); err != nil {
+		return
+	}
+	if grpcReq.DescriptorSet != "" {
+		if _, err = grpcReq.methodDescriptor(context.Background(), nil); err != nil {
+			return
+		}
+	}
+
+	// tls is true for the host's root CAs, or the same object as HTTP jobs
+	switch tlsVal := input["tls"].(type) {
+	case nil:
+	case bool:
+		if tlsVal {
+			grpcReq.TLS = &HttpTLSConfig{}
+		}
+	default:
+		if grpcReq.TLS, err = (HttpAction{}).parseTLSConfig(input); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// methodDescriptor returns the descriptor of the method from the descriptor
+// set, or from the server's reflection
+func (grpcReq *GrpcActionReq) methodDescriptor(ctx context.Context, conn *grpc.ClientConn) (methodDesc protoreflect.MethodDescriptor, err error) {
+	var (
+		files *protoregistry.Files
+	)
+	if grpcReq.DescriptorSet != "" {
+		files, err = parseDescriptorSet(grpcReq.DescriptorSet)
+	} else {
+		files, err = reflectFiles(ctx, conn, grpcReq.Service)
+	}
+	if err != nil {
+		return
+	}
+	return grpcMethodDescriptor(grpcFileResolver{files: files}, grpcReq.Service, grpcReq.Method)
+}
+
+func (grpcReq *GrpcActionReq) dial() (conn *grpc.ClientConn, err error) {
+	var (
+		builtConfig *tls.Config
+	)
+	transportCredentials := insecure.NewCredentials()
+	if grpcReq.TLS != nil {
+		if builtConfig, err = grpcReq.TLS.Build(); err != nil {
+			return
+		}
+		transportCredentials = credentials.NewTLS(builtConfig)
+	}
+	if conn, err = grpc.NewClient(grpcReq.Target, grpc.WithTransportCredentials(transportCredentials), grpc.WithUserAgent("cronny")); err != nil {
+		err = fmt.Errorf("Invalid target %s: %w", grpcReq.Target, err)
+		return
+	}
+	return
+}
+
+func (grpcAction GrpcAction) Execute(input Input) (output Output, err error) {
+	return grpcAction.ExecuteContext(context.Background(), input, nil)
+}
+
+// ExecuteContext calls the method, the job's timeout is the deadline of the
+// call. The output has the response and the response's metadata.
+func (grpcAction GrpcAction) ExecuteContext(ctx context.Context, input Input, getSecret SecretGetter) (output Output, err error) {
+	var (
+		grpcReq    *GrpcActionReq
+		conn       *grpc.ClientConn
+		methodDesc protoreflect.MethodDescriptor
+		respJSON   []byte
+		response   interface{}
+		header     metadata.MD
+	)
+	if grpcReq, err = grpcAction.parse(input); err != nil {
+		return
+	}
+	if err = grpcReq.TLS.resolveClientKey(input, getSecret); err != nil {
+		return
+	}
+	if conn, err = grpcReq.dial(); err != nil {
+		return
+	}
+	defer conn.Close()
+	if methodDesc, err = grpcReq.methodDescriptor(ctx, conn); err != nil {
+		return
+	}
+
+	req := dynamicpb.NewMessage(methodDesc.Input())
+	if err = protojson.Unmarshal(grpcReq.Request, req); err != nil {
+		err = fmt.Errorf("request doesn't match %s: %w", methodDesc.Input().FullName(), err)
+		return
+	}
+	resp := dynamicpb.NewMessage(methodDesc.Output())
+	callCtx := metadata.NewOutgoingContext(ctx, grpcReq.Metadata)
+	fullMethod := "/" + grpcReq.Service + "/" + grpcReq.Method
+	if err = conn.Invoke(callCtx, fullMethod, req, resp, grpc.Header(&header)); err != nil {
+		callStatus := status.Convert(err)
+		err = fmt.Errorf("gRPC call failed with %s: %s", callStatus.Code(), callStatus.Message())
+		return
+	}
+
+	// Unset fields are part of the response so that the next jobs can refer
+	// to them
+	if respJSON, err = (protojson.MarshalOptions{EmitUnpopulated: true}).Marshal(resp); err != nil {
+		return
+	}
+	if err = json.Unmarshal(respJSON, &response); err != nil {
+		return
+	}
+	headers := make(map[string]interface{}, len(header))
+	for key, vals := range header {
+		headers[key] = strings.Join(vals, ",")
+	}
+	output = Output{
+		"response": response,
+		"headers":  headers,
+	}
+	return
+}
@@ -0,0 +1,250 @@
+package actions
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	reflectionv1 "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	reflectionv1alpha "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+type (
+	// grpcFileResolver resolves the files fetched from a server before the
+	// well-known files linked in the binary, eg. google/protobuf/timestamp.proto
+	grpcFileResolver struct {
+		files *protoregistry.Files
+	}
+
+	// grpcFileFetcher fetches the file descriptors defining a symbol, or
+	// the one with a name, from the server
+	grpcFileFetcher func(ctx context.Context, symbol, filename string) (fileProtos [][]byte, err error)
+)
+
+func (resolver grpcFileResolver) FindFileByPath(path string) (protoreflect.FileDescriptor, error) {
+	if fileDesc, err := resolver.files.FindFileByPath(path); err == nil {
+		return fileDesc, nil
+	}
+	return protoregistry.GlobalFiles.FindFileByPath(path)
+}
+
+func (resolver grpcFileResolver) FindDescriptorByName(name protoreflect.FullName) (protoreflect.Descriptor, error) {
+	if desc, err := resolver.files.FindDescriptorByName(name); err == nil {
+		return desc, nil
+	}
+	return protoregistry.GlobalFiles.FindDescriptorByName(name)
+}
+
+// grpcMethodDescriptor returns the unary method of the service
+func grpcMethodDescriptor(resolver protodesc.Resolver, service, method string) (methodDesc protoreflect.MethodDescriptor, err error) {
+	var (
+		desc protoreflect.Descriptor
+	)
+	if desc, err = resolver.FindDescriptorByName(protoreflect.FullName(service)); err != nil {
+		err = fmt.Errorf("Service %s not found: %w", service, err)
+		return
+	}
+	serviceDesc, isService := desc.(protoreflect.ServiceDescriptor)
+	if !isService {
+		err = fmt.Errorf("%s isn't a service", service)
+		return
+	}
+	if methodDesc = serviceDesc.Methods().ByName(protoreflect.Name(method)); methodDesc == nil {
+		err = fmt.Errorf("Method %s not found in %s", method, service)
+		return
+	}
+	if methodDesc.IsStreamingClient() || methodDesc.IsStreamingServer() {
+		err = fmt.Errorf("Method %s/%s is streaming, only unary methods are supported", service, method)
+		methodDesc = nil
+		return
+	}
+	return
+}
+
+// parseDescriptorSet parses a base64 encoded FileDescriptorSet, eg. the
+// output of protoc --descriptor_set_out --include_imports
+func parseDescriptorSet(encoded string) (files *protoregistry.Files, err error) {
+	var (
+		setB []byte
+	)
+	if setB, err = base64.StdEncoding.DecodeString(encoded); err != nil {
+		err = fmt.Errorf("descriptor_set should be base64 encoded: %w", err)
+		return
+	}
+	descriptorSet := &descriptorpb.FileDescriptorSet{}
+	if err = proto.Unmarshal(setB, descriptorSet); err != nil {
+		err = fmt.Errorf("Invalid descriptor_set: %w", err)
+		return
+	}
+	if files, err = protodesc.NewFiles(descriptorSet); err != nil {
+		err = fmt.Errorf("Invalid descriptor_set: %w", err)
+		return
+	}
+	return
+}
+
+// reflectFiles fetches the files defining the service, along with their
+// dependencies, using the server reflection of the server. The v1alpha
+// reflection is used by servers which don't support v1 yet.
+func reflectFiles(ctx context.Context, conn *grpc.ClientConn, service string) (files *protoregistry.Files, err error) {
+	if files, err = fetchFiles(ctx, service, reflectionV1Fetcher(conn)); status.Code(err) == codes.Unimplemented {
+		files, err = fetchFiles(ctx, service, reflectionV1alphaFetcher(conn))
+	}
+	if err != nil {
+		err = fmt.Errorf("Server reflection failed: %w", err)
+		return
+	}
+	return
+}
+
+func fetchFiles(ctx context.Context, service string, fetch grpcFileFetcher) (files *protoregistry.Files, err error) {
+	var (
+		fileProtosB [][]byte
+	)
+	fileProtos := make(map[string]*descriptorpb.FileDescriptorProto)
+	addFileProtos := func() (err error) {
+		for _, fileProtoB := range fileProtosB {
+			fileProto := &descriptorpb.FileDescriptorProto{}
+			if err = proto.Unmarshal(fileProtoB, fileProto); err != nil {
+				return
+			}
+			fileProtos[fileProto.GetName()] = fileProto
+		}
+		return
+	}
+	if fileProtosB, err = fetch(ctx, service, ""); err != nil {
+		return
+	}
+	if err = addFileProtos(); err != nil {
+		return
+	}
+	// Servers usually send the dependencies along with the file, the missing
+	// ones are fetched by name
+	for fetched := true; fetched; {
+		fetched = false
+		for _, fileProto := range fileProtos {
+			for _, dependency := range fileProto.GetDependency() {
+				if _, isPresent := fileProtos[dependency]; isPresent {
+					continue
+				}
+				if _, findErr := protoregistry.GlobalFiles.FindFileByPath(dependency); findErr == nil {
+					continue
+				}
+				if fileProtosB, err = fetch(ctx, "", dependency); err != nil {
+					return
+				}
+				if err = addFileProtos(); err != nil {
+					return
+				}
+				fetched = true
+			}
+		}
+	}
+
+	files = &protoregistry.Files{}
+	resolver := grpcFileResolver{files: files}
+	// A server could send files importing each other, registering is
+	// stopped on a file that's already being registered
+	registering := map[string]bool{}
+	var register func(name string) error
+	register = func(name string) (err error) {
+		fileProto, isPresent := fileProtos[name]
+		if !isPresent {
+			return
+		}
+		if _, findErr := files.FindFileByPath(name); findErr == nil {
+			return
+		}
+		if registering[name] {
+			return fmt.Errorf("import cycle on %s", name)
+		}
+		registering[name] = true
+		defer delete(registering, name)
+		for _, dependency := range fileProto.GetDependency() {
+			if err = register(dependency); err != nil {
+				return
+			}
+		}
+		var fileDesc protoreflect.FileDescriptor
+		if fileDesc, err = protodesc.NewFile(fileProto, resolver); err != nil {
+			return
+		}
+		return files.RegisterFile(fileDesc)
+	}
+	for name := range fileProtos {
+		if err = register(name); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func reflectionV1Fetcher(conn *grpc.ClientConn) grpcFileFetcher {
+	return func(ctx context.Context, symbol, filename string) (fileProtos [][]byte, err error) {
+		var (
+			stream reflectionv1.ServerReflection_ServerReflectionInfoClient
+			resp   *reflectionv1.ServerReflectionResponse
+		)
+		req := &reflectionv1.ServerReflectionRequest{
+			MessageRequest: &reflectionv1.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: symbol},
+		}
+		if filename != "" {
+			req.MessageRequest = &reflectionv1.ServerReflectionRequest_FileByFilename{FileByFilename: filename}
+		}
+		if stream, err = reflectionv1.NewServerReflectionClient(conn).ServerReflectionInfo(ctx); err != nil {
+			return
+		}
+		defer stream.CloseSend()
+		if err = stream.Send(req); err != nil {
+			return
+		}
+		if resp, err = stream.Recv(); err != nil {
+			return
+		}
+		if errResp := resp.GetErrorResponse(); errResp != nil {
+			err = status.Error(codes.Code(errResp.GetErrorCode()), errResp.GetErrorMessage())
+			return
+		}
+		fileProtos = resp.GetFileDescriptorResponse().GetFileDescriptorProto()
+		return
+	}
+}
+
+func reflectionV1alphaFetcher(conn *grpc.ClientConn) grpcFileFetcher {
+	return func(ctx context.Context, symbol, filename string) (fileProtos [][]byte, err error) {
+		var (
+			stream reflectionv1alpha.ServerReflection_ServerReflectionInfoClient
+			resp   *reflectionv1alpha.ServerReflectionResponse
+		)
+		req := &reflectionv1alpha.ServerReflectionRequest{
+			MessageRequest: &reflectionv1alpha.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: symbol},
+		}
+		if filename != "" {
+			req.MessageRequest = &reflectionv1alpha.ServerReflectionRequest_FileByFilename{FileByFilename: filename}
+		}
+		if stream, err = reflectionv1alpha.NewServerReflectionClient(conn).ServerReflectionInfo(ctx); err != nil {
+			return
+		}
+		defer stream.CloseSend()
+		if err = stream.Send(req); err != nil {
+			return
+		}
+		if resp, err = stream.Recv(); err != nil {
+			return
+		}
+		if errResp := resp.GetErrorResponse(); errResp != nil {
+			err = status.Error(codes.Code(errResp.GetErrorCode()), errResp.GetErrorMessage())
+			return
+		}
+		fileProtos = resp.GetFileDescriptorResponse().GetFileDescriptorProto()
+		return
+	}
+}
@@ -2,17 +2,25 @@ package actions
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
-	"reflect"
+	"net/url"
 	"strconv"
+	"strings"
 	"time"
 )
 
 // Shared HTTP client with timeout - reused across all HTTP actions
+// defaultHttpTimeout bounds the requests which are neither part of a job
+// nor have a timeout_in_secs
+const defaultHttpTimeout = 30 * time.Second
+
 var httpClient = &http.Client{
-	Timeout: 30 * time.Second,
+	Timeout: defaultHttpTimeout,
 	Transport: &http.Transport{
 		MaxIdleConns:        100,
 		MaxIdleConnsPerHost: 10,
@@ -22,17 +30,86 @@ var httpClient = &http.Client{
 
 const (
 	// Http Methods
-	GetHttpMethod  = HttpMethodT("GET")
-	PostHttpMethod = HttpMethodT("POST")
+	GetHttpMethod     = HttpMethodT("GET")
+	HeadHttpMethod    = HttpMethodT("HEAD")
+	PostHttpMethod    = HttpMethodT("POST")
+	PutHttpMethod     = HttpMethodT("PUT")
+	PatchHttpMethod   = HttpMethodT("PATCH")
+	DeleteHttpMethod  = HttpMethodT("DELETE")
+	OptionsHttpMethod = HttpMethodT("OPTIONS")
+
+	// Http Body Types
+	// JSONHttpBodyType is the default, the request body is sent as JSON
+	JSONHttpBodyType = HttpBodyT("json")
+	// FormHttpBodyType sends an object as a URL encoded form
+	FormHttpBodyType = HttpBodyT("form")
+	// TextHttpBodyType sends a string as text/plain
+	TextHttpBodyType = HttpBodyT("text")
+	// RawHttpBodyType sends a string as is with the Content-Type from the headers
+	RawHttpBodyType = HttpBodyT("raw")
+
+	// Http Auth Types
+	BasicHttpAuthType  = HttpAuthT("basic")
+	BearerHttpAuthType = HttpAuthT("bearer")
+
+	DefaultHttpMaxRedirects = 10
+)
+
+var (
+	httpMethods = map[HttpMethodT]bool{
+		GetHttpMethod:     true,
+		HeadHttpMethod:    true,
+		PostHttpMethod:    true,
+		PutHttpMethod:     true,
+		PatchHttpMethod:   true,
+		DeleteHttpMethod:  true,
+		OptionsHttpMethod: true,
+	}
 )
 
 type (
 	HttpMethodT string
+	HttpBodyT   string
+	HttpAuthT   string
+
+	HttpAuth struct {
+		Type     HttpAuthT
+		Username string
+		// Password and Token are read from the secrets named by
+		// password_secret and token_secret while executing
+		Password string
+		Token    string
+		OAuth2   *OAuth2ClientCredentials
+	}
 
 	HttpActionReq struct {
 		Url         string      `json:"url"`
 		Method      HttpMethodT `json:"method"`
 		RequestBody interface{} `json:"request_body"`
+
+		Headers  http.Header `json:"headers"`
+		Query    url.Values  `json:"query"`
+		BodyType HttpBodyT   `json:"body_type"`
+		Auth     *HttpAuth   `json:"auth"`
+
+		// TLS and Proxy are nil when the shared client's transport applies
+		TLS   *HttpTLSConfig `json:"tls"`
+		Proxy *url.URL       `json:"-"`
+
+		// Timeout is 0 when the job's timeout applies
+		Timeout         time.Duration `json:"-"`
+		FollowRedirects bool          `json:"follow_redirects"`
+		MaxRedirects    int           `json:"max_redirects"`
+		// ExpectedStatus holds status codes like "200" or classes like "2xx".
+		// Any other status fails the job.
+		ExpectedStatus []string `json:"expected_status"`
+
+		// Signing is nil when the requests aren't signed. It's set while
+		// executing since its keys are read from the user's secrets.
+		Signing *HttpSigning `json:"-"`
+
+		// Pagination is nil when a single request is sent
+		Pagination *HttpPagination `json:"pagination"`
 	}
 
 	HttpAction struct {
@@ -45,38 +122,424 @@ func (httpAction HttpAction) RequiredKeys() (keys []ActionKey) {
 }
 
 func (httpAction HttpAction) Validate(input Input) (httpReq *HttpActionReq, err error) {
+	var (
+		timeoutInSecs float64
+		maxRedirects  float64
+		bodyType      string
+		method        string
+		headers       map[string][]string
+		query         map[string][]string
+	)
 	httpReq = &HttpActionReq{
-		Url:         input["url"].(string),
-		Method:      HttpMethodT(input["method"].(string)),
 		RequestBody: input["request_body"],
+		Headers:     make(http.Header),
+		Query:       make(url.Values),
+	}
+	if httpReq.Url, err = input.GetString("url", true); err != nil {
+		return
+	}
+	if method, err = input.GetString("method", true); err != nil {
+		return
+	}
+	httpReq.Method = HttpMethodT(strings.ToUpper(method))
+	if !httpMethods[httpReq.Method] {
+		err = fmt.Errorf("Unsupported HTTP method %s", method)
+		return
+	}
+
+	if headers, err = input.GetStringMap("headers"); err != nil {
+		return
+	}
+	for key, vals := range headers {
+		for _, val := range vals {
+			httpReq.Headers.Add(key, val)
+		}
+	}
+	if query, err = input.GetStringMap("query"); err != nil {
+		return
+	}
+	for key, vals := range query {
+		httpReq.Query[key] = vals
+	}
+
+	if bodyType, err = input.GetString("body_type", false); err != nil {
+		return
+	}
+	httpReq.BodyType = HttpBodyT(bodyType)
+	switch httpReq.BodyType {
+	case "":
+		httpReq.BodyType = JSONHttpBodyType
+	case JSONHttpBodyType, FormHttpBodyType, TextHttpBodyType, RawHttpBodyType:
+	default:
+		err = fmt.Errorf("Unsupported body type %s", bodyType)
+		return
+	}
+
+	if httpReq.Auth, err = httpAction.parseAuth(input); err != nil {
+		return
+	}
+
+	if httpReq.TLS, err = httpAction.parseTLSConfig(input); err != nil {
+		return
+	}
+	if httpReq.Proxy, err = httpAction.parseProxy(input); err != nil {
+		return
+	}
+	if httpReq.Pagination, err = httpAction.parsePagination(input); err != nil {
+		return
+	}
+
+	if timeoutInSecs, err = input.GetNumber("timeout_in_secs"); err != nil {
+		return
+	}
+	if timeoutInSecs < 0 {
+		err = fmt.Errorf("timeout_in_secs should be positive")
+		return
+	}
+	httpReq.Timeout = time.Duration(timeoutInSecs * float64(time.Second))
+	if httpReq.FollowRedirects, err = input.GetBool("follow_redirects", true); err != nil {
+		return
+	}
+	if maxRedirects, err = input.GetNumber("max_redirects"); err != nil {
+		return
+	}
+	httpReq.MaxRedirects = int(maxRedirects)
+	if httpReq.MaxRedirects <= 0 {
+		httpReq.MaxRedirects = DefaultHttpMaxRedirects
+	}
+	if httpReq.ExpectedStatus, err = httpAction.parseExpectedStatus(input["expected_status"]); err != nil {
+		return
 	}
 	return
 }
 
-func (httpAction HttpAction) Execute(input Input) (output Output, err error) {
+// parseAuth parses the auth object, eg. {"type": "basic", "username": "u", "password_secret": "API_PASSWORD"},
+// {"type": "bearer", "token_secret": "API_TOKEN"} or the client credentials of the oauth2 type
+func (httpAction HttpAction) parseAuth(input Input) (auth *HttpAuth, err error) {
 	var (
-		req    *http.Request
-		resp   *http.Response
+		authObj  map[string]interface{}
+		authType string
+	)
+	if authObj, err = input.GetObject("auth"); err != nil || authObj == nil {
+		return
+	}
+	authInput := Input(authObj)
+	if authType, err = authInput.GetString("type", true); err != nil {
+		err = fmt.Errorf("auth: %w", err)
+		return
+	}
+	// The credentials would be stored along with the job and its executions
+	for _, key := range []string{"password", "token"} {
+		if _, isPresent := authInput[key]; isPresent {
+			err = fmt.Errorf("auth: %s can't be part of the input, set %s_secret to the name of a secret", key, key)
+			return
+		}
+	}
+	auth = &HttpAuth{Type: HttpAuthT(authType)}
+	switch auth.Type {
+	case BasicHttpAuthType:
+		if auth.Username, err = authInput.GetString("username", true); err != nil {
+			break
+		}
+		_, err = authInput.GetString("password_secret", false)
+	case BearerHttpAuthType:
+		_, err = authInput.GetString("token_secret", true)
+	case OAuth2HttpAuthType:
+		auth.OAuth2, err = httpAction.parseOAuth2(authInput)
+	default:
+		err = fmt.Errorf("Unsupported auth type %s", authType)
+	}
+	if err != nil {
+		err = fmt.Errorf("auth: %w", err)
+		return
+	}
+	return
+}
+
+// resolveAuthSecrets reads the password, the token or the client secret of
+// the auth from the user's secrets
+func (httpAction HttpAction) resolveAuthSecrets(input Input, auth *HttpAuth, getSecret SecretGetter) (err error) {
+	var (
+		authObj map[string]interface{}
+	)
+	if auth.Type == OAuth2HttpAuthType {
+		return httpAction.resolveOAuth2Secret(input, auth.OAuth2, getSecret)
+	}
+	if authObj, err = input.GetObject("auth"); err != nil {
+		return
+	}
+	switch auth.Type {
+	case BasicHttpAuthType:
+		auth.Password, err = getSecret.GetSecret(Input(authObj), "password_secret", false)
+	case BearerHttpAuthType:
+		auth.Token, err = getSecret.GetSecret(Input(authObj), "token_secret", true)
+	}
+	if err != nil {
+		err = fmt.Errorf("auth: %w", err)
+		return
+	}
+	return
+}
+
+// parseExpectedStatus accepts a status code, a class like "2xx"
+// or a list of them
+func (httpAction HttpAction) parseExpectedStatus(rawVal interface{}) (expectedStatus []string, err error) {
+	var (
+		vals []interface{}
+	)
+	switch typedVal := rawVal.(type) {
+	case nil:
+		return
+	case []interface{}:
+		vals = typedVal
+	default:
+		vals = []interface{}{typedVal}
+	}
+	for _, val := range vals {
+		status := strings.ToLower(fmt.Sprint(val))
+		if len(status) != 3 || status[0] < '1' || status[0] > '5' {
+			err = fmt.Errorf("Invalid expected status %v", val)
+			return
+		}
+		if status[1:] != "xx" {
+			if _, convErr := strconv.Atoi(status); convErr != nil {
+				err = fmt.Errorf("Invalid expected status %v", val)
+				return
+			}
+		}
+		expectedStatus = append(expectedStatus, status)
+	}
+	return
+}
+
+func (httpReq *HttpActionReq) isExpectedStatus(statusCode int) bool {
+	if len(httpReq.ExpectedStatus) == 0 {
+		return true
+	}
+	status := strconv.Itoa(statusCode)
+	for _, expected := range httpReq.ExpectedStatus {
+		if expected == status || (strings.HasSuffix(expected, "xx") && expected[0] == status[0]) {
+			return true
+		}
+	}
+	return false
+}
 
-		reqBody  io.Reader
+func (httpReq *HttpActionReq) body() (reqBody io.Reader, contentType string, err error) {
+	var (
 		payloadB []byte
+	)
+	if httpReq.RequestBody == nil {
+		return
+	}
+	switch httpReq.BodyType {
+	case FormHttpBodyType:
+		var (
+			form map[string][]string
+		)
+		if form, err = (Input{"request_body": httpReq.RequestBody}).GetStringMap("request_body"); err != nil {
+			return
+		}
+		reqBody = strings.NewReader(url.Values(form).Encode())
+		contentType = "application/x-www-form-urlencoded"
+	case TextHttpBodyType, RawHttpBodyType:
+		str, isString := httpReq.RequestBody.(string)
+		if !isString {
+			err = fmt.Errorf("request_body should be a string for the %s body type", httpReq.BodyType)
+			return
+		}
+		reqBody = strings.NewReader(str)
+		contentType = "text/plain; charset=utf-8"
+		if httpReq.BodyType == RawHttpBodyType {
+			contentType = "application/octet-stream"
+		}
+	default:
+		if payloadB, err = json.Marshal(httpReq.RequestBody); err != nil {
+			return
+		}
+		reqBody = bytes.NewBuffer(payloadB)
+		contentType = "application/json"
+	}
+	return
+}
+
+// NewRequest builds the request with its query, headers, body and auth
+func (httpReq *HttpActionReq) NewRequest(ctx context.Context) (req *http.Request, err error) {
+	var (
+		reqUrl      *url.URL
+		reqBody     io.Reader
+		contentType string
+	)
+	if reqUrl, err = url.Parse(httpReq.Url); err != nil {
+		return
+	}
+	if len(httpReq.Query) > 0 {
+		query := reqUrl.Query()
+		for key, vals := range httpReq.Query {
+			for _, val := range vals {
+				query.Add(key, val)
+			}
+		}
+		reqUrl.RawQuery = query.Encode()
+	}
+	if reqBody, contentType, err = httpReq.body(); err != nil {
+		return
+	}
+	if req, err = http.NewRequestWithContext(ctx, string(httpReq.Method), reqUrl.String(), reqBody); err != nil {
+		return
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	for key, vals := range httpReq.Headers {
+		req.Header[key] = vals
+	}
+	if httpReq.Auth != nil {
+		switch httpReq.Auth.Type {
+		case BasicHttpAuthType:
+			req.SetBasicAuth(httpReq.Auth.Username, httpReq.Auth.Password)
+		case BearerHttpAuthType:
+			req.Header.Set("Authorization", "Bearer "+httpReq.Auth.Token)
+		}
+	}
+	return
+}
+
+// client returns a copy of the shared client with the request's redirect
+// policy. The shared transport is used unless the request has its own TLS
+// or proxy configuration.
+func (httpReq *HttpActionReq) client() (client *http.Client, err error) {
+	reqClient := *httpClient
+	client = &reqClient
+	// The deadline of the request's context applies instead, which can be
+	// longer than the shared client's timeout and covers every page
+	client.Timeout = 0
+	if httpReq.TLS != nil || httpReq.Proxy != nil {
+		if client.Transport, err = httpTransports.Get(httpReq.TLS, httpReq.Proxy); err != nil {
+			return
+		}
+	}
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if !httpReq.FollowRedirects {
+			return http.ErrUseLastResponse
+		}
+		if len(via) >= httpReq.MaxRedirects {
+			return fmt.Errorf("stopped after %d redirects", httpReq.MaxRedirects)
+		}
+		return nil
+	}
+	return
+}
+
+// do sends the request. Requests using OAuth2 are authorized with the cached
+// token, which is refreshed and the request retried once when it's rejected.
+func (httpReq *HttpActionReq) do(ctx context.Context, client *http.Client) (resp *http.Response, err error) {
+	var (
+		req *http.Request
+	)
+	for attempt := 0; attempt < 2; attempt++ {
+		if req, err = httpReq.NewRequest(ctx); err != nil {
+			return
+		}
+		isOAuth2 := httpReq.Auth != nil && httpReq.Auth.Type == OAuth2HttpAuthType
+		if isOAuth2 {
+			var accessToken string
+			if accessToken, err = oauth2Tokens.Get(ctx, client, httpReq.Auth.OAuth2); err != nil {
+				return
+			}
+			// The token isn't part of the output even when the server echoes it
+			redactSecret(ctx, accessToken)
+			req.Header.Set("Authorization", "Bearer "+accessToken)
+		}
+		if httpReq.Signing != nil {
+			if err = httpReq.Signing.Sign(req); err != nil {
+				return
+			}
+		}
+		if resp, err = client.Do(req); err != nil || !isOAuth2 || resp.StatusCode != http.StatusUnauthorized {
+			return
+		}
+		oauth2Tokens.Invalidate(httpReq.Auth.OAuth2)
+		if attempt == 0 {
+			resp.Body.Close()
+		}
+	}
+	return
+}
+
+func (httpAction HttpAction) Execute(input Input) (output Output, err error) {
+	return httpAction.ExecuteContext(context.Background(), input, nil)
+}
+
+// ExecuteWithSecrets executes the request without a deadline other than
+// the request's timeout
+func (httpAction HttpAction) ExecuteWithSecrets(input Input, getSecret SecretGetter) (output Output, err error) {
+	return httpAction.ExecuteContext(context.Background(), input, getSecret)
+}
+
+// ExecuteContext executes the request, and the pages following it, until
+// the context is done. The request's timeout applies on top of the job's
+// timeout. The secrets are only read to sign the request and to fetch
+// OAuth2 tokens.
+func (httpAction HttpAction) ExecuteContext(ctx context.Context, input Input, getSecret SecretGetter) (output Output, err error) {
+	var (
+		client *http.Client
 
 		httpReq *HttpActionReq
 	)
 	if httpReq, err = httpAction.Validate(input); err != nil {
 		return
 	}
+	if httpReq.Auth != nil {
+		if err = httpAction.resolveAuthSecrets(input, httpReq.Auth, getSecret); err != nil {
+			return
+		}
+	}
+	if err = httpReq.TLS.resolveClientKey(input, getSecret); err != nil {
+		return
+	}
+	if httpReq.Signing, err = httpAction.parseSigning(input, getSecret); err != nil {
+		return
+	}
+	if httpReq.Signing != nil && httpReq.Signing.Type == AwsSigV4HttpSigningType && httpReq.Auth != nil {
+		err = fmt.Errorf("auth can't be used along with AWS SigV4 signing")
+		return
+	}
 
-	if payloadB, err = json.Marshal(httpReq.RequestBody); err != nil {
+	reqCtx := ctx
+	timeout := httpReq.Timeout
+	if _, hasDeadline := ctx.Deadline(); timeout == 0 && !hasDeadline {
+		timeout = defaultHttpTimeout
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		reqCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	if client, err = httpReq.client(); err != nil {
 		return
 	}
-	reqBody = bytes.NewBuffer(payloadB)
-	if req, err = http.NewRequest(string(httpReq.Method), httpReq.Url, reqBody); err != nil {
+	if httpReq.Pagination != nil {
+		output, err = httpAction.executePaginated(reqCtx, client, httpReq)
+	} else {
+		output, err = httpAction.executeOnce(reqCtx, client, httpReq)
+	}
+	if err != nil {
+		output = nil
+		// The job's context is done when the job timed out or was cancelled
+		if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+			err = fmt.Errorf("request timed out after %s: %w", timeout, err)
+		}
 		return
 	}
-	req.Header.Set("Content-Type", "application/json")
+	return
+}
 
-	if resp, err = httpClient.Do(req); err != nil {
+func (httpAction HttpAction) executeOnce(ctx context.Context, client *http.Client, httpReq *HttpActionReq) (output Output, err error) {
+	var (
+		resp *http.Response
+	)
+	if resp, err = httpReq.do(ctx, client); err != nil {
 		return
 	}
 	defer resp.Body.Close()
@@ -84,33 +547,57 @@ func (httpAction HttpAction) Execute(input Input) (output Output, err error) {
 	if output, err = httpAction.convertResp(resp); err != nil {
 		return
 	}
+	if err = httpReq.checkStatus(resp); err != nil {
+		return
+	}
+	return
+}
+
+func (httpReq *HttpActionReq) checkStatus(resp *http.Response) (err error) {
+	if !httpReq.isExpectedStatus(resp.StatusCode) {
+		err = fmt.Errorf("unexpected status %d, expected %s", resp.StatusCode, strings.Join(httpReq.ExpectedStatus, ", "))
+		return
+	}
 	return
 }
 
+// parseRespBody decodes JSON bodies and returns other bodies as a string.
+// Empty bodies are nil.
+func parseRespBody(respBody []byte) (respVal interface{}) {
+	if len(bytes.TrimSpace(respBody)) == 0 {
+		return
+	}
+	if json.Unmarshal(respBody, &respVal) != nil {
+		respVal = string(respBody)
+		return
+	}
+	return
+}
+
+// convertResp preserves the structure of the JSON response so that nested
+// objects, arrays, booleans and nulls can be used by later jobs. Responses
+// which aren't JSON objects are set under the "body" key, as a string when
+// they aren't JSON at all.
 func (httpAction HttpAction) convertResp(resp *http.Response) (output Output, err error) {
 	var (
-		respMap  map[string]interface{}
 		respBody []byte
 	)
 	if respBody, err = io.ReadAll(resp.Body); err != nil {
 		return
 	}
-	respMap = make(map[string]interface{})
-	if err = json.Unmarshal(respBody, &respMap); err != nil {
-		return
-	}
 	output = make(Output)
 	output["status"] = strconv.Itoa(resp.StatusCode)
+	respVal := parseRespBody(respBody)
+	if respVal == nil {
+		return
+	}
+	respMap, isMap := respVal.(map[string]interface{})
+	if !isMap {
+		output["body"] = respVal
+		return
+	}
 	for mKey, mVal := range respMap {
-		valType := reflect.TypeOf(mVal).Kind()
-		switch valType {
-		case reflect.String:
-			output[mKey] = mVal.(string)
-		case reflect.Int:
-			output[mKey] = strconv.Itoa(mVal.(int))
-		case reflect.Float64:
-			output[mKey] = strconv.Itoa(int(mVal.(float64)))
-		}
+		output[mKey] = mVal
 	}
 
 	return
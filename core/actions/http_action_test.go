@@ -1,10 +1,14 @@
 package actions
 
 import (
+	"context"
 	"encoding/json"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -69,11 +73,8 @@ func TestHttpAction_Validate_MissingUrl(t *testing.T) {
 		"method": "GET",
 	}
 
-	// This will panic due to type assertion on nil value
-	// Documenting current behavior - should be fixed with proper error handling
-	assert.Panics(t, func() {
-		httpAction.Validate(input)
-	}, "Validate panics with missing URL (should return error instead)")
+	_, err := httpAction.Validate(input)
+	assert.Error(t, err, "Validate should error with missing URL")
 }
 
 func TestHttpAction_Validate_MissingMethod(t *testing.T) {
@@ -82,10 +83,8 @@ func TestHttpAction_Validate_MissingMethod(t *testing.T) {
 		"url": "https://example.com/api",
 	}
 
-	// This will panic due to type assertion on nil value
-	assert.Panics(t, func() {
-		httpAction.Validate(input)
-	}, "Validate panics with missing method (should return error instead)")
+	_, err := httpAction.Validate(input)
+	assert.Error(t, err, "Validate should error with missing method")
 }
 
 // ==========================================================
@@ -114,7 +113,7 @@ func TestHttpAction_Execute_GetRequest(t *testing.T) {
 	assert.NotNil(t, output, "Output should not be nil")
 	assert.Equal(t, "200", output["status"], "Status should be 200")
 	assert.Equal(t, "success", output["result"], "Should parse string field")
-	assert.Equal(t, "42", output["id"], "Should convert number to string")
+	assert.Equal(t, float64(42), output["id"], "Should preserve number")
 }
 
 func TestHttpAction_Execute_PostRequest(t *testing.T) {
@@ -151,7 +150,7 @@ func TestHttpAction_Execute_PostRequest(t *testing.T) {
 	assert.NotNil(t, output, "Output should not be nil")
 	assert.Equal(t, "200", output["status"], "Status should be 200")
 	assert.Equal(t, "true", output["created"], "Should parse response field")
-	assert.Equal(t, "123", output["id"], "Should convert response number")
+	assert.Equal(t, float64(123), output["id"], "Should preserve response number")
 }
 
 func TestHttpAction_Execute_StatusCode(t *testing.T) {
@@ -229,8 +228,9 @@ func TestHttpAction_Execute_NonJsonResponse(t *testing.T) {
 	}
 
 	output, err := httpAction.Execute(input)
-	assert.Error(t, err, "Execute should error with non-JSON response")
-	assert.Nil(t, output, "Output should be nil when JSON parsing fails")
+	assert.NoError(t, err, "Execute should not error with non-JSON response")
+	assert.Equal(t, "200", output["status"], "Should have status")
+	assert.Equal(t, "This is plain text, not JSON", output["body"], "Should set the raw body")
 }
 
 func TestHttpAction_Execute_EmptyResponse(t *testing.T) {
@@ -255,15 +255,17 @@ func TestHttpAction_Execute_EmptyResponse(t *testing.T) {
 }
 
 func TestHttpAction_Execute_ComplexJsonResponse(t *testing.T) {
-	// Create test server with response containing only supported types
-	// Note: convertResp only handles string, int, and float64
-	// Other types (bool, null, arrays, objects) cause panics in type assertions
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"string_field": "test",
 			"int_field":    float64(42),
 			"float_field":  float64(3.14),
+			"bool_field":   true,
+			"null_field":   nil,
+			"data": map[string]interface{}{
+				"items": []interface{}{map[string]interface{}{"id": float64(1)}},
+			},
 		})
 	}))
 	defer server.Close()
@@ -281,11 +283,32 @@ func TestHttpAction_Execute_ComplexJsonResponse(t *testing.T) {
 	// Verify converted fields
 	assert.Equal(t, "200", output["status"], "Should have status")
 	assert.Equal(t, "test", output["string_field"], "Should convert string")
-	assert.Equal(t, "42", output["int_field"], "Should convert int to string")
-	assert.Equal(t, "3", output["float_field"], "Should convert float to int string")
+	assert.Equal(t, float64(42), output["int_field"], "Should preserve int")
+	assert.Equal(t, float64(3.14), output["float_field"], "Should preserve float")
+	assert.Equal(t, true, output["bool_field"], "Should preserve bool")
+	assert.Contains(t, output, "null_field", "Should preserve null")
+	assert.Equal(t, map[string]interface{}{
+		"items": []interface{}{map[string]interface{}{"id": float64(1)}},
+	}, output["data"], "Should preserve nested objects and arrays")
+}
+
+func TestHttpAction_Execute_NonObjectJsonResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode([]interface{}{"a", "b"})
+	}))
+	defer server.Close()
 
-	// Current implementation only handles string, int, and float64
-	// bool, null, arrays, and objects will cause type assertion panics
+	httpAction := HttpAction{}
+	input := Input{
+		"url":    server.URL,
+		"method": "GET",
+	}
+
+	output, err := httpAction.Execute(input)
+	assert.NoError(t, err, "Execute should not error")
+	assert.Equal(t, "200", output["status"], "Should have status")
+	assert.Equal(t, []interface{}{"a", "b"}, output["body"], "Should set the response under body")
 }
 
 // ==========================================================
@@ -317,8 +340,8 @@ func TestHttpAction_convertResp_TypeConversions(t *testing.T) {
 			},
 			expectedOutput: map[string]interface{}{
 				"status": "200",
-				"count":  "42",
-				"total":  "100",
+				"count":  float64(42),
+				"total":  float64(100),
 			},
 		},
 		{
@@ -329,8 +352,8 @@ func TestHttpAction_convertResp_TypeConversions(t *testing.T) {
 			},
 			expectedOutput: map[string]interface{}{
 				"status": "200",
-				"price":  "19",
-				"rating": "4",
+				"price":  float64(19.99),
+				"rating": float64(4.5),
 			},
 		},
 		{
@@ -343,8 +366,8 @@ func TestHttpAction_convertResp_TypeConversions(t *testing.T) {
 			expectedOutput: map[string]interface{}{
 				"status": "200",
 				"name":   "product",
-				"count":  "10",
-				"price":  "29",
+				"count":  float64(10),
+				"price":  float64(29.99),
 			},
 		},
 	}
@@ -412,7 +435,209 @@ func TestHttpAction_Integration_RealWorldScenario(t *testing.T) {
 	output, err := httpAction.Execute(input)
 	assert.NoError(t, err, "Integration test should succeed")
 	assert.Equal(t, "201", output["status"], "Should return 201 Created")
-	assert.Equal(t, "12345", output["id"], "Should return created resource ID")
+	assert.Equal(t, float64(12345), output["id"], "Should return created resource ID")
 	assert.Equal(t, "Resource created successfully", output["message"], "Should return success message")
 	assert.Equal(t, "true", output["success"], "Should return success flag")
 }
+
+// ==========================================================
+// TestHttpAction_RequestOptions
+
+func TestHttpAction_Execute_HeadersQueryAndBearerAuth(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "v1", r.Header.Get("X-Api-Version"))
+		assert.Equal(t, "Bearer abc", r.Header.Get("Authorization"))
+		assert.Equal(t, "existing", r.URL.Query().Get("keep"))
+		assert.Equal(t, []string{"a", "b"}, r.URL.Query()["tag"])
+		assert.Equal(t, "10", r.URL.Query().Get("limit"))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	output, err := HttpAction{}.ExecuteWithSecrets(Input{
+		"url":     server.URL + "?keep=existing",
+		"method":  "get",
+		"headers": map[string]interface{}{"X-Api-Version": "v1"},
+		"query":   map[string]interface{}{"tag": []interface{}{"a", "b"}, "limit": float64(10)},
+		"auth":    map[string]interface{}{"type": "bearer", "token_secret": "API_TOKEN"},
+	}, testSecretGetter(map[string]string{"API_TOKEN": "abc"}))
+	require.NoError(t, err)
+	assert.Equal(t, Output{"status": "204"}, output, "Empty responses should only have the status")
+}
+
+func TestHttpAction_Execute_Bodies(t *testing.T) {
+	testCases := []struct {
+		name                string
+		input               Input
+		expectedContentType string
+		expectedBody        string
+	}{
+		{
+			name:                "Form body with basic auth",
+			input:               Input{"method": "POST", "body_type": "form", "request_body": map[string]interface{}{"name": "jane doe"}, "auth": map[string]interface{}{"type": "basic", "username": "user", "password_secret": "API_PASSWORD"}},
+			expectedContentType: "application/x-www-form-urlencoded",
+			expectedBody:        "name=jane+doe",
+		},
+		{
+			name:                "Text body",
+			input:               Input{"method": "PUT", "body_type": "text", "request_body": "hello"},
+			expectedContentType: "text/plain; charset=utf-8",
+			expectedBody:        "hello",
+		},
+		{
+			name:                "Raw body with custom content type",
+			input:               Input{"method": "PATCH", "body_type": "raw", "request_body": "<a/>", "headers": map[string]interface{}{"Content-Type": "application/xml"}},
+			expectedContentType: "application/xml",
+			expectedBody:        "<a/>",
+		},
+		{
+			name:                "JSON body by default",
+			input:               Input{"method": "DELETE", "request_body": map[string]interface{}{"id": float64(1)}},
+			expectedContentType: "application/json",
+			expectedBody:        `{"id":1}`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, tc.input["method"], r.Method)
+				assert.Equal(t, tc.expectedContentType, r.Header.Get("Content-Type"))
+				body, _ := io.ReadAll(r.Body)
+				assert.Equal(t, tc.expectedBody, string(body))
+				if tc.input["auth"] != nil {
+					username, password, ok := r.BasicAuth()
+					assert.True(t, ok)
+					assert.Equal(t, "user", username)
+					assert.Equal(t, "pass", password)
+				}
+			}))
+			defer server.Close()
+
+			tc.input["url"] = server.URL
+			_, err := HttpAction{}.ExecuteWithSecrets(tc.input, testSecretGetter(map[string]string{"API_PASSWORD": "pass"}))
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestHttpAction_Execute_ExpectedStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("down"))
+	}))
+	defer server.Close()
+
+	testCases := []struct {
+		name           string
+		expectedStatus interface{}
+		shouldError    bool
+	}{
+		{name: "Any status without expectations", expectedStatus: nil},
+		{name: "Exact status", expectedStatus: float64(503)},
+		{name: "Status class", expectedStatus: []interface{}{"2xx", "5xx"}},
+		{name: "Unexpected status", expectedStatus: "2xx", shouldError: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			output, err := HttpAction{}.Execute(Input{
+				"url":             server.URL,
+				"method":          "GET",
+				"expected_status": tc.expectedStatus,
+			})
+			if tc.shouldError {
+				assert.ErrorContains(t, err, "unexpected status 503")
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, "503", output["status"])
+		})
+	}
+}
+
+func TestHttpAction_Execute_RedirectPolicy(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/old" {
+			http.Redirect(w, r, "/new", http.StatusFound)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"path": r.URL.Path})
+	}))
+	defer server.Close()
+
+	output, err := HttpAction{}.Execute(Input{"url": server.URL + "/old", "method": "GET"})
+	require.NoError(t, err)
+	assert.Equal(t, "/new", output["path"], "Redirects are followed by default")
+
+	output, err = HttpAction{}.Execute(Input{"url": server.URL + "/old", "method": "GET", "follow_redirects": false})
+	require.NoError(t, err)
+	assert.Equal(t, "302", output["status"], "The redirect response should be returned")
+}
+
+func TestHttpAction_Execute_Timeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	_, err := HttpAction{}.Execute(Input{"url": server.URL, "method": "GET", "timeout_in_secs": 0.05})
+	assert.ErrorContains(t, err, "timed out")
+}
+
+// deadlineTransport records the deadline of the requests' context
+type deadlineTransport struct {
+	deadline time.Time
+}
+
+func (transport *deadlineTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	transport.deadline, _ = req.Context().Deadline()
+	return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader("")), Request: req}, nil
+}
+
+func TestHttpAction_Execute_TimeoutAboveSharedClientTimeout(t *testing.T) {
+	transport := &deadlineTransport{}
+	prevTransport := httpClient.Transport
+	httpClient.Transport = transport
+	defer func() { httpClient.Transport = prevTransport }()
+
+	httpReq := &HttpActionReq{Timeout: 45 * time.Second}
+	client, err := httpReq.client()
+	require.NoError(t, err)
+	assert.Zero(t, client.Timeout, "The shared client's timeout shouldn't cut the request's one")
+
+	start := time.Now()
+	_, err = HttpAction{}.Execute(Input{"url": "http://example.com", "method": "GET", "timeout_in_secs": float64(45)})
+	require.NoError(t, err)
+	assert.WithinDuration(t, start.Add(45*time.Second), transport.deadline, 5*time.Second)
+
+	// The job's timeout applies when the request has none
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	jobDeadline, _ := ctx.Deadline()
+	_, err = HttpAction{}.ExecuteContext(ctx, Input{"url": "http://example.com", "method": "GET"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, jobDeadline, transport.deadline)
+}
+
+func TestHttpAction_Validate_InvalidOptions(t *testing.T) {
+	testCases := []struct {
+		name  string
+		input Input
+	}{
+		{name: "Unsupported method", input: Input{"method": "CONNECT"}},
+		{name: "Unsupported body type", input: Input{"method": "POST", "body_type": "xml"}},
+		{name: "Unsupported auth type", input: Input{"method": "GET", "auth": map[string]interface{}{"type": "digest"}}},
+		{name: "Bearer auth without token", input: Input{"method": "GET", "auth": map[string]interface{}{"type": "bearer"}}},
+		{name: "Plaintext bearer token", input: Input{"method": "GET", "auth": map[string]interface{}{"type": "bearer", "token": "abc"}}},
+		{name: "Plaintext basic password", input: Input{"method": "GET", "auth": map[string]interface{}{"type": "basic", "username": "user", "password": "pass"}}},
+		{name: "Headers which aren't an object", input: Input{"method": "GET", "headers": "X-A: b"}},
+		{name: "Invalid expected status", input: Input{"method": "GET", "expected_status": "ok"}},
+		{name: "Negative timeout", input: Input{"method": "GET", "timeout_in_secs": float64(-1)}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.input["url"] = "https://example.com"
+			_, err := HttpAction{}.Validate(tc.input)
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,253 @@
+package actions
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	OAuth2HttpAuthType = HttpAuthT("oauth2")
+
+	// OAuth2 Client Auth Styles
+	// HeaderOAuth2AuthStyle sends the client credentials via basic auth
+	HeaderOAuth2AuthStyle = OAuth2AuthStyleT("header")
+	// BodyOAuth2AuthStyle sends the client credentials in the form body
+	BodyOAuth2AuthStyle = OAuth2AuthStyleT("body")
+
+	// oauth2ExpiryDelta refreshes tokens slightly before they expire
+	oauth2ExpiryDelta = 30 * time.Second
+)
+
+type (
+	OAuth2AuthStyleT string
+
+	// OAuth2ClientCredentials configures fetching tokens with the OAuth2
+	// client credentials grant
+	OAuth2ClientCredentials struct {
+		TokenUrl     string           `json:"token_url"`
+		ClientID     string           `json:"client_id"`
+		ClientSecret string           `json:"client_secret"`
+		Scopes       []string         `json:"scopes"`
+		Audience     string           `json:"audience"`
+		AuthStyle    OAuth2AuthStyleT `json:"auth_style"`
+	}
+
+	oauth2Token struct {
+		AccessToken string
+		// ExpiresAt is zero when the token server didn't set an expiry,
+		// the token is then used until it's rejected
+		ExpiresAt time.Time
+	}
+
+	// oauth2TokenCache keeps the tokens fetched for each set of client
+	// credentials so that they're reused across executions until expiry
+	oauth2TokenCache struct {
+		mu     sync.Mutex
+		tokens map[string]*oauth2Token
+	}
+)
+
+var (
+	oauth2Tokens = &oauth2TokenCache{
+		tokens: make(map[string]*oauth2Token),
+	}
+)
+
+// parseOAuth2 parses the oauth2 auth object, eg. {"type": "oauth2", "token_url": "https://idp/token",
+// "client_id": "id", "client_secret_secret": "NAME", "scopes": ["read"]}. The client secret is read
+// from the user's secrets while executing, see resolveOAuth2Secret.
+func (httpAction HttpAction) parseOAuth2(authInput Input) (credentials *OAuth2ClientCredentials, err error) {
+	var (
+		authStyle string
+	)
+	credentials = &OAuth2ClientCredentials{}
+	if credentials.TokenUrl, err = authInput.GetString("token_url", true); err != nil {
+		return
+	}
+	if credentials.ClientID, err = authInput.GetString("client_id", true); err != nil {
+		return
+	}
+	// The secret would be stored along with the job and its executions
+	if _, isPresent := authInput["client_secret"]; isPresent {
+		err = fmt.Errorf("client_secret can't be part of the input, set client_secret_secret to the name of a secret")
+		return
+	}
+	if _, err = authInput.GetString("client_secret_secret", true); err != nil {
+		return
+	}
+	if credentials.Audience, err = authInput.GetString("audience", false); err != nil {
+		return
+	}
+	switch scopes := authInput["scopes"].(type) {
+	case nil:
+	case string:
+		credentials.Scopes = strings.Fields(scopes)
+	case []interface{}:
+		for _, scope := range scopes {
+			scopeStr, isString := scope.(string)
+			if !isString {
+				err = fmt.Errorf("scopes should be a list of strings")
+				return
+			}
+			credentials.Scopes = append(credentials.Scopes, scopeStr)
+		}
+	default:
+		err = fmt.Errorf("scopes should be a list of strings")
+		return
+	}
+	if authStyle, err = authInput.GetString("auth_style", false); err != nil {
+		return
+	}
+	credentials.AuthStyle = OAuth2AuthStyleT(authStyle)
+	switch credentials.AuthStyle {
+	case "":
+		credentials.AuthStyle = HeaderOAuth2AuthStyle
+	case HeaderOAuth2AuthStyle, BodyOAuth2AuthStyle:
+	default:
+		err = fmt.Errorf("Unsupported auth_style %s", authStyle)
+		return
+	}
+	if _, err = url.ParseRequestURI(credentials.TokenUrl); err != nil {
+		err = fmt.Errorf("Invalid token_url %s", credentials.TokenUrl)
+		return
+	}
+	return
+}
+
+// resolveOAuth2Secret reads the client secret of the oauth2 auth from the
+// secret named by client_secret_secret
+func (httpAction HttpAction) resolveOAuth2Secret(input Input, credentials *OAuth2ClientCredentials, getSecret SecretGetter) (err error) {
+	var (
+		authObj map[string]interface{}
+	)
+	if authObj, err = input.GetObject("auth"); err != nil {
+		return
+	}
+	if credentials.ClientSecret, err = getSecret.GetSecret(Input(authObj), "client_secret_secret", true); err != nil {
+		err = fmt.Errorf("auth: %w", err)
+		return
+	}
+	return
+}
+
+func (credentials *OAuth2ClientCredentials) cacheKey() string {
+	keyB, _ := json.Marshal(credentials)
+	hash := sha256.Sum256(keyB)
+	return hex.EncodeToString(hash[:])
+}
+
+// fetchToken requests a new token from the token URL
+func (credentials *OAuth2ClientCredentials) fetchToken(ctx context.Context, client *http.Client) (token *oauth2Token, err error) {
+	var (
+		req       *http.Request
+		resp      *http.Response
+		respBody  []byte
+		tokenResp struct {
+			AccessToken string      `json:"access_token"`
+			ExpiresIn   json.Number `json:"expires_in"`
+		}
+	)
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(credentials.Scopes) > 0 {
+		form.Set("scope", strings.Join(credentials.Scopes, " "))
+	}
+	if credentials.Audience != "" {
+		form.Set("audience", credentials.Audience)
+	}
+	if credentials.AuthStyle == BodyOAuth2AuthStyle {
+		form.Set("client_id", credentials.ClientID)
+		form.Set("client_secret", credentials.ClientSecret)
+	}
+	if req, err = http.NewRequestWithContext(ctx, http.MethodPost, credentials.TokenUrl, strings.NewReader(form.Encode())); err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if credentials.AuthStyle == HeaderOAuth2AuthStyle {
+		req.SetBasicAuth(url.QueryEscape(credentials.ClientID), url.QueryEscape(credentials.ClientSecret))
+	}
+
+	if resp, err = client.Do(req); err != nil {
+		err = fmt.Errorf("failed to fetch OAuth2 token: %w", err)
+		return
+	}
+	defer resp.Body.Close()
+	if respBody, err = io.ReadAll(io.LimitReader(resp.Body, 1<<20)); err != nil {
+		return
+	}
+	if resp.StatusCode != http.StatusOK {
+		err = fmt.Errorf("failed to fetch OAuth2 token: token endpoint returned status %d", resp.StatusCode)
+		return
+	}
+	if err = json.Unmarshal(respBody, &tokenResp); err != nil {
+		err = fmt.Errorf("failed to parse OAuth2 token response: %w", err)
+		return
+	}
+	if tokenResp.AccessToken == "" {
+		err = fmt.Errorf("OAuth2 token response has no access_token")
+		return
+	}
+	token = &oauth2Token{AccessToken: tokenResp.AccessToken}
+	if expiresIn, convErr := tokenResp.ExpiresIn.Int64(); convErr == nil && expiresIn > 0 {
+		token.ExpiresAt = time.Now().Add(time.Duration(expiresIn) * time.Second)
+	}
+	return
+}
+
+func (token *oauth2Token) isValid() bool {
+	return token.ExpiresAt.IsZero() || time.Now().Add(oauth2ExpiryDelta).Before(token.ExpiresAt)
+}
+
+// removeExpiredTokens drops the tokens which expired so that a cache doesn't
+// grow with the credentials of jobs which stopped running. The cache
+// should be locked.
+func removeExpiredTokens(tokens map[string]*oauth2Token) {
+	now := time.Now()
+	for key, token := range tokens {
+		if !token.ExpiresAt.IsZero() && now.After(token.ExpiresAt) {
+			delete(tokens, key)
+		}
+	}
+}
+
+// Get returns the cached token for the credentials, fetching a new one
+// when it's missing or about to expire
+func (cache *oauth2TokenCache) Get(ctx context.Context, client *http.Client, credentials *OAuth2ClientCredentials) (accessToken string, err error) {
+	var (
+		token *oauth2Token
+	)
+	key := credentials.cacheKey()
+	cache.mu.Lock()
+	token = cache.tokens[key]
+	cache.mu.Unlock()
+	if token != nil && token.isValid() {
+		accessToken = token.AccessToken
+		return
+	}
+
+	if token, err = credentials.fetchToken(ctx, client); err != nil {
+		return
+	}
+	cache.mu.Lock()
+	removeExpiredTokens(cache.tokens)
+	cache.tokens[key] = token
+	cache.mu.Unlock()
+	accessToken = token.AccessToken
+	return
+}
+
+// Invalidate drops the cached token for the credentials, eg. after it was rejected
+func (cache *oauth2TokenCache) Invalidate(credentials *OAuth2ClientCredentials) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	delete(cache.tokens, credentials.cacheKey())
+}
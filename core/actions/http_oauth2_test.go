@@ -0,0 +1,209 @@
+package actions
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestTokenServer issues token-1, token-2... and counts the tokens issued
+func newTestTokenServer(t *testing.T, expiresIn int, fetchCount *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		assert.Equal(t, "client_credentials", r.PostForm.Get("grant_type"))
+		assert.Equal(t, "read write", r.PostForm.Get("scope"))
+		clientID, clientSecret, ok := r.BasicAuth()
+		if !ok {
+			clientID, clientSecret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+		}
+		if clientID != "cronny" || clientSecret != "s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		count := atomic.AddInt32(fetchCount, 1)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": fmt.Sprintf("token-%d", count),
+			"token_type":   "Bearer",
+			"expires_in":   expiresIn,
+		})
+	}))
+}
+
+func oauth2Input(apiUrl, tokenUrl string) Input {
+	return Input{
+		"url":    apiUrl,
+		"method": "GET",
+		"auth": map[string]interface{}{
+			"type":                 "oauth2",
+			"token_url":            tokenUrl,
+			"client_id":            "cronny",
+			"client_secret_secret": "OAUTH2_SECRET",
+			"scopes":               []interface{}{"read", "write"},
+		},
+	}
+}
+
+// oauth2SecretGetter has the client secret the token server expects
+var oauth2SecretGetter = testSecretGetter(map[string]string{"OAUTH2_SECRET": "s3cret", "WRONG_SECRET": "wrong"})
+
+func resetOAuth2Tokens() {
+	oauth2Tokens = &oauth2TokenCache{tokens: make(map[string]*oauth2Token)}
+}
+
+// ==========================================================
+// TestHttpAction_OAuth2
+
+func TestHttpAction_Execute_OAuth2CachesToken(t *testing.T) {
+	resetOAuth2Tokens()
+	var fetchCount int32
+	tokenServer := newTestTokenServer(t, 3600, &fetchCount)
+	defer tokenServer.Close()
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer token-1", r.Header.Get("Authorization"))
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": true})
+	}))
+	defer apiServer.Close()
+
+	for idx := 0; idx < 3; idx++ {
+		output, err := HttpAction{}.ExecuteWithSecrets(oauth2Input(apiServer.URL, tokenServer.URL), oauth2SecretGetter)
+		require.NoError(t, err)
+		assert.Equal(t, true, output["ok"])
+	}
+	assert.Equal(t, int32(1), fetchCount, "The token should be reused until it expires")
+}
+
+func TestHttpAction_Execute_OAuth2RefreshesExpiringToken(t *testing.T) {
+	resetOAuth2Tokens()
+	var fetchCount int32
+	// Tokens expiring within the expiry delta are refreshed
+	tokenServer := newTestTokenServer(t, 10, &fetchCount)
+	defer tokenServer.Close()
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer apiServer.Close()
+
+	for idx := 0; idx < 2; idx++ {
+		_, err := HttpAction{}.ExecuteWithSecrets(oauth2Input(apiServer.URL, tokenServer.URL), oauth2SecretGetter)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, int32(2), fetchCount)
+}
+
+func TestHttpAction_Execute_OAuth2RefreshesOnUnauthorized(t *testing.T) {
+	resetOAuth2Tokens()
+	var fetchCount int32
+	tokenServer := newTestTokenServer(t, 3600, &fetchCount)
+	defer tokenServer.Close()
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The first token has been revoked
+		if r.Header.Get("Authorization") != "Bearer token-2" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		// The token is echoed back but shouldn't end up in the output
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"headers": map[string]interface{}{"authorization": r.Header.Get("Authorization")},
+		})
+	}))
+	defer apiServer.Close()
+
+	// The tokens are redacted from the output along with the user's secrets
+	var redacted []string
+	ctx := ContextWithSecretRedactor(context.Background(), func(value string) {
+		redacted = append(redacted, value)
+	})
+	output, err := HttpAction{}.ExecuteContext(ctx, oauth2Input(apiServer.URL, tokenServer.URL), oauth2SecretGetter)
+	require.NoError(t, err)
+	assert.Equal(t, "200", output["status"])
+	assert.Equal(t, int32(2), fetchCount)
+	assert.Equal(t, []string{"token-1", "token-2"}, redacted)
+}
+
+func TestOAuth2TokenCache_RemovesExpiredTokens(t *testing.T) {
+	resetOAuth2Tokens()
+	var fetchCount int32
+	tokenServer := newTestTokenServer(t, 3600, &fetchCount)
+	defer tokenServer.Close()
+
+	expired := &OAuth2ClientCredentials{TokenUrl: tokenServer.URL, ClientID: "expired"}
+	oauth2Tokens.tokens[expired.cacheKey()] = &oauth2Token{AccessToken: "old", ExpiresAt: time.Now().Add(-time.Minute)}
+	credentials := &OAuth2ClientCredentials{
+		TokenUrl: tokenServer.URL, ClientID: "cronny", ClientSecret: "s3cret", Scopes: []string{"read", "write"},
+		AuthStyle: HeaderOAuth2AuthStyle,
+	}
+	_, err := oauth2Tokens.Get(context.Background(), http.DefaultClient, credentials)
+	require.NoError(t, err)
+
+	assert.Len(t, oauth2Tokens.tokens, 1, "The expired token should have been removed")
+	assert.NotNil(t, oauth2Tokens.tokens[credentials.cacheKey()])
+}
+
+func TestHttpAction_Execute_OAuth2BodyAuthStyle(t *testing.T) {
+	resetOAuth2Tokens()
+	var fetchCount int32
+	tokenServer := newTestTokenServer(t, 3600, &fetchCount)
+	defer tokenServer.Close()
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer apiServer.Close()
+
+	input := oauth2Input(apiServer.URL, tokenServer.URL)
+	input["auth"].(map[string]interface{})["auth_style"] = "body"
+	_, err := HttpAction{}.ExecuteWithSecrets(input, oauth2SecretGetter)
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), fetchCount)
+}
+
+func TestHttpAction_Execute_OAuth2InvalidCredentials(t *testing.T) {
+	resetOAuth2Tokens()
+	var fetchCount int32
+	tokenServer := newTestTokenServer(t, 3600, &fetchCount)
+	defer tokenServer.Close()
+
+	input := oauth2Input("http://127.0.0.1:1", tokenServer.URL)
+	input["auth"].(map[string]interface{})["client_secret_secret"] = "WRONG_SECRET"
+	_, err := HttpAction{}.ExecuteWithSecrets(input, oauth2SecretGetter)
+	assert.ErrorContains(t, err, "failed to fetch OAuth2 token")
+}
+
+func TestHttpAction_Execute_OAuth2MissingSecret(t *testing.T) {
+	resetOAuth2Tokens()
+	var fetchCount int32
+	tokenServer := newTestTokenServer(t, 3600, &fetchCount)
+	defer tokenServer.Close()
+
+	input := oauth2Input("http://127.0.0.1:1", tokenServer.URL)
+	input["auth"].(map[string]interface{})["client_secret_secret"] = "MISSING_SECRET"
+	_, err := HttpAction{}.ExecuteWithSecrets(input, oauth2SecretGetter)
+	assert.ErrorContains(t, err, "Secret MISSING_SECRET not found")
+
+	// Secrets are only resolved while executing jobs
+	_, err = HttpAction{}.Execute(oauth2Input("http://127.0.0.1:1", tokenServer.URL))
+	assert.ErrorContains(t, err, "can't be resolved outside of a job")
+	assert.Equal(t, int32(0), fetchCount)
+}
+
+func TestHttpAction_Validate_InvalidOAuth2(t *testing.T) {
+	testCases := []struct {
+		name string
+		auth map[string]interface{}
+	}{
+		{name: "Missing token URL", auth: map[string]interface{}{"type": "oauth2", "client_id": "a", "client_secret_secret": "B"}},
+		{name: "Missing client secret", auth: map[string]interface{}{"type": "oauth2", "token_url": "https://idp/token", "client_id": "a"}},
+		{name: "Plaintext client secret", auth: map[string]interface{}{"type": "oauth2", "token_url": "https://idp/token", "client_id": "a", "client_secret": "b"}},
+		{name: "Invalid scopes", auth: map[string]interface{}{"type": "oauth2", "token_url": "https://idp/token", "client_id": "a", "client_secret_secret": "B", "scopes": float64(1)}},
+		{name: "Invalid auth style", auth: map[string]interface{}{"type": "oauth2", "token_url": "https://idp/token", "client_id": "a", "client_secret_secret": "B", "auth_style": "jwt"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := HttpAction{}.Validate(Input{"url": "https://example.com", "method": "GET", "auth": tc.auth})
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,329 @@
+package actions
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/cronny/core/config"
+	"github.com/cronny/core/helpers"
+)
+
+const (
+	// Http Pagination Types
+	// LinkHttpPaginationType follows the rel="next" URL of the Link header
+	LinkHttpPaginationType = HttpPaginationT("link")
+	// CursorHttpPaginationType sends the cursor found in the response as a query parameter
+	CursorHttpPaginationType = HttpPaginationT("cursor")
+	// PageHttpPaginationType increments a page number query parameter
+	PageHttpPaginationType = HttpPaginationT("page")
+	// OffsetHttpPaginationType increments an offset query parameter by the items received
+	OffsetHttpPaginationType = HttpPaginationT("offset")
+
+	DefaultHttpPaginationMaxPages = 100
+	DefaultHttpPaginationMaxItems = 1000
+)
+
+type (
+	HttpPaginationT string
+
+	// HttpPagination aggregates the items of all the pages of a response
+	HttpPagination struct {
+		Type HttpPaginationT `json:"type"`
+		// ItemsPath selects the items of a page. The whole response is
+		// used when it's empty, ie. for responses which are lists.
+		ItemsPath string `json:"items_path"`
+		// CursorPath selects the cursor of the next page in the response
+		CursorPath string `json:"cursor_path"`
+		// Param is the query parameter set to the cursor, page or offset
+		Param string `json:"param"`
+		// Start is the first page or offset
+		Start    int `json:"start"`
+		MaxPages int `json:"max_pages"`
+		MaxItems int `json:"max_items"`
+	}
+)
+
+// parsePagination parses the pagination object, eg. {"type": "cursor", "items_path": "data",
+// "cursor_path": "meta.next_cursor", "param": "cursor", "max_items": 500}
+func (httpAction HttpAction) parsePagination(input Input) (pagination *HttpPagination, err error) {
+	var (
+		paginationObj  map[string]interface{}
+		paginationType string
+		num            float64
+	)
+	if paginationObj, err = input.GetObject("pagination"); err != nil || paginationObj == nil {
+		return
+	}
+	paginationInput := Input(paginationObj)
+	pagination = &HttpPagination{}
+	if paginationType, err = paginationInput.GetString("type", true); err != nil {
+		err = fmt.Errorf("pagination: %w", err)
+		return
+	}
+	pagination.Type = HttpPaginationT(paginationType)
+	if pagination.ItemsPath, err = paginationInput.GetString("items_path", false); err != nil {
+		return
+	}
+	if pagination.CursorPath, err = paginationInput.GetString("cursor_path", false); err != nil {
+		return
+	}
+	if pagination.Param, err = paginationInput.GetString("param", false); err != nil {
+		return
+	}
+	if num, err = paginationInput.GetNumber("start"); err != nil {
+		return
+	}
+	pagination.Start = int(num)
+
+	switch pagination.Type {
+	case LinkHttpPaginationType:
+	case CursorHttpPaginationType:
+		if pagination.CursorPath == "" {
+			err = fmt.Errorf("pagination: cursor_path is required for cursor pagination")
+			return
+		}
+	case PageHttpPaginationType:
+		if _, isPresent := paginationObj["start"]; !isPresent {
+			pagination.Start = 1
+		}
+	case OffsetHttpPaginationType:
+	default:
+		err = fmt.Errorf("Unsupported pagination type %s", paginationType)
+		return
+	}
+	if pagination.Param == "" && pagination.Type != LinkHttpPaginationType {
+		pagination.Param = string(pagination.Type)
+	}
+	if pagination.Start < 0 {
+		err = fmt.Errorf("pagination: start should be positive")
+		return
+	}
+	for _, path := range []string{pagination.ItemsPath, pagination.CursorPath} {
+		if path == "" {
+			continue
+		}
+		if _, err = helpers.ParsePath(path); err != nil {
+			err = fmt.Errorf("pagination: %w", err)
+			return
+		}
+	}
+
+	if num, err = paginationInput.GetNumber("max_pages"); err != nil {
+		return
+	}
+	if pagination.MaxPages = int(num); pagination.MaxPages <= 0 {
+		pagination.MaxPages = DefaultHttpPaginationMaxPages
+	}
+	if num, err = paginationInput.GetNumber("max_items"); err != nil {
+		return
+	}
+	if pagination.MaxItems = int(num); pagination.MaxItems <= 0 {
+		pagination.MaxItems = DefaultHttpPaginationMaxItems
+	}
+	if pagination.MaxItems > config.MaxHttpPaginationItems {
+		err = fmt.Errorf("pagination: max_items can't be more than %d", config.MaxHttpPaginationItems)
+		return
+	}
+	return
+}
+
+// items returns the items of a page
+func (pagination *HttpPagination) items(respVal interface{}) (items []interface{}, err error) {
+	var (
+		isList bool
+	)
+	if pagination.ItemsPath != "" {
+		if respVal, _, err = helpers.LookupPath(respVal, pagination.ItemsPath); err != nil {
+			return
+		}
+	}
+	if respVal == nil {
+		return
+	}
+	if items, isList = respVal.([]interface{}); !isList {
+		err = fmt.Errorf("pagination: the items of the response aren't a list, items_path should select them")
+		return
+	}
+	return
+}
+
+// nextCursor returns the cursor of the next page, empty when it's the last page
+func (pagination *HttpPagination) nextCursor(respVal interface{}) (cursor string, err error) {
+	var (
+		cursorVal interface{}
+	)
+	if cursorVal, _, err = helpers.LookupPath(respVal, pagination.CursorPath); err != nil {
+		return
+	}
+	switch typedVal := cursorVal.(type) {
+	case nil:
+	case string:
+		cursor = typedVal
+	case float64:
+		if typedVal == math.Trunc(typedVal) {
+			cursor = strconv.FormatInt(int64(typedVal), 10)
+			break
+		}
+		cursor = strconv.FormatFloat(typedVal, 'f', -1, 64)
+	case bool:
+		// APIs like Slack's set has_more to false on the last page
+	default:
+		err = fmt.Errorf("pagination: the cursor at %s isn't a string or a number", pagination.CursorPath)
+		return
+	}
+	return
+}
+
+// nextLink returns the rel="next" URL of the Link headers resolved against
+// the URL of the request
+func nextLink(resp *http.Response) (next string) {
+	for _, header := range resp.Header.Values("Link") {
+		for _, link := range strings.Split(header, ",") {
+			parts := strings.Split(link, ";")
+			target := strings.TrimSpace(parts[0])
+			if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+				continue
+			}
+			for _, param := range parts[1:] {
+				key, val, _ := strings.Cut(strings.TrimSpace(param), "=")
+				if !strings.EqualFold(key, "rel") {
+					continue
+				}
+				for _, rel := range strings.Fields(strings.Trim(val, `"`)) {
+					if !strings.EqualFold(rel, "next") {
+						continue
+					}
+					nextUrl, err := resp.Request.URL.Parse(target[1 : len(target)-1])
+					if err != nil {
+						return
+					}
+					next = nextUrl.String()
+					return
+				}
+			}
+		}
+	}
+	return
+}
+
+// checkSameOrigin refuses next links to another scheme or host than the
+// request's, since the pages are requested with the request's credentials
+// and signature
+func (httpReq *HttpActionReq) checkSameOrigin(next string) (err error) {
+	var (
+		reqUrl, nextUrl *url.URL
+	)
+	if reqUrl, err = url.Parse(httpReq.Url); err != nil {
+		return
+	}
+	if nextUrl, err = url.Parse(next); err != nil {
+		return
+	}
+	if !strings.EqualFold(nextUrl.Scheme, reqUrl.Scheme) || !strings.EqualFold(nextUrl.Host, reqUrl.Host) {
+		err = fmt.Errorf("next link %s://%s isn't on the same origin as the request", nextUrl.Scheme, nextUrl.Host)
+		return
+	}
+	return
+}
+
+// doPage sends the request for a single page and returns its decoded body
+func (httpReq *HttpActionReq) doPage(ctx context.Context, client *http.Client) (resp *http.Response, respVal interface{}, err error) {
+	var (
+		respBody []byte
+	)
+	if resp, err = httpReq.do(ctx, client); err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if respBody, err = io.ReadAll(resp.Body); err != nil {
+		return
+	}
+	if err = httpReq.checkStatus(resp); err != nil {
+		return
+	}
+	respVal = parseRespBody(respBody)
+	return
+}
+
+// executePaginated requests pages until the last page, max_pages or
+// max_items is reached. The output has the status of the last page,
+// the aggregated items and the number of pages requested.
+func (httpAction HttpAction) executePaginated(ctx context.Context, client *http.Client, httpReq *HttpActionReq) (output Output, err error) {
+	var (
+		resp      *http.Response
+		respVal   interface{}
+		pageItems []interface{}
+		pages     int
+	)
+	pagination := httpReq.Pagination
+	pageReq := *httpReq
+	pageReq.Query = make(url.Values)
+	for key, vals := range httpReq.Query {
+		pageReq.Query[key] = vals
+	}
+	position := pagination.Start
+	if pagination.Type == PageHttpPaginationType || pagination.Type == OffsetHttpPaginationType {
+		pageReq.Query.Set(pagination.Param, strconv.Itoa(position))
+	}
+
+	items := make([]interface{}, 0)
+	for pages < pagination.MaxPages && len(items) < pagination.MaxItems {
+		if resp, respVal, err = pageReq.doPage(ctx, client); err != nil {
+			err = fmt.Errorf("failed to get page %d: %w", pages+1, err)
+			return
+		}
+		pages++
+		if pageItems, err = pagination.items(respVal); err != nil {
+			return
+		}
+		items = append(items, pageItems...)
+		if len(pageItems) == 0 {
+			break
+		}
+
+		var next string
+		switch pagination.Type {
+		case LinkHttpPaginationType:
+			if next = nextLink(resp); next != "" {
+				if err = httpReq.checkSameOrigin(next); err != nil {
+					return
+				}
+				// The next link has the query of the next page
+				pageReq.Url = next
+				pageReq.Query = make(url.Values)
+			}
+		case CursorHttpPaginationType:
+			if next, err = pagination.nextCursor(respVal); err != nil {
+				return
+			}
+			pageReq.Query.Set(pagination.Param, next)
+		case PageHttpPaginationType:
+			position++
+			next = strconv.Itoa(position)
+			pageReq.Query.Set(pagination.Param, next)
+		case OffsetHttpPaginationType:
+			position += len(pageItems)
+			next = strconv.Itoa(position)
+			pageReq.Query.Set(pagination.Param, next)
+		}
+		if next == "" {
+			break
+		}
+	}
+	if len(items) > pagination.MaxItems {
+		items = items[:pagination.MaxItems]
+	}
+
+	output = Output{
+		"status": strconv.Itoa(resp.StatusCode),
+		"items":  items,
+		"pages":  pages,
+	}
+	return
+}
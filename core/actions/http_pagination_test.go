@@ -0,0 +1,230 @@
+package actions
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// pageItems returns the items 1..total split in pages of pageSize
+func pageItems(page, pageSize, total int) []interface{} {
+	items := make([]interface{}, 0)
+	for idx := (page-1)*pageSize + 1; idx <= page*pageSize && idx <= total; idx++ {
+		items = append(items, float64(idx))
+	}
+	return items
+}
+
+// ==========================================================
+// TestHttpAction_Pagination
+
+func TestHttpAction_Execute_LinkPagination(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		if page == 0 {
+			page = 1
+		}
+		assert.Equal(t, "open", r.URL.Query().Get("state"))
+		if page < 3 {
+			w.Header().Set("Link", fmt.Sprintf(`</items?state=open&page=%d>; rel="next", </items?page=3>; rel="last"`, page+1))
+		}
+		json.NewEncoder(w).Encode(pageItems(page, 2, 5))
+	}))
+	defer server.Close()
+
+	output, err := HttpAction{}.Execute(Input{
+		"url":        server.URL + "/items",
+		"method":     "GET",
+		"query":      map[string]interface{}{"state": "open"},
+		"pagination": map[string]interface{}{"type": "link"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{float64(1), float64(2), float64(3), float64(4), float64(5)}, output["items"])
+	assert.Equal(t, 3, output["pages"])
+	assert.Equal(t, "200", output["status"])
+}
+
+func TestHttpAction_Execute_LinkPaginationRefusesOtherOrigins(t *testing.T) {
+	var otherRequests atomic.Int32
+	otherServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		otherRequests.Add(1)
+		json.NewEncoder(w).Encode([]interface{}{})
+	}))
+	defer otherServer.Close()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Link", fmt.Sprintf(`<%s/items?page=2>; rel="next"`, otherServer.URL))
+		json.NewEncoder(w).Encode(pageItems(1, 2, 5))
+	}))
+	defer server.Close()
+
+	_, err := HttpAction{}.ExecuteWithSecrets(Input{
+		"url":        server.URL + "/items",
+		"method":     "GET",
+		"auth":       map[string]interface{}{"type": "bearer", "token_secret": "API_TOKEN"},
+		"pagination": map[string]interface{}{"type": "link"},
+	}, testSecretGetter(map[string]string{"API_TOKEN": "t0ken"}))
+	assert.ErrorContains(t, err, "isn't on the same origin as the request")
+	assert.Equal(t, int32(0), otherRequests.Load(), "The credentials shouldn't be sent to another origin")
+}
+
+func TestHttpAction_Execute_CursorPagination(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page := 1
+		if cursor := r.URL.Query().Get("after"); cursor != "" {
+			page, _ = strconv.Atoi(cursor)
+		}
+		nextCursor := interface{}(nil)
+		if page < 3 {
+			nextCursor = float64(page + 1)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{"items": pageItems(page, 2, 6)},
+			"meta": map[string]interface{}{"next": nextCursor},
+		})
+	}))
+	defer server.Close()
+
+	output, err := HttpAction{}.Execute(Input{
+		"url":    server.URL,
+		"method": "GET",
+		"pagination": map[string]interface{}{
+			"type":        "cursor",
+			"items_path":  "data.items",
+			"cursor_path": "meta.next",
+			"param":       "after",
+		},
+	})
+	require.NoError(t, err)
+	assert.Len(t, output["items"], 6)
+	assert.Equal(t, 3, output["pages"])
+}
+
+func TestHttpAction_Execute_PageAndOffsetPagination(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if offset := r.URL.Query().Get("offset"); offset != "" {
+			offsetNum, _ := strconv.Atoi(offset)
+			items := make([]interface{}, 0)
+			for idx := offsetNum + 1; idx <= offsetNum+2 && idx <= 5; idx++ {
+				items = append(items, float64(idx))
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"results": items})
+			return
+		}
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		json.NewEncoder(w).Encode(map[string]interface{}{"results": pageItems(page, 2, 5)})
+	}))
+	defer server.Close()
+
+	for _, paginationType := range []string{"page", "offset"} {
+		t.Run(paginationType, func(t *testing.T) {
+			output, err := HttpAction{}.Execute(Input{
+				"url":        server.URL,
+				"method":     "GET",
+				"pagination": map[string]interface{}{"type": paginationType, "items_path": "results"},
+			})
+			require.NoError(t, err)
+			assert.Len(t, output["items"], 5)
+			// The last page is empty
+			assert.Equal(t, 4, output["pages"])
+		})
+	}
+}
+
+func TestHttpAction_Execute_PaginationLimits(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		json.NewEncoder(w).Encode(pageItems(page, 10, 1000))
+	}))
+	defer server.Close()
+
+	output, err := HttpAction{}.Execute(Input{
+		"url":        server.URL,
+		"method":     "GET",
+		"pagination": map[string]interface{}{"type": "page", "max_items": float64(25)},
+	})
+	require.NoError(t, err)
+	assert.Len(t, output["items"], 25)
+	assert.Equal(t, 3, requests, "No more pages should be requested once max_items is reached")
+
+	requests = 0
+	output, err = HttpAction{}.Execute(Input{
+		"url":        server.URL,
+		"method":     "GET",
+		"pagination": map[string]interface{}{"type": "page", "max_pages": float64(2)},
+	})
+	require.NoError(t, err)
+	assert.Len(t, output["items"], 20)
+	assert.Equal(t, 2, requests)
+}
+
+func TestHttpAction_ExecuteContext_PaginationStopsWhenDone(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		time.Sleep(20 * time.Millisecond)
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		json.NewEncoder(w).Encode(pageItems(page, 10, 100000))
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err := HttpAction{}.ExecuteContext(ctx, Input{
+		"url":        server.URL,
+		"method":     "GET",
+		"pagination": map[string]interface{}{"type": "page", "max_pages": float64(1000), "max_items": float64(10000)},
+	}, nil)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.NotContains(t, err.Error(), "request timed out", "The job timed out rather than the request")
+	time.Sleep(50 * time.Millisecond)
+	assert.Less(t, requests.Load(), int32(10), "No more pages should be requested once the job timed out")
+}
+
+func TestHttpAction_Execute_PaginationFailingPage(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("page") == "2" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(pageItems(1, 2, 10))
+	}))
+	defer server.Close()
+
+	_, err := HttpAction{}.Execute(Input{
+		"url":             server.URL,
+		"method":          "GET",
+		"expected_status": "2xx",
+		"pagination":      map[string]interface{}{"type": "page"},
+	})
+	assert.ErrorContains(t, err, "failed to get page 2")
+}
+
+func TestHttpAction_Validate_InvalidPagination(t *testing.T) {
+	testCases := []struct {
+		name       string
+		pagination map[string]interface{}
+	}{
+		{name: "Missing type", pagination: map[string]interface{}{}},
+		{name: "Unsupported type", pagination: map[string]interface{}{"type": "token"}},
+		{name: "Cursor without cursor path", pagination: map[string]interface{}{"type": "cursor"}},
+		{name: "Invalid items path", pagination: map[string]interface{}{"type": "link", "items_path": "data[x]"}},
+		{name: "Too many items", pagination: map[string]interface{}{"type": "link", "max_items": float64(1000000)}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := HttpAction{}.Validate(Input{"url": "https://example.com", "method": "GET", "pagination": tc.pagination})
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,325 @@
+package actions
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Http Signing Types
+	// HmacSha256HttpSigningType signs a canonical string of the request with a shared key
+	HmacSha256HttpSigningType = HttpSigningT("hmac_sha256")
+	// AwsSigV4HttpSigningType signs the request with AWS Signature Version 4
+	AwsSigV4HttpSigningType = HttpSigningT("aws_sigv4")
+
+	DefaultHmacSignatureHeader = "X-Cronny-Signature"
+	DefaultHmacTimestampHeader = "X-Cronny-Timestamp"
+	// DefaultHmacCanonicalString is signed unless the job sets its own. The
+	// {method}, {path}, {query}, {timestamp} and {body} placeholders are
+	// replaced by the values of the request.
+	DefaultHmacCanonicalString = "{timestamp}.{body}"
+
+	awsSigV4Algorithm  = "AWS4-HMAC-SHA256"
+	awsSigV4TimeFormat = "20060102T150405Z"
+)
+
+type (
+	HttpSigningT string
+
+	// HttpSigning signs the requests of an HTTP job. The keys are read from
+	// the user's secrets, the job's input only has the names of the secrets.
+	HttpSigning struct {
+		Type HttpSigningT
+
+		// HMAC-SHA256
+		Key             string
+		Header          string
+		TimestampHeader string
+		CanonicalString string
+		// Prefix is prepended to the signature, eg. "sha256="
+		Prefix string
+		// Encoding of the signature, hex (default) or base64
+		Encoding string
+
+		// AWS SigV4
+		AccessKeyID     string
+		SecretAccessKey string
+		SessionToken    string
+		Region          string
+		Service         string
+
+		// now returns the signing time, replaced in tests
+		now func() time.Time
+	}
+)
+
+// parseSigning parses the signing object, eg. {"type": "hmac_sha256", "key_secret": "WEBHOOK_KEY"}
+// or {"type": "aws_sigv4", "access_key_id_secret": "AWS_KEY_ID", "secret_access_key_secret": "AWS_SECRET",
+// "region": "us-east-1", "service": "execute-api"}
+func (httpAction HttpAction) parseSigning(input Input, getSecret SecretGetter) (signing *HttpSigning, err error) {
+	var (
+		signingObj  map[string]interface{}
+		signingType string
+	)
+	if signingObj, err = input.GetObject("signing"); err != nil || signingObj == nil {
+		return
+	}
+	signingInput := Input(signingObj)
+	if signingType, err = signingInput.GetString("type", true); err != nil {
+		err = fmt.Errorf("signing: %w", err)
+		return
+	}
+	signing = &HttpSigning{Type: HttpSigningT(signingType), now: time.Now}
+	switch signing.Type {
+	case HmacSha256HttpSigningType:
+		err = signing.parseHmac(signingInput, getSecret)
+	case AwsSigV4HttpSigningType:
+		err = signing.parseAwsSigV4(signingInput, getSecret)
+	default:
+		err = fmt.Errorf("Unsupported signing type %s", signingType)
+	}
+	if err != nil {
+		err = fmt.Errorf("signing: %w", err)
+		return
+	}
+	return
+}
+
+func (signing *HttpSigning) parseHmac(signingInput Input, getSecret SecretGetter) (err error) {
+	if signing.Key, err = getSecret.GetSecret(signingInput, "key_secret", true); err != nil {
+		return
+	}
+	if signing.Header, err = signingInput.GetString("header", false); err != nil {
+		return
+	}
+	if signing.TimestampHeader, err = signingInput.GetString("timestamp_header", false); err != nil {
+		return
+	}
+	if signing.CanonicalString, err = signingInput.GetString("canonical_string", false); err != nil {
+		return
+	}
+	if signing.Prefix, err = signingInput.GetString("prefix", false); err != nil {
+		return
+	}
+	if signing.Encoding, err = signingInput.GetString("encoding", false); err != nil {
+		return
+	}
+	if signing.Header == "" {
+		signing.Header = DefaultHmacSignatureHeader
+	}
+	if signing.TimestampHeader == "" {
+		signing.TimestampHeader = DefaultHmacTimestampHeader
+	}
+	if signing.CanonicalString == "" {
+		signing.CanonicalString = DefaultHmacCanonicalString
+	}
+	switch signing.Encoding {
+	case "":
+		signing.Encoding = "hex"
+	case "hex", "base64":
+	default:
+		err = fmt.Errorf("Unsupported encoding %s", signing.Encoding)
+		return
+	}
+	return
+}
+
+func (signing *HttpSigning) parseAwsSigV4(signingInput Input, getSecret SecretGetter) (err error) {
+	if signing.AccessKeyID, err = getSecret.GetSecret(signingInput, "access_key_id_secret", true); err != nil {
+		return
+	}
+	if signing.SecretAccessKey, err = getSecret.GetSecret(signingInput, "secret_access_key_secret", true); err != nil {
+		return
+	}
+	if signing.SessionToken, err = getSecret.GetSecret(signingInput, "session_token_secret", false); err != nil {
+		return
+	}
+	if signing.Region, err = signingInput.GetString("region", true); err != nil {
+		return
+	}
+	if signing.Service, err = signingInput.GetString("service", true); err != nil {
+		return
+	}
+	return
+}
+
+// Sign adds the signature headers to the request
+func (signing *HttpSigning) Sign(req *http.Request) (err error) {
+	var (
+		body []byte
+	)
+	if req.GetBody != nil {
+		var bodyReader io.ReadCloser
+		if bodyReader, err = req.GetBody(); err != nil {
+			return
+		}
+		defer bodyReader.Close()
+		if body, err = io.ReadAll(bodyReader); err != nil {
+			return
+		}
+	}
+	switch signing.Type {
+	case HmacSha256HttpSigningType:
+		signing.signHmac(req, body)
+	case AwsSigV4HttpSigningType:
+		SignAwsSigV4(req, body, AwsCredentials{
+			AccessKeyID:     signing.AccessKeyID,
+			SecretAccessKey: signing.SecretAccessKey,
+			SessionToken:    signing.SessionToken,
+		}, signing.Region, signing.Service, signing.now())
+	}
+	return
+}
+
+func (signing *HttpSigning) signHmac(req *http.Request, body []byte) {
+	timestamp := strconv.FormatInt(signing.now().Unix(), 10)
+	canonicalString := strings.NewReplacer(
+		"{method}", req.Method,
+		"{path}", req.URL.EscapedPath(),
+		"{query}", req.URL.RawQuery,
+		"{timestamp}", timestamp,
+		"{body}", string(body),
+	).Replace(signing.CanonicalString)
+
+	mac := hmac.New(sha256.New, []byte(signing.Key))
+	mac.Write([]byte(canonicalString))
+	signature := hex.EncodeToString(mac.Sum(nil))
+	if signing.Encoding == "base64" {
+		signature = base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	}
+	req.Header.Set(signing.TimestampHeader, timestamp)
+	req.Header.Set(signing.Header, signing.Prefix+signature)
+}
+
+// ==========================================================
+// AWS Signature Version 4
+
+type (
+	AwsCredentials struct {
+		AccessKeyID     string
+		SecretAccessKey string
+		SessionToken    string
+	}
+)
+
+func hmacSha256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])
+}
+
+// awsUriEncode encodes the string as described by SigV4, ie. every byte
+// apart from the unreserved characters is percent encoded
+func awsUriEncode(str string, encodeSlash bool) string {
+	var (
+		encoded strings.Builder
+	)
+	for _, b := range []byte(str) {
+		isUnreserved := (b >= 'A' && b <= 'Z') || (b >= 'a' && b <= 'z') || (b >= '0' && b <= '9') ||
+			b == '-' || b == '_' || b == '.' || b == '~'
+		if isUnreserved || (b == '/' && !encodeSlash) {
+			encoded.WriteByte(b)
+			continue
+		}
+		fmt.Fprintf(&encoded, "%%%02X", b)
+	}
+	return encoded.String()
+}
+
+func awsCanonicalQuery(query url.Values) string {
+	var (
+		params []string
+	)
+	for key, vals := range query {
+		for _, val := range vals {
+			params = append(params, awsUriEncode(key, true)+"="+awsUriEncode(val, true))
+		}
+	}
+	sort.Strings(params)
+	return strings.Join(params, "&")
+}
+
+// SignAwsSigV4 signs the request with AWS Signature Version 4. The host,
+// Content-Type and X-Amz-* headers are signed. S3 requests also have their
+// payload hash set in the X-Amz-Content-Sha256 header.
+func SignAwsSigV4(req *http.Request, body []byte, credentials AwsCredentials, region, service string, signTime time.Time) {
+	signTime = signTime.UTC()
+	amzDate := signTime.Format(awsSigV4TimeFormat)
+	date := signTime.Format("20060102")
+	payloadHash := sha256Hex(body)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	if credentials.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", credentials.SessionToken)
+	}
+	if service == "s3" {
+		req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	}
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	headers := map[string]string{"host": host}
+	for key, vals := range req.Header {
+		lowerKey := strings.ToLower(key)
+		if lowerKey == "content-type" || strings.HasPrefix(lowerKey, "x-amz-") {
+			headers[lowerKey] = strings.Join(vals, ",")
+		}
+	}
+	headerNames := make([]string, 0, len(headers))
+	for name := range headers {
+		headerNames = append(headerNames, name)
+	}
+	sort.Strings(headerNames)
+	var canonicalHeaders strings.Builder
+	for _, name := range headerNames {
+		canonicalHeaders.WriteString(name + ":" + strings.Join(strings.Fields(headers[name]), " ") + "\n")
+	}
+	signedHeaders := strings.Join(headerNames, ";")
+
+	path := req.URL.Path
+	if path == "" {
+		path = "/"
+	}
+	canonicalUri := awsUriEncode(path, false)
+	if service != "s3" {
+		// Every service apart from S3 expects the path to be encoded twice
+		canonicalUri = awsUriEncode(canonicalUri, false)
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		canonicalUri,
+		awsCanonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := strings.Join([]string{date, region, service, "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{awsSigV4Algorithm, amzDate, scope, sha256Hex([]byte(canonicalRequest))}, "\n")
+
+	signingKey := hmacSha256([]byte("AWS4"+credentials.SecretAccessKey), date)
+	signingKey = hmacSha256(signingKey, region)
+	signingKey = hmacSha256(signingKey, service)
+	signingKey = hmacSha256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSha256(signingKey, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		awsSigV4Algorithm, credentials.AccessKeyID, scope, signedHeaders, signature))
+}
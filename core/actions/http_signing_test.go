@@ -0,0 +1,181 @@
+package actions
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testSecretGetter(secrets map[string]string) SecretGetter {
+	return func(name string) (value string, err error) {
+		value, isPresent := secrets[name]
+		if !isPresent {
+			err = fmt.Errorf("Secret %s not found", name)
+		}
+		return
+	}
+}
+
+// ==========================================================
+// TestHttpAction_Signing
+
+func TestHttpAction_Execute_HmacSigning(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		timestamp := r.Header.Get("X-Cronny-Timestamp")
+		require.NotEmpty(t, timestamp)
+
+		mac := hmac.New(sha256.New, []byte("webhook-key"))
+		mac.Write([]byte(timestamp + "." + string(body)))
+		assert.Equal(t, hex.EncodeToString(mac.Sum(nil)), r.Header.Get("X-Cronny-Signature"))
+	}))
+	defer server.Close()
+
+	output, err := HttpAction{}.ExecuteWithSecrets(Input{
+		"url":             server.URL,
+		"method":          "POST",
+		"request_body":    map[string]interface{}{"event": "ping"},
+		"expected_status": "200",
+		"signing":         map[string]interface{}{"type": "hmac_sha256", "key_secret": "WEBHOOK_KEY"},
+	}, testSecretGetter(map[string]string{"WEBHOOK_KEY": "webhook-key"}))
+	require.NoError(t, err)
+	assert.Equal(t, "200", output["status"])
+}
+
+func TestHttpAction_Execute_HmacSigningCustomFormat(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		timestamp := r.Header.Get("X-Timestamp")
+		require.NotEmpty(t, timestamp)
+
+		mac := hmac.New(sha256.New, []byte("webhook-key"))
+		mac.Write([]byte(fmt.Sprintf("v1:%s:%s?%s:%s:%s", r.Method, r.URL.Path, r.URL.RawQuery, timestamp, body)))
+		assert.Equal(t, "sha256="+base64.StdEncoding.EncodeToString(mac.Sum(nil)), r.Header.Get("X-Signature"))
+	}))
+	defer server.Close()
+
+	_, err := HttpAction{}.ExecuteWithSecrets(Input{
+		"url":             server.URL + "/hooks",
+		"method":          "PUT",
+		"query":           map[string]interface{}{"id": "1"},
+		"request_body":    "payload",
+		"body_type":       "text",
+		"expected_status": "200",
+		"signing": map[string]interface{}{
+			"type":             "hmac_sha256",
+			"key_secret":       "WEBHOOK_KEY",
+			"header":           "X-Signature",
+			"timestamp_header": "X-Timestamp",
+			"canonical_string": "v1:{method}:{path}?{query}:{timestamp}:{body}",
+			"prefix":           "sha256=",
+			"encoding":         "base64",
+		},
+	}, testSecretGetter(map[string]string{"WEBHOOK_KEY": "webhook-key"}))
+	require.NoError(t, err)
+}
+
+func TestHttpAction_Execute_SigningWithoutSecrets(t *testing.T) {
+	_, err := HttpAction{}.Execute(Input{
+		"url":     "http://127.0.0.1:1",
+		"method":  "GET",
+		"signing": map[string]interface{}{"type": "hmac_sha256", "key_secret": "WEBHOOK_KEY"},
+	})
+	assert.ErrorContains(t, err, "can't be resolved")
+
+	_, err = HttpAction{}.ExecuteWithSecrets(Input{
+		"url":     "http://127.0.0.1:1",
+		"method":  "GET",
+		"signing": map[string]interface{}{"type": "hmac_sha256", "key_secret": "MISSING"},
+	}, testSecretGetter(map[string]string{}))
+	assert.ErrorContains(t, err, "MISSING")
+}
+
+func TestHttpAction_Execute_InvalidSigning(t *testing.T) {
+	getSecret := testSecretGetter(map[string]string{"KEY": "key"})
+	testCases := []struct {
+		name    string
+		signing map[string]interface{}
+		auth    map[string]interface{}
+	}{
+		{name: "Missing type", signing: map[string]interface{}{"key_secret": "KEY"}},
+		{name: "Unsupported type", signing: map[string]interface{}{"type": "rsa"}},
+		{name: "Unsupported encoding", signing: map[string]interface{}{"type": "hmac_sha256", "key_secret": "KEY", "encoding": "base32"}},
+		{name: "Missing region", signing: map[string]interface{}{"type": "aws_sigv4", "access_key_id_secret": "KEY", "secret_access_key_secret": "KEY", "service": "s3"}},
+		{
+			name:    "SigV4 with auth",
+			signing: map[string]interface{}{"type": "aws_sigv4", "access_key_id_secret": "KEY", "secret_access_key_secret": "KEY", "region": "us-east-1", "service": "s3"},
+			auth:    map[string]interface{}{"type": "bearer", "token_secret": "KEY"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			input := Input{"url": "http://127.0.0.1:1", "method": "GET", "signing": tc.signing}
+			if tc.auth != nil {
+				input["auth"] = tc.auth
+			}
+			_, err := HttpAction{}.ExecuteWithSecrets(input, getSecret)
+			assert.ErrorContains(t, err, "sign")
+		})
+	}
+}
+
+// ==========================================================
+// TestSignAwsSigV4
+
+func TestSignAwsSigV4_GetVanilla(t *testing.T) {
+	// get-vanilla from the AWS SigV4 test suite
+	req, err := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", nil)
+	require.NoError(t, err)
+	signTime := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+
+	SignAwsSigV4(req, nil, AwsCredentials{
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+	}, "us-east-1", "service", signTime)
+
+	assert.Equal(t, "20150830T123600Z", req.Header.Get("X-Amz-Date"))
+	assert.Equal(t, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, "+
+		"SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		req.Header.Get("Authorization"))
+}
+
+func TestHttpAction_Execute_AwsSigV4Signing(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "session-token", r.Header.Get("X-Amz-Security-Token"))
+		assert.Equal(t, sha256Hex([]byte(`{"key":"value"}`)), r.Header.Get("X-Amz-Content-Sha256"))
+		assert.Contains(t, r.Header.Get("Authorization"), "Credential=AKIDEXAMPLE/")
+		assert.Contains(t, r.Header.Get("Authorization"), "/eu-west-1/s3/aws4_request")
+		assert.Contains(t, r.Header.Get("Authorization"), "SignedHeaders=content-type;host;x-amz-content-sha256;x-amz-date;x-amz-security-token")
+	}))
+	defer server.Close()
+
+	_, err := HttpAction{}.ExecuteWithSecrets(Input{
+		"url":             server.URL + "/bucket/key",
+		"method":          "PUT",
+		"request_body":    map[string]interface{}{"key": "value"},
+		"expected_status": "200",
+		"signing": map[string]interface{}{
+			"type":                     "aws_sigv4",
+			"access_key_id_secret":     "AWS_KEY_ID",
+			"secret_access_key_secret": "AWS_SECRET",
+			"session_token_secret":     "AWS_SESSION",
+			"region":                   "eu-west-1",
+			"service":                  "s3",
+		},
+	}, testSecretGetter(map[string]string{
+		"AWS_KEY_ID":  "AKIDEXAMPLE",
+		"AWS_SECRET":  "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+		"AWS_SESSION": "session-token",
+	}))
+	require.NoError(t, err)
+}
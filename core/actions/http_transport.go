@@ -0,0 +1,222 @@
+package actions
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/cronny/core/config"
+)
+
+type (
+	// HttpTLSConfig is the TLS configuration of a single HTTP job. The
+	// certificates and key are PEM encoded, the key is read from the secret
+	// named by client_key_secret while executing.
+	HttpTLSConfig struct {
+		CABundle           string `json:"ca_bundle"`
+		ClientCert         string `json:"client_cert"`
+		ClientKey          string `json:"client_key"`
+		ServerName         string `json:"server_name"`
+		InsecureSkipVerify bool   `json:"insecure_skip_verify"`
+	}
+
+	// httpTransportKey identifies the transport of a TLS and proxy configuration
+	httpTransportKey string
+
+	// httpTransportCache keeps a transport per TLS and proxy configuration
+	// so that jobs with the same configuration share their connections
+	httpTransportCache struct {
+		mu         sync.Mutex
+		transports map[httpTransportKey]*http.Transport
+	}
+)
+
+var (
+	httpTransports = &httpTransportCache{
+		transports: make(map[httpTransportKey]*http.Transport),
+	}
+)
+
+// parseTLSConfig parses the tls object, eg. {"ca_bundle": "-----BEGIN CERTIFICATE-----...", "server_name": "internal"}
+func (httpAction HttpAction) parseTLSConfig(input Input) (tlsConfig *HttpTLSConfig, err error) {
+	var (
+		tlsObj          map[string]interface{}
+		clientKeySecret string
+	)
+	if tlsObj, err = input.GetObject("tls"); err != nil || tlsObj == nil {
+		return
+	}
+	tlsInput := Input(tlsObj)
+	tlsConfig = &HttpTLSConfig{}
+	if tlsConfig.CABundle, err = tlsInput.GetString("ca_bundle", false); err != nil {
+		return
+	}
+	if tlsConfig.ClientCert, err = tlsInput.GetString("client_cert", false); err != nil {
+		return
+	}
+	// The key would be stored along with the job and its executions
+	if _, isPresent := tlsInput["client_key"]; isPresent {
+		err = fmt.Errorf("tls: client_key can't be part of the input, set client_key_secret to the name of a secret")
+		return
+	}
+	if clientKeySecret, err = tlsInput.GetString("client_key_secret", false); err != nil {
+		return
+	}
+	if tlsConfig.ServerName, err = tlsInput.GetString("server_name", false); err != nil {
+		return
+	}
+	if tlsConfig.InsecureSkipVerify, err = tlsInput.GetBool("insecure_skip_verify", false); err != nil {
+		return
+	}
+	if (tlsConfig.ClientCert == "") != (clientKeySecret == "") {
+		err = fmt.Errorf("tls: both client_cert and client_key_secret should be provided")
+		return
+	}
+	if block, _ := pem.Decode([]byte(tlsConfig.ClientCert)); tlsConfig.ClientCert != "" && block == nil {
+		err = fmt.Errorf("tls: client_cert isn't PEM encoded")
+		return
+	}
+	if tlsConfig.InsecureSkipVerify && !config.AllowInsecureSkipVerify {
+		err = fmt.Errorf("tls: insecure_skip_verify isn't allowed on this server")
+		return
+	}
+	// The client certificate is checked against its key once it's resolved
+	withoutClientCert := *tlsConfig
+	withoutClientCert.ClientCert = ""
+	if _, err = withoutClientCert.Build(); err != nil {
+		return
+	}
+	return
+}
+
+// resolveClientKey reads the key of the client certificate from the secret
+// named by client_key_secret
+func (tlsConfig *HttpTLSConfig) resolveClientKey(input Input, getSecret SecretGetter) (err error) {
+	var (
+		tlsObj map[string]interface{}
+	)
+	if tlsConfig == nil || tlsConfig.ClientCert == "" {
+		return
+	}
+	if tlsObj, err = input.GetObject("tls"); err != nil {
+		return
+	}
+	if tlsConfig.ClientKey, err = getSecret.GetSecret(Input(tlsObj), "client_key_secret", true); err != nil {
+		err = fmt.Errorf("tls: %w", err)
+		return
+	}
+	return
+}
+
+// Build returns the tls.Config for the configuration
+func (tlsConfig *HttpTLSConfig) Build() (builtConfig *tls.Config, err error) {
+	builtConfig = &tls.Config{
+		ServerName:         tlsConfig.ServerName,
+		InsecureSkipVerify: tlsConfig.InsecureSkipVerify,
+	}
+	if tlsConfig.CABundle != "" {
+		builtConfig.RootCAs = x509.NewCertPool()
+		if !builtConfig.RootCAs.AppendCertsFromPEM([]byte(tlsConfig.CABundle)) {
+			err = fmt.Errorf("tls: ca_bundle doesn't contain any PEM encoded certificate")
+			return
+		}
+	}
+	if tlsConfig.ClientCert != "" {
+		var (
+			cert tls.Certificate
+		)
+		if cert, err = tls.X509KeyPair([]byte(tlsConfig.ClientCert), []byte(tlsConfig.ClientKey)); err != nil {
+			err = fmt.Errorf("tls: invalid client certificate or key: %w", err)
+			return
+		}
+		builtConfig.Certificates = []tls.Certificate{cert}
+	}
+	return
+}
+
+// parseProxy validates the proxy URL. http, https and socks5 proxies are supported.
+func (httpAction HttpAction) parseProxy(input Input) (proxyUrl *url.URL, err error) {
+	var (
+		proxy string
+	)
+	if proxy, err = input.GetString("proxy", false); err != nil || proxy == "" {
+		return
+	}
+	if proxyUrl, err = url.Parse(proxy); err != nil {
+		err = fmt.Errorf("Invalid proxy %s: %w", proxy, err)
+		return
+	}
+	switch proxyUrl.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		err = fmt.Errorf("Unsupported proxy scheme %s", proxyUrl.Scheme)
+		return
+	}
+	return
+}
+
+func newHttpTransportKey(tlsConfig *HttpTLSConfig, proxyUrl *url.URL) (key httpTransportKey, err error) {
+	var (
+		keyB []byte
+	)
+	keyVal := struct {
+		TLS   *HttpTLSConfig
+		Proxy string
+	}{TLS: tlsConfig}
+	if proxyUrl != nil {
+		keyVal.Proxy = proxyUrl.String()
+	}
+	if keyB, err = json.Marshal(keyVal); err != nil {
+		return
+	}
+	hash := sha256.Sum256(keyB)
+	key = httpTransportKey(hex.EncodeToString(hash[:]))
+	return
+}
+
+// Get returns the transport for the configuration, creating it from the
+// shared client's transport when it isn't cached yet
+func (cache *httpTransportCache) Get(tlsConfig *HttpTLSConfig, proxyUrl *url.URL) (transport *http.Transport, err error) {
+	var (
+		key         httpTransportKey
+		builtConfig *tls.Config
+		isPresent   bool
+	)
+	if key, err = newHttpTransportKey(tlsConfig, proxyUrl); err != nil {
+		return
+	}
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if transport, isPresent = cache.transports[key]; isPresent {
+		return
+	}
+
+	transport = httpClient.Transport.(*http.Transport).Clone()
+	if tlsConfig != nil {
+		if builtConfig, err = tlsConfig.Build(); err != nil {
+			return
+		}
+		transport.TLSClientConfig = builtConfig
+	}
+	if proxyUrl != nil {
+		transport.Proxy = http.ProxyURL(proxyUrl)
+	}
+	if len(cache.transports) >= config.MaxHttpTransports {
+		// Evict any transport to stay within the limit
+		for evictKey, evictTransport := range cache.transports {
+			evictTransport.CloseIdleConnections()
+			delete(cache.transports, evictKey)
+			break
+		}
+	}
+	cache.transports[key] = transport
+	return
+}
@@ -0,0 +1,209 @@
+package actions
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+const (
+	NatsBroker  = "nats"
+	AmqpBroker  = "amqp"
+	KafkaBroker = "kafka"
+)
+
+type (
+	// PublishActionReq is the message published by a publish job. The
+	// destination depends on the broker: a NATS subject, an AMQP exchange and
+	// routing key, or a Kafka topic.
+	PublishActionReq struct {
+		Broker string
+		// Servers are the NATS URLs, the AMQP URL or the Kafka brokers
+		Servers []string
+
+		Subject    string
+		Exchange   string
+		RoutingKey string
+		Topic      string
+
+		// Key is the message ID of NATS and AMQP messages, which JetStream
+		// uses to discard duplicates, and the key of Kafka messages
+		Key         string
+		Headers     map[string][]string
+		ContentType string
+		Payload     []byte
+
+		Username string
+		Password string
+		// JetStream waits for the NATS message to be stored by a stream
+		JetStream bool
+		// Tls connects to the Kafka brokers over TLS, NATS and AMQP use the
+		// tls:// and amqps:// schemes
+		Tls bool
+	}
+
+	// PublishAction publishes a message to NATS, an AMQP 0-9-1 broker like
+	// RabbitMQ, or Kafka and returns the broker's acknowledgment
+	PublishAction struct{}
+)
+
+func (publishAction PublishAction) RequiredKeys() (keys []ActionKey) {
+	keys = []ActionKey{
+		{"broker", StringActionKeyType},
+		{"url", StringActionKeyType},
+		{"payload", StringActionKeyType},
+	}
+	return
+}
+
+func (publishAction PublishAction) OptionalKeys() (keys []ActionKey) {
+	keys = []ActionKey{
+		{"subject", StringActionKeyType},
+		{"jetstream", BoolActionKeyType},
+		{"exchange", StringActionKeyType},
+		{"routing_key", StringActionKeyType},
+		{"topic", StringActionKeyType},
+		{"key", StringActionKeyType},
+		{"tls", BoolActionKeyType},
+		{"headers", ObjectActionKeyType},
+		{"content_type", StringActionKeyType},
+		{"username", StringActionKeyType},
+		{"password_secret", StringActionKeyType},
+	}
+	return
+}
+
+func (publishAction PublishAction) Validate(input Input) (err error) {
+	_, err = publishAction.parse(input)
+	return
+}
+
+func (publishAction PublishAction) parse(input Input) (publishReq *PublishActionReq, err error) {
+	var (
+		servers string
+	)
+	publishReq = &PublishActionReq{}
+	if publishReq.Broker, err = input.GetString("broker", true); err != nil {
+		return
+	}
+	if servers, err = input.GetString("url", true); err != nil {
+		return
+	}
+	for _, server := range strings.Split(servers, ",") {
+		if server = strings.TrimSpace(server); server != "" {
+			publishReq.Servers = append(publishReq.Servers, server)
+		}
+	}
+	if len(publishReq.Servers) == 0 {
+		err = fmt.Errorf("missing required field: url")
+		return
+	}
+
+	switch publishReq.Broker {
+	case NatsBroker:
+		if publishReq.Subject, err = input.GetString("subject", true); err != nil {
+			return
+		}
+		if publishReq.JetStream, err = input.GetBool("jetstream", false); err != nil {
+			return
+		}
+	case AmqpBroker:
+		if len(publishReq.Servers) > 1 {
+			err = fmt.Errorf("url should be a single AMQP URL")
+			return
+		}
+		if publishReq.Exchange, err = input.GetString("exchange", false); err != nil {
+			return
+		}
+		if publishReq.RoutingKey, err = input.GetString("routing_key", false); err != nil {
+			return
+		}
+		if publishReq.Exchange == "" && publishReq.RoutingKey == "" {
+			err = fmt.Errorf("Either exchange or routing_key should be provided")
+			return
+		}
+	case KafkaBroker:
+		if publishReq.Topic, err = input.GetString("topic", true); err != nil {
+			return
+		}
+		if publishReq.Tls, err = input.GetBool("tls", false); err != nil {
+			return
+		}
+	default:
+		err = fmt.Errorf("Unsupported broker %s", publishReq.Broker)
+		return
+	}
+
+	if publishReq.Key, err = input.GetString("key", false); err != nil {
+		return
+	}
+	if publishReq.Headers, err = input.GetStringMap("headers"); err != nil {
+		return
+	}
+	if publishReq.ContentType, err = input.GetString("content_type", false); err != nil {
+		return
+	}
+	if publishReq.Username, err = input.GetString("username", false); err != nil {
+		return
+	}
+	if _, hasPassword := input["password_secret"]; publishReq.Username != "" && !hasPassword {
+		err = fmt.Errorf("password_secret is required along with username")
+		return
+	}
+
+	// The payload is usually the output of a previous job, which is
+	// published as JSON
+	switch payload := input["payload"].(type) {
+	case nil:
+		err = fmt.Errorf("missing required field: payload")
+		return
+	case string:
+		publishReq.Payload = []byte(payload)
+		if publishReq.ContentType == "" {
+			publishReq.ContentType = "text/plain"
+		}
+	default:
+		if publishReq.Payload, err = json.Marshal(payload); err != nil {
+			return
+		}
+		if publishReq.ContentType == "" {
+			publishReq.ContentType = "application/json"
+		}
+	}
+	return
+}
+
+func (publishAction PublishAction) Execute(input Input) (output Output, err error) {
+	return publishAction.ExecuteContext(context.Background(), input, nil)
+}
+
+// ExecuteContext publishes the message and waits for the broker to
+// acknowledge it, or for the job to time out. The password is read from the
+// user's secrets.
+func (publishAction PublishAction) ExecuteContext(ctx context.Context, input Input, getSecret SecretGetter) (output Output, err error) {
+	var (
+		publishReq *PublishActionReq
+	)
+	if publishReq, err = publishAction.parse(input); err != nil {
+		return
+	}
+	if publishReq.Password, err = getSecret.GetSecret(input, "password_secret", false); err != nil {
+		return
+	}
+
+	switch publishReq.Broker {
+	case NatsBroker:
+		output, err = publishReq.publishNats(ctx)
+	case AmqpBroker:
+		output, err = publishReq.publishAmqp(ctx)
+	case KafkaBroker:
+		output, err = publishReq.publishKafka(ctx)
+	}
+	if err != nil {
+		err = fmt.Errorf("Failed to publish to %s: %w", publishReq.Broker, err)
+		return
+	}
+	output["broker"] = publishReq.Broker
+	return
+}
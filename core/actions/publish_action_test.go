@@ -0,0 +1,275 @@
+package actions
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	natsserver "github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestNatsServer runs an embedded NATS server with JetStream, which
+// accepts the user cronny with the password hunter2
+func newTestNatsServer(t *testing.T) *natsserver.Server {
+	server, err := natsserver.NewServer(&natsserver.Options{
+		Host:      "127.0.0.1",
+		Port:      -1,
+		JetStream: true,
+		StoreDir:  t.TempDir(),
+		Username:  "cronny",
+		Password:  "hunter2",
+		NoLog:     true,
+		NoSigs:    true,
+	})
+	require.NoError(t, err)
+	go server.Start()
+	require.True(t, server.ReadyForConnections(5*time.Second))
+	t.Cleanup(server.Shutdown)
+	return server
+}
+
+type fakeAmqpPublisher struct {
+	exchange   string
+	routingKey string
+	msg        amqp.Publishing
+	err        error
+	closed     bool
+}
+
+func (publisher *fakeAmqpPublisher) Publish(ctx context.Context, exchange, routingKey string, msg amqp.Publishing) (deliveryTag uint64, err error) {
+	publisher.exchange, publisher.routingKey, publisher.msg = exchange, routingKey, msg
+	return 1, publisher.err
+}
+
+func (publisher *fakeAmqpPublisher) Close() error {
+	publisher.closed = true
+	return nil
+}
+
+// useFakeAmqpPublisher replaces the broker with the publisher for the
+// duration of the test and records the URL and the config dialed
+func useFakeAmqpPublisher(t *testing.T, publisher *fakeAmqpPublisher) (dialed *amqp.Config) {
+	dialed = &amqp.Config{}
+	prevDialAmqp := dialAmqp
+	dialAmqp = func(ctx context.Context, amqpUrl string, amqpConfig amqp.Config) (amqpPublisher, error) {
+		*dialed = amqpConfig
+		return publisher, nil
+	}
+	t.Cleanup(func() { dialAmqp = prevDialAmqp })
+	return
+}
+
+type fakeKafkaProducer struct {
+	publishReq *PublishActionReq
+	msg        kafka.Message
+	closed     bool
+}
+
+func (producer *fakeKafkaProducer) Produce(ctx context.Context, msg kafka.Message) (written kafka.Message, err error) {
+	producer.msg = msg
+	written = msg
+	written.Topic, written.Partition, written.Offset = producer.publishReq.Topic, 2, 41
+	return
+}
+
+func (producer *fakeKafkaProducer) Close() error {
+	producer.closed = true
+	return nil
+}
+
+// ==========================================================
+// TestPublishAction_Execute
+
+func TestPublishAction_Execute_Nats(t *testing.T) {
+	server := newTestNatsServer(t)
+	conn, err := nats.Connect(server.ClientURL(), nats.UserInfo("cronny", "hunter2"))
+	require.NoError(t, err)
+	defer conn.Close()
+	sub, err := conn.SubscribeSync("events.backup")
+	require.NoError(t, err)
+	require.NoError(t, conn.Flush())
+	getSecret := testSecretGetter(map[string]string{"NATS_PASSWORD": "hunter2"})
+
+	output, err := PublishAction{}.ExecuteContext(context.Background(), Input{
+		"broker":          NatsBroker,
+		"url":             server.ClientURL(),
+		"subject":         "events.backup",
+		"payload":         map[string]interface{}{"status": "done"},
+		"headers":         map[string]interface{}{"X-Trigger": "nightly"},
+		"username":        "cronny",
+		"password_secret": "NATS_PASSWORD",
+	}, getSecret)
+	require.NoError(t, err)
+	assert.Equal(t, Output{"broker": NatsBroker, "subject": "events.backup"}, output)
+
+	msg, err := sub.NextMsg(time.Second)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"status": "done"}`, string(msg.Data))
+	assert.Equal(t, "nightly", msg.Header.Get("X-Trigger"))
+	assert.Equal(t, "application/json", msg.Header.Get("Content-Type"))
+}
+
+func TestPublishAction_Execute_NatsJetStream(t *testing.T) {
+	server := newTestNatsServer(t)
+	conn, err := nats.Connect(server.ClientURL(), nats.UserInfo("cronny", "hunter2"))
+	require.NoError(t, err)
+	defer conn.Close()
+	js, err := jetstream.New(conn)
+	require.NoError(t, err)
+	_, err = js.CreateStream(context.Background(), jetstream.StreamConfig{Name: "EVENTS", Subjects: []string{"events.>"}})
+	require.NoError(t, err)
+	getSecret := testSecretGetter(map[string]string{"NATS_PASSWORD": "hunter2"})
+
+	input := Input{
+		"broker":          NatsBroker,
+		"url":             server.ClientURL(),
+		"subject":         "events.backup",
+		"payload":         "done",
+		"key":             "backup-2024-05-01",
+		"jetstream":       true,
+		"username":        "cronny",
+		"password_secret": "NATS_PASSWORD",
+	}
+	output, err := PublishAction{}.ExecuteContext(context.Background(), input, getSecret)
+	require.NoError(t, err)
+	assert.Equal(t, "EVENTS", output["stream"])
+	assert.Equal(t, uint64(1), output["sequence"])
+	assert.Equal(t, false, output["duplicate"])
+
+	// The key discards the messages published again, eg. by a retried job
+	output, err = PublishAction{}.ExecuteContext(context.Background(), input, getSecret)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), output["sequence"])
+	assert.Equal(t, true, output["duplicate"])
+}
+
+func TestPublishAction_Execute_NatsRejectsWrongPassword(t *testing.T) {
+	server := newTestNatsServer(t)
+	getSecret := testSecretGetter(map[string]string{"NATS_PASSWORD": "wrong"})
+
+	_, err := PublishAction{}.ExecuteContext(context.Background(), Input{
+		"broker":          NatsBroker,
+		"url":             server.ClientURL(),
+		"subject":         "events.backup",
+		"payload":         "done",
+		"username":        "cronny",
+		"password_secret": "NATS_PASSWORD",
+	}, getSecret)
+	assert.ErrorContains(t, err, "Failed to publish to nats: nats: Authorization Violation")
+}
+
+func TestPublishAction_Execute_Amqp(t *testing.T) {
+	publisher := &fakeAmqpPublisher{}
+	dialed := useFakeAmqpPublisher(t, publisher)
+	getSecret := testSecretGetter(map[string]string{"AMQP_PASSWORD": "hunter2"})
+
+	output, err := PublishAction{}.ExecuteContext(context.Background(), Input{
+		"broker":      AmqpBroker,
+		"url":         "amqps://rabbitmq.example.com/events",
+		"exchange":    "events",
+		"routing_key": "backup.done",
+		"key":         "backup-2024-05-01",
+		"payload":     map[string]interface{}{"status": "done"},
+		"headers": map[string]interface{}{
+			"x-trigger": "nightly",
+			"x-tags":    []interface{}{"db", "nightly"},
+		},
+		"username":        "cronny",
+		"password_secret": "AMQP_PASSWORD",
+	}, getSecret)
+	require.NoError(t, err)
+	assert.Equal(t, Output{
+		"broker":       AmqpBroker,
+		"exchange":     "events",
+		"routing_key":  "backup.done",
+		"delivery_tag": uint64(1),
+	}, output)
+
+	assert.True(t, publisher.closed)
+	assert.Equal(t, "events", publisher.exchange)
+	assert.Equal(t, "backup.done", publisher.routingKey)
+	assert.JSONEq(t, `{"status": "done"}`, string(publisher.msg.Body))
+	assert.Equal(t, "application/json", publisher.msg.ContentType)
+	assert.Equal(t, "backup-2024-05-01", publisher.msg.MessageId)
+	assert.Equal(t, amqp.Persistent, publisher.msg.DeliveryMode)
+	assert.Equal(t, amqp.Table{"x-trigger": "nightly", "x-tags": []interface{}{"db", "nightly"}}, publisher.msg.Headers)
+	require.Len(t, dialed.SASL, 1)
+	assert.Equal(t, &amqp.PlainAuth{Username: "cronny", Password: "hunter2"}, dialed.SASL[0])
+}
+
+func TestPublishAction_Execute_AmqpRejected(t *testing.T) {
+	useFakeAmqpPublisher(t, &fakeAmqpPublisher{err: fmt.Errorf("The message was returned: NO_ROUTE")})
+
+	_, err := PublishAction{}.Execute(Input{
+		"broker":      AmqpBroker,
+		"url":         "amqp://localhost",
+		"routing_key": "missing-queue",
+		"payload":     "done",
+	})
+	assert.EqualError(t, err, "Failed to publish to amqp: The message was returned: NO_ROUTE")
+}
+
+func TestPublishAction_Execute_Kafka(t *testing.T) {
+	producer := &fakeKafkaProducer{}
+	prevNewKafkaProducer := newKafkaProducer
+	newKafkaProducer = func(publishReq *PublishActionReq) kafkaProducer {
+		producer.publishReq = publishReq
+		return producer
+	}
+	t.Cleanup(func() { newKafkaProducer = prevNewKafkaProducer })
+
+	output, err := PublishAction{}.Execute(Input{
+		"broker":  KafkaBroker,
+		"url":     "kafka-1:9092, kafka-2:9092",
+		"topic":   "events",
+		"key":     "backup",
+		"payload": "done",
+		"headers": map[string]interface{}{"x-trigger": "nightly", "x-attempt": float64(1)},
+		"tls":     true,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, Output{"broker": KafkaBroker, "topic": "events", "partition": 2, "offset": int64(41)}, output)
+
+	assert.True(t, producer.closed)
+	assert.Equal(t, []string{"kafka-1:9092", "kafka-2:9092"}, producer.publishReq.Servers)
+	assert.True(t, producer.publishReq.Tls)
+	assert.Equal(t, "backup", string(producer.msg.Key))
+	assert.Equal(t, "done", string(producer.msg.Value))
+	assert.Equal(t, []kafka.Header{
+		{Key: "Content-Type", Value: []byte("text/plain")},
+		{Key: "x-attempt", Value: []byte("1")},
+		{Key: "x-trigger", Value: []byte("nightly")},
+	}, producer.msg.Headers)
+}
+
+// ==========================================================
+// TestPublishAction_Validate
+
+func TestPublishAction_Validate_InvalidInput(t *testing.T) {
+	testCases := []struct {
+		name  string
+		input Input
+	}{
+		{name: "Unsupported broker", input: Input{"broker": "sqs", "url": "https://sqs.example.com", "payload": "done"}},
+		{name: "Missing url", input: Input{"broker": NatsBroker, "url": " , ", "subject": "events", "payload": "done"}},
+		{name: "Missing subject", input: Input{"broker": NatsBroker, "url": "nats://localhost", "payload": "done"}},
+		{name: "Missing topic", input: Input{"broker": KafkaBroker, "url": "localhost:9092", "payload": "done"}},
+		{name: "Missing routing", input: Input{"broker": AmqpBroker, "url": "amqp://localhost", "payload": "done"}},
+		{name: "Several AMQP urls", input: Input{"broker": AmqpBroker, "url": "amqp://a,amqp://b", "routing_key": "q", "payload": "done"}},
+		{name: "Missing payload", input: Input{"broker": NatsBroker, "url": "nats://localhost", "subject": "events"}},
+		{name: "Missing password", input: Input{"broker": NatsBroker, "url": "nats://localhost", "subject": "events", "payload": "done", "username": "cronny"}},
+		{name: "Invalid headers", input: Input{"broker": NatsBroker, "url": "nats://localhost", "subject": "events", "payload": "done", "headers": "x-trigger"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Error(t, PublishAction{}.Validate(tc.input))
+		})
+	}
+}
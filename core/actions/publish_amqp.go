@@ -0,0 +1,142 @@
+package actions
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// amqpConnectTimeout bounds connecting to the broker when the job has no deadline
+const amqpConnectTimeout = 30 * time.Second
+
+type (
+	// amqpPublisher publishes messages on a channel in confirm mode
+	amqpPublisher interface {
+		// Publish returns the delivery tag of the message once the broker
+		// confirmed it
+		Publish(ctx context.Context, exchange, routingKey string, msg amqp.Publishing) (deliveryTag uint64, err error)
+		Close() error
+	}
+
+	amqpChannelPublisher struct {
+		conn    *amqp.Connection
+		channel *amqp.Channel
+		returns chan amqp.Return
+	}
+)
+
+var (
+	// dialAmqp connects to the broker, it's replaced in tests
+	dialAmqp = func(ctx context.Context, amqpUrl string, amqpConfig amqp.Config) (publisher amqpPublisher, err error) {
+		// The deadline bounds the handshake, it's cleared once the
+		// connection is open
+		amqpConfig.Dial = func(network, addr string) (conn net.Conn, err error) {
+			dialer := &net.Dialer{}
+			if conn, err = dialer.DialContext(ctx, network, addr); err != nil {
+				return
+			}
+			deadline := time.Now().Add(amqpConnectTimeout)
+			if ctxDeadline, hasDeadline := ctx.Deadline(); hasDeadline && ctxDeadline.Before(deadline) {
+				deadline = ctxDeadline
+			}
+			err = conn.SetDeadline(deadline)
+			return
+		}
+		channelPublisher := &amqpChannelPublisher{}
+		if channelPublisher.conn, err = amqp.DialConfig(amqpUrl, amqpConfig); err != nil {
+			return
+		}
+		if channelPublisher.channel, err = channelPublisher.conn.Channel(); err != nil {
+			channelPublisher.conn.Close()
+			return
+		}
+		if err = channelPublisher.channel.Confirm(false); err != nil {
+			channelPublisher.conn.Close()
+			return
+		}
+		channelPublisher.returns = channelPublisher.channel.NotifyReturn(make(chan amqp.Return, 1))
+		publisher = channelPublisher
+		return
+	}
+)
+
+// Publish publishes the message as mandatory so that the broker returns it
+// rather than dropping it when no queue is bound to the routing key
+func (publisher *amqpChannelPublisher) Publish(ctx context.Context, exchange, routingKey string, msg amqp.Publishing) (deliveryTag uint64, err error) {
+	var (
+		confirmation *amqp.DeferredConfirmation
+		acked        bool
+	)
+	if confirmation, err = publisher.channel.PublishWithDeferredConfirmWithContext(ctx, exchange, routingKey, true, false, msg); err != nil {
+		return
+	}
+	if acked, err = confirmation.WaitContext(ctx); err != nil {
+		return
+	}
+	if !acked {
+		err = fmt.Errorf("The broker rejected the message")
+		return
+	}
+	// Returned messages are sent before their confirmation
+	select {
+	case returned := <-publisher.returns:
+		err = fmt.Errorf("The message was returned: %s", returned.ReplyText)
+		return
+	default:
+	}
+	deliveryTag = confirmation.DeliveryTag
+	return
+}
+
+func (publisher *amqpChannelPublisher) Close() error {
+	return publisher.conn.Close()
+}
+
+// publishAmqp publishes the message to the exchange, the default exchange
+// routes it to the queue named by the routing key
+func (publishReq *PublishActionReq) publishAmqp(ctx context.Context) (output Output, err error) {
+	var (
+		publisher   amqpPublisher
+		deliveryTag uint64
+	)
+	amqpConfig := amqp.Config{Properties: amqp.NewConnectionProperties()}
+	amqpConfig.Properties.SetClientConnectionName("cronny")
+	if publishReq.Username != "" {
+		amqpConfig.SASL = []amqp.Authentication{&amqp.PlainAuth{Username: publishReq.Username, Password: publishReq.Password}}
+	}
+	if publisher, err = dialAmqp(ctx, publishReq.Servers[0], amqpConfig); err != nil {
+		return
+	}
+	defer publisher.Close()
+
+	msg := amqp.Publishing{
+		Headers:      amqp.Table{},
+		ContentType:  publishReq.ContentType,
+		DeliveryMode: amqp.Persistent,
+		MessageId:    publishReq.Key,
+		Timestamp:    time.Now(),
+		Body:         publishReq.Payload,
+	}
+	for key, vals := range publishReq.Headers {
+		msg.Headers[key] = vals[0]
+		if len(vals) > 1 {
+			list := make([]interface{}, 0, len(vals))
+			for _, val := range vals {
+				list = append(list, val)
+			}
+			msg.Headers[key] = list
+		}
+	}
+	if deliveryTag, err = publisher.Publish(ctx, publishReq.Exchange, publishReq.RoutingKey, msg); err != nil {
+		return
+	}
+	output = Output{
+		"exchange":     publishReq.Exchange,
+		"routing_key":  publishReq.RoutingKey,
+		"delivery_tag": deliveryTag,
+	}
+	return
+}
@@ -0,0 +1,109 @@
+package actions
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"sort"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl/plain"
+)
+
+type (
+	// kafkaProducer writes messages to Kafka
+	kafkaProducer interface {
+		// Produce returns the message with the partition and the offset it
+		// was written at once every in-sync replica acknowledged it
+		Produce(ctx context.Context, msg kafka.Message) (written kafka.Message, err error)
+		Close() error
+	}
+
+	kafkaWriterProducer struct {
+		writer *kafka.Writer
+	}
+)
+
+var (
+	// newKafkaProducer connects to the brokers, it's replaced in tests
+	newKafkaProducer = func(publishReq *PublishActionReq) kafkaProducer {
+		transport := &kafka.Transport{ClientID: "cronny"}
+		if publishReq.Tls {
+			transport.TLS = &tls.Config{}
+		}
+		if publishReq.Username != "" {
+			transport.SASL = plain.Mechanism{Username: publishReq.Username, Password: publishReq.Password}
+		}
+		return &kafkaWriterProducer{
+			writer: &kafka.Writer{
+				Addr:     kafka.TCP(publishReq.Servers...),
+				Topic:    publishReq.Topic,
+				Balancer: &kafka.Hash{},
+				// The message is written on its own rather than waiting for
+				// a batch to fill up
+				BatchSize:    1,
+				RequiredAcks: kafka.RequireAll,
+				Transport:    transport,
+			},
+		}
+	}
+)
+
+func (producer *kafkaWriterProducer) Produce(ctx context.Context, msg kafka.Message) (written kafka.Message, err error) {
+	// The writer only sets the partition and the offset on the messages
+	// passed to the completion function
+	producer.writer.Completion = func(messages []kafka.Message, completionErr error) {
+		if completionErr == nil && len(messages) == 1 {
+			written = messages[0]
+		}
+	}
+	if err = producer.writer.WriteMessages(ctx, msg); err != nil {
+		return
+	}
+	return
+}
+
+func (producer *kafkaWriterProducer) Close() error {
+	return producer.writer.Close()
+}
+
+// publishKafka writes the message to the topic, messages with the same key
+// go to the same partition
+func (publishReq *PublishActionReq) publishKafka(ctx context.Context) (output Output, err error) {
+	var (
+		written kafka.Message
+	)
+	producer := newKafkaProducer(publishReq)
+	defer producer.Close()
+
+	msg := kafka.Message{
+		Value:   publishReq.Payload,
+		Headers: []kafka.Header{{Key: "Content-Type", Value: []byte(publishReq.ContentType)}},
+	}
+	if publishReq.Key != "" {
+		msg.Key = []byte(publishReq.Key)
+	}
+	keys := make([]string, 0, len(publishReq.Headers))
+	for key := range publishReq.Headers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		for _, val := range publishReq.Headers[key] {
+			msg.Headers = append(msg.Headers, kafka.Header{Key: key, Value: []byte(val)})
+		}
+	}
+	if written, err = producer.Produce(ctx, msg); err != nil {
+		return
+	}
+	if written.Topic == "" {
+		err = fmt.Errorf("The brokers didn't acknowledge the message")
+		return
+	}
+	output = Output{
+		"topic":     written.Topic,
+		"partition": written.Partition,
+		"offset":    written.Offset,
+	}
+	return
+}
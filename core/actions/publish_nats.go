@@ -0,0 +1,81 @@
+package actions
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// natsConnectTimeout bounds connecting to NATS, and flushing, when the job
+// has no deadline
+const natsConnectTimeout = 10 * time.Second
+
+// publishNats publishes the message to the subject. Core NATS doesn't
+// acknowledge messages so the connection is flushed, JetStream returns the
+// stream and the sequence the message was stored at.
+func (publishReq *PublishActionReq) publishNats(ctx context.Context) (output Output, err error) {
+	var (
+		conn   *nats.Conn
+		js     jetstream.JetStream
+		pubAck *jetstream.PubAck
+	)
+	connectTimeout := natsConnectTimeout
+	if deadline, hasDeadline := ctx.Deadline(); hasDeadline && time.Until(deadline) < connectTimeout {
+		connectTimeout = time.Until(deadline)
+	}
+	options := []nats.Option{
+		nats.Name("cronny"),
+		nats.Timeout(connectTimeout),
+		nats.NoReconnect(),
+	}
+	if publishReq.Username != "" {
+		options = append(options, nats.UserInfo(publishReq.Username, publishReq.Password))
+	}
+	if conn, err = nats.Connect(strings.Join(publishReq.Servers, ","), options...); err != nil {
+		return
+	}
+	defer conn.Close()
+
+	msg := nats.NewMsg(publishReq.Subject)
+	msg.Data = publishReq.Payload
+	for key, vals := range publishReq.Headers {
+		msg.Header[key] = vals
+	}
+	msg.Header.Set("Content-Type", publishReq.ContentType)
+	if publishReq.Key != "" {
+		msg.Header.Set(nats.MsgIdHdr, publishReq.Key)
+	}
+
+	if !publishReq.JetStream {
+		if err = conn.PublishMsg(msg); err != nil {
+			return
+		}
+		// Flushing requires a deadline
+		if _, hasDeadline := ctx.Deadline(); !hasDeadline {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, natsConnectTimeout)
+			defer cancel()
+		}
+		if err = conn.FlushWithContext(ctx); err != nil {
+			return
+		}
+		output = Output{"subject": publishReq.Subject}
+		return
+	}
+	if js, err = jetstream.New(conn); err != nil {
+		return
+	}
+	if pubAck, err = js.PublishMsg(ctx, msg); err != nil {
+		return
+	}
+	output = Output{
+		"subject":   publishReq.Subject,
+		"stream":    pubAck.Stream,
+		"sequence":  pubAck.Sequence,
+		"duplicate": pubAck.Duplicate,
+	}
+	return
+}
@@ -0,0 +1,517 @@
+package actions
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/cronny/core/config"
+)
+
+const (
+	PutS3Operation    = S3OperationT("put")
+	GetS3Operation    = S3OperationT("get")
+	ListS3Operation   = S3OperationT("list")
+	DeleteS3Operation = S3OperationT("delete")
+
+	DefaultS3Region = "us-east-1"
+)
+
+type (
+	S3OperationT string
+
+	// S3ActionReq is the operation of an S3 job on a bucket
+	S3ActionReq struct {
+		Operation S3OperationT
+		Bucket    string
+		// Keys has the key of the object put or got, and the keys deleted
+		Keys []string
+
+		// Endpoint is AWS unless the job uses another S3-compatible
+		// service, eg. MinIO or R2. PathStyle puts the bucket in the path
+		// rather than in the host.
+		Endpoint    *url.URL
+		Region      string
+		PathStyle   bool
+		Credentials AwsCredentials
+
+		// Put
+		Content     []byte
+		ContentType string
+		Metadata    map[string]string
+
+		// List
+		Prefix    string
+		Delimiter string
+		MaxKeys   int
+
+		// now returns the signing time, replaced in tests
+		now func() time.Time
+	}
+
+	// S3Action puts, gets, lists and deletes the objects of a bucket on S3
+	// or any S3-compatible service. The credentials are read from the user's
+	// secrets.
+	S3Action struct{}
+
+	s3Object struct {
+		Key          string `xml:"Key"`
+		Size         int64  `xml:"Size"`
+		ETag         string `xml:"ETag"`
+		LastModified string `xml:"LastModified"`
+		StorageClass string `xml:"StorageClass"`
+	}
+
+	s3ListResult struct {
+		Contents       []s3Object `xml:"Contents"`
+		CommonPrefixes []struct {
+			Prefix string `xml:"Prefix"`
+		} `xml:"CommonPrefixes"`
+		IsTruncated           bool   `xml:"IsTruncated"`
+		NextContinuationToken string `xml:"NextContinuationToken"`
+	}
+
+	s3Error struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+)
+
+func (s3Action S3Action) RequiredKeys() (keys []ActionKey) {
+	keys = []ActionKey{
+		{"operation", StringActionKeyType},
+		{"bucket", StringActionKeyType},
+		{"access_key_id_secret", StringActionKeyType},
+		{"secret_access_key_secret", StringActionKeyType},
+	}
+	return
+}
+
+func (s3Action S3Action) OptionalKeys() (keys []ActionKey) {
+	keys = []ActionKey{
+		{"key", StringActionKeyType},
+		{"keys", ListActionKeyType},
+		{"endpoint", StringActionKeyType},
+		{"path_style", BoolActionKeyType},
+		{"region", StringActionKeyType},
+		{"session_token_secret", StringActionKeyType},
+		{"content", StringActionKeyType},
+		{"content_type", StringActionKeyType},
+		{"encoding", StringActionKeyType},
+		{"metadata", ObjectActionKeyType},
+		{"prefix", StringActionKeyType},
+		{"delimiter", StringActionKeyType},
+		{"max_keys", NumberActionKeyType},
+	}
+	return
+}
+
+func (s3Action S3Action) Validate(input Input) (err error) {
+	_, err = s3Action.parse(input)
+	return
+}
+
+func (s3Action S3Action) parse(input Input) (s3Req *S3ActionReq, err error) {
+	var (
+		operation string
+		endpoint  string
+		key       string
+	)
+	s3Req = &S3ActionReq{now: time.Now}
+	if operation, err = input.GetString("operation", true); err != nil {
+		return
+	}
+	s3Req.Operation = S3OperationT(operation)
+	if s3Req.Bucket, err = input.GetString("bucket", true); err != nil {
+		return
+	}
+	if s3Req.Region, err = input.GetString("region", false); err != nil {
+		return
+	}
+	if s3Req.Region == "" {
+		s3Req.Region = DefaultS3Region
+	}
+	if endpoint, err = input.GetString("endpoint", false); err != nil {
+		return
+	}
+	if endpoint == "" {
+		endpoint = "https://s3." + s3Req.Region + ".amazonaws.com"
+	}
+	if s3Req.Endpoint, err = url.Parse(endpoint); err != nil || s3Req.Endpoint.Host == "" ||
+		(s3Req.Endpoint.Scheme != "http" && s3Req.Endpoint.Scheme != "https") {
+		err = fmt.Errorf("Invalid endpoint %s", endpoint)
+		return
+	}
+	if s3Req.PathStyle, err = input.GetBool("path_style", false); err != nil {
+		return
+	}
+	// Bucket names with dots don't match the certificates of virtual hosts
+	if strings.Contains(s3Req.Bucket, ".") && s3Req.Endpoint.Scheme == "https" {
+		s3Req.PathStyle = true
+	}
+
+	if key, err = input.GetString("key", false); err != nil {
+		return
+	}
+	if key != "" {
+		s3Req.Keys = []string{key}
+	}
+	switch s3Req.Operation {
+	case PutS3Operation:
+		if len(s3Req.Keys) == 0 {
+			err = fmt.Errorf("missing required field: key")
+			return
+		}
+		err = s3Req.parsePut(input)
+	case GetS3Operation:
+		if len(s3Req.Keys) == 0 {
+			err = fmt.Errorf("missing required field: key")
+			return
+		}
+	case ListS3Operation:
+		err = s3Req.parseList(input)
+	case DeleteS3Operation:
+		var keys []string
+		if keys, err = input.GetStringList("keys"); err != nil {
+			return
+		}
+		s3Req.Keys = append(s3Req.Keys, keys...)
+		if len(s3Req.Keys) == 0 {
+			err = fmt.Errorf("Either key or keys should be provided")
+			return
+		}
+		if len(s3Req.Keys) > config.MaxS3ListKeys {
+			err = fmt.Errorf("Can't delete more than %d keys", config.MaxS3ListKeys)
+			return
+		}
+	default:
+		err = fmt.Errorf("Unsupported operation %s", operation)
+		return
+	}
+	return
+}
+
+// parsePut parses the content of the object, which is usually the output of
+// a previous job. Content which isn't a string is put as JSON and binary
+// content can be base64 encoded along with "encoding": "base64".
+func (s3Req *S3ActionReq) parsePut(input Input) (err error) {
+	var (
+		encoding string
+		metadata map[string][]string
+	)
+	if s3Req.ContentType, err = input.GetString("content_type", false); err != nil {
+		return
+	}
+	if encoding, err = input.GetString("encoding", false); err != nil {
+		return
+	}
+	switch content := input["content"].(type) {
+	case nil:
+		err = fmt.Errorf("missing required field: content")
+		return
+	case string:
+		s3Req.Content = []byte(content)
+	default:
+		if s3Req.Content, err = json.Marshal(content); err != nil {
+			return
+		}
+		if s3Req.ContentType == "" {
+			s3Req.ContentType = "application/json"
+		}
+	}
+	switch encoding {
+	case "":
+	case "base64":
+		if s3Req.Content, err = base64.StdEncoding.DecodeString(string(s3Req.Content)); err != nil {
+			err = fmt.Errorf("Invalid base64 content: %w", err)
+			return
+		}
+	default:
+		err = fmt.Errorf("Unsupported encoding %s", encoding)
+		return
+	}
+	if len(s3Req.Content) > config.MaxS3ObjectBytes {
+		err = fmt.Errorf("content can't be more than %d bytes", config.MaxS3ObjectBytes)
+		return
+	}
+	if s3Req.ContentType == "" {
+		s3Req.ContentType = "application/octet-stream"
+	}
+
+	if metadata, err = input.GetStringMap("metadata"); err != nil {
+		return
+	}
+	s3Req.Metadata = make(map[string]string, len(metadata))
+	for key, vals := range metadata {
+		s3Req.Metadata[key] = strings.Join(vals, ",")
+	}
+	return
+}
+
+func (s3Req *S3ActionReq) parseList(input Input) (err error) {
+	var (
+		maxKeys float64
+	)
+	if s3Req.Prefix, err = input.GetString("prefix", false); err != nil {
+		return
+	}
+	if s3Req.Delimiter, err = input.GetString("delimiter", false); err != nil {
+		return
+	}
+	if maxKeys, err = input.GetNumber("max_keys"); err != nil {
+		return
+	}
+	if maxKeys < 0 || maxKeys != float64(int(maxKeys)) {
+		err = fmt.Errorf("max_keys should be a positive integer")
+		return
+	}
+	s3Req.MaxKeys = config.MaxS3ListKeys
+	if maxKeys > 0 && int(maxKeys) < s3Req.MaxKeys {
+		s3Req.MaxKeys = int(maxKeys)
+	}
+	return
+}
+
+// objectUrl returns the URL of the object, or of the bucket when the key is
+// empty. The path is encoded as SigV4 expects it.
+func (s3Req *S3ActionReq) objectUrl(key string, query url.Values) *url.URL {
+	objectUrl := *s3Req.Endpoint
+	path := strings.TrimSuffix(objectUrl.Path, "/") + "/" + key
+	if s3Req.PathStyle {
+		path = strings.TrimSuffix(objectUrl.Path, "/") + "/" + s3Req.Bucket + "/" + key
+	} else {
+		objectUrl.Host = s3Req.Bucket + "." + objectUrl.Host
+	}
+	objectUrl.Path = path
+	objectUrl.RawPath = awsUriEncode(path, false)
+	objectUrl.RawQuery = query.Encode()
+	return &objectUrl
+}
+
+// do sends the signed request. Errors returned by S3 are parsed from their
+// XML body.
+func (s3Req *S3ActionReq) do(ctx context.Context, method, key string, query url.Values, body []byte, header http.Header) (resp *http.Response, err error) {
+	var (
+		req *http.Request
+	)
+	if req, err = http.NewRequestWithContext(ctx, method, s3Req.objectUrl(key, query).String(), bytes.NewReader(body)); err != nil {
+		return
+	}
+	for headerKey, vals := range header {
+		req.Header[headerKey] = vals
+	}
+	SignAwsSigV4(req, body, s3Req.Credentials, s3Req.Region, "s3", s3Req.now())
+	if resp, err = httpClient.Do(req); err != nil {
+		return
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+		return
+	}
+	defer resp.Body.Close()
+	var s3Err s3Error
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	xml.Unmarshal(respBody, &s3Err)
+	if s3Err.Code == "" {
+		s3Err.Code = http.StatusText(resp.StatusCode)
+	}
+	err = fmt.Errorf("S3 returned status %d: %s", resp.StatusCode, s3Err.Code)
+	if s3Err.Message != "" {
+		err = fmt.Errorf("%w: %s", err, s3Err.Message)
+	}
+	resp = nil
+	return
+}
+
+func (s3Req *S3ActionReq) put(ctx context.Context) (output Output, err error) {
+	var (
+		resp *http.Response
+	)
+	header := http.Header{"Content-Type": {s3Req.ContentType}}
+	for key, val := range s3Req.Metadata {
+		header.Set("X-Amz-Meta-"+key, val)
+	}
+	if resp, err = s3Req.do(ctx, http.MethodPut, s3Req.Keys[0], nil, s3Req.Content, header); err != nil {
+		return
+	}
+	resp.Body.Close()
+	output = Output{
+		"bucket": s3Req.Bucket,
+		"key":    s3Req.Keys[0],
+		"size":   len(s3Req.Content),
+		"etag":   strings.Trim(resp.Header.Get("ETag"), `"`),
+	}
+	if versionID := resp.Header.Get("X-Amz-Version-Id"); versionID != "" {
+		output["version_id"] = versionID
+	}
+	return
+}
+
+// get returns the object as its content. JSON is parsed so that the next jobs
+// can refer to its keys, text is returned as is and binary content as base64.
+func (s3Req *S3ActionReq) get(ctx context.Context) (output Output, err error) {
+	var (
+		resp    *http.Response
+		content []byte
+	)
+	if resp, err = s3Req.do(ctx, http.MethodGet, s3Req.Keys[0], nil, nil, nil); err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if content, err = io.ReadAll(io.LimitReader(resp.Body, int64(config.MaxS3ObjectBytes)+1)); err != nil {
+		return
+	}
+	if len(content) > config.MaxS3ObjectBytes {
+		err = fmt.Errorf("Object %s is more than %d bytes", s3Req.Keys[0], config.MaxS3ObjectBytes)
+		return
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	output = Output{
+		"bucket":        s3Req.Bucket,
+		"key":           s3Req.Keys[0],
+		"size":          len(content),
+		"content_type":  contentType,
+		"etag":          strings.Trim(resp.Header.Get("ETag"), `"`),
+		"last_modified": resp.Header.Get("Last-Modified"),
+	}
+	metadata := map[string]interface{}{}
+	for key, vals := range resp.Header {
+		if metaKey, isMeta := strings.CutPrefix(key, "X-Amz-Meta-"); isMeta {
+			metadata[strings.ToLower(metaKey)] = strings.Join(vals, ",")
+		}
+	}
+	output["metadata"] = metadata
+
+	var parsed interface{}
+	switch {
+	case strings.HasPrefix(contentType, "application/json") && json.Unmarshal(content, &parsed) == nil:
+		output["content"] = parsed
+	case utf8.Valid(content):
+		output["content"] = string(content)
+	default:
+		output["content"] = base64.StdEncoding.EncodeToString(content)
+		output["encoding"] = "base64"
+	}
+	return
+}
+
+// list returns the objects under the prefix, following the pages of the
+// listing up to MaxKeys
+func (s3Req *S3ActionReq) list(ctx context.Context) (output Output, err error) {
+	var (
+		resp     *http.Response
+		objects  = []interface{}{}
+		prefixes = []interface{}{}
+		result   s3ListResult
+	)
+	query := url.Values{"list-type": {"2"}}
+	if s3Req.Prefix != "" {
+		query.Set("prefix", s3Req.Prefix)
+	}
+	if s3Req.Delimiter != "" {
+		query.Set("delimiter", s3Req.Delimiter)
+	}
+	for {
+		query.Set("max-keys", strconv.Itoa(s3Req.MaxKeys-len(objects)))
+		if resp, err = s3Req.do(ctx, http.MethodGet, "", query, nil, nil); err != nil {
+			return
+		}
+		result = s3ListResult{}
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			err = fmt.Errorf("Invalid listing: %w", err)
+			return
+		}
+		for _, object := range result.Contents {
+			objects = append(objects, map[string]interface{}{
+				"key":           object.Key,
+				"size":          object.Size,
+				"etag":          strings.Trim(object.ETag, `"`),
+				"last_modified": object.LastModified,
+				"storage_class": object.StorageClass,
+			})
+		}
+		for _, commonPrefix := range result.CommonPrefixes {
+			prefixes = append(prefixes, commonPrefix.Prefix)
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" || len(objects) >= s3Req.MaxKeys {
+			break
+		}
+		query.Set("continuation-token", result.NextContinuationToken)
+	}
+	output = Output{
+		"bucket":          s3Req.Bucket,
+		"objects":         objects,
+		"common_prefixes": prefixes,
+		"count":           len(objects),
+		"truncated":       result.IsTruncated,
+	}
+	return
+}
+
+// delete deletes the objects one by one, S3 doesn't fail on missing keys
+func (s3Req *S3ActionReq) delete(ctx context.Context) (output Output, err error) {
+	var (
+		resp    *http.Response
+		deleted = []interface{}{}
+	)
+	for _, key := range s3Req.Keys {
+		if resp, err = s3Req.do(ctx, http.MethodDelete, key, nil, nil, nil); err != nil {
+			err = fmt.Errorf("Failed to delete %s after deleting %d objects: %w", key, len(deleted), err)
+			return
+		}
+		resp.Body.Close()
+		deleted = append(deleted, key)
+	}
+	output = Output{
+		"bucket":  s3Req.Bucket,
+		"deleted": deleted,
+	}
+	return
+}
+
+func (s3Action S3Action) Execute(input Input) (output Output, err error) {
+	return s3Action.ExecuteContext(context.Background(), input, nil)
+}
+
+// ExecuteContext runs the operation until it's done or the job times out
+func (s3Action S3Action) ExecuteContext(ctx context.Context, input Input, getSecret SecretGetter) (output Output, err error) {
+	var (
+		s3Req *S3ActionReq
+	)
+	if s3Req, err = s3Action.parse(input); err != nil {
+		return
+	}
+	if s3Req.Credentials.AccessKeyID, err = getSecret.GetSecret(input, "access_key_id_secret", true); err != nil {
+		return
+	}
+	if s3Req.Credentials.SecretAccessKey, err = getSecret.GetSecret(input, "secret_access_key_secret", true); err != nil {
+		return
+	}
+	if s3Req.Credentials.SessionToken, err = getSecret.GetSecret(input, "session_token_secret", false); err != nil {
+		return
+	}
+
+	switch s3Req.Operation {
+	case PutS3Operation:
+		output, err = s3Req.put(ctx)
+	case GetS3Operation:
+		output, err = s3Req.get(ctx)
+	case ListS3Operation:
+		output, err = s3Req.list(ctx)
+	case DeleteS3Operation:
+		output, err = s3Req.delete(ctx)
+	}
+	return
+}
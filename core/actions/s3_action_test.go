@@ -0,0 +1,328 @@
+package actions
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cronny/core/config"
+)
+
+type testS3Object struct {
+	content     []byte
+	contentType string
+	metadata    http.Header
+}
+
+// testS3Server is an S3 fake serving path-style requests. It verifies their
+// signature with the credentials AKID and SECRET.
+type testS3Server struct {
+	*httptest.Server
+	mu      sync.Mutex
+	objects map[string]*testS3Object
+}
+
+func newTestS3Server(t *testing.T) *testS3Server {
+	server := &testS3Server{objects: make(map[string]*testS3Object)}
+	server.Server = httptest.NewServer(http.HandlerFunc(server.serveHTTP))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func (server *testS3Server) writeError(w http.ResponseWriter, status int, code string) {
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<Error><Code>%s</Code><Message>%s</Message></Error>", code, strings.ToLower(code))
+}
+
+// verifySignature signs the request again at the time it was signed
+func (server *testS3Server) verifySignature(r *http.Request, body []byte) bool {
+	signTime, err := time.Parse(awsSigV4TimeFormat, r.Header.Get("X-Amz-Date"))
+	if err != nil {
+		return false
+	}
+	signed := r.Clone(r.Context())
+	signed.Header.Del("Authorization")
+	SignAwsSigV4(signed, body, AwsCredentials{AccessKeyID: "AKID", SecretAccessKey: "SECRET"}, "eu-west-1", "s3", signTime)
+	return signed.Header.Get("Authorization") == r.Header.Get("Authorization")
+}
+
+func (server *testS3Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	if !server.verifySignature(r, body) {
+		server.writeError(w, http.StatusForbidden, "SignatureDoesNotMatch")
+		return
+	}
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket != "reports" {
+		server.writeError(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	switch {
+	case r.Method == http.MethodPut:
+		object := &testS3Object{content: body, contentType: r.Header.Get("Content-Type"), metadata: http.Header{}}
+		for headerKey, vals := range r.Header {
+			if strings.HasPrefix(headerKey, "X-Amz-Meta-") {
+				object.metadata[headerKey] = vals
+			}
+		}
+		server.objects[key] = object
+		hash := md5.Sum(body)
+		w.Header().Set("ETag", `"`+hex.EncodeToString(hash[:])+`"`)
+	case r.Method == http.MethodGet && key == "":
+		server.list(w, r.URL.Query())
+	case r.Method == http.MethodGet:
+		object, isPresent := server.objects[key]
+		if !isPresent {
+			server.writeError(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		for headerKey, vals := range object.metadata {
+			w.Header()[headerKey] = vals
+		}
+		w.Header().Set("Content-Type", object.contentType)
+		w.Write(object.content)
+	case r.Method == http.MethodDelete:
+		delete(server.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// list lists the keys after the continuation token, which is the last key
+// of the previous page
+func (server *testS3Server) list(w http.ResponseWriter, query url.Values) {
+	maxKeys, _ := strconv.Atoi(query.Get("max-keys"))
+	prefix, delimiter := query.Get("prefix"), query.Get("delimiter")
+	keys := make([]string, 0, len(server.objects))
+	for key := range server.objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	result := struct {
+		XMLName               xml.Name `xml:"ListBucketResult"`
+		Contents              []s3Object
+		CommonPrefixes        []struct{ Prefix string }
+		IsTruncated           bool
+		NextContinuationToken string `xml:",omitempty"`
+	}{}
+	seenPrefixes := map[string]bool{}
+	for _, key := range keys {
+		if !strings.HasPrefix(key, prefix) || key <= query.Get("continuation-token") {
+			continue
+		}
+		if len(result.Contents) >= maxKeys {
+			result.IsTruncated = true
+			break
+		}
+		if delimiter != "" {
+			if idx := strings.Index(key[len(prefix):], delimiter); idx >= 0 {
+				commonPrefix := key[:len(prefix)+idx+len(delimiter)]
+				if !seenPrefixes[commonPrefix] {
+					seenPrefixes[commonPrefix] = true
+					result.CommonPrefixes = append(result.CommonPrefixes, struct{ Prefix string }{commonPrefix})
+				}
+				continue
+			}
+		}
+		result.Contents = append(result.Contents, s3Object{Key: key, Size: int64(len(server.objects[key].content)), StorageClass: "STANDARD"})
+		result.NextContinuationToken = key
+	}
+	if !result.IsTruncated {
+		result.NextContinuationToken = ""
+	}
+	xml.NewEncoder(w).Encode(result)
+}
+
+func (server *testS3Server) input(extra Input) Input {
+	input := Input{
+		"bucket":                   "reports",
+		"endpoint":                 server.URL,
+		"region":                   "eu-west-1",
+		"path_style":               true,
+		"access_key_id_secret":     "S3_KEY_ID",
+		"secret_access_key_secret": "S3_SECRET",
+	}
+	for key, val := range extra {
+		input[key] = val
+	}
+	return input
+}
+
+var testS3Secrets = testSecretGetter(map[string]string{"S3_KEY_ID": "AKID", "S3_SECRET": "SECRET"})
+
+// ==========================================================
+// TestS3Action_Execute
+
+func TestS3Action_Execute_PutAndGet(t *testing.T) {
+	server := newTestS3Server(t)
+
+	output, err := S3Action{}.ExecuteContext(context.Background(), server.input(Input{
+		"operation": "put",
+		"key":       "daily/2024-05-01 summary.json",
+		"content":   map[string]interface{}{"failed": float64(2)},
+		"metadata":  map[string]interface{}{"trigger": "nightly"},
+	}), testS3Secrets)
+	require.NoError(t, err)
+	assert.Equal(t, "daily/2024-05-01 summary.json", output["key"])
+	assert.Equal(t, 12, output["size"])
+	assert.NotEmpty(t, output["etag"])
+
+	output, err = S3Action{}.ExecuteContext(context.Background(), server.input(Input{
+		"operation": "get",
+		"key":       "daily/2024-05-01 summary.json",
+	}), testS3Secrets)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"failed": float64(2)}, output["content"], "JSON objects should be parsed")
+	assert.Equal(t, "application/json", output["content_type"])
+	assert.Equal(t, map[string]interface{}{"trigger": "nightly"}, output["metadata"])
+}
+
+func TestS3Action_Execute_PutAndGetBinary(t *testing.T) {
+	server := newTestS3Server(t)
+
+	_, err := S3Action{}.ExecuteContext(context.Background(), server.input(Input{
+		"operation": "put",
+		"key":       "logo.png",
+		"content":   "iVBORw==",
+		"encoding":  "base64",
+	}), testS3Secrets)
+	require.NoError(t, err)
+	assert.Equal(t, "\x89PNG", string(server.objects["logo.png"].content))
+	assert.Equal(t, "application/octet-stream", server.objects["logo.png"].contentType)
+
+	output, err := S3Action{}.ExecuteContext(context.Background(), server.input(Input{"operation": "get", "key": "logo.png"}), testS3Secrets)
+	require.NoError(t, err)
+	assert.Equal(t, "iVBORw==", output["content"])
+	assert.Equal(t, "base64", output["encoding"])
+}
+
+func TestS3Action_Execute_GetMissingObject(t *testing.T) {
+	server := newTestS3Server(t)
+
+	_, err := S3Action{}.ExecuteContext(context.Background(), server.input(Input{"operation": "get", "key": "missing.json"}), testS3Secrets)
+	assert.EqualError(t, err, "S3 returned status 404: NoSuchKey: nosuchkey")
+}
+
+func TestS3Action_Execute_RejectsWrongCredentials(t *testing.T) {
+	server := newTestS3Server(t)
+	getSecret := testSecretGetter(map[string]string{"S3_KEY_ID": "AKID", "S3_SECRET": "WRONG"})
+
+	_, err := S3Action{}.ExecuteContext(context.Background(), server.input(Input{"operation": "list"}), getSecret)
+	assert.ErrorContains(t, err, "SignatureDoesNotMatch")
+}
+
+func TestS3Action_Execute_ListAndDelete(t *testing.T) {
+	server := newTestS3Server(t)
+	for _, key := range []string{"daily/a.json", "daily/b.json", "daily/c.json", "daily/archive/d.json", "weekly/e.json"} {
+		server.objects[key] = &testS3Object{content: []byte("{}")}
+	}
+
+	// The listing follows the pages up to max_keys
+	prevMaxKeys := config.MaxS3ListKeys
+	config.MaxS3ListKeys = 2
+	output, err := S3Action{}.ExecuteContext(context.Background(), server.input(Input{"operation": "list", "prefix": "daily/"}), testS3Secrets)
+	config.MaxS3ListKeys = prevMaxKeys
+	require.NoError(t, err)
+	assert.Equal(t, 2, output["count"])
+	assert.Equal(t, true, output["truncated"])
+
+	output, err = S3Action{}.ExecuteContext(context.Background(), server.input(Input{
+		"operation": "list",
+		"prefix":    "daily/",
+		"delimiter": "/",
+	}), testS3Secrets)
+	require.NoError(t, err)
+	assert.Equal(t, 3, output["count"])
+	assert.Equal(t, false, output["truncated"])
+	assert.Equal(t, []interface{}{"daily/archive/"}, output["common_prefixes"])
+	objects := output["objects"].([]interface{})
+	assert.Equal(t, "daily/a.json", objects[0].(map[string]interface{})["key"])
+	assert.Equal(t, int64(2), objects[0].(map[string]interface{})["size"])
+
+	output, err = S3Action{}.ExecuteContext(context.Background(), server.input(Input{
+		"operation": "delete",
+		"keys":      []interface{}{"daily/a.json", "daily/b.json"},
+	}), testS3Secrets)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"daily/a.json", "daily/b.json"}, output["deleted"])
+	assert.NotContains(t, server.objects, "daily/a.json")
+	assert.Contains(t, server.objects, "daily/c.json")
+}
+
+// ==========================================================
+// TestS3ActionReq_ObjectUrl
+
+func TestS3ActionReq_ObjectUrl(t *testing.T) {
+	testCases := []struct {
+		name        string
+		input       Input
+		expectedUrl string
+	}{
+		{
+			name:        "AWS virtual host",
+			input:       Input{"bucket": "reports", "region": "eu-west-1"},
+			expectedUrl: "https://reports.s3.eu-west-1.amazonaws.com/daily/a%20b%2Bc.json",
+		},
+		{
+			name:        "Path style",
+			input:       Input{"bucket": "reports", "endpoint": "http://minio:9000", "path_style": true},
+			expectedUrl: "http://minio:9000/reports/daily/a%20b%2Bc.json",
+		},
+		{
+			name:        "Bucket with dots",
+			input:       Input{"bucket": "reports.example.com"},
+			expectedUrl: "https://s3.us-east-1.amazonaws.com/reports.example.com/daily/a%20b%2Bc.json",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.input["operation"] = "get"
+			tc.input["key"] = "daily/a b+c.json"
+			s3Req, err := S3Action{}.parse(tc.input)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedUrl, s3Req.objectUrl(s3Req.Keys[0], nil).String())
+		})
+	}
+}
+
+// ==========================================================
+// TestS3Action_Validate
+
+func TestS3Action_Validate_InvalidInput(t *testing.T) {
+	testCases := []struct {
+		name  string
+		input Input
+	}{
+		{name: "Unsupported operation", input: Input{"operation": "copy", "bucket": "reports", "key": "a"}},
+		{name: "Missing bucket", input: Input{"operation": "get", "key": "a"}},
+		{name: "Missing key", input: Input{"operation": "get", "bucket": "reports"}},
+		{name: "Missing content", input: Input{"operation": "put", "bucket": "reports", "key": "a"}},
+		{name: "Invalid base64", input: Input{"operation": "put", "bucket": "reports", "key": "a", "content": "!", "encoding": "base64"}},
+		{name: "Missing delete keys", input: Input{"operation": "delete", "bucket": "reports"}},
+		{name: "Invalid endpoint", input: Input{"operation": "list", "bucket": "reports", "endpoint": "minio:9000"}},
+		{name: "Invalid max keys", input: Input{"operation": "list", "bucket": "reports", "max_keys": float64(1.5)}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Error(t, S3Action{}.Validate(tc.input))
+		})
+	}
+}
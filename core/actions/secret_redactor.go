@@ -0,0 +1,27 @@
+package actions
+
+import (
+	"context"
+)
+
+type (
+	// SecretRedactor records a secret value an action obtained while
+	// executing, eg. an OAuth2 token, so that it's redacted from the job's
+	// execution and output
+	SecretRedactor func(value string)
+
+	secretRedactorKey struct{}
+)
+
+// ContextWithSecretRedactor returns a context carrying the redactor of the
+// secrets obtained by the actions executed with it
+func ContextWithSecretRedactor(ctx context.Context, redact SecretRedactor) context.Context {
+	return context.WithValue(ctx, secretRedactorKey{}, redact)
+}
+
+// redactSecret records the value with the redactor of the context, if any
+func redactSecret(ctx context.Context, value string) {
+	if redact, _ := ctx.Value(secretRedactorKey{}).(SecretRedactor); redact != nil {
+		redact(value)
+	}
+}
@@ -0,0 +1,194 @@
+package actions
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/cronny/core/config"
+	"github.com/cronny/core/helpers"
+)
+
+type (
+	// ShellActionReq is the command run by a shell job
+	ShellActionReq struct {
+		Command    []string
+		WorkingDir string
+		Env        []string
+		Stdin      string
+		Timeout    time.Duration
+	}
+
+	// ShellAction runs a command on the host executing the job. It's only
+	// available when enabled by the admin.
+	ShellAction struct{}
+)
+
+func (shellAction ShellAction) RequiredKeys() (keys []ActionKey) {
+	keys = []ActionKey{
+		{"command", ListActionKeyType},
+	}
+	return
+}
+
+func (shellAction ShellAction) OptionalKeys() (keys []ActionKey) {
+	keys = []ActionKey{
+		{"workdir", StringActionKeyType},
+		{"env", ObjectActionKeyType},
+		{"stdin", StringActionKeyType},
+		{"timeout_secs", NumberActionKeyType},
+	}
+	return
+}
+
+func (shellAction ShellAction) Validate(input Input) (err error) {
+	_, err = shellAction.parse(input)
+	return
+}
+
+func (shellAction ShellAction) parse(input Input) (shellReq *ShellActionReq, err error) {
+	var (
+		timeoutSecs float64
+	)
+	if !config.ShellActionEnabled {
+		err = fmt.Errorf("Shell jobs aren't enabled")
+		return
+	}
+	shellReq = &ShellActionReq{}
+
+	// A command string runs in a shell like the ones of Docker jobs, which
+	// needs sh to be allowed and then runs any command
+	command, isString := input["command"].(string)
+	if isString {
+		shellReq.Command = []string{"/bin/sh", "-c", command}
+	} else if shellReq.Command, err = input.GetStringList("command"); err != nil {
+		return
+	}
+	if len(shellReq.Command) == 0 || shellReq.Command[0] == "" {
+		err = fmt.Errorf("missing required field: command")
+		return
+	}
+	if shellReq.Command[0], err = allowedShellCommand(shellReq.Command[0]); err != nil {
+		if isString {
+			err = fmt.Errorf("Command strings are run by /bin/sh -c: %w", err)
+		}
+		return
+	}
+
+	if shellReq.WorkingDir, err = input.GetString("workdir", false); err != nil {
+		return
+	}
+	if shellReq.WorkingDir != "" && !filepath.IsAbs(shellReq.WorkingDir) {
+		err = fmt.Errorf("workdir should be an absolute path")
+		return
+	}
+	if shellReq.Env, err = parseEnv(input); err != nil {
+		return
+	}
+	if shellReq.Stdin, err = parseStdin(input); err != nil {
+		return
+	}
+	if timeoutSecs, err = input.GetNumber("timeout_secs"); err != nil {
+		return
+	}
+	if timeoutSecs < 0 {
+		err = fmt.Errorf("timeout_secs should be positive")
+		return
+	}
+	shellReq.Timeout = time.Duration(timeoutSecs * float64(time.Second))
+	return
+}
+
+// parseStdin reads stdin, which is usually the output of a previous job.
+// Values other than strings are written as JSON.
+func parseStdin(input Input) (stdin string, err error) {
+	switch rawStdin := input["stdin"].(type) {
+	case nil:
+	case string:
+		stdin = rawStdin
+	default:
+		var stdinB []byte
+		if stdinB, err = json.Marshal(rawStdin); err != nil {
+			return
+		}
+		stdin = string(stdinB)
+	}
+	return
+}
+
+// allowedShellCommand returns the path of the command when the admin allows
+// running it. The command and the allowed commands are names looked up in
+// the PATH or paths, no command is allowed when none are listed.
+func allowedShellCommand(command string) (commandPath string, err error) {
+	if commandPath, err = exec.LookPath(command); err != nil {
+		err = fmt.Errorf("Command %s not found: %w", command, err)
+		return
+	}
+	resolvedPath := resolveCommandPath(commandPath)
+	for _, allowed := range config.ShellAllowedCommands {
+		if allowedPath, lookErr := exec.LookPath(allowed); lookErr == nil && resolveCommandPath(allowedPath) == resolvedPath {
+			return
+		}
+	}
+	err = fmt.Errorf("Command %s isn't allowed", command)
+	return
+}
+
+// resolveCommandPath resolves the directory of the command so that eg.
+// /bin/sh and /usr/bin/sh match when /bin links to /usr/bin. The command
+// itself isn't resolved since multi-call binaries like busybox are linked
+// to by every command they implement.
+func resolveCommandPath(commandPath string) string {
+	dir, err := filepath.Abs(filepath.Dir(commandPath))
+	if err != nil {
+		return commandPath
+	}
+	if resolvedDir, err := filepath.EvalSymlinks(dir); err == nil {
+		dir = resolvedDir
+	}
+	return filepath.Join(dir, filepath.Base(commandPath))
+}
+
+func (shellAction ShellAction) Execute(input Input) (output Output, err error) {
+	return shellAction.ExecuteContext(context.Background(), input, nil)
+}
+
+// ExecuteContext runs the command until it exits, it's killed along with
+// the processes it started once the job times out. The output has the exit
+// code, stdout and stderr of the command.
+func (shellAction ShellAction) ExecuteContext(ctx context.Context, input Input, getSecret SecretGetter) (output Output, err error) {
+	var (
+		shellReq *ShellActionReq
+		result   *helpers.ShellResult
+	)
+	if shellReq, err = shellAction.parse(input); err != nil {
+		return
+	}
+
+	shellExecutor := &helpers.ShellExecutor{
+		Command: shellReq.Command,
+		Dir:     shellReq.WorkingDir,
+		// The environment of the executor has its own secrets, only the
+		// PATH is passed on
+		Env:            append([]string{"PATH=" + os.Getenv("PATH")}, shellReq.Env...),
+		Stdin:          shellReq.Stdin,
+		Timeout:        shellReq.Timeout,
+		MaxOutputBytes: config.MaxShellOutputBytes,
+	}
+	// A command exiting with a non-zero code has a result so that its
+	// output is recorded with the error
+	if result, err = shellExecutor.Execute(ctx); result == nil {
+		return
+	}
+
+	output = Output{
+		"exit_code": result.ExitCode,
+		"stdout":    result.Stdout,
+		"stderr":    result.Stderr,
+	}
+	return
+}
@@ -0,0 +1,124 @@
+package actions
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cronny/core/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// enableShellAction enables shell jobs for the allowed commands until the test ends
+func enableShellAction(t *testing.T, allowedCommands ...string) {
+	prevEnabled, prevAllowed := config.ShellActionEnabled, config.ShellAllowedCommands
+	config.ShellActionEnabled, config.ShellAllowedCommands = true, allowedCommands
+	t.Cleanup(func() {
+		config.ShellActionEnabled, config.ShellAllowedCommands = prevEnabled, prevAllowed
+	})
+}
+
+// ==========================================================
+// TestShellAction_Execute
+
+func TestShellAction_Execute(t *testing.T) {
+	enableShellAction(t, "sh")
+
+	output, err := ShellAction{}.Execute(Input{
+		"command": `cat; echo " in $PWD as $GREETING"`,
+		"workdir": "/tmp",
+		"env":     map[string]interface{}{"GREETING": "hello"},
+		"stdin":   map[string]interface{}{"id": float64(1)},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 0, output["exit_code"])
+	assert.Equal(t, `{"id":1} in /tmp as hello`+"\n", output["stdout"])
+	assert.Equal(t, "", output["stderr"])
+}
+
+func TestShellAction_Execute_RecordsOutputOnNonZeroExit(t *testing.T) {
+	enableShellAction(t, "sh")
+
+	output, err := ShellAction{}.Execute(Input{"command": "echo partial; echo 'no such table' >&2; exit 3"})
+	assert.EqualError(t, err, "Command exited with code 3: no such table")
+	assert.Equal(t, 3, output["exit_code"])
+	assert.Equal(t, "partial\n", output["stdout"])
+	assert.Equal(t, "no such table\n", output["stderr"])
+}
+
+func TestShellAction_Execute_DoesNotLeakEnvironment(t *testing.T) {
+	enableShellAction(t, "env")
+	t.Setenv("SECRETS_ENCRYPTION_KEY", "hunter2")
+
+	output, err := ShellAction{}.Execute(Input{"command": []interface{}{"env"}})
+	require.NoError(t, err)
+	assert.NotContains(t, output["stdout"], "hunter2")
+	assert.Contains(t, output["stdout"], "PATH=")
+}
+
+func TestShellAction_ExecuteContext_TimesOut(t *testing.T) {
+	enableShellAction(t, "sh")
+
+	_, err := ShellAction{}.Execute(Input{"command": "sleep 10", "timeout_secs": 0.1})
+	assert.ErrorContains(t, err, "Command timed out")
+
+	// The job's timeout applies
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = ShellAction{}.ExecuteContext(ctx, Input{"command": "sleep 10"}, nil)
+	assert.ErrorContains(t, err, "Command timed out")
+}
+
+// ==========================================================
+// TestShellAction_Validate
+
+func TestShellAction_Validate_Disabled(t *testing.T) {
+	prevEnabled := config.ShellActionEnabled
+	config.ShellActionEnabled = false
+	defer func() { config.ShellActionEnabled = prevEnabled }()
+
+	assert.EqualError(t, ShellAction{}.Validate(Input{"command": "echo hello"}), "Shell jobs aren't enabled")
+}
+
+func TestShellAction_Validate_AllowedCommands(t *testing.T) {
+	enableShellAction(t, "echo", "/bin/sh")
+
+	assert.NoError(t, ShellAction{}.Validate(Input{"command": []interface{}{"echo", "hello"}}))
+	// Commands match the allowed ones by path
+	assert.NoError(t, ShellAction{}.Validate(Input{"command": "echo hello"}))
+	assert.ErrorContains(t, ShellAction{}.Validate(Input{"command": []interface{}{"cat", "/etc/passwd"}}), "isn't allowed")
+}
+
+func TestShellAction_Validate_DeniesByDefault(t *testing.T) {
+	enableShellAction(t)
+
+	assert.ErrorContains(t, ShellAction{}.Validate(Input{"command": []interface{}{"echo", "hello"}}), "isn't allowed")
+}
+
+func TestShellAction_Validate_CommandStringsNeedSh(t *testing.T) {
+	enableShellAction(t, "echo")
+
+	assert.NoError(t, ShellAction{}.Validate(Input{"command": []interface{}{"echo", "hello"}}))
+	assert.ErrorContains(t, ShellAction{}.Validate(Input{"command": "echo hello"}), "Command strings are run by /bin/sh -c")
+}
+
+func TestShellAction_Validate_InvalidInput(t *testing.T) {
+	enableShellAction(t, "sh", "ls")
+
+	testCases := []struct {
+		name  string
+		input Input
+	}{
+		{name: "Empty command", input: Input{"command": []interface{}{}}},
+		{name: "Unknown command", input: Input{"command": []interface{}{"no-such-command"}}},
+		{name: "Relative workdir", input: Input{"command": "ls", "workdir": "tmp"}},
+		{name: "Invalid env name", input: Input{"command": "ls", "env": map[string]interface{}{"A=B": "c"}}},
+		{name: "Negative timeout", input: Input{"command": "ls", "timeout_secs": float64(-1)}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Error(t, ShellAction{}.Validate(tc.input))
+		})
+	}
+}
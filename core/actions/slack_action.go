@@ -2,43 +2,372 @@ package actions
 
 import (
 	"context"
-	"log"
+	"encoding/json"
+	"fmt"
+	"strings"
 
 	"github.com/slack-go/slack"
 )
 
+var (
+	// slackApiUrl is replaced in tests by a local stand-in of the Slack API
+	slackApiUrl = slack.APIURL
+)
+
 type (
+	// SlackFile is uploaded to the channel, the message is then its comment
+	SlackFile struct {
+		Content  string `json:"content"`
+		Filename string `json:"filename"`
+		Title    string `json:"title"`
+	}
+
+	SlackMessageReq struct {
+		// Either the bot token or the incoming webhook URL is set, they're read
+		// from the secrets named by slack_api_token_secret and
+		// webhook_url_secret when the job is executed
+		Token      string `json:"-"`
+		WebhookUrl string `json:"-"`
+
+		// ChannelID is resolved from Channel or User when it's not set
+		ChannelID string `json:"channel_id"`
+		Channel   string `json:"channel"`
+		User      string `json:"user"`
+
+		Message        string        `json:"message"`
+		Blocks         *slack.Blocks `json:"blocks"`
+		ThreadTs       string        `json:"thread_ts"`
+		ReplyBroadcast bool          `json:"reply_broadcast"`
+		File           *SlackFile    `json:"file"`
+	}
+
 	SlackMessageAction struct{}
 )
 
 func (slackMsgAction SlackMessageAction) RequiredKeys() (keys []ActionKey) {
-	keys = []ActionKey{
-		ActionKey{"slack_api_token", StringActionKeyType},
-		ActionKey{"channel_id", StringActionKeyType},
-		ActionKey{"message", StringActionKeyType},
+	// Either slack_api_token_secret or webhook_url_secret is required, which Validate checks
+	return
+}
+
+func (slackMsgAction SlackMessageAction) Validate(input Input) (slackReq *SlackMessageReq, err error) {
+	var (
+		tokenSecret      string
+		webhookUrlSecret string
+	)
+	slackReq = &SlackMessageReq{}
+	// The token and the webhook URL would be stored along with the job and
+	// its executions
+	for _, key := range []string{"slack_api_token", "webhook_url"} {
+		if _, isPresent := input[key]; isPresent {
+			err = fmt.Errorf("%s can't be part of the input, set %s_secret to the name of a secret", key, key)
+			return
+		}
+	}
+	if tokenSecret, err = input.GetString("slack_api_token_secret", false); err != nil {
+		return
+	}
+	if webhookUrlSecret, err = input.GetString("webhook_url_secret", false); err != nil {
+		return
+	}
+	if (tokenSecret == "") == (webhookUrlSecret == "") {
+		err = fmt.Errorf("Either slack_api_token_secret or webhook_url_secret is required")
+		return
+	}
+	if slackReq.ChannelID, err = input.GetString("channel_id", false); err != nil {
+		return
+	}
+	if slackReq.Channel, err = input.GetString("channel", false); err != nil {
+		return
+	}
+	if slackReq.User, err = input.GetString("user", false); err != nil {
+		return
+	}
+	if slackReq.Message, err = input.GetString("message", false); err != nil {
+		return
+	}
+	if slackReq.ThreadTs, err = input.GetString("thread_ts", false); err != nil {
+		return
+	}
+	if slackReq.ReplyBroadcast, err = input.GetBool("reply_broadcast", false); err != nil {
+		return
+	}
+	if slackReq.Blocks, err = slackMsgAction.parseBlocks(input); err != nil {
+		return
+	}
+	if slackReq.File, err = slackMsgAction.parseFile(input); err != nil {
+		return
+	}
+
+	if slackReq.Message == "" && slackReq.Blocks == nil && slackReq.File == nil {
+		err = fmt.Errorf("One of message, blocks or file is required")
+		return
+	}
+	recipients := 0
+	for _, recipient := range []string{slackReq.ChannelID, slackReq.Channel, slackReq.User} {
+		if recipient != "" {
+			recipients++
+		}
+	}
+	if webhookUrlSecret != "" {
+		// Incoming webhooks post to the channel they were created for
+		if recipients > 0 || slackReq.File != nil {
+			err = fmt.Errorf("channel_id, channel, user and file can't be used with webhook_url_secret")
+			return
+		}
+		return
+	}
+	if recipients != 1 {
+		err = fmt.Errorf("Exactly one of channel_id, channel or user is required")
+		return
 	}
 	return
 }
 
-func (slackMsgAction SlackMessageAction) Validate(input Input) (err error) {
+// parseBlocks parses the Block Kit blocks, either a list of blocks or an
+// object with a blocks key as built by Slack's Block Kit Builder
+func (slackMsgAction SlackMessageAction) parseBlocks(input Input) (blocks *slack.Blocks, err error) {
+	var (
+		blocksB []byte
+	)
+	rawBlocks, isPresent := input["blocks"]
+	if !isPresent || rawBlocks == nil {
+		return
+	}
+	if blocksObj, isObj := rawBlocks.(map[string]interface{}); isObj {
+		rawBlocks = blocksObj["blocks"]
+	}
+	if _, isList := rawBlocks.([]interface{}); !isList {
+		err = fmt.Errorf("blocks should be a list of Block Kit blocks")
+		return
+	}
+	if blocksB, err = json.Marshal(rawBlocks); err != nil {
+		return
+	}
+	blocks = &slack.Blocks{}
+	if err = json.Unmarshal(blocksB, blocks); err != nil {
+		err = fmt.Errorf("Invalid blocks: %w", err)
+		return
+	}
+	return
+}
+
+// parseFile parses the file object, eg. {"filename": "report.csv", "content": "..."}. Content which
+// isn't a string, like the output of a previous job, is uploaded as JSON.
+func (slackMsgAction SlackMessageAction) parseFile(input Input) (file *SlackFile, err error) {
+	var (
+		fileObj map[string]interface{}
+	)
+	if fileObj, err = input.GetObject("file"); err != nil || fileObj == nil {
+		return
+	}
+	fileInput := Input(fileObj)
+	file = &SlackFile{}
+	if file.Filename, err = fileInput.GetString("filename", true); err != nil {
+		err = fmt.Errorf("file: %w", err)
+		return
+	}
+	if file.Title, err = fileInput.GetString("title", false); err != nil {
+		return
+	}
+	switch content := fileObj["content"].(type) {
+	case nil:
+	case string:
+		file.Content = content
+	default:
+		var contentB []byte
+		if contentB, err = json.MarshalIndent(content, "", "  "); err != nil {
+			return
+		}
+		file.Content = string(contentB)
+	}
+	if file.Content == "" {
+		err = fmt.Errorf("file: content can't be empty")
+		return
+	}
+	return
+}
+
+// resolveCredentials reads the bot token, or the incoming webhook URL, from
+// the user's secrets
+func (slackReq *SlackMessageReq) resolveCredentials(input Input, getSecret SecretGetter) (err error) {
+	if _, isPresent := input["webhook_url_secret"]; isPresent {
+		slackReq.WebhookUrl, err = getSecret.GetSecret(input, "webhook_url_secret", true)
+		return
+	}
+	slackReq.Token, err = getSecret.GetSecret(input, "slack_api_token_secret", true)
+	return
+}
+
+// resolveChannelID returns the ID of the channel to post to. Channels are
+// looked up by name, users by email or name, and messages sent to a user
+// are posted in the app's direct message with them.
+func (slackReq *SlackMessageReq) resolveChannelID(ctx context.Context, client *slack.Client) (channelID string, err error) {
+	switch {
+	case slackReq.ChannelID != "":
+		channelID = slackReq.ChannelID
+	case slackReq.Channel != "":
+		channelID, err = findSlackChannel(ctx, client, strings.TrimPrefix(slackReq.Channel, "#"))
+	case slackReq.User != "":
+		channelID, err = findSlackUser(ctx, client, strings.TrimPrefix(slackReq.User, "@"))
+	}
+	return
+}
+
+func findSlackChannel(ctx context.Context, client *slack.Client, name string) (channelID string, err error) {
+	var (
+		channels []slack.Channel
+		cursor   string
+	)
+	params := &slack.GetConversationsParameters{
+		ExcludeArchived: true,
+		Limit:           1000,
+		Types:           []string{"public_channel", "private_channel"},
+	}
+	for {
+		if channels, cursor, err = client.GetConversationsContext(ctx, params); err != nil {
+			err = fmt.Errorf("Failed to list slack channels: %w", err)
+			return
+		}
+		for _, channel := range channels {
+			if channel.Name == name {
+				channelID = channel.ID
+				return
+			}
+		}
+		if cursor == "" {
+			break
+		}
+		params.Cursor = cursor
+	}
+	err = fmt.Errorf("Slack channel %s not found", name)
+	return
+}
+
+func findSlackUser(ctx context.Context, client *slack.Client, name string) (userID string, err error) {
+	var (
+		user  *slack.User
+		users []slack.User
+	)
+	if strings.Contains(name, "@") {
+		if user, err = client.GetUserByEmailContext(ctx, name); err != nil {
+			err = fmt.Errorf("Failed to find slack user %s: %w", name, err)
+			return
+		}
+		userID = user.ID
+		return
+	}
+	if users, err = client.GetUsersContext(ctx); err != nil {
+		err = fmt.Errorf("Failed to list slack users: %w", err)
+		return
+	}
+	for _, user := range users {
+		if user.Deleted {
+			continue
+		}
+		if user.Name == name || user.Profile.DisplayName == name || user.RealName == name {
+			userID = user.ID
+			return
+		}
+	}
+	err = fmt.Errorf("Slack user %s not found", name)
+	return
+}
+
+func (slackMsgAction SlackMessageAction) postWebhook(ctx context.Context, slackReq *SlackMessageReq) (output Output, err error) {
+	msg := &slack.WebhookMessage{
+		Text:            slackReq.Message,
+		Blocks:          slackReq.Blocks,
+		ThreadTimestamp: slackReq.ThreadTs,
+		ReplyBroadcast:  slackReq.ReplyBroadcast,
+	}
+	if err = slack.PostWebhookContext(ctx, slackReq.WebhookUrl, msg); err != nil {
+		err = fmt.Errorf("Failed to post slack message: %w", err)
+		return
+	}
+	// Incoming webhooks don't return the timestamp of the message
+	output = Output{"ok": true}
+	return
+}
+
+func (slackMsgAction SlackMessageAction) uploadFile(ctx context.Context, client *slack.Client, channelID string, slackReq *SlackMessageReq) (output Output, err error) {
+	var (
+		file *slack.FileSummary
+	)
+	if file, err = client.UploadFileV2Context(ctx, slack.UploadFileV2Parameters{
+		Content:         slackReq.File.Content,
+		FileSize:        len(slackReq.File.Content),
+		Filename:        slackReq.File.Filename,
+		Title:           slackReq.File.Title,
+		InitialComment:  slackReq.Message,
+		Channel:         channelID,
+		ThreadTimestamp: slackReq.ThreadTs,
+	}); err != nil {
+		err = fmt.Errorf("Failed to upload slack file: %w", err)
+		return
+	}
+	output = Output{
+		"ok":         true,
+		"channel_id": channelID,
+		"file_id":    file.ID,
+	}
+	if slackReq.ThreadTs != "" {
+		output["thread_ts"] = slackReq.ThreadTs
+	}
 	return
 }
 
 func (slackMsgAction SlackMessageAction) Execute(input Input) (output Output, err error) {
+	return slackMsgAction.ExecuteContext(context.Background(), input, nil)
+}
 
-	if err = slackMsgAction.Validate(input); err != nil {
+// ExecuteContext posts the message, or uploads the file, until the job
+// times out. The output has the channel_id and ts of the message so that
+// later jobs can reply in its thread via thread_ts.
+func (slackMsgAction SlackMessageAction) ExecuteContext(ctx context.Context, input Input, getSecret SecretGetter) (output Output, err error) {
+	var (
+		slackReq  *SlackMessageReq
+		channelID string
+		ts        string
+	)
+	if slackReq, err = slackMsgAction.Validate(input); err != nil {
+		return
+	}
+	if err = slackReq.resolveCredentials(input, getSecret); err != nil {
 		return
 	}
-	// Create a new Slack client
-	token := input["slack_api_token"].(string)
-	client := slack.New(token)
+	if slackReq.WebhookUrl != "" {
+		return slackMsgAction.postWebhook(ctx, slackReq)
+	}
 
-	// Post a message to a channel
-	channelID := input["channel_id"].(string)
-	message := input["message"].(string)
+	client := slack.New(slackReq.Token, slack.OptionAPIURL(slackApiUrl))
+	if channelID, err = slackReq.resolveChannelID(ctx, client); err != nil {
+		return
+	}
+	if slackReq.File != nil {
+		return slackMsgAction.uploadFile(ctx, client, channelID, slackReq)
+	}
 
-	if _, _, err = client.PostMessageContext(context.Background(), channelID, slack.MsgOptionText(message, false)); err != nil {
-		log.Println("Failed to post slack message", err)
+	options := []slack.MsgOption{slack.MsgOptionText(slackReq.Message, false)}
+	if slackReq.Blocks != nil {
+		options = append(options, slack.MsgOptionBlocks(slackReq.Blocks.BlockSet...))
+	}
+	if slackReq.ThreadTs != "" {
+		options = append(options, slack.MsgOptionTS(slackReq.ThreadTs))
+		if slackReq.ReplyBroadcast {
+			options = append(options, slack.MsgOptionBroadcast())
+		}
+	}
+	if channelID, ts, err = client.PostMessageContext(ctx, channelID, options...); err != nil {
+		err = fmt.Errorf("Failed to post slack message: %w", err)
+		return
+	}
+	output = Output{
+		"ok":         true,
+		"channel_id": channelID,
+		"ts":         ts,
+	}
+	if slackReq.ThreadTs != "" {
+		output["thread_ts"] = slackReq.ThreadTs
 	}
 	return
 }
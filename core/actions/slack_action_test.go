@@ -0,0 +1,309 @@
+package actions
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testSlackServer is a local stand-in for the Slack Web API which records
+// the form of every API call
+type testSlackServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	calls    map[string][]map[string]string
+	uploaded string
+}
+
+func newTestSlackServer(t *testing.T) *testSlackServer {
+	slack := &testSlackServer{calls: make(map[string][]map[string]string)}
+	mux := http.NewServeMux()
+	reply := func(w http.ResponseWriter, resp map[string]interface{}) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}
+	record := func(r *http.Request, method string) map[string]string {
+		require.NoError(t, r.ParseForm())
+		form := make(map[string]string)
+		for key := range r.PostForm {
+			form[key] = r.PostForm.Get(key)
+		}
+		slack.mu.Lock()
+		defer slack.mu.Unlock()
+		slack.calls[method] = append(slack.calls[method], form)
+		return form
+	}
+
+	mux.HandleFunc("/api/chat.postMessage", func(w http.ResponseWriter, r *http.Request) {
+		form := record(r, "chat.postMessage")
+		if form["token"] != "xoxb-test" {
+			reply(w, map[string]interface{}{"ok": false, "error": "invalid_auth"})
+			return
+		}
+		if form["channel"] == "C_ARCHIVED" {
+			reply(w, map[string]interface{}{"ok": false, "error": "is_archived"})
+			return
+		}
+		reply(w, map[string]interface{}{"ok": true, "channel": form["channel"], "ts": "1700000000.000100"})
+	})
+	mux.HandleFunc("/api/conversations.list", func(w http.ResponseWriter, r *http.Request) {
+		// Channels are split in two pages
+		if record(r, "conversations.list")["cursor"] == "" {
+			reply(w, map[string]interface{}{
+				"ok":                true,
+				"channels":          []map[string]interface{}{{"id": "C1", "name": "general"}},
+				"response_metadata": map[string]interface{}{"next_cursor": "page-2"},
+			})
+			return
+		}
+		reply(w, map[string]interface{}{
+			"ok":       true,
+			"channels": []map[string]interface{}{{"id": "C2", "name": "alerts"}},
+		})
+	})
+	mux.HandleFunc("/api/users.list", func(w http.ResponseWriter, r *http.Request) {
+		record(r, "users.list")
+		reply(w, map[string]interface{}{
+			"ok": true,
+			"members": []map[string]interface{}{
+				{"id": "U0", "name": "alice", "deleted": true},
+				{"id": "U1", "name": "alice.smith", "profile": map[string]interface{}{"display_name": "alice"}},
+			},
+		})
+	})
+	mux.HandleFunc("/api/users.lookupByEmail", func(w http.ResponseWriter, r *http.Request) {
+		if record(r, "users.lookupByEmail")["email"] != "bob@example.com" {
+			reply(w, map[string]interface{}{"ok": false, "error": "users_not_found"})
+			return
+		}
+		reply(w, map[string]interface{}{"ok": true, "user": map[string]interface{}{"id": "U2", "name": "bob"}})
+	})
+	mux.HandleFunc("/api/files.getUploadURLExternal", func(w http.ResponseWriter, r *http.Request) {
+		record(r, "files.getUploadURLExternal")
+		reply(w, map[string]interface{}{"ok": true, "upload_url": slack.URL + "/upload", "file_id": "F1"})
+	})
+	mux.HandleFunc("/upload", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		slack.mu.Lock()
+		slack.uploaded = r.PostForm.Get("content")
+		slack.mu.Unlock()
+	})
+	mux.HandleFunc("/api/files.completeUploadExternal", func(w http.ResponseWriter, r *http.Request) {
+		record(r, "files.completeUploadExternal")
+		reply(w, map[string]interface{}{"ok": true, "files": []map[string]interface{}{{"id": "F1", "title": "Report"}}})
+	})
+	slack.Server = httptest.NewServer(mux)
+
+	prevApiUrl := slackApiUrl
+	slackApiUrl = slack.URL + "/api/"
+	t.Cleanup(func() {
+		slackApiUrl = prevApiUrl
+		slack.Close()
+	})
+	return slack
+}
+
+func (slack *testSlackServer) lastCall(method string) map[string]string {
+	slack.mu.Lock()
+	defer slack.mu.Unlock()
+	calls := slack.calls[method]
+	if len(calls) == 0 {
+		return nil
+	}
+	return calls[len(calls)-1]
+}
+
+// executeSlack executes the action with the tokens of slackTestSecrets
+func executeSlack(input Input) (Output, error) {
+	return SlackMessageAction{}.ExecuteContext(context.Background(), input, testSecretGetter(slackTestSecrets))
+}
+
+var slackTestSecrets = map[string]string{
+	"SLACK_TOKEN":       "xoxb-test",
+	"SLACK_WRONG_TOKEN": "xoxb-wrong",
+}
+
+// ==========================================================
+// TestSlackMessageAction_Execute
+
+func TestSlackMessageAction_Execute_PostsMessage(t *testing.T) {
+	slack := newTestSlackServer(t)
+
+	output, err := executeSlack(Input{
+		"slack_api_token_secret": "SLACK_TOKEN",
+		"channel_id":             "C1",
+		"message":                "hello from cronny",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "C1", output["channel_id"])
+	assert.Equal(t, "1700000000.000100", output["ts"])
+	assert.Equal(t, "hello from cronny", slack.lastCall("chat.postMessage")["text"])
+}
+
+func TestSlackMessageAction_Execute_BlocksInThread(t *testing.T) {
+	slack := newTestSlackServer(t)
+
+	output, err := executeSlack(Input{
+		"slack_api_token_secret": "SLACK_TOKEN",
+		"channel_id":             "C1",
+		"message":                "Deploy finished",
+		"thread_ts":              "1700000000.000001",
+		"reply_broadcast":        true,
+		"blocks": []interface{}{
+			map[string]interface{}{
+				"type": "section",
+				"text": map[string]interface{}{"type": "mrkdwn", "text": "*Deploy* finished"},
+			},
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "1700000000.000001", output["thread_ts"])
+
+	call := slack.lastCall("chat.postMessage")
+	assert.Equal(t, "1700000000.000001", call["thread_ts"])
+	assert.Equal(t, "true", call["reply_broadcast"])
+	assert.JSONEq(t, `[{"type": "section", "text": {"type": "mrkdwn", "text": "*Deploy* finished"}}]`, call["blocks"])
+}
+
+func TestSlackMessageAction_Execute_LooksUpChannelAndUser(t *testing.T) {
+	slack := newTestSlackServer(t)
+
+	testCases := []struct {
+		name      string
+		input     Input
+		channelID string
+	}{
+		{name: "Channel on the second page", input: Input{"channel": "#alerts"}, channelID: "C2"},
+		{name: "User by display name", input: Input{"user": "@alice"}, channelID: "U1"},
+		{name: "User by email", input: Input{"user": "bob@example.com"}, channelID: "U2"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.input["slack_api_token_secret"] = "SLACK_TOKEN"
+			tc.input["message"] = "hi"
+			output, err := executeSlack(tc.input)
+			require.NoError(t, err)
+			assert.Equal(t, tc.channelID, output["channel_id"])
+			assert.Equal(t, tc.channelID, slack.lastCall("chat.postMessage")["channel"])
+		})
+	}
+
+	_, err := executeSlack(Input{"slack_api_token_secret": "SLACK_TOKEN", "channel": "missing", "message": "hi"})
+	assert.ErrorContains(t, err, "Slack channel missing not found")
+}
+
+func TestSlackMessageAction_Execute_UploadsFile(t *testing.T) {
+	slack := newTestSlackServer(t)
+
+	output, err := executeSlack(Input{
+		"slack_api_token_secret": "SLACK_TOKEN",
+		"channel_id":             "C1",
+		"message":                "Nightly report",
+		"file": map[string]interface{}{
+			"filename": "report.json",
+			"title":    "Report",
+			"content":  map[string]interface{}{"failed": float64(0)},
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "F1", output["file_id"])
+	assert.Contains(t, slack.uploaded, `"failed": 0`)
+
+	call := slack.lastCall("files.completeUploadExternal")
+	assert.Equal(t, "C1", call["channel_id"])
+	assert.Equal(t, "Nightly report", call["initial_comment"])
+}
+
+func TestSlackMessageAction_Execute_ReturnsErrors(t *testing.T) {
+	newTestSlackServer(t)
+
+	_, err := executeSlack(Input{"slack_api_token_secret": "SLACK_TOKEN", "channel_id": "C_ARCHIVED", "message": "hi"})
+	assert.ErrorContains(t, err, "is_archived")
+
+	_, err = executeSlack(Input{"slack_api_token_secret": "SLACK_WRONG_TOKEN", "channel_id": "C1", "message": "hi"})
+	assert.ErrorContains(t, err, "invalid_auth")
+}
+
+func TestSlackMessageAction_Execute_Webhook(t *testing.T) {
+	var received map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&received)
+		if received["text"] == "fail" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte("no_service"))
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	getSecret := testSecretGetter(map[string]string{"SLACK_WEBHOOK": server.URL})
+	output, err := SlackMessageAction{}.ExecuteContext(context.Background(), Input{
+		"webhook_url_secret": "SLACK_WEBHOOK",
+		"message":            "hello",
+		"blocks": map[string]interface{}{
+			"blocks": []interface{}{map[string]interface{}{"type": "divider"}},
+		},
+	}, getSecret)
+	require.NoError(t, err)
+	assert.Equal(t, true, output["ok"])
+	assert.Equal(t, "hello", received["text"])
+	assert.Equal(t, []interface{}{map[string]interface{}{"type": "divider"}}, received["blocks"])
+
+	_, err = SlackMessageAction{}.ExecuteContext(context.Background(), Input{"webhook_url_secret": "SLACK_WEBHOOK", "message": "fail"}, getSecret)
+	assert.Error(t, err)
+}
+
+func TestSlackMessageAction_ExecuteContext_StopsWhenDone(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The connection is watched for the client going away once the body is read
+		io.Copy(io.Discard, r.Body)
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	getSecret := testSecretGetter(map[string]string{"SLACK_WEBHOOK": server.URL})
+	_, err := SlackMessageAction{}.ExecuteContext(ctx, Input{"webhook_url_secret": "SLACK_WEBHOOK", "message": "hello"}, getSecret)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
+
+// ==========================================================
+// TestSlackMessageAction_Validate
+
+func TestSlackMessageAction_Validate_InvalidInput(t *testing.T) {
+	testCases := []struct {
+		name  string
+		input Input
+	}{
+		{name: "Missing token and webhook", input: Input{"channel_id": "C1", "message": "hi"}},
+		{name: "Both token and webhook", input: Input{"slack_api_token_secret": "SLACK_TOKEN", "webhook_url_secret": "SLACK_WEBHOOK", "message": "hi"}},
+		{name: "Missing recipient", input: Input{"slack_api_token_secret": "SLACK_TOKEN", "message": "hi"}},
+		{name: "Several recipients", input: Input{"slack_api_token_secret": "SLACK_TOKEN", "channel_id": "C1", "user": "alice", "message": "hi"}},
+		{name: "Missing message", input: Input{"slack_api_token_secret": "SLACK_TOKEN", "channel_id": "C1"}},
+		{name: "Invalid blocks", input: Input{"slack_api_token_secret": "SLACK_TOKEN", "channel_id": "C1", "blocks": "section"}},
+		{name: "Unknown block type", input: Input{"slack_api_token_secret": "SLACK_TOKEN", "channel_id": "C1", "blocks": []interface{}{map[string]interface{}{"type": 1}}}},
+		{name: "File without filename", input: Input{"slack_api_token_secret": "SLACK_TOKEN", "channel_id": "C1", "file": map[string]interface{}{"content": "a"}}},
+		{name: "Plaintext token", input: Input{"slack_api_token": "xoxb-test", "channel_id": "C1", "message": "hi"}},
+		{name: "Plaintext webhook", input: Input{"webhook_url": "https://hooks.slack.com/x", "message": "hi"}},
+		{name: "Webhook with channel", input: Input{"webhook_url_secret": "SLACK_WEBHOOK", "channel_id": "C1", "message": "hi"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := SlackMessageAction{}.Validate(tc.input)
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,207 @@
+package actions
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cronny/core/config"
+)
+
+// setSqlConnections configures a reports SQLite database with a few jobs
+// for the duration of the test
+func setSqlConnections(t *testing.T) {
+	prevConnections, prevReadOnly, prevMaxRows := config.SqlConnections, config.SqlReadOnlyConnections, config.MaxSqlRows
+	config.SqlConnections = map[string]string{
+		"reports": "sqlite://" + filepath.Join(t.TempDir(), "reports.db"),
+	}
+	config.SqlReadOnlyConnections, config.MaxSqlRows = nil, 1000
+	t.Cleanup(func() {
+		config.SqlConnections, config.SqlReadOnlyConnections, config.MaxSqlRows = prevConnections, prevReadOnly, prevMaxRows
+	})
+
+	for _, statement := range []string{
+		"CREATE TABLE jobs (id INTEGER PRIMARY KEY, name TEXT, status TEXT, payload BLOB)",
+		"INSERT INTO jobs (name, status, payload) VALUES ('backup', 'failed', X'00FF'), ('report', 'success', NULL), ('cleanup', 'failed', NULL)",
+	} {
+		_, err := SqlAction{}.Execute(Input{"connection": "reports", "statement": statement})
+		require.NoError(t, err)
+	}
+}
+
+// ==========================================================
+// TestSqlAction_Execute
+
+func TestSqlAction_Execute_Query(t *testing.T) {
+	setSqlConnections(t)
+
+	output, err := SqlAction{}.Execute(Input{
+		"connection": "reports",
+		"query":      "SELECT id, name, payload FROM jobs WHERE status = ? ORDER BY id",
+		"params":     []interface{}{"failed"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, output["row_count"])
+	assert.Equal(t, false, output["truncated"])
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"id": int64(1), "name": "backup", "payload": "AP8="},
+		map[string]interface{}{"id": int64(3), "name": "cleanup", "payload": nil},
+	}, output["rows"])
+}
+
+func TestSqlAction_Execute_Statement(t *testing.T) {
+	setSqlConnections(t)
+
+	output, err := SqlAction{}.Execute(Input{
+		"connection": "reports",
+		"statement":  "DELETE FROM jobs WHERE status = ?",
+		"params":     []interface{}{"failed"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), output["rows_affected"])
+
+	output, err = SqlAction{}.Execute(Input{"connection": "reports", "query": "SELECT name FROM jobs"})
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{map[string]interface{}{"name": "report"}}, output["rows"])
+}
+
+func TestSqlAction_Execute_CapsRows(t *testing.T) {
+	setSqlConnections(t)
+
+	output, err := SqlAction{}.Execute(Input{
+		"connection": "reports",
+		"query":      "SELECT name FROM jobs ORDER BY id",
+		"max_rows":   float64(2),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, output["row_count"])
+	assert.Equal(t, true, output["truncated"])
+
+	// Jobs can only lower the admin's cap
+	config.MaxSqlRows = 1
+	output, err = SqlAction{}.Execute(Input{
+		"connection": "reports",
+		"query":      "SELECT name FROM jobs ORDER BY id",
+		"max_rows":   float64(10),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{map[string]interface{}{"name": "backup"}}, output["rows"])
+	assert.Equal(t, true, output["truncated"])
+}
+
+func TestSqlAction_Execute_ReadOnly(t *testing.T) {
+	setSqlConnections(t)
+
+	output, err := SqlAction{}.Execute(Input{
+		"connection": "reports",
+		"query":      "SELECT count(*) AS total FROM jobs",
+		"read_only":  true,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{map[string]interface{}{"total": int64(3)}}, output["rows"])
+
+	_, err = SqlAction{}.Execute(Input{
+		"connection": "reports",
+		"query":      "DELETE FROM jobs RETURNING id",
+		"read_only":  true,
+	})
+	assert.ErrorContains(t, err, "readonly")
+
+	_, err = SqlAction{}.Execute(Input{
+		"connection": "reports",
+		"statement":  "DELETE FROM jobs",
+		"read_only":  true,
+	})
+	assert.EqualError(t, err, "Statements can't run in read-only mode")
+
+	// Read-only connections are read-only for every job
+	config.SqlReadOnlyConnections = []string{"reports"}
+	_, err = SqlAction{}.Execute(Input{"connection": "reports", "query": "DELETE FROM jobs RETURNING id"})
+	assert.ErrorContains(t, err, "readonly")
+}
+
+func TestSqlAction_ExecuteContext_Cancelled(t *testing.T) {
+	setSqlConnections(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := SqlAction{}.ExecuteContext(ctx, Input{"connection": "reports", "query": "SELECT name FROM jobs"}, nil)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+// ==========================================================
+// TestSqlDataSource
+
+func TestSqlDataSource(t *testing.T) {
+	testCases := []struct {
+		name               string
+		connUrl            string
+		readOnly           bool
+		expectedDriver     string
+		expectedDataSource string
+	}{
+		{
+			name:               "Postgres",
+			connUrl:            "postgres://cronny:s3cret@db:5432/reports?sslmode=require",
+			expectedDriver:     PostgresSqlDriver,
+			expectedDataSource: "postgres://cronny:s3cret@db:5432/reports?sslmode=require",
+		},
+		{
+			name:               "MySQL",
+			connUrl:            "mysql://cronny:s3cret@db/reports?timeout=5s",
+			expectedDriver:     MysqlSqlDriver,
+			expectedDataSource: "cronny:s3cret@tcp(db:3306)/reports?parseTime=true&timeout=5s",
+		},
+		{
+			name:               "SQLite",
+			connUrl:            "sqlite:///var/lib/cronny/reports.db",
+			expectedDriver:     SqliteSqlDriver,
+			expectedDataSource: "file:/var/lib/cronny/reports.db",
+		},
+		{
+			name:               "Read-only SQLite",
+			connUrl:            "sqlite://reports.db?_busy_timeout=500",
+			readOnly:           true,
+			expectedDriver:     SqliteSqlDriver,
+			expectedDataSource: "file:reports.db?_busy_timeout=500&mode=ro",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			driverName, dataSource, err := sqlDataSource(tc.connUrl, tc.readOnly)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedDriver, driverName)
+			assert.Equal(t, tc.expectedDataSource, dataSource)
+		})
+	}
+
+	_, _, err := sqlDataSource("mssql://cronny:s3cret@db/reports", false)
+	assert.EqualError(t, err, "Unsupported connection URL scheme mssql")
+}
+
+// ==========================================================
+// TestSqlAction_Validate
+
+func TestSqlAction_Validate_InvalidInput(t *testing.T) {
+	setSqlConnections(t)
+
+	testCases := []struct {
+		name  string
+		input Input
+	}{
+		{name: "Unknown connection", input: Input{"connection": "billing", "query": "SELECT 1"}},
+		{name: "Missing query", input: Input{"connection": "reports"}},
+		{name: "Query and statement", input: Input{"connection": "reports", "query": "SELECT 1", "statement": "DELETE FROM jobs"}},
+		{name: "Invalid params", input: Input{"connection": "reports", "query": "SELECT ?", "params": "failed"}},
+		{name: "Invalid max rows", input: Input{"connection": "reports", "query": "SELECT 1", "max_rows": float64(-1)}},
+		{name: "Invalid read only", input: Input{"connection": "reports", "query": "SELECT 1", "read_only": "yes"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Error(t, SqlAction{}.Validate(tc.input))
+		})
+	}
+}
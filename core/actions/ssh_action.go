@@ -0,0 +1,240 @@
+package actions
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"github.com/cronny/core/config"
+	"github.com/cronny/core/helpers"
+)
+
+type (
+	// SshActionReq is the command run by an SSH job
+	SshActionReq struct {
+		Host       string
+		Port       int
+		User       string
+		Command    string
+		Stdin      string
+		KnownHosts []string
+	}
+
+	// SshAction runs a command on a remote host. The private key or the
+	// password are read from the user's secrets and the host key is
+	// verified against the known hosts.
+	SshAction struct{}
+)
+
+func (sshAction SshAction) RequiredKeys() (keys []ActionKey) {
+	keys = []ActionKey{
+		{"host", StringActionKeyType},
+		{"user", StringActionKeyType},
+		{"command", ListActionKeyType},
+	}
+	return
+}
+
+func (sshAction SshAction) OptionalKeys() (keys []ActionKey) {
+	keys = []ActionKey{
+		{"port", NumberActionKeyType},
+		{"private_key_secret", StringActionKeyType},
+		{"passphrase_secret", StringActionKeyType},
+		{"password_secret", StringActionKeyType},
+		{"known_hosts", ListActionKeyType},
+		{"stdin", StringActionKeyType},
+	}
+	return
+}
+
+func (sshAction SshAction) Validate(input Input) (err error) {
+	_, err = sshAction.parse(input)
+	return
+}
+
+func (sshAction SshAction) parse(input Input) (sshReq *SshActionReq, err error) {
+	var (
+		port    float64
+		command []string
+	)
+	sshReq = &SshActionReq{}
+	if sshReq.Host, err = input.GetString("host", true); err != nil {
+		return
+	}
+	if sshReq.User, err = input.GetString("user", true); err != nil {
+		return
+	}
+	if port, err = input.GetNumber("port"); err != nil {
+		return
+	}
+	if port == 0 {
+		port = 22
+	}
+	if port != float64(int(port)) || port < 1 || port > 65535 {
+		err = fmt.Errorf("port should be between 1 and 65535")
+		return
+	}
+	sshReq.Port = int(port)
+
+	// A list of arguments is quoted for the user's shell on the host
+	if rawCommand, isString := input["command"].(string); isString {
+		sshReq.Command = rawCommand
+	} else if command, err = input.GetStringList("command"); err != nil {
+		return
+	} else {
+		sshReq.Command = shellQuote(command)
+	}
+	if sshReq.Command == "" {
+		err = fmt.Errorf("missing required field: command")
+		return
+	}
+
+	_, hasPrivateKey := input["private_key_secret"]
+	_, hasPassword := input["password_secret"]
+	if !hasPrivateKey && !hasPassword {
+		err = fmt.Errorf("Either private_key_secret or password_secret should be provided")
+		return
+	}
+
+	if rawKnownHosts, isString := input["known_hosts"].(string); isString {
+		sshReq.KnownHosts = strings.Split(rawKnownHosts, "\n")
+	} else if sshReq.KnownHosts, err = input.GetStringList("known_hosts"); err != nil {
+		return
+	}
+	if len(sshReq.KnownHosts) == 0 && config.SshKnownHostsFile == "" {
+		err = fmt.Errorf("known_hosts should be provided to verify the host key")
+		return
+	}
+
+	if sshReq.Stdin, err = parseStdin(input); err != nil {
+		return
+	}
+	return
+}
+
+// shellQuote quotes the arguments so that a POSIX shell runs them as is
+func shellQuote(args []string) string {
+	quoted := make([]string, 0, len(args))
+	for _, arg := range args {
+		quoted = append(quoted, "'"+strings.ReplaceAll(arg, "'", `'\''`)+"'")
+	}
+	return strings.Join(quoted, " ")
+}
+
+// authMethods returns the ways to authenticate with the secrets of the job,
+// the private key is tried before the password
+func (sshAction SshAction) authMethods(input Input, getSecret SecretGetter) (auth []ssh.AuthMethod, err error) {
+	var (
+		privateKey string
+		passphrase string
+		password   string
+		signer     ssh.Signer
+	)
+	if getSecret == nil {
+		err = fmt.Errorf("Secrets aren't available")
+		return
+	}
+	if privateKey, err = getSecret.GetSecret(input, "private_key_secret", false); err != nil {
+		return
+	}
+	if passphrase, err = getSecret.GetSecret(input, "passphrase_secret", false); err != nil {
+		return
+	}
+	if password, err = getSecret.GetSecret(input, "password_secret", false); err != nil {
+		return
+	}
+	if privateKey != "" {
+		if passphrase != "" {
+			signer, err = ssh.ParsePrivateKeyWithPassphrase([]byte(privateKey), []byte(passphrase))
+		} else {
+			signer, err = ssh.ParsePrivateKey([]byte(privateKey))
+		}
+		if err != nil {
+			err = fmt.Errorf("Invalid private key: %w", err)
+			return
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if password != "" {
+		auth = append(auth, ssh.Password(password))
+	}
+	return
+}
+
+// hostKeyCallback verifies the host key against the known hosts of the job
+// and the ones of the admin
+func (sshAction SshAction) hostKeyCallback(knownHosts []string) (callback ssh.HostKeyCallback, err error) {
+	var (
+		knownHostsFile *os.File
+		files          []string
+	)
+	if config.SshKnownHostsFile != "" {
+		files = append(files, config.SshKnownHostsFile)
+	}
+	if len(knownHosts) > 0 {
+		// knownhosts only reads files, which handles hashed hosts,
+		// non-standard ports and revoked keys
+		if knownHostsFile, err = os.CreateTemp("", "cronny-known-hosts"); err != nil {
+			return
+		}
+		defer os.Remove(knownHostsFile.Name())
+		_, err = knownHostsFile.WriteString(strings.Join(knownHosts, "\n") + "\n")
+		knownHostsFile.Close()
+		if err != nil {
+			return
+		}
+		files = append(files, knownHostsFile.Name())
+	}
+	if callback, err = knownhosts.New(files...); err != nil {
+		err = fmt.Errorf("Invalid known_hosts: %w", err)
+		return
+	}
+	return
+}
+
+func (sshAction SshAction) Execute(input Input) (output Output, err error) {
+	return sshAction.ExecuteContext(context.Background(), input, nil)
+}
+
+// ExecuteContext runs the command on the host until it exits or the job
+// times out. The output has the exit code, stdout and stderr of the command.
+func (sshAction SshAction) ExecuteContext(ctx context.Context, input Input, getSecret SecretGetter) (output Output, err error) {
+	var (
+		sshReq *SshActionReq
+		result *helpers.ShellResult
+	)
+	if sshReq, err = sshAction.parse(input); err != nil {
+		return
+	}
+	sshExecutor := &helpers.SshExecutor{
+		Addr:           net.JoinHostPort(sshReq.Host, strconv.Itoa(sshReq.Port)),
+		User:           sshReq.User,
+		Command:        sshReq.Command,
+		Stdin:          sshReq.Stdin,
+		MaxOutputBytes: config.MaxSshOutputBytes,
+	}
+	if sshExecutor.Auth, err = sshAction.authMethods(input, getSecret); err != nil {
+		return
+	}
+	if sshExecutor.HostKeyCallback, err = sshAction.hostKeyCallback(sshReq.KnownHosts); err != nil {
+		return
+	}
+	// A command exiting with a non-zero code has a result so that its
+	// output is recorded with the error
+	if result, err = sshExecutor.Execute(ctx); result == nil {
+		return
+	}
+
+	output = Output{
+		"exit_code": result.ExitCode,
+		"stdout":    result.Stdout,
+		"stderr":    result.Stderr,
+	}
+	return
+}
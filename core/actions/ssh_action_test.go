@@ -0,0 +1,265 @@
+package actions
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"os/exec"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// testSshServer runs the exec requests of the sessions with /bin/sh on the
+// local host. It accepts the password hunter2 and the client key.
+type testSshServer struct {
+	addr      string
+	hostKey   ssh.Signer
+	clientKey string
+	listener  net.Listener
+}
+
+func newTestSshServer(t *testing.T) *testSshServer {
+	_, hostPrivateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	hostKey, err := ssh.NewSignerFromKey(hostPrivateKey)
+	require.NoError(t, err)
+	clientPublicKey, clientPrivateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	clientPem, err := ssh.MarshalPrivateKey(clientPrivateKey, "")
+	require.NoError(t, err)
+	authorizedKey, err := ssh.NewPublicKey(clientPublicKey)
+	require.NoError(t, err)
+
+	serverConfig := &ssh.ServerConfig{
+		PasswordCallback: func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if conn.User() == "cronny" && string(password) == "hunter2" {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("password rejected for %s", conn.User())
+		},
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if conn.User() == "cronny" && bytes.Equal(key.Marshal(), authorizedKey.Marshal()) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("unknown public key for %s", conn.User())
+		},
+	}
+	serverConfig.AddHostKey(hostKey)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := &testSshServer{
+		addr:      listener.Addr().String(),
+		hostKey:   hostKey,
+		clientKey: string(pem.EncodeToMemory(clientPem)),
+		listener:  listener,
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serveConn(conn, serverConfig)
+		}
+	}()
+	t.Cleanup(func() { listener.Close() })
+	return server
+}
+
+func (server *testSshServer) serveConn(conn net.Conn, serverConfig *ssh.ServerConfig) {
+	_, channels, requests, err := ssh.NewServerConn(conn, serverConfig)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(requests)
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+		channel, channelRequests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+		go server.serveSession(channel, channelRequests)
+	}
+}
+
+func (server *testSshServer) serveSession(channel ssh.Channel, requests <-chan *ssh.Request) {
+	defer channel.Close()
+	for req := range requests {
+		if req.Type != "exec" {
+			req.Reply(false, nil)
+			continue
+		}
+		commandLen := binary.BigEndian.Uint32(req.Payload)
+		cmd := exec.Command("/bin/sh", "-c", string(req.Payload[4:4+commandLen]))
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = channel, channel, channel.Stderr()
+		req.Reply(true, nil)
+
+		exitStatus := uint32(0)
+		if err := cmd.Run(); err != nil {
+			exitStatus = uint32(cmd.ProcessState.ExitCode())
+		}
+		channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{exitStatus}))
+		return
+	}
+}
+
+func (server *testSshServer) knownHosts() string {
+	return knownhosts.Line([]string{knownhosts.Normalize(server.addr)}, server.hostKey.PublicKey())
+}
+
+func (server *testSshServer) input(extra Input) Input {
+	host, port, _ := net.SplitHostPort(server.addr)
+	portNum, _ := strconv.Atoi(port)
+	input := Input{
+		"host":        host,
+		"port":        float64(portNum),
+		"user":        "cronny",
+		"known_hosts": []interface{}{server.knownHosts()},
+	}
+	for key, val := range extra {
+		input[key] = val
+	}
+	return input
+}
+
+// ==========================================================
+// TestSshAction_Execute
+
+func TestSshAction_Execute_PrivateKey(t *testing.T) {
+	server := newTestSshServer(t)
+	getSecret := testSecretGetter(map[string]string{"DEPLOY_KEY": server.clientKey})
+
+	output, err := SshAction{}.ExecuteContext(context.Background(), server.input(Input{
+		"command":            []interface{}{"printf", "%s|%s", "it's", "$HOME"},
+		"private_key_secret": "DEPLOY_KEY",
+	}), getSecret)
+	require.NoError(t, err)
+	assert.Equal(t, 0, output["exit_code"])
+	assert.Equal(t, "it's|$HOME", output["stdout"], "The arguments should be quoted")
+}
+
+func TestSshAction_Execute_PasswordAndStdin(t *testing.T) {
+	server := newTestSshServer(t)
+	getSecret := testSecretGetter(map[string]string{"VM_PASSWORD": "hunter2"})
+
+	output, err := SshAction{}.ExecuteContext(context.Background(), server.input(Input{
+		"command":         "cat; echo warning >&2",
+		"stdin":           map[string]interface{}{"id": float64(1)},
+		"password_secret": "VM_PASSWORD",
+	}), getSecret)
+	require.NoError(t, err)
+	assert.Equal(t, `{"id":1}`, output["stdout"])
+	assert.Equal(t, "warning\n", output["stderr"])
+}
+
+func TestSshAction_Execute_FailsOnNonZeroExit(t *testing.T) {
+	server := newTestSshServer(t)
+	getSecret := testSecretGetter(map[string]string{"VM_PASSWORD": "hunter2"})
+
+	output, err := SshAction{}.ExecuteContext(context.Background(), server.input(Input{
+		"command":         "echo cleaning; echo 'disk full' >&2; exit 4",
+		"password_secret": "VM_PASSWORD",
+	}), getSecret)
+	assert.EqualError(t, err, "Command exited with code 4: disk full")
+	// The exit status and the logs are recorded along with the error
+	assert.Equal(t, 4, output["exit_code"])
+	assert.Equal(t, "cleaning\n", output["stdout"])
+	assert.Equal(t, "disk full\n", output["stderr"])
+}
+
+func TestSshAction_Execute_RejectsUnknownHostKey(t *testing.T) {
+	server := newTestSshServer(t)
+	otherServer := newTestSshServer(t)
+	getSecret := testSecretGetter(map[string]string{"VM_PASSWORD": "hunter2"})
+
+	_, err := SshAction{}.ExecuteContext(context.Background(), server.input(Input{
+		"command":         "echo hello",
+		"password_secret": "VM_PASSWORD",
+		"known_hosts":     knownhosts.Line([]string{knownhosts.Normalize(server.addr)}, otherServer.hostKey.PublicKey()),
+	}), getSecret)
+	assert.ErrorContains(t, err, "key mismatch")
+
+	_, err = SshAction{}.ExecuteContext(context.Background(), server.input(Input{
+		"command":         "echo hello",
+		"password_secret": "VM_PASSWORD",
+		"known_hosts":     otherServer.knownHosts(),
+	}), getSecret)
+	assert.ErrorContains(t, err, "key is unknown")
+}
+
+func TestSshAction_Execute_RejectsWrongPassword(t *testing.T) {
+	server := newTestSshServer(t)
+	getSecret := testSecretGetter(map[string]string{"VM_PASSWORD": "wrong"})
+
+	_, err := SshAction{}.ExecuteContext(context.Background(), server.input(Input{
+		"command":         "echo hello",
+		"password_secret": "VM_PASSWORD",
+	}), getSecret)
+	assert.ErrorContains(t, err, "unable to authenticate")
+}
+
+func TestSshAction_ExecuteContext_TimesOut(t *testing.T) {
+	server := newTestSshServer(t)
+	getSecret := testSecretGetter(map[string]string{"VM_PASSWORD": "hunter2"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	_, err := SshAction{}.ExecuteContext(ctx, server.input(Input{
+		"command":         "sleep 10",
+		"password_secret": "VM_PASSWORD",
+	}), getSecret)
+	assert.ErrorContains(t, err, "Command timed out")
+}
+
+// ==========================================================
+// TestSshAction_Validate
+
+func TestSshAction_Validate_InvalidInput(t *testing.T) {
+	valid := Input{"host": "vm.example.com", "user": "cronny", "command": "uptime",
+		"password_secret": "VM_PASSWORD", "known_hosts": "vm.example.com ssh-ed25519 AAAA"}
+	require.NoError(t, SshAction{}.Validate(valid))
+
+	with := func(key string, val interface{}) Input {
+		input := Input{}
+		for k, v := range valid {
+			input[k] = v
+		}
+		if val == nil {
+			delete(input, key)
+		} else {
+			input[key] = val
+		}
+		return input
+	}
+	testCases := []struct {
+		name  string
+		input Input
+	}{
+		{name: "Missing host", input: with("host", nil)},
+		{name: "Invalid port", input: with("port", float64(70000))},
+		{name: "Empty command", input: with("command", []interface{}{})},
+		{name: "Missing credentials", input: with("password_secret", nil)},
+		{name: "Missing known hosts", input: with("known_hosts", nil)},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Error(t, SshAction{}.Validate(tc.input))
+		})
+	}
+}
@@ -5,6 +5,7 @@ import (
 
 	"github.com/cronny/core/models"
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 func (handler *Handler) ActionIndexHandler(c *gin.Context) {
@@ -159,3 +160,52 @@ func (handler *Handler) ActionDeleteHandler(c *gin.Context) {
 	})
 	return
 }
+
+func (handler *Handler) ActionValidateHandler(c *gin.Context) {
+	var (
+		action   *models.Action
+		issues   []*models.WorkflowIssue
+		actionId int
+		err      error
+	)
+	if actionId, err = strconv.Atoi(c.Param("id")); err != nil {
+		c.JSON(400, gin.H{
+			"message": "Improper ID format",
+		})
+		return
+	}
+
+	// The scoped DB is used for multiple queries, so a session is
+	// created to avoid conditions leaking across them
+	db := handler.GetUserScopedDb(c).Session(&gorm.Session{})
+
+	action = &models.Action{}
+	if ex := db.Where("id = ?", uint(actionId)).First(action); ex.Error != nil {
+		c.JSON(404, gin.H{
+			"message": "Action not found",
+		})
+		return
+	}
+
+	if issues, err = action.ValidateWorkflow(db); err != nil {
+		c.JSON(500, gin.H{
+			"message": err.Error(),
+		})
+		return
+	}
+
+	isValid := true
+	for _, issue := range issues {
+		if issue.Severity == models.ErrorIssueSeverity {
+			isValid = false
+			break
+		}
+	}
+
+	c.JSON(200, gin.H{
+		"valid":   isValid,
+		"issues":  issues,
+		"message": "success",
+	})
+	return
+}
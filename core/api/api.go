@@ -115,6 +115,11 @@ func (apiServer *ApiServer) Setup() (err error) {
 		authorized.POST("/actions", apiServer.handler.ActionCreateHandler)
 		authorized.PUT("/actions/:id", apiServer.handler.ActionUpdateHandler)
 		authorized.DELETE("/actions/:id", apiServer.handler.ActionDeleteHandler)
+		authorized.GET("/actions/:id/validate", apiServer.handler.ActionValidateHandler)
+		authorized.GET("/actions/:id/runs", apiServer.handler.ActionRunsHandler)
+
+		// Workflow Runs
+		authorized.GET("/runs/:id", apiServer.handler.WorkflowRunShowHandler)
 
 		// Jobs
 		authorized.GET("/jobs", apiServer.handler.JobIndexHandler)
@@ -125,6 +130,18 @@ func (apiServer *ApiServer) Setup() (err error) {
 
 		// Job Templates
 		authorized.GET("/job_templates", apiServer.handler.JobTemplateIndexHandler)
+
+		// Secrets
+		authorized.GET("/secrets", apiServer.handler.SecretIndexHandler)
+		authorized.POST("/secrets", apiServer.handler.SecretCreateHandler)
+		authorized.PUT("/secrets/:id", apiServer.handler.SecretUpdateHandler)
+		authorized.DELETE("/secrets/:id", apiServer.handler.SecretDeleteHandler)
+
+		// Registry credentials
+		authorized.GET("/registry_credentials", apiServer.handler.RegistryCredentialIndexHandler)
+		authorized.POST("/registry_credentials", apiServer.handler.RegistryCredentialCreateHandler)
+		authorized.PUT("/registry_credentials/:id", apiServer.handler.RegistryCredentialUpdateHandler)
+		authorized.DELETE("/registry_credentials/:id", apiServer.handler.RegistryCredentialDeleteHandler)
 	}
 
 	return
@@ -118,7 +118,7 @@ func (handler *Handler) DashboardStatsHandler(c *gin.Context) {
 			Type:          "job",
 			Name:          job.Name,
 			ExecutionTime: exec.ExecutionStartTime,
-			Status:        "completed", // You might want to add a status field to JobExecution
+			Status:        string(exec.Status),
 		})
 	}
 
@@ -1,12 +1,52 @@
 package api
 
 import (
+	"errors"
 	"strconv"
 
 	"github.com/cronny/core/models"
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
+// saveValidatedJob runs save inside a transaction and rolls it back if the
+// saved job breaks the workflow of its action. Jobs which fail their own
+// validation are reported as a single issue.
+func (handler *Handler) saveValidatedJob(job *models.Job, save func(txHandler *Handler) error) (issues []*models.WorkflowIssue, err error) {
+	err = handler.db.Transaction(func(tx *gorm.DB) (err error) {
+		if err = save(&Handler{db: tx}); err != nil {
+			var validationErr *models.JobValidationError
+			if errors.As(err, &validationErr) {
+				issues = []*models.WorkflowIssue{validationErr.Issue}
+			}
+			return
+		}
+		if ex := tx.Where("id = ?", job.ID).First(job); ex.Error != nil {
+			err = ex.Error
+			return
+		}
+		if issues, err = job.ValidateWorkflow(tx); err != nil {
+			return
+		}
+		return
+	})
+	return
+}
+
+func (handler *Handler) respondWithSaveError(c *gin.Context, issues []*models.WorkflowIssue, err error) {
+	if errors.Is(err, models.ErrInvalidWorkflow) {
+		c.JSON(400, gin.H{
+			"message": err.Error(),
+			"issues":  issues,
+		})
+		return
+	}
+	c.JSON(500, gin.H{
+		"message": err.Error(),
+	})
+	return
+}
+
 func (handler *Handler) JobIndexHandler(c *gin.Context) {
 	var (
 		jobs []*models.Job
@@ -64,8 +104,9 @@ func (handler *Handler) JobShowHandler(c *gin.Context) {
 
 func (handler *Handler) JobCreateHandler(c *gin.Context) {
 	var (
-		job *models.Job
-		err error
+		job    *models.Job
+		issues []*models.WorkflowIssue
+		err    error
 	)
 	job = &models.Job{}
 	if err = c.ShouldBindJSON(job); err != nil {
@@ -75,10 +116,10 @@ func (handler *Handler) JobCreateHandler(c *gin.Context) {
 		return
 	}
 
-	if err = handler.SaveWithUser(c, job); err != nil {
-		c.JSON(500, gin.H{
-			"message": err.Error(),
-		})
+	if issues, err = handler.saveValidatedJob(job, func(txHandler *Handler) error {
+		return txHandler.SaveWithUser(c, job)
+	}); err != nil {
+		handler.respondWithSaveError(c, issues, err)
 		return
 	}
 
@@ -93,6 +134,7 @@ func (handler *Handler) JobUpdateHandler(c *gin.Context) {
 	var (
 		job        *models.Job
 		updatedJob *models.Job
+		issues     []*models.WorkflowIssue
 		jobId      int
 		err        error
 	)
@@ -120,10 +162,10 @@ func (handler *Handler) JobUpdateHandler(c *gin.Context) {
 		return
 	}
 
-	if err = handler.UpdateWithUser(c, job, updatedJob); err != nil {
-		c.JSON(500, gin.H{
-			"message": err.Error(),
-		})
+	if issues, err = handler.saveValidatedJob(job, func(txHandler *Handler) error {
+		return txHandler.UpdateWithUser(c, job, updatedJob)
+	}); err != nil {
+		handler.respondWithSaveError(c, issues, err)
 		return
 	}
 
@@ -0,0 +1,171 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/cronny/core/models"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// setupJobTest creates a test environment with a handler and router for job tests
+func setupJobTest(t *testing.T) (*Handler, *gin.Engine) {
+	db := setupTestDB(t)
+	require.NoError(t, db.AutoMigrate(&models.Action{}, &models.Job{}, &models.JobTemplate{}, &models.JobExecution{}, &models.User{}))
+
+	handler := &Handler{db: db}
+	router := setupTestRouter(handler, 1)
+	router.POST("/jobs", handler.JobCreateHandler)
+	router.PUT("/jobs/:id", handler.JobUpdateHandler)
+	router.GET("/actions/:id/validate", handler.ActionValidateHandler)
+	return handler, router
+}
+
+func createTestJobTemplate(t *testing.T, db *gorm.DB) *models.JobTemplate {
+	jobTemplate := &models.JobTemplate{Name: "logger"}
+	jobTemplate.SetUserID(1)
+	require.NoError(t, db.Create(jobTemplate).Error)
+	return jobTemplate
+}
+
+func TestJobCreateHandler_ValidWorkflow(t *testing.T) {
+	handler, router := setupJobTest(t)
+	action := createTestAction(t, handler.db)
+	jobTemplate := createTestJobTemplate(t, handler.db)
+
+	req, _ := createRequestWithToken("POST", "/jobs", map[string]interface{}{
+		"name":            "root",
+		"action_id":       action.ID,
+		"job_template_id": jobTemplate.ID,
+		"job_input_type":  models.StaticJsonInput,
+		"job_input_value": `{}`,
+		"is_root_job":     true,
+	}, 1)
+	w := performRequest(router, req)
+
+	assertJSONResponse(t, w, http.StatusOK, map[string]interface{}{"message": "success"})
+}
+
+func TestJobCreateHandler_RejectsInvalidWorkflow(t *testing.T) {
+	handler, router := setupJobTest(t)
+	action := createTestAction(t, handler.db)
+	jobTemplate := createTestJobTemplate(t, handler.db)
+
+	req, _ := createRequestWithToken("POST", "/jobs", map[string]interface{}{
+		"name":            "root",
+		"action_id":       action.ID,
+		"job_template_id": jobTemplate.ID,
+		"job_input_type":  models.StaticJsonInput,
+		"job_input_value": `{}`,
+		"is_root_job":     true,
+		"condition":       `{"condition_rules": [{"job_id": 99999}]}`,
+	}, 1)
+	w := performRequest(router, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	var response map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	issues, ok := response["issues"].([]interface{})
+	require.True(t, ok, "Response should list the issues")
+	assert.Len(t, issues, 1)
+	assert.Equal(t, string(models.MissingRuleTargetIssue), issues[0].(map[string]interface{})["code"])
+
+	// The transaction should have been rolled back
+	var jobCount int64
+	handler.db.Model(&models.Job{}).Count(&jobCount)
+	assert.Equal(t, int64(0), jobCount, "Rejected job should not be saved")
+}
+
+func TestJobCreateHandler_RejectsInvalidCondition(t *testing.T) {
+	handler, router := setupJobTest(t)
+	action := createTestAction(t, handler.db)
+	jobTemplate := createTestJobTemplate(t, handler.db)
+
+	req, _ := createRequestWithToken("POST", "/jobs", map[string]interface{}{
+		"name":            "root",
+		"action_id":       action.ID,
+		"job_template_id": jobTemplate.ID,
+		"job_input_type":  models.StaticJsonInput,
+		"job_input_value": `{}`,
+		"is_root_job":     true,
+		"condition":       `{"condition_rules": [{"filters": [{"name": "status", "comparison_type": "unknown"}]}]}`,
+	}, 1)
+	w := performRequest(router, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	var response map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	issues, ok := response["issues"].([]interface{})
+	require.True(t, ok, "Response should list the issues")
+	assert.Len(t, issues, 1)
+	assert.Equal(t, string(models.InvalidConditionIssue), issues[0].(map[string]interface{})["code"])
+}
+
+func TestJobUpdateHandler_RejectsSecondRootJob(t *testing.T) {
+	handler, router := setupJobTest(t)
+	action := createTestAction(t, handler.db)
+	jobTemplate := createTestJobTemplate(t, handler.db)
+
+	for _, isRoot := range []bool{true, false} {
+		job := &models.Job{
+			Name:          fmt.Sprintf("job-%v", isRoot),
+			ActionID:      action.ID,
+			JobTemplateID: jobTemplate.ID,
+			JobInputType:  models.StaticJsonInput,
+			JobInputValue: `{}`,
+			IsRootJob:     isRoot,
+		}
+		job.SetUserID(1)
+		require.NoError(t, handler.db.Create(job).Error)
+	}
+
+	var nonRootJob models.Job
+	require.NoError(t, handler.db.Where("is_root_job = ?", false).First(&nonRootJob).Error)
+
+	req, _ := createRequestWithToken("PUT", fmt.Sprintf("/jobs/%d", nonRootJob.ID), map[string]interface{}{
+		"is_root_job": true,
+	}, 1)
+	w := performRequest(router, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	handler.db.First(&nonRootJob, nonRootJob.ID)
+	assert.False(t, nonRootJob.IsRootJob, "Update should have been rolled back")
+}
+
+func TestActionValidateHandler(t *testing.T) {
+	handler, router := setupJobTest(t)
+	action := createTestAction(t, handler.db)
+	jobTemplate := createTestJobTemplate(t, handler.db)
+
+	job := &models.Job{
+		Name:          "orphan",
+		ActionID:      action.ID,
+		JobTemplateID: jobTemplate.ID,
+		JobInputType:  models.StaticJsonInput,
+		JobInputValue: `{}`,
+	}
+	job.SetUserID(1)
+	require.NoError(t, handler.db.Create(job).Error)
+
+	req, _ := createRequestWithToken("GET", fmt.Sprintf("/actions/%d/validate", action.ID), nil, 1)
+	w := performRequest(router, req)
+
+	assertJSONResponse(t, w, http.StatusOK, map[string]interface{}{
+		"message": "success",
+		"valid":   false,
+	})
+	var response map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	issues := response["issues"].([]interface{})
+	assert.Len(t, issues, 1)
+	assert.Equal(t, string(models.MissingRootJobIssue), issues[0].(map[string]interface{})["code"])
+
+	req, _ = createRequestWithToken("GET", "/actions/999/validate", nil, 1)
+	w = performRequest(router, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,155 @@
+package api
+
+import (
+	"strconv"
+
+	"github.com/cronny/core/models"
+	"github.com/gin-gonic/gin"
+)
+
+type (
+	// RegistryCredentialReq is used to set the password of a registry
+	// credential since it's never bound from or rendered to JSON
+	RegistryCredentialReq struct {
+		Name     string `json:"name"`
+		Registry string `json:"registry" binding:"required"`
+		Username string `json:"username" binding:"required"`
+		Password string `json:"password" binding:"required"`
+	}
+)
+
+func (handler *Handler) RegistryCredentialIndexHandler(c *gin.Context) {
+	var (
+		credentials []*models.RegistryCredential
+	)
+
+	if ex := handler.GetUserScopedDb(c).Find(&credentials); ex.Error != nil {
+		c.JSON(500, gin.H{
+			"message": ex.Error.Error(),
+		})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"registry_credentials": credentials,
+		"message":              "success",
+	})
+	return
+}
+
+func (handler *Handler) RegistryCredentialCreateHandler(c *gin.Context) {
+	var (
+		credentialReq *RegistryCredentialReq
+		credential    *models.RegistryCredential
+		err           error
+	)
+	credentialReq = &RegistryCredentialReq{}
+	if err = c.ShouldBindJSON(credentialReq); err != nil {
+		c.JSON(400, gin.H{
+			"message": err.Error(),
+		})
+		return
+	}
+
+	credential = &models.RegistryCredential{
+		Name:     credentialReq.Name,
+		Registry: credentialReq.Registry,
+		Username: credentialReq.Username,
+		Password: credentialReq.Password,
+	}
+	if err = handler.SaveWithUser(c, credential); err != nil {
+		c.JSON(400, gin.H{
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"registry_credential": credential,
+		"message":             "success",
+	})
+	return
+}
+
+func (handler *Handler) RegistryCredentialUpdateHandler(c *gin.Context) {
+	var (
+		credentialReq *RegistryCredentialReq
+		credential    *models.RegistryCredential
+		credentialId  int
+		err           error
+	)
+	if credentialId, err = strconv.Atoi(c.Param("id")); err != nil {
+		c.JSON(400, gin.H{
+			"message": "Improper ID format",
+		})
+		return
+	}
+
+	credential = &models.RegistryCredential{}
+	if ex := handler.GetUserScopedDb(c).Where("id = ?", uint(credentialId)).First(credential); ex.Error != nil {
+		c.JSON(404, gin.H{
+			"message": "Registry credential not found",
+		})
+		return
+	}
+
+	credentialReq = &RegistryCredentialReq{}
+	if err = c.ShouldBindJSON(credentialReq); err != nil {
+		c.JSON(400, gin.H{
+			"message": err.Error(),
+		})
+		return
+	}
+
+	// The name is kept as is since jobs refer to the credential by it
+	credential.Registry = credentialReq.Registry
+	credential.Username = credentialReq.Username
+	credential.Password = credentialReq.Password
+	if ex := handler.db.Save(credential); ex.Error != nil {
+		c.JSON(400, gin.H{
+			"message": ex.Error.Error(),
+		})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"registry_credential": credential,
+		"message":             "success",
+	})
+	return
+}
+
+func (handler *Handler) RegistryCredentialDeleteHandler(c *gin.Context) {
+	var (
+		credential   *models.RegistryCredential
+		credentialId int
+		err          error
+	)
+	if credentialId, err = strconv.Atoi(c.Param("id")); err != nil {
+		c.JSON(400, gin.H{
+			"message": "Improper ID format",
+		})
+		return
+	}
+
+	credential = &models.RegistryCredential{}
+	if ex := handler.GetUserScopedDb(c).Where("id = ?", uint(credentialId)).First(credential); ex.Error != nil {
+		c.JSON(404, gin.H{
+			"message": "Registry credential not found",
+		})
+		return
+	}
+
+	if ex := handler.db.Delete(credential); ex.Error != nil {
+		c.JSON(500, gin.H{
+			"message": ex.Error.Error(),
+		})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"registry_credential": credential,
+		"message":             "success",
+	})
+	return
+}
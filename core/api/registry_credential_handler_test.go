@@ -0,0 +1,96 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/cronny/core/models"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupRegistryCredentialTest creates a test environment with a handler and router for registry credential tests
+func setupRegistryCredentialTest(t *testing.T) (*Handler, *gin.Engine) {
+	db := setupTestDB(t)
+	require.NoError(t, db.AutoMigrate(&models.RegistryCredential{}, &models.User{}))
+
+	handler := &Handler{db: db}
+	router := setupTestRouter(handler, 1)
+	router.GET("/registry_credentials", handler.RegistryCredentialIndexHandler)
+	router.POST("/registry_credentials", handler.RegistryCredentialCreateHandler)
+	router.PUT("/registry_credentials/:id", handler.RegistryCredentialUpdateHandler)
+	router.DELETE("/registry_credentials/:id", handler.RegistryCredentialDeleteHandler)
+	return handler, router
+}
+
+func TestRegistryCredentialHandlers_NeverReturnPasswords(t *testing.T) {
+	handler, router := setupRegistryCredentialTest(t)
+
+	req, _ := createRequestWithToken("POST", "/registry_credentials", map[string]interface{}{
+		"name":     "GHCR",
+		"registry": "ghcr.io",
+		"username": "cronny",
+		"password": "s3cr3t",
+	}, 1)
+	w := performRequest(router, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "s3cr3t")
+
+	var response struct {
+		RegistryCredential map[string]interface{} `json:"registry_credential"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "GHCR", response.RegistryCredential["name"])
+	assert.Equal(t, "cronny", response.RegistryCredential["username"])
+	assert.NotContains(t, response.RegistryCredential, "password")
+	assert.NotContains(t, response.RegistryCredential, "encrypted_password")
+
+	req, _ = createRequestWithToken("GET", "/registry_credentials", nil, 1)
+	w = performRequest(router, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "GHCR")
+	assert.NotContains(t, w.Body.String(), "s3cr3t")
+
+	credentialID := uint(response.RegistryCredential["ID"].(float64))
+	req, _ = createRequestWithToken("PUT", fmt.Sprintf("/registry_credentials/%d", credentialID), map[string]interface{}{
+		"registry": "ghcr.io",
+		"username": "cronny-bot",
+		"password": "updated",
+	}, 1)
+	w = performRequest(router, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "updated")
+
+	credential, err := models.GetRegistryCredential(handler.db, 1, "GHCR")
+	require.NoError(t, err)
+	assert.Equal(t, "cronny-bot", credential.Username)
+	assert.Equal(t, "updated", credential.Password)
+}
+
+func TestRegistryCredentialCreateHandler_RejectsInvalidCredentials(t *testing.T) {
+	_, router := setupRegistryCredentialTest(t)
+
+	for _, body := range []map[string]interface{}{
+		{"name": "GHCR", "registry": "ghcr.io", "username": "cronny"},
+		{"name": "ghcr-io", "registry": "ghcr.io", "username": "cronny", "password": "s3cr3t"},
+	} {
+		req, _ := createRequestWithToken("POST", "/registry_credentials", body, 1)
+		w := performRequest(router, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestRegistryCredentialDeleteHandler_OtherUsersCredential(t *testing.T) {
+	handler, router := setupRegistryCredentialTest(t)
+
+	credential := &models.RegistryCredential{Name: "GHCR", Registry: "ghcr.io", Username: "cronny", Password: "s3cr3t"}
+	credential.SetUserID(2)
+	require.NoError(t, handler.db.Create(credential).Error)
+
+	req, _ := createRequestWithToken("DELETE", fmt.Sprintf("/registry_credentials/%d", credential.ID), nil, 1)
+	w := performRequest(router, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,150 @@
+package api
+
+import (
+	"strconv"
+
+	"github.com/cronny/core/models"
+	"github.com/gin-gonic/gin"
+)
+
+type (
+	// SecretReq is used to set the value of a secret since the
+	// value of a Secret is never bound from or rendered to JSON
+	SecretReq struct {
+		Name  string `json:"name"`
+		Value string `json:"value" binding:"required"`
+	}
+)
+
+func (handler *Handler) SecretIndexHandler(c *gin.Context) {
+	var (
+		secrets []*models.Secret
+	)
+
+	if ex := handler.GetUserScopedDb(c).Find(&secrets); ex.Error != nil {
+		c.JSON(500, gin.H{
+			"message": ex.Error.Error(),
+		})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"secrets": secrets,
+		"message": "success",
+	})
+	return
+}
+
+func (handler *Handler) SecretCreateHandler(c *gin.Context) {
+	var (
+		secretReq *SecretReq
+		secret    *models.Secret
+		err       error
+	)
+	secretReq = &SecretReq{}
+	if err = c.ShouldBindJSON(secretReq); err != nil {
+		c.JSON(400, gin.H{
+			"message": err.Error(),
+		})
+		return
+	}
+
+	secret = &models.Secret{
+		Name:  secretReq.Name,
+		Value: secretReq.Value,
+	}
+	if err = handler.SaveWithUser(c, secret); err != nil {
+		c.JSON(400, gin.H{
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"secret":  secret,
+		"message": "success",
+	})
+	return
+}
+
+func (handler *Handler) SecretUpdateHandler(c *gin.Context) {
+	var (
+		secretReq *SecretReq
+		secret    *models.Secret
+		secretId  int
+		err       error
+	)
+	if secretId, err = strconv.Atoi(c.Param("id")); err != nil {
+		c.JSON(400, gin.H{
+			"message": "Improper ID format",
+		})
+		return
+	}
+
+	secret = &models.Secret{}
+	if ex := handler.GetUserScopedDb(c).Where("id = ?", uint(secretId)).First(secret); ex.Error != nil {
+		c.JSON(404, gin.H{
+			"message": "Secret not found",
+		})
+		return
+	}
+
+	secretReq = &SecretReq{}
+	if err = c.ShouldBindJSON(secretReq); err != nil {
+		c.JSON(400, gin.H{
+			"message": err.Error(),
+		})
+		return
+	}
+
+	// Only the value of a secret can be updated, the name is
+	// kept as is since jobs refer to the secret by it
+	secret.Value = secretReq.Value
+	if ex := handler.db.Save(secret); ex.Error != nil {
+		c.JSON(400, gin.H{
+			"message": ex.Error.Error(),
+		})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"secret":  secret,
+		"message": "success",
+	})
+	return
+}
+
+func (handler *Handler) SecretDeleteHandler(c *gin.Context) {
+	var (
+		secret   *models.Secret
+		secretId int
+		err      error
+	)
+	if secretId, err = strconv.Atoi(c.Param("id")); err != nil {
+		c.JSON(400, gin.H{
+			"message": "Improper ID format",
+		})
+		return
+	}
+
+	secret = &models.Secret{}
+	if ex := handler.GetUserScopedDb(c).Where("id = ?", uint(secretId)).First(secret); ex.Error != nil {
+		c.JSON(404, gin.H{
+			"message": "Secret not found",
+		})
+		return
+	}
+
+	if ex := handler.db.Delete(secret); ex.Error != nil {
+		c.JSON(500, gin.H{
+			"message": ex.Error.Error(),
+		})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"secret":  secret,
+		"message": "success",
+	})
+	return
+}
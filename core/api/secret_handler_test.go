@@ -0,0 +1,90 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/cronny/core/models"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupSecretTest creates a test environment with a handler and router for secret tests
+func setupSecretTest(t *testing.T) (*Handler, *gin.Engine) {
+	db := setupTestDB(t)
+	require.NoError(t, db.AutoMigrate(&models.Secret{}, &models.User{}))
+
+	handler := &Handler{db: db}
+	router := setupTestRouter(handler, 1)
+	router.GET("/secrets", handler.SecretIndexHandler)
+	router.POST("/secrets", handler.SecretCreateHandler)
+	router.PUT("/secrets/:id", handler.SecretUpdateHandler)
+	router.DELETE("/secrets/:id", handler.SecretDeleteHandler)
+	return handler, router
+}
+
+func TestSecretHandlers_NeverReturnValues(t *testing.T) {
+	handler, router := setupSecretTest(t)
+
+	req, _ := createRequestWithToken("POST", "/secrets", map[string]interface{}{
+		"name":  "API_TOKEN",
+		"value": "s3cr3t",
+	}, 1)
+	w := performRequest(router, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "s3cr3t")
+
+	var response struct {
+		Secret map[string]interface{} `json:"secret"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "API_TOKEN", response.Secret["name"])
+	assert.NotContains(t, response.Secret, "value")
+	assert.NotContains(t, response.Secret, "encrypted_value")
+
+	req, _ = createRequestWithToken("GET", "/secrets", nil, 1)
+	w = performRequest(router, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "API_TOKEN")
+	assert.NotContains(t, w.Body.String(), "s3cr3t")
+
+	secretID := uint(response.Secret["ID"].(float64))
+	req, _ = createRequestWithToken("PUT", fmt.Sprintf("/secrets/%d", secretID), map[string]interface{}{
+		"value": "updated",
+	}, 1)
+	w = performRequest(router, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "updated")
+
+	value, err := models.GetSecretValue(handler.db, 1, "API_TOKEN")
+	assert.NoError(t, err)
+	assert.Equal(t, "updated", value)
+}
+
+func TestSecretCreateHandler_RejectsInvalidSecrets(t *testing.T) {
+	_, router := setupSecretTest(t)
+
+	for _, body := range []map[string]interface{}{
+		{"name": "API_TOKEN"},
+		{"name": "api-token", "value": "s3cr3t"},
+	} {
+		req, _ := createRequestWithToken("POST", "/secrets", body, 1)
+		w := performRequest(router, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestSecretDeleteHandler_OtherUsersSecret(t *testing.T) {
+	handler, router := setupSecretTest(t)
+
+	secret := &models.Secret{Name: "API_TOKEN", Value: "s3cr3t"}
+	secret.SetUserID(2)
+	require.NoError(t, handler.db.Create(secret).Error)
+
+	req, _ := createRequestWithToken("DELETE", fmt.Sprintf("/secrets/%d", secret.ID), nil, 1)
+	w := performRequest(router, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,82 @@
+package api
+
+import (
+	"strconv"
+
+	"github.com/cronny/core/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	// MaxWorkflowRunsPerRequest caps the number of runs returned for an action
+	MaxWorkflowRunsPerRequest = 100
+)
+
+func (handler *Handler) ActionRunsHandler(c *gin.Context) {
+	var (
+		action   *models.Action
+		runs     []*models.WorkflowRun
+		actionId int
+		err      error
+	)
+	if actionId, err = strconv.Atoi(c.Param("id")); err != nil {
+		c.JSON(400, gin.H{
+			"message": "Improper ID format",
+		})
+		return
+	}
+
+	db := handler.GetUserScopedDb(c).Session(&gorm.Session{})
+
+	action = &models.Action{}
+	if ex := db.Where("id = ?", uint(actionId)).First(action); ex.Error != nil {
+		c.JSON(404, gin.H{
+			"message": "Action not found",
+		})
+		return
+	}
+
+	if ex := db.Where("action_id = ?", action.ID).Order("id desc").Limit(MaxWorkflowRunsPerRequest).Find(&runs); ex.Error != nil {
+		c.JSON(500, gin.H{
+			"message": ex.Error.Error(),
+		})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"runs":    runs,
+		"message": "success",
+	})
+	return
+}
+
+func (handler *Handler) WorkflowRunShowHandler(c *gin.Context) {
+	var (
+		run   *models.WorkflowRun
+		runId int
+		err   error
+	)
+	if runId, err = strconv.Atoi(c.Param("id")); err != nil {
+		c.JSON(400, gin.H{
+			"message": "Improper ID format",
+		})
+		return
+	}
+
+	run = &models.WorkflowRun{}
+	if ex := handler.GetUserScopedDb(c).Preload("JobExecutions", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id")
+	}).Where("id = ?", uint(runId)).First(run); ex.Error != nil {
+		c.JSON(404, gin.H{
+			"message": "Run not found",
+		})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"run":     run,
+		"message": "success",
+	})
+	return
+}
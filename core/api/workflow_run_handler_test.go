@@ -0,0 +1,86 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/cronny/core/models"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupWorkflowRunTest creates a test environment with a handler and router for workflow run tests
+func setupWorkflowRunTest(t *testing.T) (*Handler, *gin.Engine) {
+	db := setupTestDB(t)
+	require.NoError(t, db.AutoMigrate(&models.Action{}, &models.Job{}, &models.JobTemplate{}, &models.JobExecution{}, &models.WorkflowRun{}, &models.User{}))
+
+	handler := &Handler{db: db}
+	router := setupTestRouter(handler, 1)
+	router.GET("/actions/:id/runs", handler.ActionRunsHandler)
+	router.GET("/runs/:id", handler.WorkflowRunShowHandler)
+	return handler, router
+}
+
+func createTestWorkflowRun(t *testing.T, handler *Handler, action *models.Action) *models.WorkflowRun {
+	run, err := models.NewWorkflowRun(handler.db, action, nil)
+	require.NoError(t, err)
+
+	jobExecution := &models.JobExecution{WorkflowRunID: run.ID, Output: `{"ok": true}`}
+	jobExecution.SetUserID(action.UserID)
+	require.NoError(t, handler.db.Create(jobExecution).Error)
+	require.NoError(t, run.Finish(handler.db, models.NewExecutionContext(nil), nil))
+	return run
+}
+
+func TestActionRunsHandler(t *testing.T) {
+	handler, router := setupWorkflowRunTest(t)
+	action := createTestAction(t, handler.db)
+	createTestWorkflowRun(t, handler, action)
+	createTestWorkflowRun(t, handler, action)
+
+	req, _ := createRequestWithToken("GET", fmt.Sprintf("/actions/%d/runs", action.ID), nil, 1)
+	w := performRequest(router, req)
+
+	assertJSONResponse(t, w, http.StatusOK, map[string]interface{}{"message": "success"})
+	var response map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	runs := response["runs"].([]interface{})
+	require.Len(t, runs, 2)
+	assert.Equal(t, string(models.SucceededWorkflowRunStatus), runs[0].(map[string]interface{})["status"])
+	assert.Greater(t, runs[0].(map[string]interface{})["ID"], runs[1].(map[string]interface{})["ID"], "Latest run should be first")
+}
+
+func TestActionRunsHandler_OtherUsersAction(t *testing.T) {
+	handler, router := setupWorkflowRunTest(t)
+	action := &models.Action{Name: "Other Action"}
+	action.SetUserID(2)
+	require.NoError(t, handler.db.Create(action).Error)
+
+	req, _ := createRequestWithToken("GET", fmt.Sprintf("/actions/%d/runs", action.ID), nil, 1)
+	w := performRequest(router, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestWorkflowRunShowHandler(t *testing.T) {
+	handler, router := setupWorkflowRunTest(t)
+	action := createTestAction(t, handler.db)
+	run := createTestWorkflowRun(t, handler, action)
+
+	req, _ := createRequestWithToken("GET", fmt.Sprintf("/runs/%d", run.ID), nil, 1)
+	w := performRequest(router, req)
+
+	assertJSONResponse(t, w, http.StatusOK, map[string]interface{}{"message": "success"})
+	var response map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	runResp := response["run"].(map[string]interface{})
+	assert.Equal(t, float64(action.ID), runResp["action_id"])
+	assert.Len(t, runResp["job_executions"], 1)
+
+	req, _ = createRequestWithToken("GET", "/runs/999", nil, 1)
+	w = performRequest(router, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
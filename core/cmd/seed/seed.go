@@ -22,6 +22,10 @@ func createDefaultPlans(db *gorm.DB) error {
 		Type:        models.PlanTypeStarter,
 		Price:       0.00,
 		Description: "Basic plan for getting started",
+
+		DockerMaxCpus:     0.5,
+		DockerMaxMemoryMB: 256,
+		DockerMaxPids:     128,
 	}
 	if err := db.Save(starterPlan).Error; err != nil {
 		return fmt.Errorf("failed to create starter plan: %v", err)
@@ -33,6 +37,10 @@ func createDefaultPlans(db *gorm.DB) error {
 		Type:        models.PlanTypePro,
 		Price:       9.99,
 		Description: "Professional plan with advanced features",
+
+		DockerMaxCpus:     1,
+		DockerMaxMemoryMB: 1024,
+		DockerMaxPids:     256,
 	}
 	if err := db.Save(proPlan).Error; err != nil {
 		return fmt.Errorf("failed to create pro plan: %v", err)
@@ -112,10 +120,15 @@ func getAction(db *gorm.DB, userID uint) (action *models.Action) {
 	jobTemplate := getJobTemplate(userID)
 	db.Save(jobTemplate)
 
+	// The Slack job reads its token from the user's secrets
+	slackSecret := &models.Secret{Name: "SLACK_TOKEN", Value: SlackToken}
+	slackSecret.SetUserID(userID)
+	db.Save(slackSecret)
+
 	jobThree := &models.Job{
 		Name:          "job-3",
 		JobInputType:  models.StaticJsonInput,
-		JobInputValue: fmt.Sprintf("{\"slack_api_token\": \"%s\", \"channel_id\": \"channel_1\", \"message\": \"hello from cronny\"}", SlackToken),
+		JobInputValue: "{\"slack_api_token_secret\": \"SLACK_TOKEN\", \"channel_id\": \"channel_1\", \"message\": \"hello from cronny\"}",
 		ActionID:      action.ID,
 		JobTemplateID: jobTemplate.ID,
 	}
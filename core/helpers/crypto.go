@@ -0,0 +1,69 @@
+package helpers
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io"
+)
+
+// Encrypt encrypts the plaintext with AES-GCM using a key derived from the
+// passphrase. The result is base64 encoded with the nonce prepended to it.
+func Encrypt(passphrase, plaintext string) (ciphertext string, err error) {
+	var (
+		gcm   cipher.AEAD
+		nonce []byte
+	)
+	if gcm, err = newGCM(passphrase); err != nil {
+		return
+	}
+	nonce = make([]byte, gcm.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+	ciphertext = base64.StdEncoding.EncodeToString(sealed)
+	return
+}
+
+// Decrypt decrypts a ciphertext returned by Encrypt
+func Decrypt(passphrase, ciphertext string) (plaintext string, err error) {
+	var (
+		gcm       cipher.AEAD
+		sealed    []byte
+		plaintxtB []byte
+	)
+	if gcm, err = newGCM(passphrase); err != nil {
+		return
+	}
+	if sealed, err = base64.StdEncoding.DecodeString(ciphertext); err != nil {
+		return
+	}
+	if len(sealed) < gcm.NonceSize() {
+		err = errors.New("ciphertext is too short")
+		return
+	}
+	nonce, sealed := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	if plaintxtB, err = gcm.Open(nil, nonce, sealed, nil); err != nil {
+		return
+	}
+	plaintext = string(plaintxtB)
+	return
+}
+
+func newGCM(passphrase string) (gcm cipher.AEAD, err error) {
+	var (
+		block cipher.Block
+	)
+	key := sha256.Sum256([]byte(passphrase))
+	if block, err = aes.NewCipher(key[:]); err != nil {
+		return
+	}
+	if gcm, err = cipher.NewGCM(block); err != nil {
+		return
+	}
+	return
+}
@@ -0,0 +1,30 @@
+package helpers
+
+import (
+	"testing"
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	ciphertext, err := Encrypt("passphrase", "s3cr3t value")
+	if err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+	if ciphertext == "s3cr3t value" {
+		t.Fatal("Encrypt() returned the plaintext")
+	}
+
+	plaintext, err := Decrypt("passphrase", ciphertext)
+	if err != nil {
+		t.Fatalf("Decrypt() error = %v", err)
+	}
+	if plaintext != "s3cr3t value" {
+		t.Errorf("Decrypt() = %v, want %v", plaintext, "s3cr3t value")
+	}
+
+	if _, err = Decrypt("other passphrase", ciphertext); err == nil {
+		t.Error("Decrypt() should fail with a different passphrase")
+	}
+	if _, err = Decrypt("passphrase", "c2hvcnQ="); err == nil {
+		t.Error("Decrypt() should fail with a short ciphertext")
+	}
+}
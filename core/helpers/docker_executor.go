@@ -2,23 +2,130 @@ package helpers
 
 import (
 	"context"
-	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
 	"time"
 
+	"github.com/distribution/reference"
+	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/registry"
 	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
+	"github.com/docker/docker/pkg/jsonmessage"
+	"github.com/docker/docker/pkg/stdcopy"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
 )
 
-type DockerExecutor struct {
-	Image            string
-	Registry         string
-	RegistryUsername string
-	RegistryPassword string
-	client           *client.Client
-	timeoutSec       int
-	ctx              context.Context
-}
+const (
+	// DefaultDockerTimeout applies when the context has no deadline
+	DefaultDockerTimeout = 15 * time.Second
+	// dockerCleanupTimeout bounds stopping and removing a container, which
+	// happens even once the job's context is done
+	dockerCleanupTimeout = 30 * time.Second
+
+	// PullAlways pulls the image before every run
+	PullAlways = DockerPullPolicy("always")
+	// PullIfNotPresent only pulls the image when it's not on the host
+	PullIfNotPresent = DockerPullPolicy("if-not-present")
+	// PullNever only runs images which are on the host
+	PullNever = DockerPullPolicy("never")
+)
+
+type (
+	DockerPullPolicy string
+
+	// dockerApiClient is the part of the Docker client used by the executor
+	dockerApiClient interface {
+		ImagePull(ctx context.Context, refStr string, options image.PullOptions) (io.ReadCloser, error)
+		ImageInspectWithRaw(ctx context.Context, imageID string) (types.ImageInspect, []byte, error)
+		ContainerCreate(ctx context.Context, config *container.Config, hostConfig *container.HostConfig,
+			networkingConfig *network.NetworkingConfig, platform *ocispec.Platform, containerName string) (container.CreateResponse, error)
+		ContainerStart(ctx context.Context, containerID string, options container.StartOptions) error
+		ContainerWait(ctx context.Context, containerID string, condition container.WaitCondition) (<-chan container.WaitResponse, <-chan error)
+		ContainerLogs(ctx context.Context, containerID string, options container.LogsOptions) (io.ReadCloser, error)
+		ContainerStop(ctx context.Context, containerID string, options container.StopOptions) error
+		ContainerRemove(ctx context.Context, containerID string, options container.RemoveOptions) error
+	}
+
+	DockerMount struct {
+		// Type is bind, volume or tmpfs
+		Type     mount.Type
+		Source   string
+		Target   string
+		ReadOnly bool
+	}
+
+	// DockerLimits are the resources and the isolation of a container. The
+	// resources are unlimited when they're 0.
+	DockerLimits struct {
+		Cpus     float64
+		MemoryMB int64
+		Pids     int64
+		DiskMB   int64
+
+		// NetworkMode is none, bridge or the name of a network
+		NetworkMode    string
+		User           string
+		ReadOnlyRootfs bool
+	}
+
+	// DockerResult is the outcome of a container which ran until it exited
+	DockerResult struct {
+		ExitCode int64
+		Stdout   string
+		Stderr   string
+
+		// ImageDigest is the digest the image was pulled by, eg. sha256:...,
+		// which is empty for images which weren't pulled from a registry
+		ImageDigest string
+		ImageID     string
+	}
+
+	DockerExecutor struct {
+		Image            string
+		Registry         string
+		RegistryUsername string
+		RegistryPassword string
+		// Digest pins the image, eg. sha256:...
+		Digest string
+		// PullPolicy is PullAlways when unset
+		PullPolicy DockerPullPolicy
+
+		// Cmd and Entrypoint override the ones of the image when set
+		Cmd        []string
+		Entrypoint []string
+		// Env holds KEY=VALUE pairs
+		Env        []string
+		WorkingDir string
+		Mounts     []DockerMount
+		// Limits apply along with dropping all the capabilities of the
+		// container and preventing it from gaining new privileges
+		Limits DockerLimits
+
+		// Timeout stops the container once exceeded. The context's deadline
+		// applies when it's earlier or when Timeout is 0.
+		Timeout time.Duration
+		// MaxOutputBytes caps the stdout and the stderr kept, 0 keeps all
+		MaxOutputBytes int
+
+		client dockerApiClient
+		ctx    context.Context
+		// image is the image the container was created from
+		image types.ImageInspect
+	}
+
+	// cappedBuffer keeps the first max bytes written to it and drops the rest
+	cappedBuffer struct {
+		buf       []byte
+		max       int
+		truncated bool
+	}
+)
 
 func NewDockerExecutor(image string, registry, username, password string) (dockerExecutor *DockerExecutor, err error) {
 	dockerExecutor = &DockerExecutor{
@@ -26,93 +133,302 @@ func NewDockerExecutor(image string, registry, username, password string) (docke
 		Registry:         registry,
 		RegistryUsername: username,
 		RegistryPassword: password,
-		timeoutSec:       15,
+		Timeout:          DefaultDockerTimeout,
 		ctx:              context.Background(),
 	}
-	if dockerExecutor.client, err = client.NewClientWithOpts(client.FromEnv); err != nil {
+	if dockerExecutor.client, err = client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation()); err != nil {
 		return
 	}
 	return
 }
 
-func (dockerExecutor *DockerExecutor) Prepare() (resp container.CreateResponse, err error) {
-	// Determine the full image name with registry if provided
-	imageName := dockerExecutor.Image
+// ImageName is the image with its registry and its digest
+func (dockerExecutor *DockerExecutor) ImageName() (imageName string) {
+	imageName = dockerExecutor.Image
 	if dockerExecutor.Registry != "" {
-		// If registry is provided, format the image name correctly
-		imageName = dockerExecutor.Registry + "/" + dockerExecutor.Image
+		imageName = dockerExecutor.Registry + "/" + imageName
+	}
+	if dockerExecutor.Digest != "" {
+		imageName += "@" + dockerExecutor.Digest
 	}
+	return
+}
 
-	// Set up authentication for private registry if credentials are provided
-	var pullOptions image.PullOptions
+// pullImage pulls the image, authenticating with the registry credentials
+// when they're provided
+func (dockerExecutor *DockerExecutor) pullImage(imageName string) (err error) {
+	var (
+		pullOptions image.PullOptions
+		pullResp    io.ReadCloser
+	)
 	if dockerExecutor.RegistryUsername != "" && dockerExecutor.RegistryPassword != "" {
-		// Create auth configuration
-		authConfig := map[string]string{
-			"username": dockerExecutor.RegistryUsername,
-			"password": dockerExecutor.RegistryPassword,
+		if pullOptions.RegistryAuth, err = registry.EncodeAuthConfig(registry.AuthConfig{
+			Username:      dockerExecutor.RegistryUsername,
+			Password:      dockerExecutor.RegistryPassword,
+			ServerAddress: dockerExecutor.Registry,
+		}); err != nil {
+			return
 		}
+	}
 
-		// Convert to JSON for Docker API
-		encodedJSON, err := json.Marshal(authConfig)
-		if err != nil {
-			return resp, err
+	// The pull only completes once its progress is read, errors are
+	// reported as part of the progress
+	if pullResp, err = dockerExecutor.client.ImagePull(dockerExecutor.ctx, imageName, pullOptions); err != nil {
+		err = fmt.Errorf("Failed to pull image %s: %w", imageName, err)
+		return
+	}
+	defer pullResp.Close()
+	if err = jsonmessage.DisplayJSONMessagesStream(pullResp, io.Discard, 0, false, nil); err != nil {
+		err = fmt.Errorf("Failed to pull image %s: %w", imageName, err)
+		return
+	}
+	return
+}
+
+// ensureImage pulls the image according to the pull policy and inspects it
+func (dockerExecutor *DockerExecutor) ensureImage(imageName string) (err error) {
+	switch dockerExecutor.PullPolicy {
+	case "", PullAlways:
+		if err = dockerExecutor.pullImage(imageName); err != nil {
+			return
+		}
+	case PullIfNotPresent, PullNever:
+		if dockerExecutor.image, _, err = dockerExecutor.client.ImageInspectWithRaw(dockerExecutor.ctx, imageName); err == nil {
+			return
 		}
+		if !errdefs.IsNotFound(err) {
+			return
+		}
+		if dockerExecutor.PullPolicy == PullNever {
+			err = fmt.Errorf("Image %s isn't present and the pull policy is never", imageName)
+			return
+		}
+		if err = dockerExecutor.pullImage(imageName); err != nil {
+			return
+		}
+	default:
+		err = fmt.Errorf("Unsupported pull policy %s", dockerExecutor.PullPolicy)
+		return
+	}
+	if dockerExecutor.image, _, err = dockerExecutor.client.ImageInspectWithRaw(dockerExecutor.ctx, imageName); err != nil {
+		err = fmt.Errorf("Failed to inspect image %s: %w", imageName, err)
+		return
+	}
+	return
+}
 
-		pullOptions = image.PullOptions{
-			RegistryAuth: string(encodedJSON),
+// imageDigest returns the digest of the image in the repository it was
+// pulled from, the image can have the digests of several repositories
+func (dockerExecutor *DockerExecutor) imageDigest(imageName string) (digest string) {
+	named, err := reference.ParseNormalizedNamed(imageName)
+	if err != nil {
+		return
+	}
+	for _, repoDigest := range dockerExecutor.image.RepoDigests {
+		repoNamed, err := reference.ParseNormalizedNamed(repoDigest)
+		if err != nil {
+			continue
+		}
+		if canonical, isCanonical := repoNamed.(reference.Canonical); isCanonical && repoNamed.Name() == named.Name() {
+			return canonical.Digest().String()
 		}
 	}
+	return
+}
 
-	// Pull the image with appropriate options
-	if _, err = dockerExecutor.client.ImagePull(dockerExecutor.ctx, imageName, pullOptions); err != nil {
+func (dockerExecutor *DockerExecutor) Prepare() (resp container.CreateResponse, err error) {
+	imageName := dockerExecutor.ImageName()
+	if err = dockerExecutor.ensureImage(imageName); err != nil {
 		return
 	}
 
+	mounts := make([]mount.Mount, 0, len(dockerExecutor.Mounts))
+	for _, dockerMount := range dockerExecutor.Mounts {
+		mounts = append(mounts, mount.Mount{
+			Type:     dockerMount.Type,
+			Source:   dockerMount.Source,
+			Target:   dockerMount.Target,
+			ReadOnly: dockerMount.ReadOnly,
+		})
+	}
+
 	// Create the container
 	if resp, err = dockerExecutor.client.ContainerCreate(dockerExecutor.ctx, &container.Config{
-		Image: imageName,
-		Cmd:   []string{"echo", "Hello from Docker!"},
-	}, nil, nil, nil, ""); err != nil {
+		Image:      imageName,
+		Cmd:        dockerExecutor.Cmd,
+		Entrypoint: dockerExecutor.Entrypoint,
+		Env:        dockerExecutor.Env,
+		WorkingDir: dockerExecutor.WorkingDir,
+		User:       dockerExecutor.Limits.User,
+	}, dockerExecutor.hostConfig(mounts), nil, nil, ""); err != nil {
 		return
 	}
 	return
 }
 
-func (dockerExecutor *DockerExecutor) WaitAfterExecuting(createResp container.CreateResponse) (err error) {
+// hostConfig applies the limits of the container
+func (dockerExecutor *DockerExecutor) hostConfig(mounts []mount.Mount) (hostConfig *container.HostConfig) {
+	limits := dockerExecutor.Limits
+	hostConfig = &container.HostConfig{
+		Mounts:         mounts,
+		NetworkMode:    container.NetworkMode(limits.NetworkMode),
+		ReadonlyRootfs: limits.ReadOnlyRootfs,
+		CapDrop:        []string{"ALL"},
+		SecurityOpt:    []string{"no-new-privileges"},
+		Resources: container.Resources{
+			NanoCPUs: int64(limits.Cpus * 1e9),
+			Memory:   limits.MemoryMB << 20,
+			// The swap is included in MemorySwap, setting both to the same
+			// value prevents the container from swapping
+			MemorySwap: limits.MemoryMB << 20,
+		},
+	}
+	if limits.Pids > 0 {
+		hostConfig.Resources.PidsLimit = &limits.Pids
+	}
+	if limits.DiskMB > 0 {
+		hostConfig.StorageOpt = map[string]string{"size": fmt.Sprintf("%dM", limits.DiskMB)}
+	}
+	return
+}
+
+// timeout returns the time the container can run for
+func (dockerExecutor *DockerExecutor) timeout() (timeout time.Duration) {
+	timeout = dockerExecutor.Timeout
+	deadline, hasDeadline := dockerExecutor.ctx.Deadline()
+	if hasDeadline && (timeout <= 0 || time.Until(deadline) < timeout) {
+		timeout = time.Until(deadline)
+		return
+	}
+	if timeout <= 0 {
+		timeout = DefaultDockerTimeout
+	}
+	return
+}
+
+// cleanupContext outlives the executor's context so that containers are
+// stopped and removed once the job has timed out or been cancelled
+func (dockerExecutor *DockerExecutor) cleanupContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.WithoutCancel(dockerExecutor.ctx), dockerCleanupTimeout)
+}
+
+// WaitAfterExecuting waits for the container to exit and collects its logs.
+// The container is stopped when it runs past the timeout.
+func (dockerExecutor *DockerExecutor) WaitAfterExecuting(createResp container.CreateResponse) (result *DockerResult, err error) {
+	timeout := dockerExecutor.timeout()
 	statusCh, errCh := dockerExecutor.client.ContainerWait(dockerExecutor.ctx, createResp.ID, container.WaitConditionNotRunning)
-	timeout := time.After(time.Duration(dockerExecutor.timeoutSec) * time.Second)
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
 
 	select {
 	case err = <-errCh:
-		if err != nil {
-			break
-		}
-	case <-statusCh:
-		break
-	case <-timeout:
-		if err = dockerExecutor.client.ContainerStop(dockerExecutor.ctx, createResp.ID, container.StopOptions{}); err != nil {
-			break
+		dockerExecutor.stop(createResp.ID)
+		err = fmt.Errorf("Failed to wait for the container: %w", err)
+		return
+	case status := <-statusCh:
+		if status.Error != nil {
+			err = fmt.Errorf("Failed to wait for the container: %s", status.Error.Message)
+			return
 		}
+		result = &DockerResult{ExitCode: status.StatusCode}
+	case <-timer.C:
+		dockerExecutor.stop(createResp.ID)
+		err = fmt.Errorf("Container timed out after %s", timeout.Round(time.Second))
+		return
+	}
+
+	if result.Stdout, result.Stderr, err = dockerExecutor.logs(createResp.ID); err != nil {
+		return
 	}
-	if err = dockerExecutor.client.ContainerRemove(dockerExecutor.ctx, createResp.ID, container.RemoveOptions{}); err != nil {
+	return
+}
+
+func (dockerExecutor *DockerExecutor) stop(containerID string) {
+	ctx, cancel := dockerExecutor.cleanupContext()
+	defer cancel()
+	timeoutSecs := 0
+	dockerExecutor.client.ContainerStop(ctx, containerID, container.StopOptions{Timeout: &timeoutSecs})
+}
+
+func (dockerExecutor *DockerExecutor) remove(containerID string) {
+	ctx, cancel := dockerExecutor.cleanupContext()
+	defer cancel()
+	dockerExecutor.client.ContainerRemove(ctx, containerID, container.RemoveOptions{Force: true})
+}
+
+// logs returns the stdout and the stderr of the container
+func (dockerExecutor *DockerExecutor) logs(containerID string) (stdout, stderr string, err error) {
+	var (
+		logsResp io.ReadCloser
+	)
+	ctx, cancel := dockerExecutor.cleanupContext()
+	defer cancel()
+	if logsResp, err = dockerExecutor.client.ContainerLogs(ctx, containerID, container.LogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+	}); err != nil {
+		err = fmt.Errorf("Failed to read the container logs: %w", err)
 		return
 	}
+	defer logsResp.Close()
+
+	stdoutBuf := &cappedBuffer{max: dockerExecutor.MaxOutputBytes}
+	stderrBuf := &cappedBuffer{max: dockerExecutor.MaxOutputBytes}
+	if _, err = stdcopy.StdCopy(stdoutBuf, stderrBuf, logsResp); err != nil {
+		err = fmt.Errorf("Failed to read the container logs: %w", err)
+		return
+	}
+	stdout, stderr = stdoutBuf.String(), stderrBuf.String()
 	return
 }
 
-func (dockerExecutor *DockerExecutor) Execute() (output string, err error) {
+// Execute runs the container until it exits. The container is removed
+// whatever the outcome and exiting with a non-zero code is an error, the
+// result with the container's logs is returned along with it.
+func (dockerExecutor *DockerExecutor) Execute(ctx context.Context) (result *DockerResult, err error) {
 	var (
 		createResp container.CreateResponse
 	)
+	dockerExecutor.ctx = ctx
 	if createResp, err = dockerExecutor.Prepare(); err != nil {
 		return
 	}
+	defer dockerExecutor.remove(createResp.ID)
+
 	if err = dockerExecutor.client.ContainerStart(dockerExecutor.ctx, createResp.ID, container.StartOptions{}); err != nil {
 		return
 	}
-	if err = dockerExecutor.WaitAfterExecuting(createResp); err != nil {
+	if result, err = dockerExecutor.WaitAfterExecuting(createResp); err != nil {
+		return
+	}
+	result.ImageDigest = dockerExecutor.imageDigest(dockerExecutor.ImageName())
+	result.ImageID = dockerExecutor.image.ID
+	if result.ExitCode != 0 {
+		err = fmt.Errorf("Container exited with code %d: %s", result.ExitCode, lastLine(result.Stderr))
 		return
 	}
+	return
+}
 
+// lastLine returns the last line, usually the error of a failed command
+func lastLine(str string) string {
+	str = strings.TrimSpace(str)
+	return str[strings.LastIndex(str, "\n")+1:]
+}
+
+func (buf *cappedBuffer) Write(p []byte) (n int, err error) {
+	n = len(p)
+	if buf.max > 0 && len(buf.buf)+len(p) > buf.max {
+		p = p[:buf.max-len(buf.buf)]
+		buf.truncated = true
+	}
+	buf.buf = append(buf.buf, p...)
 	return
 }
+
+func (buf *cappedBuffer) String() string {
+	if buf.truncated {
+		return string(buf.buf) + "\n[truncated]"
+	}
+	return string(buf.buf)
+}
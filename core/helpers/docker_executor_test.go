@@ -1,7 +1,25 @@
 package helpers
 
 import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/registry"
+	"github.com/docker/docker/errdefs"
+	"github.com/docker/docker/pkg/stdcopy"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestNewDockerExecutor(t *testing.T) {
@@ -68,6 +86,7 @@ func TestDockerExecutor_PrepareImageName(t *testing.T) {
 		name              string
 		image             string
 		registry          string
+		digest            string
 		wantFullImageName string
 	}{
 		{
@@ -94,15 +113,19 @@ func TestDockerExecutor_PrepareImageName(t *testing.T) {
 			registry:          "registry.example.com",
 			wantFullImageName: "registry.example.com/nginx:latest",
 		},
+		{
+			name:              "image with digest",
+			image:             "nginx:latest",
+			registry:          "registry.example.com",
+			digest:            "sha256:abc",
+			wantFullImageName: "registry.example.com/nginx:latest@sha256:abc",
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			// Test just the image name construction logic
-			imageName := tt.image
-			if tt.registry != "" {
-				imageName = tt.registry + "/" + tt.image
-			}
+			executor := &DockerExecutor{Image: tt.image, Registry: tt.registry, Digest: tt.digest}
+			imageName := executor.ImageName()
 
 			if imageName != tt.wantFullImageName {
 				t.Errorf("Expected image name %v, got %v", tt.wantFullImageName, imageName)
@@ -110,3 +133,229 @@ func TestDockerExecutor_PrepareImageName(t *testing.T) {
 		})
 	}
 }
+
+// fakeDockerClient runs containers instantly, exiting with exitCode after
+// writing stdout and stderr, or never exiting when hang is set
+type fakeDockerClient struct {
+	pullStream string
+	exitCode   int64
+	stdout     string
+	stderr     string
+	hang       bool
+	// images are the images on the host, pulled images are added to it
+	images map[string]types.ImageInspect
+
+	pulled   []string
+	pullAuth string
+	created  *container.Config
+	hostCfg *container.HostConfig
+	stopped bool
+	removed bool
+}
+
+func (fake *fakeDockerClient) ImagePull(ctx context.Context, refStr string, options image.PullOptions) (io.ReadCloser, error) {
+	fake.pulled = append(fake.pulled, refStr)
+	fake.pullAuth = options.RegistryAuth
+	if fake.images == nil {
+		fake.images = make(map[string]types.ImageInspect)
+	}
+	if _, isPresent := fake.images[refStr]; !isPresent {
+		fake.images[refStr] = types.ImageInspect{ID: "sha256:pulled"}
+	}
+	return io.NopCloser(strings.NewReader(fake.pullStream)), nil
+}
+
+func (fake *fakeDockerClient) ImageInspectWithRaw(ctx context.Context, imageID string) (types.ImageInspect, []byte, error) {
+	inspect, isPresent := fake.images[imageID]
+	if !isPresent {
+		return inspect, nil, errdefs.NotFound(fmt.Errorf("No such image: %s", imageID))
+	}
+	return inspect, nil, nil
+}
+
+func (fake *fakeDockerClient) ContainerCreate(ctx context.Context, config *container.Config, hostConfig *container.HostConfig,
+	networkingConfig *network.NetworkingConfig, platform *ocispec.Platform, containerName string) (container.CreateResponse, error) {
+	fake.created, fake.hostCfg = config, hostConfig
+	return container.CreateResponse{ID: "c1"}, nil
+}
+
+func (fake *fakeDockerClient) ContainerStart(ctx context.Context, containerID string, options container.StartOptions) error {
+	return nil
+}
+
+func (fake *fakeDockerClient) ContainerWait(ctx context.Context, containerID string, condition container.WaitCondition) (<-chan container.WaitResponse, <-chan error) {
+	statusCh := make(chan container.WaitResponse, 1)
+	errCh := make(chan error, 1)
+	if !fake.hang {
+		statusCh <- container.WaitResponse{StatusCode: fake.exitCode}
+	}
+	return statusCh, errCh
+}
+
+func (fake *fakeDockerClient) ContainerLogs(ctx context.Context, containerID string, options container.LogsOptions) (io.ReadCloser, error) {
+	logs := &bytes.Buffer{}
+	stdcopy.NewStdWriter(logs, stdcopy.Stdout).Write([]byte(fake.stdout))
+	stdcopy.NewStdWriter(logs, stdcopy.Stderr).Write([]byte(fake.stderr))
+	return io.NopCloser(logs), nil
+}
+
+func (fake *fakeDockerClient) ContainerStop(ctx context.Context, containerID string, options container.StopOptions) error {
+	fake.stopped = true
+	return nil
+}
+
+func (fake *fakeDockerClient) ContainerRemove(ctx context.Context, containerID string, options container.RemoveOptions) error {
+	fake.removed = true
+	return nil
+}
+
+func newFakeDockerExecutor(fake *fakeDockerClient) *DockerExecutor {
+	return &DockerExecutor{Image: "alpine", client: fake, Timeout: DefaultDockerTimeout, ctx: context.Background()}
+}
+
+func TestDockerExecutor_Execute_CapturesOutput(t *testing.T) {
+	fake := &fakeDockerClient{stdout: "hello\n", stderr: "warning\n"}
+	executor := newFakeDockerExecutor(fake)
+	executor.Cmd = []string{"echo", "hello"}
+	executor.Env = []string{"LEVEL=debug"}
+	executor.WorkingDir = "/app"
+	executor.Mounts = []DockerMount{{Type: mount.TypeVolume, Source: "cache", Target: "/cache", ReadOnly: true}}
+
+	result, err := executor.Execute(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), result.ExitCode)
+	assert.Equal(t, "hello\n", result.Stdout)
+	assert.Equal(t, "warning\n", result.Stderr)
+
+	assert.Equal(t, []string{"echo", "hello"}, []string(fake.created.Cmd))
+	assert.Equal(t, []string{"LEVEL=debug"}, fake.created.Env)
+	assert.Equal(t, "/app", fake.created.WorkingDir)
+	assert.Equal(t, []mount.Mount{{Type: mount.TypeVolume, Source: "cache", Target: "/cache", ReadOnly: true}}, fake.hostCfg.Mounts)
+	assert.True(t, fake.removed, "The container should be removed")
+}
+
+func TestDockerExecutor_Execute_AppliesLimits(t *testing.T) {
+	fake := &fakeDockerClient{}
+	executor := newFakeDockerExecutor(fake)
+	executor.Limits = DockerLimits{Cpus: 0.5, MemoryMB: 128, Pids: 64, DiskMB: 1024,
+		NetworkMode: "none", User: "65534:65534", ReadOnlyRootfs: true}
+
+	_, err := executor.Execute(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "65534:65534", fake.created.User)
+	assert.Equal(t, container.NetworkMode("none"), fake.hostCfg.NetworkMode)
+	assert.True(t, fake.hostCfg.ReadonlyRootfs)
+	assert.Equal(t, []string{"ALL"}, []string(fake.hostCfg.CapDrop))
+	assert.Equal(t, int64(500000000), fake.hostCfg.NanoCPUs)
+	assert.Equal(t, int64(128<<20), fake.hostCfg.Memory)
+	assert.Equal(t, fake.hostCfg.Memory, fake.hostCfg.MemorySwap, "The container shouldn't swap")
+	require.NotNil(t, fake.hostCfg.PidsLimit)
+	assert.Equal(t, int64(64), *fake.hostCfg.PidsLimit)
+	assert.Equal(t, map[string]string{"size": "1024M"}, fake.hostCfg.StorageOpt)
+}
+
+func TestDockerExecutor_Execute_PullPolicies(t *testing.T) {
+	present := map[string]types.ImageInspect{"alpine": {ID: "sha256:local"}}
+	tests := []struct {
+		name       string
+		policy     DockerPullPolicy
+		images     map[string]types.ImageInspect
+		wantPulled bool
+		wantErr    string
+	}{
+		{name: "always pulls", policy: PullAlways, images: present, wantPulled: true},
+		{name: "unset pulls", images: present, wantPulled: true},
+		{name: "if-not-present uses the image on the host", policy: PullIfNotPresent, images: present},
+		{name: "if-not-present pulls missing images", policy: PullIfNotPresent, wantPulled: true},
+		{name: "never uses the image on the host", policy: PullNever, images: present},
+		{name: "never fails for missing images", policy: PullNever, wantErr: "isn't present"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeDockerClient{images: tt.images}
+			executor := newFakeDockerExecutor(fake)
+			executor.PullPolicy = tt.policy
+
+			_, err := executor.Execute(context.Background())
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				assert.Nil(t, fake.created)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantPulled, len(fake.pulled) > 0)
+		})
+	}
+}
+
+func TestDockerExecutor_Execute_ReportsDigest(t *testing.T) {
+	digest := "sha256:" + strings.Repeat("a", 64)
+	fake := &fakeDockerClient{images: map[string]types.ImageInspect{
+		"registry.example.com/team/app@" + digest: {ID: "sha256:image", RepoDigests: []string{
+			"mirror.example.com/team/app@sha256:" + strings.Repeat("b", 64),
+			"registry.example.com/team/app@" + digest,
+		}},
+	}}
+	executor := newFakeDockerExecutor(fake)
+	executor.Registry = "registry.example.com"
+	executor.Image = "team/app"
+	executor.Digest = digest
+	executor.RegistryUsername, executor.RegistryPassword = "user", "pass"
+
+	result, err := executor.Execute(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"registry.example.com/team/app@" + digest}, fake.pulled)
+	assert.Equal(t, "registry.example.com/team/app@"+digest, fake.created.Image)
+	assert.Equal(t, digest, result.ImageDigest)
+	assert.Equal(t, "sha256:image", result.ImageID)
+
+	// The Docker API expects the credentials as base64url encoded JSON
+	authConfig, err := registry.DecodeAuthConfig(fake.pullAuth)
+	require.NoError(t, err)
+	assert.Equal(t, "user", authConfig.Username)
+	assert.Equal(t, "pass", authConfig.Password)
+	assert.Equal(t, "registry.example.com", authConfig.ServerAddress)
+}
+
+func TestDockerExecutor_Execute_FailsOnNonZeroExit(t *testing.T) {
+	fake := &fakeDockerClient{exitCode: 2, stderr: "starting\nfile not found\n"}
+	result, err := newFakeDockerExecutor(fake).Execute(context.Background())
+	assert.EqualError(t, err, "Container exited with code 2: file not found")
+	require.NotNil(t, result)
+	assert.Equal(t, int64(2), result.ExitCode)
+	assert.Equal(t, "starting\nfile not found\n", result.Stderr)
+	assert.True(t, fake.removed)
+}
+
+func TestDockerExecutor_Execute_PullError(t *testing.T) {
+	fake := &fakeDockerClient{pullStream: `{"status": "Pulling from library/missing"}` + "\n" +
+		`{"errorDetail": {"message": "manifest unknown"}, "error": "manifest unknown"}` + "\n"}
+	_, err := newFakeDockerExecutor(fake).Execute(context.Background())
+	assert.ErrorContains(t, err, "manifest unknown")
+	assert.Nil(t, fake.created, "The container shouldn't be created")
+}
+
+func TestDockerExecutor_Execute_StopsOnTimeout(t *testing.T) {
+	fake := &fakeDockerClient{hang: true}
+	executor := newFakeDockerExecutor(fake)
+	executor.Timeout = 0
+
+	// The context's deadline applies when there's no timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := executor.Execute(ctx)
+	assert.ErrorContains(t, err, "Container timed out")
+	assert.True(t, fake.stopped)
+	assert.True(t, fake.removed, "The container should be removed once the context is done")
+}
+
+func TestCappedBuffer(t *testing.T) {
+	buf := &cappedBuffer{max: 5}
+	n, err := buf.Write([]byte("abc"))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+	n, _ = buf.Write([]byte("defgh"))
+	assert.Equal(t, 5, n, "Writes should succeed so that the rest of the logs is drained")
+	buf.Write([]byte("ijk"))
+	assert.Equal(t, "abcde\n[truncated]", buf.String())
+}
@@ -0,0 +1,102 @@
+package helpers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type (
+	// PathSegment is a single step of a JSON path. It is either a key
+	// of an object or an index of an array.
+	PathSegment struct {
+		Key     string
+		Index   int
+		IsIndex bool
+	}
+)
+
+// ParsePath parses dotted paths like "data.items[0].id". A leading "$" is
+// optional, so JSONPath style selectors like "$.data.items[0]" and keys
+// with dots in them like `$["a.b"].c` are supported as well.
+func ParsePath(path string) (segments []PathSegment, err error) {
+	path = strings.TrimSpace(path)
+	path = strings.TrimPrefix(path, "$")
+	idx := 0
+	for idx < len(path) {
+		switch path[idx] {
+		case '.':
+			idx++
+			if idx >= len(path) || path[idx] == '.' || path[idx] == '[' {
+				err = fmt.Errorf("Empty key in path %s", path)
+				return
+			}
+		case '[':
+			closeIdx := strings.IndexByte(path[idx:], ']')
+			if closeIdx < 0 {
+				err = fmt.Errorf("Unclosed bracket in path %s", path)
+				return
+			}
+			selector := path[idx+1 : idx+closeIdx]
+			idx += closeIdx + 1
+			if len(selector) >= 2 && (selector[0] == '"' || selector[0] == '\'') && selector[len(selector)-1] == selector[0] {
+				segments = append(segments, PathSegment{Key: selector[1 : len(selector)-1]})
+				continue
+			}
+			var arrIdx int
+			if arrIdx, err = strconv.Atoi(selector); err != nil || arrIdx < 0 {
+				err = fmt.Errorf("Invalid array index %s in path %s", selector, path)
+				return
+			}
+			segments = append(segments, PathSegment{Index: arrIdx, IsIndex: true})
+			continue
+		}
+		endIdx := strings.IndexAny(path[idx:], ".[")
+		if endIdx < 0 {
+			endIdx = len(path) - idx
+		}
+		if endIdx > 0 {
+			segments = append(segments, PathSegment{Key: path[idx : idx+endIdx]})
+		}
+		idx += endIdx
+	}
+	if len(segments) == 0 {
+		err = fmt.Errorf("Path %s doesn't select anything", path)
+		return
+	}
+	return
+}
+
+// LookupPath returns the value present at the path in data decoded from
+// JSON, ie. made up of map[string]interface{} and []interface{} values.
+func LookupPath(data interface{}, path string) (value interface{}, isPresent bool, err error) {
+	var (
+		segments []PathSegment
+	)
+	if segments, err = ParsePath(path); err != nil {
+		return
+	}
+	value = data
+	for _, segment := range segments {
+		if segment.IsIndex {
+			arr, isArr := value.([]interface{})
+			if !isArr || segment.Index >= len(arr) {
+				value, isPresent = nil, false
+				return
+			}
+			value = arr[segment.Index]
+			continue
+		}
+		obj, isObj := value.(map[string]interface{})
+		if !isObj {
+			value, isPresent = nil, false
+			return
+		}
+		if value, isPresent = obj[segment.Key]; !isPresent {
+			value = nil
+			return
+		}
+	}
+	isPresent = true
+	return
+}
@@ -0,0 +1,54 @@
+package helpers
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestLookupPath(t *testing.T) {
+	var data interface{}
+	if err := json.Unmarshal([]byte(`{
+		"status": "ok",
+		"a.b": {"c": 1},
+		"data": {"items": [{"id": 7, "tags": ["x", "y"]}], "empty": null}
+	}`), &data); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		path      string
+		expected  interface{}
+		isPresent bool
+		wantErr   bool
+	}{
+		{name: "top level key", path: "status", expected: "ok", isPresent: true},
+		{name: "nested key", path: "data.items[0].id", expected: float64(7), isPresent: true},
+		{name: "jsonpath prefix", path: "$.data.items[0].tags[1]", expected: "y", isPresent: true},
+		{name: "quoted key", path: `$["a.b"].c`, expected: float64(1), isPresent: true},
+		{name: "null value", path: "data.empty", expected: nil, isPresent: true},
+		{name: "missing key", path: "data.missing"},
+		{name: "index out of range", path: "data.items[3].id"},
+		{name: "index on object", path: "data[0]"},
+		{name: "key on scalar", path: "status.value"},
+		{name: "empty key", path: "data..items", wantErr: true},
+		{name: "unclosed bracket", path: "data.items[0", wantErr: true},
+		{name: "invalid index", path: "data.items[-1]", wantErr: true},
+		{name: "empty path", path: "$", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, isPresent, err := LookupPath(data, tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LookupPath() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if isPresent != tt.isPresent {
+				t.Errorf("LookupPath() isPresent = %v, want %v", isPresent, tt.isPresent)
+			}
+			if value != tt.expected {
+				t.Errorf("LookupPath() value = %v, want %v", value, tt.expected)
+			}
+		})
+	}
+}
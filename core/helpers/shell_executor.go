@@ -0,0 +1,94 @@
+package helpers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const (
+	// shellWaitDelay bounds waiting for the output of the processes the
+	// command started once it has been killed
+	shellWaitDelay = time.Second
+)
+
+type (
+	// ShellResult is the outcome of a command which ran until it exited
+	ShellResult struct {
+		ExitCode int
+		Stdout   string
+		Stderr   string
+	}
+
+	ShellExecutor struct {
+		// Command is the program, looked up in the PATH, and its arguments
+		Command []string
+		Dir     string
+		// Env holds KEY=VALUE pairs, the command doesn't inherit the
+		// environment of the executor besides its PATH
+		Env   []string
+		Stdin string
+
+		// Timeout kills the command once exceeded. The context's deadline
+		// applies when it's earlier or when Timeout is 0.
+		Timeout time.Duration
+		// MaxOutputBytes caps the stdout and the stderr kept, 0 keeps all
+		MaxOutputBytes int
+	}
+)
+
+// Execute runs the command until it exits. Exiting with a non-zero code is
+// an error, the result still has the command's output.
+func (shellExecutor *ShellExecutor) Execute(ctx context.Context) (result *ShellResult, err error) {
+	var (
+		cancel context.CancelFunc
+	)
+	if len(shellExecutor.Command) == 0 {
+		err = fmt.Errorf("Command is empty")
+		return
+	}
+	if shellExecutor.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, shellExecutor.Timeout)
+		defer cancel()
+	}
+
+	cmd := exec.CommandContext(ctx, shellExecutor.Command[0], shellExecutor.Command[1:]...)
+	cmd.Dir = shellExecutor.Dir
+	cmd.Env = shellExecutor.Env
+	cmd.Stdin = strings.NewReader(shellExecutor.Stdin)
+	stdoutBuf := &cappedBuffer{max: shellExecutor.MaxOutputBytes}
+	stderrBuf := &cappedBuffer{max: shellExecutor.MaxOutputBytes}
+	cmd.Stdout, cmd.Stderr = stdoutBuf, stderrBuf
+	cmd.WaitDelay = shellWaitDelay
+	killProcessGroup(cmd)
+
+	startTime := time.Now()
+	runErr := cmd.Run()
+	result = &ShellResult{
+		ExitCode: cmd.ProcessState.ExitCode(),
+		Stdout:   stdoutBuf.String(),
+		Stderr:   stderrBuf.String(),
+	}
+	if ctx.Err() != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			err = fmt.Errorf("Command timed out after %s", time.Since(startTime).Round(time.Second))
+			return
+		}
+		err = ctx.Err()
+		return
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(runErr, &exitErr) {
+		err = fmt.Errorf("Command exited with code %d: %s", result.ExitCode, lastLine(result.Stderr))
+		return
+	}
+	if runErr != nil {
+		err = fmt.Errorf("Failed to run %s: %w", shellExecutor.Command[0], runErr)
+		return
+	}
+	return
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package helpers
+
+import (
+	"os/exec"
+)
+
+// killProcessGroup leaves the command as is, only the command itself is
+// killed since process groups are unix specific
+func killProcessGroup(cmd *exec.Cmd) {}
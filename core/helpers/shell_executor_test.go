@@ -0,0 +1,58 @@
+package helpers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShellExecutor_Execute_CapturesOutput(t *testing.T) {
+	executor := &ShellExecutor{
+		Command: []string{"/bin/sh", "-c", `read name; echo "hello $name from $PWD"; echo "$LEVEL" >&2`},
+		Dir:     "/tmp",
+		Env:     []string{"LEVEL=debug"},
+		Stdin:   "cronny\n",
+	}
+	result, err := executor.Execute(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 0, result.ExitCode)
+	assert.Equal(t, "hello cronny from /tmp\n", result.Stdout)
+	assert.Equal(t, "debug\n", result.Stderr)
+}
+
+func TestShellExecutor_Execute_FailsOnNonZeroExit(t *testing.T) {
+	executor := &ShellExecutor{Command: []string{"/bin/sh", "-c", "echo starting >&2; echo 'file not found' >&2; exit 3"}}
+	result, err := executor.Execute(context.Background())
+	assert.EqualError(t, err, "Command exited with code 3: file not found")
+	assert.Equal(t, 3, result.ExitCode)
+}
+
+func TestShellExecutor_Execute_CapsOutput(t *testing.T) {
+	executor := &ShellExecutor{Command: []string{"/bin/sh", "-c", "echo 0123456789"}, MaxOutputBytes: 4}
+	result, err := executor.Execute(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "0123\n[truncated]", result.Stdout)
+}
+
+func TestShellExecutor_Execute_KillsOnTimeout(t *testing.T) {
+	// The sleep started by the shell holds the output open until it's killed
+	executor := &ShellExecutor{Command: []string{"/bin/sh", "-c", "sleep 30; echo done"}, Timeout: 100 * time.Millisecond}
+	startTime := time.Now()
+	_, err := executor.Execute(context.Background())
+	assert.ErrorContains(t, err, "Command timed out")
+	assert.Less(t, time.Since(startTime), 5*time.Second)
+
+	// The context's deadline applies when there's no timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = (&ShellExecutor{Command: []string{"/bin/sh", "-c", "sleep 30"}}).Execute(ctx)
+	assert.ErrorContains(t, err, "Command timed out")
+}
+
+func TestShellExecutor_Execute_MissingCommand(t *testing.T) {
+	_, err := (&ShellExecutor{Command: []string{"/nonexistent/command"}}).Execute(context.Background())
+	assert.ErrorContains(t, err, "Failed to run /nonexistent/command")
+}
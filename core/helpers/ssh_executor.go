@@ -0,0 +1,122 @@
+package helpers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+type (
+	SshExecutor struct {
+		// Addr is the host and the port of the server
+		Addr            string
+		User            string
+		Auth            []ssh.AuthMethod
+		HostKeyCallback ssh.HostKeyCallback
+
+		// Command is run by the user's shell on the server
+		Command string
+		Stdin   string
+		// MaxOutputBytes caps the stdout and the stderr kept, 0 keeps all
+		MaxOutputBytes int
+	}
+)
+
+// dial connects to the server, the handshake is bound by the context
+func (sshExecutor *SshExecutor) dial(ctx context.Context) (client *ssh.Client, err error) {
+	var (
+		conn     net.Conn
+		sshConn  ssh.Conn
+		channels <-chan ssh.NewChannel
+		requests <-chan *ssh.Request
+	)
+	dialer := &net.Dialer{}
+	if conn, err = dialer.DialContext(ctx, "tcp", sshExecutor.Addr); err != nil {
+		err = fmt.Errorf("Failed to connect to %s: %w", sshExecutor.Addr, err)
+		return
+	}
+	if deadline, hasDeadline := ctx.Deadline(); hasDeadline {
+		conn.SetDeadline(deadline)
+	}
+	if sshConn, channels, requests, err = ssh.NewClientConn(conn, sshExecutor.Addr, &ssh.ClientConfig{
+		User:            sshExecutor.User,
+		Auth:            sshExecutor.Auth,
+		HostKeyCallback: sshExecutor.HostKeyCallback,
+	}); err != nil {
+		conn.Close()
+		err = fmt.Errorf("Failed to connect to %s: %w", sshExecutor.Addr, err)
+		return
+	}
+	// The deadline only applies to the handshake, the session is stopped
+	// once the context is done
+	conn.SetDeadline(time.Time{})
+	client = ssh.NewClient(sshConn, channels, requests)
+	return
+}
+
+// Execute runs the command on the server until it exits. Exiting with a
+// non-zero code is an error, the result still has the command's output.
+func (sshExecutor *SshExecutor) Execute(ctx context.Context) (result *ShellResult, err error) {
+	var (
+		client  *ssh.Client
+		session *ssh.Session
+	)
+	if client, err = sshExecutor.dial(ctx); err != nil {
+		return
+	}
+	defer client.Close()
+	if session, err = client.NewSession(); err != nil {
+		err = fmt.Errorf("Failed to open a session: %w", err)
+		return
+	}
+	defer session.Close()
+
+	stdoutBuf := &cappedBuffer{max: sshExecutor.MaxOutputBytes}
+	stderrBuf := &cappedBuffer{max: sshExecutor.MaxOutputBytes}
+	session.Stdout, session.Stderr = stdoutBuf, stderrBuf
+	session.Stdin = strings.NewReader(sshExecutor.Stdin)
+	if err = session.Start(sshExecutor.Command); err != nil {
+		err = fmt.Errorf("Failed to run the command: %w", err)
+		return
+	}
+
+	doneCh := make(chan error, 1)
+	go func() {
+		doneCh <- session.Wait()
+	}()
+	startTime := time.Now()
+	var waitErr error
+	select {
+	case waitErr = <-doneCh:
+	case <-ctx.Done():
+		// Servers may ignore signals, closing the connection ends the
+		// session either way
+		session.Signal(ssh.SIGKILL)
+		client.Close()
+		<-doneCh
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			err = fmt.Errorf("Command timed out after %s", time.Since(startTime).Round(time.Second))
+			return
+		}
+		err = ctx.Err()
+		return
+	}
+
+	result = &ShellResult{Stdout: stdoutBuf.String(), Stderr: stderrBuf.String()}
+	var exitErr *ssh.ExitError
+	if errors.As(waitErr, &exitErr) {
+		result.ExitCode = exitErr.ExitStatus()
+		err = fmt.Errorf("Command exited with code %d: %s", result.ExitCode, lastLine(result.Stderr))
+		return
+	}
+	if waitErr != nil {
+		err = fmt.Errorf("Failed to run the command: %w", waitErr)
+		return
+	}
+	return
+}
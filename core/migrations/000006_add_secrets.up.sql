@@ -0,0 +1,14 @@
+-- Create secrets table
+CREATE TABLE secrets (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER REFERENCES users(id),
+    name VARCHAR(255) NOT NULL,
+    encrypted_value TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX idx_secrets_user_id ON secrets(user_id);
+CREATE INDEX idx_secrets_name ON secrets(name);
+CREATE INDEX idx_secrets_deleted_at ON secrets(deleted_at);
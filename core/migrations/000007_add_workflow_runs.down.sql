@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_job_executions_workflow_run_id;
+ALTER TABLE job_executions DROP COLUMN IF EXISTS workflow_run_id;
+
+DROP TABLE IF EXISTS workflow_runs;
@@ -0,0 +1,24 @@
+-- Create workflow_runs table
+CREATE TABLE workflow_runs (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER REFERENCES users(id),
+    action_id INTEGER REFERENCES actions(id),
+    trigger_id INTEGER,
+    status VARCHAR(50),
+    error TEXT,
+    started_at TIMESTAMP,
+    finished_at TIMESTAMP,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX idx_workflow_runs_user_id ON workflow_runs(user_id);
+CREATE INDEX idx_workflow_runs_action_id ON workflow_runs(action_id);
+CREATE INDEX idx_workflow_runs_trigger_id ON workflow_runs(trigger_id);
+CREATE INDEX idx_workflow_runs_status ON workflow_runs(status);
+CREATE INDEX idx_workflow_runs_deleted_at ON workflow_runs(deleted_at);
+
+-- Attach job executions to their run
+ALTER TABLE job_executions ADD COLUMN workflow_run_id INTEGER;
+CREATE INDEX idx_job_executions_workflow_run_id ON job_executions(workflow_run_id);
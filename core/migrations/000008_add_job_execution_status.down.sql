@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_job_executions_status;
+
+ALTER TABLE job_executions DROP COLUMN IF EXISTS output_size;
+ALTER TABLE job_executions DROP COLUMN IF EXISTS input;
+ALTER TABLE job_executions DROP COLUMN IF EXISTS attempt;
+ALTER TABLE job_executions DROP COLUMN IF EXISTS error;
+ALTER TABLE job_executions DROP COLUMN IF EXISTS status;
@@ -0,0 +1,9 @@
+-- Record the outcome of every job execution. Executions recorded
+-- before this migration only ever succeeded.
+ALTER TABLE job_executions ADD COLUMN status VARCHAR(50) DEFAULT 'succeeded';
+ALTER TABLE job_executions ADD COLUMN error TEXT;
+ALTER TABLE job_executions ADD COLUMN attempt INTEGER DEFAULT 1;
+ALTER TABLE job_executions ADD COLUMN input TEXT;
+ALTER TABLE job_executions ADD COLUMN output_size INTEGER DEFAULT 0;
+
+CREATE INDEX idx_job_executions_status ON job_executions(status);
@@ -0,0 +1,4 @@
+ALTER TABLE plans DROP COLUMN IF EXISTS docker_max_disk_mb;
+ALTER TABLE plans DROP COLUMN IF EXISTS docker_max_pids;
+ALTER TABLE plans DROP COLUMN IF EXISTS docker_max_memory_mb;
+ALTER TABLE plans DROP COLUMN IF EXISTS docker_max_cpus;
@@ -0,0 +1,9 @@
+-- Limit the resources of the Docker jobs of each plan's users.
+-- 0 is the limit set by the admin.
+ALTER TABLE plans ADD COLUMN docker_max_cpus DECIMAL(6,2) DEFAULT 0;
+ALTER TABLE plans ADD COLUMN docker_max_memory_mb BIGINT DEFAULT 0;
+ALTER TABLE plans ADD COLUMN docker_max_pids BIGINT DEFAULT 0;
+ALTER TABLE plans ADD COLUMN docker_max_disk_mb BIGINT DEFAULT 0;
+
+UPDATE plans SET docker_max_cpus = 0.5, docker_max_memory_mb = 256, docker_max_pids = 128 WHERE type = 'starter';
+UPDATE plans SET docker_max_cpus = 1, docker_max_memory_mb = 1024, docker_max_pids = 256 WHERE type = 'pro';
@@ -0,0 +1,16 @@
+-- Create registry_credentials table
+CREATE TABLE registry_credentials (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER REFERENCES users(id),
+    name VARCHAR(255) NOT NULL,
+    registry VARCHAR(255) NOT NULL,
+    username VARCHAR(255) NOT NULL,
+    encrypted_password TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX idx_registry_credentials_user_id ON registry_credentials(user_id);
+CREATE INDEX idx_registry_credentials_name ON registry_credentials(name);
+CREATE INDEX idx_registry_credentials_deleted_at ON registry_credentials(deleted_at);
@@ -0,0 +1,2 @@
+UPDATE job_templates SET code = '{"webhook_url": "https://hooks.slack.com/...", "message": "Hello from Cronny!"}'
+WHERE name = 'Slack Job' AND exec_link = 'slack';
@@ -0,0 +1,3 @@
+-- The Slack job reads its webhook URL from the user's secrets
+UPDATE job_templates SET code = '{"webhook_url_secret": "SLACK_WEBHOOK_URL", "message": "Hello from Cronny!"}'
+WHERE name = 'Slack Job' AND exec_link = 'slack';
@@ -72,10 +72,33 @@ func (action *Action) BeforeDelete(tx *gorm.DB) (err error) {
 }
 
 func (action *Action) Execute(db *gorm.DB) (err error) {
+	return action.ExecuteWithContext(db, NewExecutionContext(nil))
+}
+
+// ExecuteWithContext executes the jobs of the action starting from the
+// root job. The execution context is passed on from one job to the next.
+func (action *Action) ExecuteWithContext(db *gorm.DB, execCtx *ExecutionContext) (err error) {
+	var (
+		run *WorkflowRun
+	)
+	if run, err = NewWorkflowRun(db, action, execCtx.Trigger); err != nil {
+		return fmt.Errorf("failed to create workflow run for action %s (ID: %d): %w", action.Name, action.ID, err)
+	}
+	execCtx.WorkflowRun = run
+
+	err = action.executeRootJob(db, execCtx)
+	if finishErr := run.Finish(db, execCtx, err); finishErr != nil && err == nil {
+		err = fmt.Errorf("failed to finish workflow run %d: %w", run.ID, finishErr)
+	}
+	return
+}
+
+func (action *Action) executeRootJob(db *gorm.DB, execCtx *ExecutionContext) (err error) {
 	job := &Job{}
 	if ex := db.Where("is_root_job = ? AND action_id = ?", true, action.ID).First(job); ex.Error != nil {
 		return fmt.Errorf("failed to find root job for action %s (ID: %d): %w", action.Name, action.ID, ex.Error)
 	}
+	job.ExecutionContext = execCtx
 	if err = job.Execute(db); err != nil {
 		return fmt.Errorf("failed to execute root job for action %s (ID: %d): %w", action.Name, action.ID, err)
 	}
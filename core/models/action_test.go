@@ -22,6 +22,8 @@ func setupActionTestDB(t *testing.T) *gorm.DB {
 		&JobTemplate{},
 		&Schedule{},
 		&User{},
+		&JobExecution{},
+		&WorkflowRun{},
 	)
 	assert.NoError(t, err, "Failed to auto-migrate models")
 
@@ -78,22 +80,23 @@ func TestAction_Execute_FindsAndExecutesRootJob(t *testing.T) {
 	template.SetUserID(1)
 	db.Create(template)
 
-	// Create a root job with condition that will error (empty rules, no next job)
-	// This will fail at Next() but we're just testing that Execute finds the root job
+	// Create a terminal root job (empty rules, no next job)
 	rootJob := createTestJobForAction(db, action.ID, template.ID, true)
 	rootJob.Condition = `{"rules": []}`
 	db.Save(rootJob)
 
 	// Also create a non-root job to verify it's not executed
-	createTestJobForAction(db, action.ID, template.ID, false)
+	nonRootJob := createTestJobForAction(db, action.ID, template.ID, false)
 
-	// NOTE: This will fail due to CreateJobExecution bug or Next() failure
-	// but we're testing that it FINDS the root job
 	err := action.Execute(db)
-
-	// We expect an error (either from CreateJobExecution bug or Next() logic)
-	// The key is that it found the root job and attempted to execute it
-	assert.Error(t, err, "Execute will error due to CreateJobExecution bug or Next() logic")
+	assert.NoError(t, err, "Execute should succeed for a terminal root job")
+
+	var run WorkflowRun
+	assert.NoError(t, db.Preload("JobExecutions").Where("action_id = ?", action.ID).First(&run).Error)
+	assert.Equal(t, SucceededWorkflowRunStatus, run.Status, "Run should succeed")
+	assert.Len(t, run.JobExecutions, 1, "Only the root job should be executed")
+	assert.Equal(t, rootJob.ID, run.JobExecutions[0].JobID)
+	assert.NotEqual(t, nonRootJob.ID, run.JobExecutions[0].JobID)
 }
 
 func TestAction_Execute_NoRootJob(t *testing.T) {
@@ -109,6 +112,11 @@ func TestAction_Execute_NoRootJob(t *testing.T) {
 
 	err := action.Execute(db)
 	assert.Error(t, err, "Execute should error when no root job found")
+
+	var run WorkflowRun
+	assert.NoError(t, db.Where("action_id = ?", action.ID).First(&run).Error)
+	assert.Equal(t, FailedWorkflowRunStatus, run.Status, "Run should be marked as failed")
+	assert.Contains(t, run.Error, "failed to find root job")
 }
 
 func TestAction_Execute_MultipleJobsOnlyRootExecutes(t *testing.T) {
@@ -129,8 +137,7 @@ func TestAction_Execute_MultipleJobsOnlyRootExecutes(t *testing.T) {
 	// Execute should attempt to execute only the root job
 	_ = action.Execute(db)
 
-	// Verify by checking if any attempt was made to execute
-	// (we can't verify success due to CreateJobExecution bug, but we verify it found the right job)
+	// Verify it found the right job
 	var foundJob Job
 	err := db.Where("is_root_job = ? AND action_id = ?", true, action.ID).First(&foundJob).Error
 	assert.NoError(t, err, "Should find the root job")
@@ -1,24 +1,64 @@
 package models
 
 import (
+	"encoding/json"
 	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/google/cel-go/cel"
 
 	"github.com/cronny/core/actions"
+	"github.com/cronny/core/helpers"
 )
 
 const (
-	EqualityComparison = ComparisonT("equality")
-	GreaterThan        = ComparisonT("greater_than")
-	LesserThan         = ComparisonT("lesser_than")
+	EqualityComparison   = ComparisonT("equality")
+	GreaterThan          = ComparisonT("greater_than")
+	GreaterThanOrEqual   = ComparisonT("greater_than_or_equal")
+	LesserThan           = ComparisonT("lesser_than")
+	LesserThanOrEqual    = ComparisonT("lesser_than_or_equal")
+	InComparison         = ComparisonT("in")
+	NotInComparison      = ComparisonT("not_in")
+	ContainsComparison   = ComparisonT("contains")
+	StartsWithComparison = ComparisonT("starts_with")
+	RegexComparison      = ComparisonT("regex")
+	ExistsComparison     = ComparisonT("exists")
+	NotExistsComparison  = ComparisonT("not_exists")
+
+	// Condition Versions
+	// Version 1 documents AND all the filters of a rule. Version 2 documents
+	// can additionally use nested filter groups on each rule.
+	ConditionVersionV1 = uint32(1)
+	ConditionVersionV2 = uint32(2)
+
+	// Filter Group Operators
+	AllGroupOperator  = GroupOperatorT("all")
+	AnyGroupOperator  = GroupOperatorT("any")
+	NoneGroupOperator = GroupOperatorT("none")
+
+	MaxFilterGroupDepth = 8
+)
+
+var (
+	// conditionExpressions caches the compiled expressions of the rules by
+	// their source
+	conditionExpressions sync.Map
 )
 
 type (
-	ComparisonT string
+	ComparisonT    string
+	GroupOperatorT string
 
 	Condition struct {
 		Version uint32           `json:"version"`
 		input   actions.Input    `json:"-"`
 		Rules   []*ConditionRule `json:"condition_rules"`
+
+		// execCtx provides the variables for expression rules
+		execCtx *ExecutionContext `json:"-"`
 	}
 
 	ConditionRule struct {
@@ -26,20 +66,43 @@ type (
 		// ie. no conditions will be checked before proceeding
 		// to the next job
 		Filters []*Filter `json:"filters"`
-		JobID   uint      `json:"job_id"`
+		// Group is only used by version 2 conditions and is checked
+		// instead of Filters when set
+		Group *FilterGroup `json:"group"`
+		// Expression is a CEL expression which should evaluate to a
+		// boolean. It is checked instead of Filters and Group when set.
+		Expression string `json:"expression"`
+		JobID      uint   `json:"job_id"`
+	}
+
+	// FilterGroup combines its filters and nested groups with a boolean
+	// operator, ie. all of them, any of them or none of them should match
+	FilterGroup struct {
+		Operator GroupOperatorT `json:"operator"`
+		Filters  []*Filter      `json:"filters"`
+		Groups   []*FilterGroup `json:"groups"`
 	}
 	Filter struct {
 		Name           string      `json:"name"`
 		ShouldMatch    bool        `json:"should_match"`
 		ComparisonType ComparisonT `json:"comparison_type"`
 		Value          string      `json:"value"`
+		// Values is used by the in and not_in comparisons
+		Values []string `json:"values"`
 	}
 )
 
 func (condition *Condition) GetNextJobID(input actions.Input) (jobId uint, err error) {
+	var (
+		inputMatches bool
+	)
 	condition.input = input
 	for _, rule := range condition.Rules {
-		if inputMatches := condition.DoesInputMatch(rule.Filters); !inputMatches {
+		if inputMatches, err = condition.DoesRuleMatch(rule); err != nil {
+			err = fmt.Errorf("Condition rule for job %d failed: %w", rule.JobID, err)
+			return
+		}
+		if !inputMatches {
 			continue
 		}
 		jobId = rule.JobID
@@ -49,6 +112,62 @@ func (condition *Condition) GetNextJobID(input actions.Input) (jobId uint, err e
 	return
 }
 
+// WithContext sets the execution context whose variables are
+// available to expression rules
+func (condition *Condition) WithContext(execCtx *ExecutionContext) *Condition {
+	condition.execCtx = execCtx
+	return condition
+}
+
+// DoesRuleMatch checks the rule against the input. Only expression rules
+// can fail, eg. when the expression refers to a missing output key.
+func (condition *Condition) DoesRuleMatch(rule *ConditionRule) (matches bool, err error) {
+	if rule.Expression != "" {
+		matches, err = condition.doesExpressionMatch(rule.Expression)
+		return
+	}
+	if condition.Version >= ConditionVersionV2 && rule.Group != nil {
+		matches = rule.Group.Matches(condition.input)
+		return
+	}
+	matches = condition.DoesInputMatch(rule.Filters)
+	return
+}
+
+// compileConditionExpression compiles the expression of a rule once, the
+// program is then reused by every run of the workflow
+func compileConditionExpression(source string) (expression *Expression, err error) {
+	if cached, isPresent := conditionExpressions.Load(source); isPresent {
+		expression = cached.(*Expression)
+		return
+	}
+	if expression, err = CompileExpression(source, cel.BoolType); err != nil {
+		return
+	}
+	conditionExpressions.Store(source, expression)
+	return
+}
+
+func (condition *Condition) doesExpressionMatch(source string) (matches bool, err error) {
+	var (
+		expression *Expression
+	)
+	if expression, err = compileConditionExpression(source); err != nil {
+		return
+	}
+	execCtx := &ExecutionContext{}
+	if condition.execCtx != nil {
+		execCtx.Trigger = condition.execCtx.Trigger
+		execCtx.Schedule = condition.execCtx.Schedule
+	}
+	// The input of the condition is the output of the previous job
+	execCtx.PrevJobOutput = actions.Output(condition.input)
+	if matches, err = expression.EvaluateBool(execCtx.ExpressionVars()); err != nil {
+		return
+	}
+	return
+}
+
 func (condition *Condition) DoesInputMatch(filters []*Filter) (matches bool) {
 	matches = false
 	for _, filter := range filters {
@@ -60,26 +179,96 @@ func (condition *Condition) DoesInputMatch(filters []*Filter) (matches bool) {
 	return
 }
 
+func (filter *Filter) Validate() (err error) {
+	switch filter.ComparisonType {
+	case EqualityComparison, ContainsComparison, StartsWithComparison,
+		ExistsComparison, NotExistsComparison:
+	case GreaterThan, GreaterThanOrEqual, LesserThan, LesserThanOrEqual:
+		if _, err = strconv.ParseFloat(filter.Value, 64); err != nil {
+			err = fmt.Errorf("Filter %s with type %s requires a numeric value, got %s", filter.Name, filter.ComparisonType, filter.Value)
+			return
+		}
+	case InComparison, NotInComparison:
+		if len(filter.Values) == 0 {
+			err = fmt.Errorf("Filter %s with type %s requires a list of values", filter.Name, filter.ComparisonType)
+			return
+		}
+	case RegexComparison:
+		if _, err = regexp.Compile(filter.Value); err != nil {
+			err = fmt.Errorf("Filter %s has an invalid regex %s: %w", filter.Name, filter.Value, err)
+			return
+		}
+	default:
+		err = fmt.Errorf("No matching comparison type found for filter with type %s", filter.ComparisonType)
+		return
+	}
+	return
+}
+
 func (filter *Filter) Compare(input actions.Input) (err error) {
 	var (
-		inpVal    string
+		inpVal    interface{}
 		isPresent bool
+		matches   bool
 	)
-	if inpVal, isPresent = input[filter.Name].(string); !isPresent {
+	inpVal, isPresent = lookupInput(input, filter.Name)
+
+	switch filter.ComparisonType {
+	case ExistsComparison, NotExistsComparison:
+		matches = isPresent == (filter.ComparisonType == ExistsComparison)
+		if matches != filter.ShouldMatch {
+			err = fmt.Errorf("Filter Key %s %s check failed", filter.Name, filter.ComparisonType)
+			return
+		}
+		return
+	}
+
+	if !isPresent {
 		err = fmt.Errorf("Filter Key %s not present in input", filter.Name)
 		return
 	}
 	switch filter.ComparisonType {
 	case EqualityComparison:
+		matches = valueEquals(inpVal, filter.Value)
 		switch filter.ShouldMatch {
 		case true:
-			if inpVal != filter.Value {
-				err = fmt.Errorf("Filter Value %s doesn't match with input %s", filter.Value, inpVal)
+			if !matches {
+				err = fmt.Errorf("Filter Value %s doesn't match with input %v", filter.Value, inpVal)
 				return
 			}
 		case false:
-			if inpVal == filter.Value {
-				err = fmt.Errorf("Filter Value %s matches with input %s", filter.Value, inpVal)
+			if matches {
+				err = fmt.Errorf("Filter Value %s matches with input %v", filter.Value, inpVal)
+				return
+			}
+		}
+		return
+	case GreaterThan, GreaterThanOrEqual, LesserThan, LesserThanOrEqual:
+		if matches, err = filter.compareNumbers(inpVal); err != nil {
+			return
+		}
+	case InComparison, NotInComparison:
+		for _, value := range filter.Values {
+			if valueEquals(inpVal, value) {
+				matches = true
+				break
+			}
+		}
+		if filter.ComparisonType == NotInComparison {
+			matches = !matches
+		}
+	case ContainsComparison:
+		matches = valueContains(inpVal, filter.Value)
+	case StartsWithComparison:
+		var inpStr string
+		if inpStr, isPresent = scalarToString(inpVal); isPresent {
+			matches = strings.HasPrefix(inpStr, filter.Value)
+		}
+	case RegexComparison:
+		var inpStr string
+		if inpStr, isPresent = scalarToString(inpVal); isPresent {
+			if matches, err = regexp.MatchString(filter.Value, inpStr); err != nil {
+				err = fmt.Errorf("Filter %s has an invalid regex %s: %w", filter.Name, filter.Value, err)
 				return
 			}
 		}
@@ -87,5 +276,258 @@ func (filter *Filter) Compare(input actions.Input) (err error) {
 		err = fmt.Errorf("No matching comparison type found for filter with type %s", filter.ComparisonType)
 		return
 	}
+	if matches != filter.ShouldMatch {
+		err = fmt.Errorf("Filter %s %s %s doesn't hold for input %v (should_match: %v)",
+			filter.Name, filter.ComparisonType, filter.Value, inpVal, filter.ShouldMatch)
+		return
+	}
+	return
+}
+
+func (filter *Filter) compareNumbers(inpVal interface{}) (matches bool, err error) {
+	var (
+		inpNum, filterNum float64
+		isNumeric         bool
+	)
+	if inpNum, isNumeric = toNumber(inpVal); !isNumeric {
+		err = fmt.Errorf("Filter Key %s has a non numeric input %v", filter.Name, inpVal)
+		return
+	}
+	if filterNum, err = strconv.ParseFloat(filter.Value, 64); err != nil {
+		err = fmt.Errorf("Filter %s has a non numeric value %s", filter.Name, filter.Value)
+		return
+	}
+	switch filter.ComparisonType {
+	case GreaterThan:
+		matches = inpNum > filterNum
+	case GreaterThanOrEqual:
+		matches = inpNum >= filterNum
+	case LesserThan:
+		matches = inpNum < filterNum
+	case LesserThanOrEqual:
+		matches = inpNum <= filterNum
+	}
+	return
+}
+
+// lookupInput looks up the filter name as a top level key first and
+// then as a path into the nested input, eg. "data.items[0].id"
+func lookupInput(input actions.Input, name string) (inpVal interface{}, isPresent bool) {
+	if inpVal, isPresent = input[name]; isPresent {
+		return
+	}
+	inpVal, isPresent, _ = helpers.LookupPath(map[string]interface{}(input), name)
+	return
+}
+
+// toNumber converts numbers and numeric strings, which is how the
+// HTTP action returns numbers, to a float64
+func toNumber(val interface{}) (num float64, isNumeric bool) {
+	var err error
+	switch typedVal := val.(type) {
+	case float64:
+		return typedVal, true
+	case float32:
+		return float64(typedVal), true
+	case int:
+		return float64(typedVal), true
+	case int64:
+		return float64(typedVal), true
+	case uint:
+		return float64(typedVal), true
+	case json.Number:
+		if num, err = typedVal.Float64(); err != nil {
+			return
+		}
+		return num, true
+	case string:
+		if num, err = strconv.ParseFloat(strings.TrimSpace(typedVal), 64); err != nil {
+			return
+		}
+		return num, true
+	}
+	return
+}
+
+// scalarToString returns the string form of strings, numbers and booleans
+func scalarToString(val interface{}) (str string, isScalar bool) {
+	switch typedVal := val.(type) {
+	case string:
+		return typedVal, true
+	case bool:
+		return strconv.FormatBool(typedVal), true
+	case json.Number:
+		return typedVal.String(), true
+	}
+	if num, isNumeric := toNumber(val); isNumeric {
+		return strconv.FormatFloat(num, 'f', -1, 64), true
+	}
+	return
+}
+
+// valueEquals compares an input value with a filter value depending
+// on the type of the input value
+func valueEquals(inpVal interface{}, filterVal string) (isEqual bool) {
+	switch typedVal := inpVal.(type) {
+	case nil:
+		return filterVal == "null"
+	case string:
+		return typedVal == filterVal
+	case bool:
+		boolVal, err := strconv.ParseBool(filterVal)
+		return err == nil && boolVal == typedVal
+	}
+	if inpNum, isNumeric := toNumber(inpVal); isNumeric {
+		filterNum, err := strconv.ParseFloat(filterVal, 64)
+		return err == nil && inpNum == filterNum
+	}
+	return
+}
+
+// valueContains checks for a substring in strings and for an element in arrays
+func valueContains(inpVal interface{}, filterVal string) (contains bool) {
+	switch typedVal := inpVal.(type) {
+	case string:
+		return strings.Contains(typedVal, filterVal)
+	case []interface{}:
+		for _, elem := range typedVal {
+			if valueEquals(elem, filterVal) {
+				return true
+			}
+		}
+	}
+	return
+}
+
+func (condition *Condition) Validate() (err error) {
+	switch condition.Version {
+	case 0, ConditionVersionV1, ConditionVersionV2:
+	default:
+		err = fmt.Errorf("Condition version %d not supported", condition.Version)
+		return
+	}
+	for idx, rule := range condition.Rules {
+		if rule.Expression != "" {
+			if len(rule.Filters) > 0 || rule.Group != nil {
+				err = fmt.Errorf("rule %d: expression can't be combined with filters or groups", idx)
+				return
+			}
+			if _, err = CompileExpression(rule.Expression, cel.BoolType); err != nil {
+				err = fmt.Errorf("rule %d: %w", idx, err)
+				return
+			}
+			continue
+		}
+		for _, filter := range rule.Filters {
+			if err = filter.Validate(); err != nil {
+				err = fmt.Errorf("rule %d: %w", idx, err)
+				return
+			}
+		}
+		if rule.Group == nil {
+			continue
+		}
+		if condition.Version < ConditionVersionV2 {
+			err = fmt.Errorf("rule %d: filter groups require condition version %d", idx, ConditionVersionV2)
+			return
+		}
+		// The group is checked instead of the filters, which would be ignored
+		if len(rule.Filters) > 0 {
+			err = fmt.Errorf("rule %d: filters can't be combined with a group, add them to the group instead", idx)
+			return
+		}
+		if err = rule.Group.Validate(1); err != nil {
+			err = fmt.Errorf("rule %d: %w", idx, err)
+			return
+		}
+	}
+	return
+}
+
+// IsWildcard returns true if the rule doesn't check anything
+// before proceeding to the next job
+func (rule *ConditionRule) IsWildcard() (isWildcard bool) {
+	if rule.Expression != "" {
+		return
+	}
+	if rule.Group != nil {
+		isWildcard = rule.Group.isEmpty()
+		return
+	}
+	isWildcard = len(rule.Filters) == 0
+	return
+}
+
+// ==========================================================
+// FilterGroups
+
+func (group *FilterGroup) isEmpty() (isEmpty bool) {
+	isEmpty = len(group.Filters) == 0 && len(group.Groups) == 0
+	return
+}
+
+func (group *FilterGroup) Validate(depth int) (err error) {
+	if depth > MaxFilterGroupDepth {
+		err = fmt.Errorf("filter groups can't be nested more than %d levels deep", MaxFilterGroupDepth)
+		return
+	}
+	switch group.Operator {
+	case AllGroupOperator:
+	case AnyGroupOperator, NoneGroupOperator:
+		if group.isEmpty() {
+			err = fmt.Errorf("filter group with operator %s requires at least one filter or group", group.Operator)
+			return
+		}
+	default:
+		err = fmt.Errorf("No matching operator found for filter group with operator %s", group.Operator)
+		return
+	}
+	for _, filter := range group.Filters {
+		if err = filter.Validate(); err != nil {
+			return
+		}
+	}
+	for _, subGroup := range group.Groups {
+		if err = subGroup.Validate(depth + 1); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (group *FilterGroup) Matches(input actions.Input) (matches bool) {
+	matchCount := 0
+	for _, filter := range group.Filters {
+		if err := filter.Compare(input); err == nil {
+			matchCount += 1
+		}
+	}
+	for _, subGroup := range group.Groups {
+		if subGroup.Matches(input) {
+			matchCount += 1
+		}
+	}
+	switch group.Operator {
+	case AllGroupOperator:
+		matches = matchCount == len(group.Filters)+len(group.Groups)
+	case AnyGroupOperator:
+		matches = matchCount > 0
+	case NoneGroupOperator:
+		matches = matchCount == 0
+	}
+	return
+}
+
+// ParseCondition parses the Condition stored on a Job. An empty condition
+// string is treated as a Condition without any rules, ie. a terminal job
+func ParseCondition(conditionStr string) (condition *Condition, err error) {
+	condition = &Condition{}
+	if strings.TrimSpace(conditionStr) == "" {
+		return
+	}
+	if err = json.Unmarshal([]byte(conditionStr), condition); err != nil {
+		err = fmt.Errorf("failed to parse condition: %w", err)
+		return
+	}
 	return
 }
@@ -1,6 +1,8 @@
 package models
 
 import (
+	"encoding/json"
+	"strings"
 	"testing"
 
 	"github.com/cronny/core/actions"
@@ -193,3 +195,319 @@ func TestFilter_Compare(t *testing.T) {
 		})
 	}
 }
+
+func TestFilter_Compare_Operators(t *testing.T) {
+	input := actions.Input{
+		"status":  "200",
+		"count":   float64(42),
+		"ok":      true,
+		"message": "deployment finished",
+		"tags":    []interface{}{"prod", "eu"},
+		"empty":   nil,
+	}
+
+	testCases := []struct {
+		name        string
+		filter      *Filter
+		shouldMatch bool
+	}{
+		{name: "Numeric string equality", filter: &Filter{Name: "status", Value: "200", ComparisonType: EqualityComparison}, shouldMatch: true},
+		{name: "Number equality", filter: &Filter{Name: "count", Value: "42.0", ComparisonType: EqualityComparison}, shouldMatch: true},
+		{name: "Boolean equality", filter: &Filter{Name: "ok", Value: "true", ComparisonType: EqualityComparison}, shouldMatch: true},
+		{name: "Boolean inequality", filter: &Filter{Name: "ok", Value: "false", ComparisonType: EqualityComparison}, shouldMatch: false},
+		{name: "Null equality", filter: &Filter{Name: "empty", Value: "null", ComparisonType: EqualityComparison}, shouldMatch: true},
+		{name: "Greater than on numeric string", filter: &Filter{Name: "status", Value: "199", ComparisonType: GreaterThan}, shouldMatch: true},
+		{name: "Greater than on number", filter: &Filter{Name: "count", Value: "42", ComparisonType: GreaterThan}, shouldMatch: false},
+		{name: "Greater than or equal", filter: &Filter{Name: "count", Value: "42", ComparisonType: GreaterThanOrEqual}, shouldMatch: true},
+		{name: "Lesser than", filter: &Filter{Name: "status", Value: "300", ComparisonType: LesserThan}, shouldMatch: true},
+		{name: "Lesser than or equal", filter: &Filter{Name: "count", Value: "41", ComparisonType: LesserThanOrEqual}, shouldMatch: false},
+		{name: "In", filter: &Filter{Name: "status", Values: []string{"200", "201"}, ComparisonType: InComparison}, shouldMatch: true},
+		{name: "In with number", filter: &Filter{Name: "count", Values: []string{"1", "42"}, ComparisonType: InComparison}, shouldMatch: true},
+		{name: "Not in", filter: &Filter{Name: "status", Values: []string{"500", "502"}, ComparisonType: NotInComparison}, shouldMatch: true},
+		{name: "Contains substring", filter: &Filter{Name: "message", Value: "finished", ComparisonType: ContainsComparison}, shouldMatch: true},
+		{name: "Contains array element", filter: &Filter{Name: "tags", Value: "eu", ComparisonType: ContainsComparison}, shouldMatch: true},
+		{name: "Contains missing array element", filter: &Filter{Name: "tags", Value: "us", ComparisonType: ContainsComparison}, shouldMatch: false},
+		{name: "Starts with", filter: &Filter{Name: "message", Value: "deploy", ComparisonType: StartsWithComparison}, shouldMatch: true},
+		{name: "Starts with on number", filter: &Filter{Name: "count", Value: "4", ComparisonType: StartsWithComparison}, shouldMatch: true},
+		{name: "Regex", filter: &Filter{Name: "status", Value: `^2\d\d$`, ComparisonType: RegexComparison}, shouldMatch: true},
+		{name: "Regex not matching", filter: &Filter{Name: "message", Value: `^failed`, ComparisonType: RegexComparison}, shouldMatch: false},
+		{name: "Exists", filter: &Filter{Name: "ok", ComparisonType: ExistsComparison}, shouldMatch: true},
+		{name: "Exists on missing key", filter: &Filter{Name: "missing", ComparisonType: ExistsComparison}, shouldMatch: false},
+		{name: "Not exists", filter: &Filter{Name: "missing", ComparisonType: NotExistsComparison}, shouldMatch: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.filter.ShouldMatch = true
+			err := tc.filter.Compare(input)
+			if tc.shouldMatch && err != nil {
+				t.Errorf("Expected filter to match, got error: %v", err)
+			} else if !tc.shouldMatch && err == nil {
+				t.Errorf("Expected filter not to match")
+			}
+
+			// ShouldMatch=false negates the comparison
+			tc.filter.ShouldMatch = false
+			err = tc.filter.Compare(input)
+			if tc.shouldMatch && err == nil {
+				t.Errorf("Expected negated filter not to match")
+			} else if !tc.shouldMatch && err != nil {
+				t.Errorf("Expected negated filter to match, got error: %v", err)
+			}
+		})
+	}
+}
+
+func TestFilter_Compare_NonNumericInput(t *testing.T) {
+	filter := &Filter{Name: "message", Value: "10", ComparisonType: GreaterThan, ShouldMatch: true}
+	err := filter.Compare(actions.Input{"message": "not a number"})
+	if err == nil || !strings.Contains(err.Error(), "non numeric input") {
+		t.Errorf("Expected non numeric input error, got %v", err)
+	}
+}
+
+func TestFilter_Compare_NestedPaths(t *testing.T) {
+	input := actions.Input{
+		"status":     "200",
+		"data.count": float64(1),
+		"data": map[string]interface{}{
+			"count": float64(3),
+			"items": []interface{}{
+				map[string]interface{}{"id": float64(7), "name": "first"},
+			},
+		},
+	}
+	testCases := []struct {
+		name        string
+		filter      *Filter
+		expectedErr bool
+	}{
+		{name: "Array element", filter: &Filter{Name: "data.items[0].id", Value: "7", ComparisonType: EqualityComparison, ShouldMatch: true}},
+		{name: "JSONPath prefix", filter: &Filter{Name: "$.data.items[0].name", Value: "fir", ComparisonType: StartsWithComparison, ShouldMatch: true}},
+		{name: "Top level key takes precedence", filter: &Filter{Name: "data.count", Value: "1", ComparisonType: EqualityComparison, ShouldMatch: true}},
+		{name: "Missing path", filter: &Filter{Name: "data.items[1].id", ComparisonType: NotExistsComparison, ShouldMatch: true}},
+		{name: "Missing path doesn't match", filter: &Filter{Name: "data.items[1].id", Value: "7", ComparisonType: EqualityComparison, ShouldMatch: true}, expectedErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.filter.Compare(input)
+			if tc.expectedErr && err == nil {
+				t.Errorf("Expected error, but got none")
+			} else if !tc.expectedErr && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestFilter_Validate(t *testing.T) {
+	testCases := []struct {
+		name      string
+		filter    *Filter
+		shouldErr bool
+	}{
+		{name: "Equality", filter: &Filter{Name: "key", Value: "value", ComparisonType: EqualityComparison}},
+		{name: "Numeric comparison", filter: &Filter{Name: "key", Value: "10.5", ComparisonType: LesserThan}},
+		{name: "Numeric comparison with non numeric value", filter: &Filter{Name: "key", Value: "ten", ComparisonType: GreaterThan}, shouldErr: true},
+		{name: "In with values", filter: &Filter{Name: "key", Values: []string{"a"}, ComparisonType: InComparison}},
+		{name: "Not in without values", filter: &Filter{Name: "key", ComparisonType: NotInComparison}, shouldErr: true},
+		{name: "Valid regex", filter: &Filter{Name: "key", Value: `^\d+$`, ComparisonType: RegexComparison}},
+		{name: "Invalid regex", filter: &Filter{Name: "key", Value: `^(\d+$`, ComparisonType: RegexComparison}, shouldErr: true},
+		{name: "Unknown comparison type", filter: &Filter{Name: "key", ComparisonType: ComparisonT("approximately")}, shouldErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.filter.Validate()
+			if tc.shouldErr && err == nil {
+				t.Errorf("Expected error, but got none")
+			} else if !tc.shouldErr && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestCondition_GetNextJobID_FilterGroups(t *testing.T) {
+	// status is 500 OR (status is 200 AND ok is false)
+	condition := &Condition{
+		Version: ConditionVersionV2,
+		Rules: []*ConditionRule{
+			{
+				Group: &FilterGroup{
+					Operator: AnyGroupOperator,
+					Filters: []*Filter{
+						{Name: "status", Value: "500", ComparisonType: EqualityComparison, ShouldMatch: true},
+					},
+					Groups: []*FilterGroup{
+						{
+							Operator: AllGroupOperator,
+							Filters: []*Filter{
+								{Name: "status", Value: "200", ComparisonType: EqualityComparison, ShouldMatch: true},
+								{Name: "ok", Value: "false", ComparisonType: EqualityComparison, ShouldMatch: true},
+							},
+						},
+					},
+				},
+				JobID: 1,
+			},
+			{
+				Group: &FilterGroup{
+					Operator: NoneGroupOperator,
+					Filters: []*Filter{
+						{Name: "status", Value: "500", ComparisonType: GreaterThanOrEqual, ShouldMatch: true},
+					},
+				},
+				JobID: 2,
+			},
+		},
+	}
+
+	testCases := []struct {
+		name        string
+		input       actions.Input
+		expectedJob uint
+		shouldErr   bool
+	}{
+		{name: "First branch of any", input: actions.Input{"status": "500", "ok": true}, expectedJob: 1},
+		{name: "Nested all group", input: actions.Input{"status": "200", "ok": false}, expectedJob: 1},
+		{name: "Falls through to none group", input: actions.Input{"status": "200", "ok": true}, expectedJob: 2},
+		{name: "No rule matches", input: actions.Input{"status": "503", "ok": true}, shouldErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			jobID, err := condition.GetNextJobID(tc.input)
+			if tc.shouldErr && err == nil {
+				t.Errorf("Expected error, but got none")
+			} else if !tc.shouldErr && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			if !tc.shouldErr && jobID != tc.expectedJob {
+				t.Errorf("Expected job ID %d, but got %d", tc.expectedJob, jobID)
+			}
+		})
+	}
+}
+
+func TestCondition_GetNextJobID_V1IgnoresGroups(t *testing.T) {
+	condition := &Condition{}
+	err := json.Unmarshal([]byte(`{
+		"condition_rules": [
+			{"filters": [{"name": "status", "value": "200", "comparison_type": "equality", "should_match": true}], "job_id": 1}
+		]
+	}`), condition)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	jobID, err := condition.GetNextJobID(actions.Input{"status": "200"})
+	if err != nil || jobID != 1 {
+		t.Errorf("Expected v1 condition to route to job 1, got %d (%v)", jobID, err)
+	}
+}
+
+func TestCondition_Validate_FilterGroups(t *testing.T) {
+	validFilter := &Filter{Name: "status", Value: "200", ComparisonType: EqualityComparison}
+
+	deepGroup := &FilterGroup{Operator: AllGroupOperator}
+	for idx := 0; idx < MaxFilterGroupDepth; idx++ {
+		deepGroup = &FilterGroup{Operator: AllGroupOperator, Groups: []*FilterGroup{deepGroup}}
+	}
+
+	testCases := []struct {
+		name      string
+		condition *Condition
+		shouldErr bool
+	}{
+		{
+			name: "Valid v2 condition",
+			condition: &Condition{Version: ConditionVersionV2, Rules: []*ConditionRule{
+				{Group: &FilterGroup{Operator: AnyGroupOperator, Filters: []*Filter{validFilter}}},
+			}},
+		},
+		{
+			name: "Group in a v1 condition",
+			condition: &Condition{Version: ConditionVersionV1, Rules: []*ConditionRule{
+				{Group: &FilterGroup{Operator: AnyGroupOperator, Filters: []*Filter{validFilter}}},
+			}},
+			shouldErr: true,
+		},
+		{
+			name:      "Unknown version",
+			condition: &Condition{Version: 3},
+			shouldErr: true,
+		},
+		{
+			name: "Unknown operator",
+			condition: &Condition{Version: ConditionVersionV2, Rules: []*ConditionRule{
+				{Group: &FilterGroup{Operator: GroupOperatorT("xor"), Filters: []*Filter{validFilter}}},
+			}},
+			shouldErr: true,
+		},
+		{
+			name: "Empty any group",
+			condition: &Condition{Version: ConditionVersionV2, Rules: []*ConditionRule{
+				{Group: &FilterGroup{Operator: AnyGroupOperator}},
+			}},
+			shouldErr: true,
+		},
+		{
+			name: "Invalid nested filter",
+			condition: &Condition{Version: ConditionVersionV2, Rules: []*ConditionRule{
+				{Group: &FilterGroup{Operator: AllGroupOperator, Groups: []*FilterGroup{
+					{Operator: NoneGroupOperator, Filters: []*Filter{{Name: "status", ComparisonType: GreaterThan, Value: "ok"}}},
+				}}},
+			}},
+			shouldErr: true,
+		},
+		{
+			name: "Filters along with a group",
+			condition: &Condition{Version: ConditionVersionV2, Rules: []*ConditionRule{
+				{Filters: []*Filter{validFilter}, Group: &FilterGroup{Operator: AllGroupOperator}},
+			}},
+			shouldErr: true,
+		},
+		{
+			name: "Groups nested too deep",
+			condition: &Condition{Version: ConditionVersionV2, Rules: []*ConditionRule{
+				{Group: deepGroup},
+			}},
+			shouldErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.condition.Validate()
+			if tc.shouldErr && err == nil {
+				t.Errorf("Expected error, but got none")
+			} else if !tc.shouldErr && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestConditionRule_IsWildcard(t *testing.T) {
+	validFilter := &Filter{Name: "status", Value: "200", ComparisonType: EqualityComparison}
+
+	testCases := []struct {
+		name       string
+		rule       *ConditionRule
+		isWildcard bool
+	}{
+		{name: "No filters", rule: &ConditionRule{}, isWildcard: true},
+		{name: "Filters", rule: &ConditionRule{Filters: []*Filter{validFilter}}},
+		{name: "Empty group", rule: &ConditionRule{Group: &FilterGroup{Operator: AllGroupOperator}}, isWildcard: true},
+		{name: "Group with filters", rule: &ConditionRule{Group: &FilterGroup{Operator: AnyGroupOperator, Filters: []*Filter{validFilter}}}},
+		{name: "Expression", rule: &ConditionRule{Expression: `output.ok == true`}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if isWildcard := tc.rule.IsWildcard(); isWildcard != tc.isWildcard {
+				t.Errorf("Expected IsWildcard to be %v, got %v", tc.isWildcard, isWildcard)
+			}
+		})
+	}
+}
@@ -123,6 +123,9 @@ func SetupModels(db *gorm.DB) (err error) {
 		&JobExecution{},
 		&Plan{},
 		&Feature{},
+		&Secret{},
+		&RegistryCredential{},
+		&WorkflowRun{},
 	}
 
 	for _, model := range models {
@@ -131,6 +134,10 @@ func SetupModels(db *gorm.DB) (err error) {
 		}
 	}
 
+	if err = MigrateRegistryCredentials(db); err != nil {
+		return fmt.Errorf("failed to migrate registry credentials: %w", err)
+	}
+
 	log.Println("All models migrated successfully")
 	return nil
 }
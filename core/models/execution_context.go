@@ -0,0 +1,193 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"gorm.io/gorm"
+
+	"github.com/cronny/core/actions"
+)
+
+const (
+	// RedactedSecretValue replaces secret values in recorded job inputs and errors
+	RedactedSecretValue = "[REDACTED]"
+	// MinRedactedSubstringLength is the length from which secret values are
+	// redacted inside strings. Shorter values, eg. "1" or "yes", would mangle
+	// unrelated text and are only redacted when they're the whole string.
+	MinRedactedSubstringLength = 6
+)
+
+type (
+	// ExecutionContext holds the state shared by the jobs of an Action while
+	// they execute one after the other for a single Trigger.
+	ExecutionContext struct {
+		Trigger  *Trigger
+		Schedule *Schedule
+		// WorkflowRun is the run the jobs' executions are attached to
+		WorkflowRun *WorkflowRun
+
+		// PrevJobOutput is the output of the job which led to the
+		// currently executing job
+		PrevJobOutput actions.Output
+		// JobOutputs holds the outputs of the jobs executed so far,
+		// keyed by the job name
+		JobOutputs map[string]actions.Output
+
+		// Ctx cancels the jobs which haven't finished executing yet
+		Ctx context.Context
+
+		// secretValues are the values of the secrets resolved while
+		// building the jobs' inputs, or obtained by the actions
+		secretValues []string
+		secretsMu    sync.Mutex
+	}
+)
+
+func NewExecutionContext(trigger *Trigger) (execCtx *ExecutionContext) {
+	execCtx = &ExecutionContext{
+		Trigger:       trigger,
+		PrevJobOutput: make(actions.Output),
+		JobOutputs:    make(map[string]actions.Output),
+	}
+	if trigger != nil {
+		execCtx.Schedule = trigger.Schedule
+	}
+	return
+}
+
+// AddJobOutput records the output of a job executed in the context
+func (execCtx *ExecutionContext) AddJobOutput(jobName string, output JobOutputT) (err error) {
+	jobOutput := make(actions.Output)
+	if err = json.Unmarshal([]byte(output), &jobOutput); err != nil {
+		err = fmt.Errorf("failed to unmarshal output of job %s: %w", jobName, err)
+		return
+	}
+	execCtx.JobOutputs[jobName] = jobOutput
+	return
+}
+
+// Context returns the context the jobs are executed with
+func (execCtx *ExecutionContext) Context() context.Context {
+	if execCtx.Ctx == nil {
+		return context.Background()
+	}
+	return execCtx.Ctx
+}
+
+// AddSecretValue records a resolved secret so that it's redacted
+// from the inputs and errors recorded for the jobs
+func (execCtx *ExecutionContext) AddSecretValue(value string) {
+	if value == "" {
+		return
+	}
+	// Actions add the secrets they obtain while the job's execution may be
+	// recorded, eg. after it timed out
+	execCtx.secretsMu.Lock()
+	defer execCtx.secretsMu.Unlock()
+	execCtx.secretValues = append(execCtx.secretValues, value)
+}
+
+// Redact replaces the secret values resolved so far in the string
+func (execCtx *ExecutionContext) Redact(str string) string {
+	execCtx.secretsMu.Lock()
+	defer execCtx.secretsMu.Unlock()
+	for _, secretValue := range execCtx.secretValues {
+		if len(secretValue) < MinRedactedSubstringLength {
+			if str == secretValue {
+				return RedactedSecretValue
+			}
+			continue
+		}
+		str = strings.ReplaceAll(str, secretValue, RedactedSecretValue)
+	}
+	return str
+}
+
+// RedactInput returns a copy of the input with the secret
+// values resolved so far replaced in all its strings
+func (execCtx *ExecutionContext) RedactInput(input actions.Input) (redacted actions.Input) {
+	redacted = make(actions.Input)
+	for key, val := range input {
+		redacted[key] = execCtx.redactValue(val)
+	}
+	return
+}
+
+// RedactOutput returns a copy of the output with the secret values
+// obtained so far replaced in all its strings
+func (execCtx *ExecutionContext) RedactOutput(output actions.Output) (redacted actions.Output) {
+	redacted = make(actions.Output)
+	for key, val := range output {
+		redacted[key] = execCtx.redactValue(val)
+	}
+	return
+}
+
+func (execCtx *ExecutionContext) redactValue(val interface{}) interface{} {
+	switch typedVal := val.(type) {
+	case string:
+		return execCtx.Redact(typedVal)
+	case map[string]interface{}:
+		redacted := make(map[string]interface{})
+		for key, elem := range typedVal {
+			redacted[key] = execCtx.redactValue(elem)
+		}
+		return redacted
+	case []interface{}:
+		redacted := make([]interface{}, len(typedVal))
+		for idx, elem := range typedVal {
+			redacted[idx] = execCtx.redactValue(elem)
+		}
+		return redacted
+	}
+	return val
+}
+
+// LatestJobExecution returns the latest execution of the job in the
+// workflow run. Outside of a run, the latest execution of the job is used.
+func (execCtx *ExecutionContext) LatestJobExecution(db *gorm.DB, job *Job) (jobExecution *JobExecution, err error) {
+	if execCtx.WorkflowRun == nil {
+		jobExecution, err = job.GetLatestJobExecution(db)
+		return
+	}
+	if jobExecution, err = execCtx.WorkflowRun.GetLatestJobExecution(db, job); err != nil {
+		err = fmt.Errorf("job %s hasn't been executed in workflow run %d: %w", job.Name, execCtx.WorkflowRun.ID, err)
+		return
+	}
+	return
+}
+
+// ExpressionVars returns the variables available to expressions
+func (execCtx *ExecutionContext) ExpressionVars() (vars map[string]interface{}) {
+	var (
+		triggerVars  = make(map[string]interface{})
+		scheduleVars = make(map[string]interface{})
+		outputVars   = make(map[string]interface{})
+	)
+	for key, val := range execCtx.PrevJobOutput {
+		outputVars[key] = val
+	}
+	if execCtx.Trigger != nil {
+		triggerVars["id"] = int64(execCtx.Trigger.ID)
+		triggerVars["start_at"] = execCtx.Trigger.StartAt
+		triggerVars["status"] = int64(execCtx.Trigger.TriggerStatus)
+	}
+	if execCtx.Schedule != nil {
+		scheduleVars["id"] = int64(execCtx.Schedule.ID)
+		scheduleVars["name"] = execCtx.Schedule.Name
+		scheduleVars["type"] = int64(execCtx.Schedule.ScheduleType)
+		scheduleVars["value"] = execCtx.Schedule.ScheduleValue
+		scheduleVars["unit"] = execCtx.Schedule.ScheduleUnit
+		scheduleVars["ends_at"] = execCtx.Schedule.EndsAt
+	}
+	vars = map[string]interface{}{
+		OutputExpressionVar:   outputVars,
+		TriggerExpressionVar:  triggerVars,
+		ScheduleExpressionVar: scheduleVars,
+	}
+	return
+}
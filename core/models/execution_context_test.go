@@ -0,0 +1,31 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cronny/core/actions"
+)
+
+// ==========================================================
+// TestExecutionContext_Redact
+
+func TestExecutionContext_RedactInput(t *testing.T) {
+	execCtx := NewExecutionContext(nil)
+	execCtx.AddSecretValue("hunter2")
+	execCtx.AddSecretValue("1")
+
+	redacted := execCtx.RedactInput(actions.Input{
+		"auth":    "Bearer hunter2",
+		"retries": "1",
+		"nested":  map[string]interface{}{"list": []interface{}{"1", "v1.10"}},
+	})
+	assert.Equal(t, actions.Input{
+		"auth":    "Bearer [REDACTED]",
+		"retries": "[REDACTED]",
+		// Short secrets are only redacted when they're the whole string
+		"nested": map[string]interface{}{"list": []interface{}{"[REDACTED]", "v1.10"}},
+	}, redacted)
+	assert.Equal(t, "failed with code 1", execCtx.Redact("failed with code 1"))
+}
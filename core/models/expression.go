@@ -0,0 +1,124 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/google/cel-go/cel"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/cronny/core/config"
+)
+
+const (
+	// Expression Variables
+	OutputExpressionVar   = "output"
+	TriggerExpressionVar  = "trigger"
+	ScheduleExpressionVar = "schedule"
+)
+
+var (
+	expressionEnv     *cel.Env
+	expressionEnvErr  error
+	expressionEnvOnce sync.Once
+)
+
+type (
+	// Expression is a CEL expression evaluated against the output of the
+	// previous job and the metadata of the Trigger and Schedule
+	Expression struct {
+		Source string
+
+		program cel.Program
+	}
+)
+
+func getExpressionEnv() (env *cel.Env, err error) {
+	expressionEnvOnce.Do(func() {
+		expressionEnv, expressionEnvErr = cel.NewEnv(
+			cel.Variable(OutputExpressionVar, cel.MapType(cel.StringType, cel.DynType)),
+			cel.Variable(TriggerExpressionVar, cel.MapType(cel.StringType, cel.DynType)),
+			cel.Variable(ScheduleExpressionVar, cel.MapType(cel.StringType, cel.DynType)),
+		)
+	})
+	env, err = expressionEnv, expressionEnvErr
+	return
+}
+
+// CompileExpression parses and type checks the expression. If expectedType
+// is set, the expression should evaluate to it or to a dynamic value.
+func CompileExpression(source string, expectedType *cel.Type) (expression *Expression, err error) {
+	var (
+		env     *cel.Env
+		ast     *cel.Ast
+		issues  *cel.Issues
+		program cel.Program
+	)
+	if len(source) > config.MaxExpressionLength {
+		err = fmt.Errorf("expression is longer than %d characters", config.MaxExpressionLength)
+		return
+	}
+	if env, err = getExpressionEnv(); err != nil {
+		return
+	}
+	if ast, issues = env.Compile(source); issues != nil && issues.Err() != nil {
+		err = fmt.Errorf("failed to compile expression %s: %w", source, issues.Err())
+		return
+	}
+	if expectedType != nil {
+		outputType := ast.OutputType()
+		if !outputType.IsExactType(expectedType) && !outputType.IsExactType(cel.DynType) {
+			err = fmt.Errorf("expression %s should evaluate to %s, not %s", source, expectedType, outputType)
+			return
+		}
+	}
+	if program, err = env.Program(ast,
+		cel.CostLimit(config.ExpressionCostLimit),
+		cel.InterruptCheckFrequency(100),
+	); err != nil {
+		return
+	}
+	expression = &Expression{
+		Source:  source,
+		program: program,
+	}
+	return
+}
+
+// Evaluate evaluates the expression and returns the result as a
+// JSON compatible value
+func (expression *Expression) Evaluate(vars map[string]interface{}) (result interface{}, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), config.ExpressionEvalTimeout)
+	defer cancel()
+
+	val, _, evalErr := expression.program.ContextEval(ctx, vars)
+	if evalErr != nil {
+		err = fmt.Errorf("failed to evaluate expression %s: %w", expression.Source, evalErr)
+		return
+	}
+	nativeVal, convErr := val.ConvertToNative(reflect.TypeOf(&structpb.Value{}))
+	if convErr != nil {
+		err = fmt.Errorf("failed to convert result of expression %s: %w", expression.Source, convErr)
+		return
+	}
+	result = nativeVal.(*structpb.Value).AsInterface()
+	return
+}
+
+// EvaluateBool evaluates expressions which are used as conditions
+func (expression *Expression) EvaluateBool(vars map[string]interface{}) (result bool, err error) {
+	var (
+		val    interface{}
+		isBool bool
+	)
+	if val, err = expression.Evaluate(vars); err != nil {
+		return
+	}
+	if result, isBool = val.(bool); !isBool {
+		err = fmt.Errorf("expression %s evaluated to %v instead of a boolean", expression.Source, val)
+		return
+	}
+	return
+}
@@ -0,0 +1,259 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/cel-go/cel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cronny/core/actions"
+	"github.com/cronny/core/config"
+)
+
+// ==========================================================
+// TestCompileExpression
+
+func TestCompileExpression(t *testing.T) {
+	testCases := []struct {
+		name         string
+		source       string
+		expectedType *cel.Type
+		shouldError  bool
+	}{
+		{name: "Boolean expression", source: `output.status == "ok"`, expectedType: cel.BoolType},
+		{name: "Dynamic value as boolean", source: `output.ok`, expectedType: cel.BoolType},
+		{name: "Any type", source: `"Hello " + string(output.name)`},
+		{name: "Syntax error", source: `output.status ==`, shouldError: true},
+		{name: "Unknown variable", source: `input.status == "ok"`, shouldError: true},
+		{name: "Wrong result type", source: `"not a bool"`, expectedType: cel.BoolType, shouldError: true},
+		{name: "Too long", source: strings.Repeat("a", config.MaxExpressionLength+1), shouldError: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := CompileExpression(tc.source, tc.expectedType)
+			if tc.shouldError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+// ==========================================================
+// TestExpression_Evaluate
+
+func TestExpression_Evaluate(t *testing.T) {
+	trigger := &Trigger{
+		StartAt: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		Schedule: &Schedule{
+			Name:          "nightly",
+			ScheduleValue: "1",
+			ScheduleUnit:  DayScheduleUnit,
+		},
+	}
+	trigger.ID = 7
+	execCtx := NewExecutionContext(trigger)
+	execCtx.PrevJobOutput = actions.Output{
+		"count": float64(3),
+		"user":  map[string]interface{}{"name": "jane"},
+		"tags":  []interface{}{"a", "b"},
+	}
+	vars := execCtx.ExpressionVars()
+
+	testCases := []struct {
+		name     string
+		source   string
+		expected interface{}
+	}{
+		{name: "Arithmetic on output", source: `output.count * 2.0`, expected: float64(6)},
+		{name: "Nested output", source: `output.user.name`, expected: "jane"},
+		{name: "List size", source: `size(output.tags)`, expected: float64(2)},
+		{name: "Trigger metadata", source: `trigger.id`, expected: float64(7)},
+		{name: "Trigger start time", source: `trigger.start_at.getFullYear()`, expected: float64(2024)},
+		{name: "Schedule fields", source: `schedule.name + "/" + schedule.unit`, expected: "nightly/day"},
+		{name: "Map result", source: `{"count": output.count}`, expected: map[string]interface{}{"count": float64(3)}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			expression, err := CompileExpression(tc.source, nil)
+			require.NoError(t, err)
+
+			result, err := expression.Evaluate(vars)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, result)
+		})
+	}
+}
+
+func TestExpression_Evaluate_MissingKey(t *testing.T) {
+	expression, err := CompileExpression(`output.missing == "x"`, cel.BoolType)
+	require.NoError(t, err)
+
+	_, err = expression.EvaluateBool(NewExecutionContext(nil).ExpressionVars())
+	assert.Error(t, err)
+}
+
+func TestExpression_Evaluate_CostLimit(t *testing.T) {
+	// Builds a list with ~1000^2 elements which exceeds the cost limit
+	expression, err := CompileExpression(`output.items.map(x, output.items.map(y, x + y)).size() > 0`, cel.BoolType)
+	require.NoError(t, err)
+
+	items := make([]interface{}, 1000)
+	for idx := range items {
+		items[idx] = float64(idx)
+	}
+	execCtx := NewExecutionContext(nil)
+	execCtx.PrevJobOutput = actions.Output{"items": items}
+
+	_, err = expression.EvaluateBool(execCtx.ExpressionVars())
+	assert.Error(t, err)
+}
+
+// ==========================================================
+// TestCondition_Expressions
+
+func TestCondition_GetNextJobID_Expressions(t *testing.T) {
+	condition := &Condition{
+		Rules: []*ConditionRule{
+			{Expression: `output.code >= 500 && output.code < 600`, JobID: 1},
+			{Expression: `schedule.name == "nightly"`, JobID: 2},
+			{JobID: 3},
+		},
+	}
+	execCtx := NewExecutionContext(&Trigger{Schedule: &Schedule{Name: "nightly"}})
+
+	testCases := []struct {
+		name          string
+		input         actions.Input
+		expectedJobID uint
+	}{
+		{name: "Matches output", input: actions.Input{"code": float64(503)}, expectedJobID: 1},
+		{name: "Matches schedule", input: actions.Input{"code": float64(200)}, expectedJobID: 2},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			jobID, err := condition.WithContext(execCtx).GetNextJobID(tc.input)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedJobID, jobID)
+		})
+	}
+
+	// The missing code fails the run rather than falling through to the next rule
+	_, err := condition.WithContext(execCtx).GetNextJobID(actions.Input{})
+	assert.ErrorContains(t, err, "Condition rule for job 1 failed")
+}
+
+func TestCompileConditionExpression_Cached(t *testing.T) {
+	source := `output.cached == true`
+	expression, err := compileConditionExpression(source)
+	require.NoError(t, err)
+	cachedExpression, err := compileConditionExpression(source)
+	require.NoError(t, err)
+	assert.Same(t, expression, cachedExpression)
+
+	_, err = compileConditionExpression(`output.cached ==`)
+	assert.Error(t, err)
+	_, isPresent := conditionExpressions.Load(`output.cached ==`)
+	assert.False(t, isPresent, "Expressions which don't compile aren't cached")
+}
+
+func TestCondition_Validate_Expressions(t *testing.T) {
+	testCases := []struct {
+		name        string
+		rule        *ConditionRule
+		shouldError bool
+	}{
+		{name: "Valid expression", rule: &ConditionRule{Expression: `output.ok == true`}},
+		{name: "Invalid expression", rule: &ConditionRule{Expression: `output.ok ==`}, shouldError: true},
+		{name: "Non boolean expression", rule: &ConditionRule{Expression: `1 + 2`}, shouldError: true},
+		{
+			name: "Expression with filters",
+			rule: &ConditionRule{
+				Expression: `output.ok == true`,
+				Filters:    []*Filter{{Name: "ok", ComparisonType: ExistsComparison, ShouldMatch: true}},
+			},
+			shouldError: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			condition := &Condition{Rules: []*ConditionRule{tc.rule}}
+			err := condition.Validate()
+			if tc.shouldError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.False(t, tc.rule.IsWildcard(), "An expression rule isn't a wildcard")
+		})
+	}
+}
+
+// ==========================================================
+// TestJob_ExpressionInput
+
+func TestJob_BeforeSave_ValidatesExpressionInput(t *testing.T) {
+	db := setupJobTestDB(t)
+	action := createTestAction(db, "Test Action")
+	template := createTestJobTemplate(db, "logger")
+
+	job := &Job{
+		Name:          "expression job",
+		ActionID:      action.ID,
+		JobTemplateID: template.ID,
+		JobInputType:  JobInputAsExpression,
+		JobInputValue: `{"message": "output.title +"}`,
+	}
+	job.SetUserID(1)
+	assert.Error(t, db.Create(job).Error, "Job with an invalid expression shouldn't be saved")
+
+	job.JobInputValue = `{"message": "'Title: ' + string(output.title)"}`
+	assert.NoError(t, db.Create(job).Error)
+}
+
+func TestJob_GetInput_JobInputAsExpression(t *testing.T) {
+	db := setupJobTestDB(t)
+	action := createTestAction(db, "Test Action")
+	template := createTestJobTemplate(db, "logger")
+
+	job := createTestJob(db, action.ID, template.ID, JobInputAsExpression,
+		`{"message": "'Title: ' + output.title", "count": "output.count + 1.0", "schedule": "schedule.name"}`, false)
+	job.ExecutionContext = NewExecutionContext(&Trigger{Schedule: &Schedule{Name: "nightly"}})
+	job.ExecutionContext.PrevJobOutput = actions.Output{"title": "hello", "count": float64(1)}
+
+	input, err := job.GetInput(db)
+	assert.NoError(t, err)
+	assert.Equal(t, "Title: hello", input["message"])
+	assert.Equal(t, float64(2), input["count"])
+	assert.Equal(t, "nightly", input["schedule"])
+}
+
+func TestJob_Next_PassesOutputToExpressions(t *testing.T) {
+	db := setupJobTestDB(t)
+	action := createTestAction(db, "Test Action")
+	template := createTestJobTemplate(db, "logger")
+
+	nextJob := createTestJob(db, action.ID, template.ID, JobInputAsExpression, `{"message": "output.title"}`, false)
+	condition := &Condition{
+		Rules: []*ConditionRule{{Expression: `output.title.startsWith("he")`, JobID: nextJob.ID}},
+	}
+	conditionJSON, _ := json.Marshal(condition)
+
+	currentJob := createTestJob(db, action.ID, template.ID, StaticJsonInput, `{}`, true)
+	currentJob.Condition = string(conditionJSON)
+	currentJob.InternalOutput = JobOutputT(`{"title": "hello"}`)
+	db.Save(currentJob)
+
+	foundNextJob, err := currentJob.Next(db)
+	require.NoError(t, err)
+	assert.Equal(t, nextJob.ID, foundNextJob.ID)
+
+	input, err := foundNextJob.GetInput(db)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", input["message"])
+}
@@ -0,0 +1,361 @@
+package models
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/cronny/core/helpers"
+)
+
+const (
+	// Go Template Functions which write their result as is. The result of
+	// every other action is escaped to be safe inside a JSON string.
+	ToJSONTemplateFunc = "toJSON"
+	JSONTemplateFunc   = "json"
+	RawTemplateFunc    = "raw"
+
+	SecretTemplateFunc = "secret"
+)
+
+type (
+	// GoTemplate is a job input written as a Go text/template which
+	// renders to a JSON document
+	GoTemplate struct {
+		Source string
+
+		db   *gorm.DB
+		job  *Job
+		tmpl *template.Template
+	}
+)
+
+// NewGoTemplate parses the template source. db and job are only required
+// to execute the template, ie. to resolve secrets.
+func NewGoTemplate(db *gorm.DB, job *Job, source string) (goTemplate *GoTemplate, err error) {
+	goTemplate = &GoTemplate{
+		Source: source,
+		db:     db,
+		job:    job,
+	}
+	goTemplate.tmpl = template.New("job_input").Option("missingkey=error").Funcs(goTemplateFuncs())
+	if goTemplate.tmpl, err = goTemplate.tmpl.Parse(source); err != nil {
+		err = fmt.Errorf("failed to parse template: %w", err)
+		return
+	}
+	for _, tmpl := range goTemplate.tmpl.Templates() {
+		if tmpl.Tree != nil {
+			escapeActions(tmpl.Tree.Root)
+		}
+	}
+	return
+}
+
+// Execute renders the template with the outputs of the jobs executed so far
+// in the execution context along with the trigger and schedule metadata
+func (goTemplate *GoTemplate) Execute(execCtx *ExecutionContext) (result string, err error) {
+	var (
+		buf bytes.Buffer
+	)
+	vars := execCtx.ExpressionVars()
+	jobs := make(map[string]interface{})
+	for jobName, jobOutput := range execCtx.JobOutputs {
+		jobs[jobName] = map[string]interface{}(jobOutput)
+	}
+	data := map[string]interface{}{
+		"Output":   vars[OutputExpressionVar],
+		"Jobs":     jobs,
+		"Trigger":  vars[TriggerExpressionVar],
+		"Schedule": vars[ScheduleExpressionVar],
+	}
+	goTemplate.tmpl.Funcs(template.FuncMap{
+		SecretTemplateFunc: goTemplate.secret,
+	})
+	if err = goTemplate.tmpl.Execute(&buf, data); err != nil {
+		err = fmt.Errorf("failed to execute template: %w", err)
+		return
+	}
+	result = buf.String()
+	return
+}
+
+func (goTemplate *GoTemplate) secret(name string) (value string, err error) {
+	if goTemplate.db == nil || goTemplate.job == nil {
+		err = fmt.Errorf("secret %s can't be resolved outside of a job", name)
+		return
+	}
+	if value, err = GetSecretValue(goTemplate.db, goTemplate.job.UserID, name); err != nil {
+		return
+	}
+	goTemplate.job.executionContext().AddSecretValue(value)
+	return
+}
+
+// JobReferences returns the names of the jobs whose outputs are read via
+// .Jobs.NAME, $.Jobs.NAME or index .Jobs "NAME". Names which are only known
+// while executing, eg. inside a with or range over .Jobs, aren't returned.
+func (goTemplate *GoTemplate) JobReferences() (jobNames []string) {
+	refs := make(map[string]bool)
+	for _, tmpl := range goTemplate.tmpl.Templates() {
+		if tmpl.Tree != nil {
+			findJobReferences(tmpl.Tree.Root, refs)
+		}
+	}
+	for jobName := range refs {
+		jobNames = append(jobNames, jobName)
+	}
+	sort.Strings(jobNames)
+	return
+}
+
+// isJobsNode checks if the node is .Jobs or $.Jobs
+func isJobsNode(node parse.Node) bool {
+	switch typedNode := node.(type) {
+	case *parse.FieldNode:
+		return len(typedNode.Ident) == 1 && typedNode.Ident[0] == "Jobs"
+	case *parse.VariableNode:
+		return len(typedNode.Ident) == 2 && typedNode.Ident[0] == "$" && typedNode.Ident[1] == "Jobs"
+	}
+	return false
+}
+
+func findJobReferences(node parse.Node, refs map[string]bool) {
+	switch typedNode := node.(type) {
+	case *parse.ListNode:
+		if typedNode == nil {
+			return
+		}
+		for _, childNode := range typedNode.Nodes {
+			findJobReferences(childNode, refs)
+		}
+	case *parse.IfNode:
+		findJobReferences(typedNode.Pipe, refs)
+		findJobReferences(typedNode.List, refs)
+		findJobReferences(typedNode.ElseList, refs)
+	case *parse.RangeNode:
+		findJobReferences(typedNode.Pipe, refs)
+		findJobReferences(typedNode.List, refs)
+		findJobReferences(typedNode.ElseList, refs)
+	case *parse.WithNode:
+		findJobReferences(typedNode.Pipe, refs)
+		findJobReferences(typedNode.List, refs)
+		findJobReferences(typedNode.ElseList, refs)
+	case *parse.ActionNode:
+		findJobReferences(typedNode.Pipe, refs)
+	case *parse.TemplateNode:
+		findJobReferences(typedNode.Pipe, refs)
+	case *parse.PipeNode:
+		if typedNode == nil {
+			return
+		}
+		for _, cmd := range typedNode.Cmds {
+			findJobReferences(cmd, refs)
+		}
+	case *parse.CommandNode:
+		if len(typedNode.Args) >= 3 && isJobsNode(typedNode.Args[1]) {
+			ident, isIdent := typedNode.Args[0].(*parse.IdentifierNode)
+			name, isString := typedNode.Args[2].(*parse.StringNode)
+			if isIdent && ident.Ident == "index" && isString {
+				refs[name.Text] = true
+			}
+		}
+		for _, arg := range typedNode.Args {
+			findJobReferences(arg, refs)
+		}
+	case *parse.ChainNode:
+		findJobReferences(typedNode.Node, refs)
+	case *parse.FieldNode:
+		if len(typedNode.Ident) > 1 && typedNode.Ident[0] == "Jobs" {
+			refs[typedNode.Ident[1]] = true
+		}
+	case *parse.VariableNode:
+		if len(typedNode.Ident) > 2 && typedNode.Ident[0] == "$" && typedNode.Ident[1] == "Jobs" {
+			refs[typedNode.Ident[2]] = true
+		}
+	}
+}
+
+// escapeActions appends the json function to the pipeline of every action
+// which doesn't already end with toJSON, json or raw, so that substituted
+// values can't break out of the JSON strings they are placed in
+func escapeActions(node parse.Node) {
+	switch typedNode := node.(type) {
+	case *parse.ListNode:
+		if typedNode == nil {
+			return
+		}
+		for _, childNode := range typedNode.Nodes {
+			escapeActions(childNode)
+		}
+	case *parse.IfNode:
+		escapeActions(typedNode.List)
+		escapeActions(typedNode.ElseList)
+	case *parse.RangeNode:
+		escapeActions(typedNode.List)
+		escapeActions(typedNode.ElseList)
+	case *parse.WithNode:
+		escapeActions(typedNode.List)
+		escapeActions(typedNode.ElseList)
+	case *parse.ActionNode:
+		pipe := typedNode.Pipe
+		if pipe == nil || len(pipe.Decl) > 0 || len(pipe.Cmds) == 0 {
+			return
+		}
+		lastCmd := pipe.Cmds[len(pipe.Cmds)-1]
+		if ident, isIdent := lastCmd.Args[0].(*parse.IdentifierNode); isIdent {
+			switch ident.Ident {
+			case ToJSONTemplateFunc, JSONTemplateFunc, RawTemplateFunc:
+				return
+			}
+		}
+		pipe.Cmds = append(pipe.Cmds, &parse.CommandNode{
+			NodeType: parse.NodeCommand,
+			Pos:      typedNode.Pos,
+			Args:     []parse.Node{parse.NewIdentifier(JSONTemplateFunc).SetPos(typedNode.Pos)},
+		})
+	}
+}
+
+// ==========================================================
+// Template Functions
+
+func goTemplateFuncs() (funcs template.FuncMap) {
+	funcs = template.FuncMap{
+		"default":          templateDefault,
+		JSONTemplateFunc:   templateJSONEscape,
+		ToJSONTemplateFunc: templateToJSON,
+		RawTemplateFunc:    templateRaw,
+		"upper":            strings.ToUpper,
+		"lower":            strings.ToLower,
+		"date":             templateDate,
+		"base64":           templateBase64,
+		"sha256":           templateSha256,
+		"get":              templateGet,
+		// Resolved while executing the template
+		SecretTemplateFunc: func(name string) (string, error) { return "", nil },
+	}
+	return
+}
+
+// templateDefault returns the default value if the value is nil,
+// an empty string or an empty list or object
+func templateDefault(defaultVal interface{}, val interface{}) interface{} {
+	if val == nil {
+		return defaultVal
+	}
+	reflectVal := reflect.ValueOf(val)
+	switch reflectVal.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map:
+		if reflectVal.Len() == 0 {
+			return defaultVal
+		}
+	}
+	return val
+}
+
+func marshalJSON(val interface{}) (valB []byte, err error) {
+	var (
+		buf bytes.Buffer
+	)
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err = encoder.Encode(val); err != nil {
+		return
+	}
+	valB = bytes.TrimSuffix(buf.Bytes(), []byte("\n"))
+	return
+}
+
+// templateJSONEscape escapes the value so that it can be placed inside a
+// JSON string. Objects and lists are first converted to JSON.
+func templateJSONEscape(val interface{}) (escaped string, err error) {
+	var (
+		str  string
+		strB []byte
+	)
+	switch typedVal := val.(type) {
+	case string:
+		str = typedVal
+	case nil:
+		str = "null"
+	case map[string]interface{}, []interface{}:
+		if strB, err = marshalJSON(typedVal); err != nil {
+			return
+		}
+		str = string(strB)
+	default:
+		str = fmt.Sprint(typedVal)
+	}
+	if strB, err = marshalJSON(str); err != nil {
+		return
+	}
+	escaped = string(strB[1 : len(strB)-1])
+	return
+}
+
+func templateToJSON(val interface{}) (str string, err error) {
+	var (
+		valB []byte
+	)
+	if valB, err = marshalJSON(val); err != nil {
+		return
+	}
+	str = string(valB)
+	return
+}
+
+func templateRaw(val interface{}) string {
+	return fmt.Sprint(val)
+}
+
+// templateDate formats times, RFC3339 strings and unix timestamps
+func templateDate(layout string, val interface{}) (formatted string, err error) {
+	var (
+		t time.Time
+	)
+	switch typedVal := val.(type) {
+	case time.Time:
+		t = typedVal
+	case string:
+		if t, err = time.Parse(time.RFC3339, typedVal); err != nil {
+			return
+		}
+	default:
+		num, isNumeric := toNumber(typedVal)
+		if !isNumeric {
+			err = fmt.Errorf("date can't format %v", val)
+			return
+		}
+		t = time.Unix(int64(num), 0).UTC()
+	}
+	formatted = t.Format(layout)
+	return
+}
+
+func templateBase64(val string) string {
+	return base64.StdEncoding.EncodeToString([]byte(val))
+}
+
+func templateSha256(val string) string {
+	hash := sha256.Sum256([]byte(val))
+	return hex.EncodeToString(hash[:])
+}
+
+// templateGet looks up a path in the value and returns nil if it isn't present
+func templateGet(val interface{}, path string) (elem interface{}, err error) {
+	if elem, _, err = helpers.LookupPath(val, path); err != nil {
+		return
+	}
+	return
+}
@@ -0,0 +1,162 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cronny/core/actions"
+)
+
+// ==========================================================
+// Test Helpers
+
+func newTestExecutionContext() *ExecutionContext {
+	trigger := &Trigger{
+		StartAt:  time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		Schedule: &Schedule{Name: "nightly"},
+	}
+	trigger.ID = 9
+	execCtx := NewExecutionContext(trigger)
+	execCtx.PrevJobOutput = actions.Output{
+		"title": `He said "hi"`,
+		"count": float64(3),
+		"empty": "",
+		"data":  map[string]interface{}{"items": []interface{}{map[string]interface{}{"id": float64(7)}}},
+	}
+	execCtx.JobOutputs["fetch"] = actions.Output{"status": "200", "ok": true}
+	return execCtx
+}
+
+// ==========================================================
+// TestGoTemplate_Execute
+
+func TestGoTemplate_Execute(t *testing.T) {
+	testCases := []struct {
+		name           string
+		source         string
+		expectedResult string
+	}{
+		{
+			name:           "Strings are JSON escaped",
+			source:         `{"message": "{{ .Output.title }}"}`,
+			expectedResult: `{"message": "He said \"hi\""}`,
+		},
+		{
+			name:           "Outputs of all jobs in the run",
+			source:         `{"status": "{{ .Jobs.fetch.status }}", "ok": {{ .Jobs.fetch.ok }}}`,
+			expectedResult: `{"status": "200", "ok": true}`,
+		},
+		{
+			name:           "Trigger and schedule metadata",
+			source:         `{"trigger": {{ .Trigger.id }}, "schedule": "{{ .Schedule.name | upper }}", "date": "{{ date "2006-01-02" .Trigger.start_at }}"}`,
+			expectedResult: `{"trigger": 9, "schedule": "NIGHTLY", "date": "2024-01-02"}`,
+		},
+		{
+			name:           "toJSON writes JSON values",
+			source:         `{"data": {{ toJSON .Output.data }}, "title": {{ toJSON .Output.title }}}`,
+			expectedResult: `{"data": {"items":[{"id":7}]}, "title": "He said \"hi\""}`,
+		},
+		{
+			name:           "Objects are escaped inside strings",
+			source:         `{"data": "{{ .Output.data }}"}`,
+			expectedResult: `{"data": "{\"items\":[{\"id\":7}]}"}`,
+		},
+		{
+			name:           "Default and get",
+			source:         `{"empty": "{{ default "none" .Output.empty }}", "missing": "{{ get .Output "data.items[1].id" | default "none" }}", "id": {{ get .Output "data.items[0].id" }}}`,
+			expectedResult: `{"empty": "none", "missing": "none", "id": 7}`,
+		},
+		{
+			name:           "Hashing and encoding",
+			source:         `{"b64": "{{ base64 "abc" }}", "sha": "{{ sha256 "abc" }}"}`,
+			expectedResult: `{"b64": "YWJj", "sha": "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"}`,
+		},
+		{
+			name:           "Control structures",
+			source:         `{"ids": [{{ range $idx, $item := .Output.data.items }}{{ if $idx }},{{ end }}{{ $item.id }}{{ end }}]}`,
+			expectedResult: `{"ids": [7]}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			goTemplate, err := NewGoTemplate(nil, nil, tc.source)
+			require.NoError(t, err)
+
+			result, err := goTemplate.Execute(newTestExecutionContext())
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedResult, result)
+		})
+	}
+}
+
+func TestGoTemplate_Execute_Errors(t *testing.T) {
+	testCases := []struct {
+		name   string
+		source string
+	}{
+		{name: "Missing key", source: `{"message": "{{ .Output.missing }}"}`},
+		{name: "Missing job", source: `{"message": "{{ .Jobs.missing.status }}"}`},
+		{name: "Secret without a job", source: `{"token": "{{ secret "API_TOKEN" }}"}`},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			goTemplate, err := NewGoTemplate(nil, nil, tc.source)
+			require.NoError(t, err)
+
+			_, err = goTemplate.Execute(newTestExecutionContext())
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestNewGoTemplate_InvalidTemplate(t *testing.T) {
+	for _, source := range []string{
+		`{"message": "{{ .Output.title "}`,
+		`{"message": "{{ unknownFunc .Output.title }}"}`,
+	} {
+		_, err := NewGoTemplate(nil, nil, source)
+		assert.Error(t, err, "Template %s should fail to parse", source)
+	}
+}
+
+// ==========================================================
+// TestJob_GoTemplateInput
+
+func TestJob_GetInput_JobInputAsGoTemplate(t *testing.T) {
+	db := setupJobTestDB(t)
+	action := createTestAction(db, "Test Action")
+	template := createTestJobTemplate(db, "logger")
+
+	secret := &Secret{Name: "API_TOKEN", Value: `s3"cr3t`}
+	secret.SetUserID(1)
+	require.NoError(t, db.Create(secret).Error)
+
+	job := createTestJob(db, action.ID, template.ID, JobInputAsGoTemplate,
+		`{"auth": "Bearer {{ secret "API_TOKEN" }}", "status": "{{ .Jobs.fetch.status }}"}`, false)
+	job.ExecutionContext = newTestExecutionContext()
+
+	input, err := job.GetInput(db)
+	assert.NoError(t, err)
+	assert.Equal(t, `Bearer s3"cr3t`, input["auth"])
+	assert.Equal(t, "200", input["status"])
+}
+
+func TestJob_BeforeSave_ValidatesGoTemplateInput(t *testing.T) {
+	db := setupJobTestDB(t)
+	action := createTestAction(db, "Test Action")
+	template := createTestJobTemplate(db, "logger")
+
+	job := &Job{
+		Name:          "go template job",
+		ActionID:      action.ID,
+		JobTemplateID: template.ID,
+		JobInputType:  JobInputAsGoTemplate,
+		JobInputValue: `{"message": "{{ .Output.title "}`,
+	}
+	job.SetUserID(1)
+	assert.Error(t, db.Create(job).Error, "Job with an invalid template shouldn't be saved")
+}
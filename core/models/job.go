@@ -1,6 +1,7 @@
 package models
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -12,6 +13,7 @@ import (
 
 	"github.com/cronny/core/actions"
 	"github.com/cronny/core/config"
+	"github.com/cronny/core/helpers"
 )
 
 const (
@@ -19,6 +21,26 @@ const (
 	StaticJsonInput    = JobInputT("static_input")
 	JobOutputAsInput   = JobInputT("job_output_as_input")
 	JobInputAsTemplate = JobInputT("job_input_as_template")
+	// JobInputAsExpression is a JSON object whose values are CEL
+	// expressions which are evaluated to build the input
+	JobInputAsExpression = JobInputT("job_input_as_expression")
+	// JobInputAsGoTemplate is a Go text/template which renders to JSON
+	JobInputAsGoTemplate = JobInputT("job_input_as_go_template")
+
+	// Job Execution Status
+	SucceededJobExecutionStatus = JobExecutionStatusT("succeeded")
+	FailedJobExecutionStatus    = JobExecutionStatusT("failed")
+	TimedOutJobExecutionStatus  = JobExecutionStatusT("timed_out")
+	CancelledJobExecutionStatus = JobExecutionStatusT("cancelled")
+	// SkippedJobExecutionStatus is recorded for jobs which were about
+	// to start when their workflow run was cancelled
+	SkippedJobExecutionStatus = JobExecutionStatusT("skipped")
+)
+
+var (
+	ErrJobTimedOut  = errors.New("job execution timed out")
+	ErrJobCancelled = errors.New("job execution cancelled")
+	ErrJobSkipped   = errors.New("job execution skipped")
 )
 
 var (
@@ -26,17 +48,29 @@ var (
 		"http":            actions.HttpAction{},
 		"logger":          actions.LoggerAction{},
 		"slack":           actions.SlackMessageAction{},
+		"github":          actions.GithubAction{},
 		"docker-registry": actions.DockerRegistryAction{},
+		"shell":           actions.ShellAction{},
+		"ssh":             actions.SshAction{},
+		"email":           actions.EmailAction{},
+		"sql":             actions.SqlAction{},
+		"publish":         actions.PublishAction{},
+		"s3":              actions.S3Action{},
+		"grpc":            actions.GrpcAction{},
 	}
 )
 
 type (
+	JobExecutionStatusT string
+
 	Job struct {
 		BaseModel
 
 		Name string `json:"name"`
 
 		InternalOutput JobOutputT `gorm:"-" json:"-"`
+		// ExecutionContext is shared by the jobs executed for a Trigger
+		ExecutionContext *ExecutionContext `gorm:"-" json:"-"`
 
 		JobInputType  JobInputT `json:"job_input_type"`
 		JobInputValue string    `json:"job_input_value"`
@@ -71,7 +105,19 @@ type (
 		JobID uint `json:"job_id"`
 		Job   *Job `json:"job"`
 
-		Output JobOutputT `json:"output"`
+		WorkflowRunID uint `json:"workflow_run_id" gorm:"index"`
+
+		// Executions recorded before the status was introduced only
+		// ever succeeded
+		Status JobExecutionStatusT `json:"status" gorm:"index;default:succeeded"`
+		Error  string              `json:"error"`
+		// Attempt counts the executions of the job in the workflow run
+		Attempt int `json:"attempt"`
+
+		// Input is the resolved input with the secrets redacted
+		Input      string     `json:"input"`
+		Output     JobOutputT `json:"output"`
+		OutputSize int        `json:"output_size"`
 
 		ExecutionStartTime time.Time `json:"execution_start_time" gorm:"type:TIMESTAMP;null;default:null"`
 		ExecutionStopTime  time.Time `json:"execution_stop_time" gorm:"type:TIMESTAMP;null;default:null"`
@@ -102,19 +148,84 @@ func (job *Job) validateAssociations() (err error) {
 	return
 }
 
+func (job *Job) validateCondition() (err error) {
+	var (
+		condition *Condition
+	)
+	if condition, err = ParseCondition(job.Condition); err != nil {
+		return
+	}
+	if err = condition.Validate(); err != nil {
+		err = fmt.Errorf("invalid condition for job %s: %w", job.Name, err)
+		return
+	}
+	return
+}
+
+// validateInput compiles expression and Go template inputs
+// so that they don't fail to parse while executing
+func (job *Job) validateInput() (err error) {
+	switch job.JobInputType {
+	case JobInputAsExpression:
+		_, err = job.inputExpressions()
+	case JobInputAsGoTemplate:
+		_, err = NewGoTemplate(nil, job, job.JobInputValue)
+	}
+	if err != nil {
+		err = fmt.Errorf("invalid input for job %s: %w", job.Name, err)
+		return
+	}
+	return
+}
+
 func (job *Job) BeforeSave(db *gorm.DB) (err error) {
 	if err = job.setDefaultValues(); err != nil {
 		return
 	}
 	if err = job.validateAssociations(); err != nil {
+		err = newJobValidationError(job, MissingAssociationIssue, err)
+		return
+	}
+	if err = job.validateCondition(); err != nil {
+		err = newJobValidationError(job, InvalidConditionIssue, err)
+		return
+	}
+	if err = job.validateInput(); err != nil {
+		err = newJobValidationError(job, InvalidInputIssue, err)
+		return
+	}
+	return
+}
+
+func (job *Job) executionContext() (execCtx *ExecutionContext) {
+	if job.ExecutionContext == nil {
+		job.ExecutionContext = NewExecutionContext(nil)
+	}
+	execCtx = job.ExecutionContext
+	return
+}
+
+func (job *Job) inputExpressions() (expressions map[string]*Expression, err error) {
+	var (
+		sources map[string]string
+	)
+	if err = json.Unmarshal([]byte(job.JobInputValue), &sources); err != nil {
+		err = fmt.Errorf("expression input should be a JSON object of expressions: %w", err)
 		return
 	}
+	expressions = make(map[string]*Expression)
+	for key, source := range sources {
+		if expressions[key], err = CompileExpression(source, nil); err != nil {
+			err = fmt.Errorf("input key %s: %w", key, err)
+			return
+		}
+	}
 	return
 }
 
 func (job *Job) GetLatestJobExecution(db *gorm.DB) (jobExecution *JobExecution, err error) {
 	jobExecution = &JobExecution{}
-	if ex := db.Where("job_id = ?", job.ID).Order("execution_stop_time desc").Limit(1).First(jobExecution); ex.Error != nil {
+	if ex := db.Where("job_id = ? AND status = ?", job.ID, SucceededJobExecutionStatus).Order("execution_stop_time desc").Limit(1).First(jobExecution); ex.Error != nil {
 		err = ex.Error
 		return
 	}
@@ -144,7 +255,7 @@ func (job *Job) GetInput(db *gorm.DB) (input actions.Input, err error) {
 			err = fmt.Errorf("[GetInput] failed to get previous job with ID %d: %w", prevJobOutputId, ex.Error)
 			return
 		}
-		if prevJobExecution, err = prevJob.GetLatestJobExecution(db); err != nil {
+		if prevJobExecution, err = job.executionContext().LatestJobExecution(db, prevJob); err != nil {
 			err = fmt.Errorf("[GetInput] failed to get latest job execution for ID %d: %w", prevJobOutputId, err)
 			return
 		}
@@ -167,6 +278,37 @@ func (job *Job) GetInput(db *gorm.DB) (input actions.Input, err error) {
 			log.Println(parsedTemplate, err)
 			return
 		}
+	case JobInputAsExpression:
+		var (
+			expressions map[string]*Expression
+			vars        map[string]interface{}
+		)
+		if expressions, err = job.inputExpressions(); err != nil {
+			return
+		}
+		vars = job.executionContext().ExpressionVars()
+		for key, expression := range expressions {
+			if input[key], err = expression.Evaluate(vars); err != nil {
+				err = fmt.Errorf("[GetInput] input key %s: %w", key, err)
+				return
+			}
+		}
+	case JobInputAsGoTemplate:
+		var (
+			goTemplate     *GoTemplate
+			renderedResult string
+		)
+		if goTemplate, err = NewGoTemplate(db, job, job.JobInputValue); err != nil {
+			return
+		}
+		if renderedResult, err = goTemplate.Execute(job.executionContext()); err != nil {
+			err = fmt.Errorf("[GetInput] %w", err)
+			return
+		}
+		if err = json.Unmarshal([]byte(renderedResult), &input); err != nil {
+			err = fmt.Errorf("[GetInput] template didn't render to a JSON object: %w", err)
+			return
+		}
 	default:
 		err = fmt.Errorf("No JobInputType matched for %s", job.JobInputType)
 		return
@@ -174,12 +316,107 @@ func (job *Job) GetInput(db *gorm.DB) (input actions.Input, err error) {
 	return
 }
 
-func (job *Job) CreateJobExecution(db *gorm.DB, startTime, stopTime time.Time, output JobOutputT) (err error) {
+// attempt returns the number of the job's executions in the workflow run
+// including the current one
+func (job *Job) attempt(db *gorm.DB) (attempt int, err error) {
+	var (
+		count int64
+	)
+	attempt = 1
+	run := job.executionContext().WorkflowRun
+	if run == nil {
+		return
+	}
+	if ex := db.Model(&JobExecution{}).Where("job_id = ? AND workflow_run_id = ?", job.ID, run.ID).Count(&count); ex.Error != nil {
+		err = ex.Error
+		return
+	}
+	attempt += int(count)
+	return
+}
+
+// secretGetter resolves the secrets of the job's user which actions read
+// by name. The resolved values are redacted from the job's execution.
+func (job *Job) secretGetter(db *gorm.DB) actions.SecretGetter {
+	return func(name string) (value string, err error) {
+		if value, err = GetSecretValue(db, job.UserID, name); err != nil {
+			return
+		}
+		job.executionContext().AddSecretValue(value)
+		return
+	}
+}
+
+// dockerLimits returns the most resources the job can use when running a
+// container, the limits of its user's plan
+func (job *Job) dockerLimits(db *gorm.DB) (limits helpers.DockerLimits, err error) {
+	var (
+		user User
+	)
+	limits = actions.AdminDockerLimits()
+	if ex := db.Preload("Plan").Where("id = ?", job.UserID).First(&user); ex.Error != nil {
+		if errors.Is(ex.Error, gorm.ErrRecordNotFound) {
+			return
+		}
+		err = ex.Error
+		return
+	}
+	limits = user.Plan.DockerLimits(limits)
+	return
+}
+
+// registryCredentialsGetter resolves the registry credentials of the job's
+// user which Docker jobs refer to by name. The passwords are redacted from
+// the job's execution.
+func (job *Job) registryCredentialsGetter(db *gorm.DB) actions.RegistryCredentialsGetter {
+	return func(name string) (credentials *actions.RegistryCredentials, err error) {
+		var (
+			credential *RegistryCredential
+		)
+		if credential, err = GetRegistryCredential(db, job.UserID, name); err != nil {
+			return
+		}
+		job.executionContext().AddSecretValue(credential.Password)
+		credentials = &actions.RegistryCredentials{
+			Registry: credential.Registry,
+			Username: credential.Username,
+			Password: credential.Password,
+		}
+		return
+	}
+}
+
+// CreateJobExecution records the execution of the job whatever its outcome.
+// The status is derived from the error returned while executing the job.
+func (job *Job) CreateJobExecution(db *gorm.DB, startTime, stopTime time.Time, input actions.Input, output JobOutputT, execErr error) (err error) {
+	var (
+		inputB []byte
+	)
+	execCtx := job.executionContext()
 	jobExecution := &JobExecution{
 		JobID:              job.ID,
+		Status:             SucceededJobExecutionStatus,
 		ExecutionStartTime: startTime,
 		ExecutionStopTime:  stopTime,
 		Output:             output,
+		OutputSize:         len(output),
+	}
+	jobExecution.SetUserID(job.UserID)
+	if execCtx.WorkflowRun != nil {
+		jobExecution.WorkflowRunID = execCtx.WorkflowRun.ID
+	}
+	if input != nil {
+		if inputB, err = json.Marshal(execCtx.RedactInput(input)); err != nil {
+			return
+		}
+		jobExecution.Input = string(inputB)
+	}
+	if execErr != nil {
+		jobExecution.Status = jobExecutionStatusForError(execErr)
+		jobExecution.Error = execCtx.Redact(execErr.Error())
+	}
+	if jobExecution.Attempt, err = job.attempt(db); err != nil {
+		return
 	}
 	if ex := db.Save(jobExecution); ex.Error != nil {
 		err = ex.Error
@@ -188,20 +425,41 @@ func (job *Job) CreateJobExecution(db *gorm.DB, startTime, stopTime time.Time, o
 	return
 }
 
+func jobExecutionStatusForError(execErr error) JobExecutionStatusT {
+	switch {
+	case errors.Is(execErr, ErrJobSkipped):
+		return SkippedJobExecutionStatus
+	case errors.Is(execErr, ErrJobTimedOut):
+		return TimedOutJobExecutionStatus
+	case errors.Is(execErr, ErrJobCancelled):
+		return CancelledJobExecutionStatus
+	}
+	return FailedJobExecutionStatus
+}
+
 func (job *Job) ExecuteJobTemplate(db *gorm.DB) (output JobOutputT, err error) {
+	var (
+		inp actions.Input
+	)
+	if inp, err = job.GetInput(db); err != nil {
+		return
+	}
+	if output, err = job.executeJobTemplateWithInput(db, inp); err != nil {
+		return
+	}
+	return
+}
+
+func (job *Job) executeJobTemplateWithInput(db *gorm.DB, inp actions.Input) (output JobOutputT, err error) {
 	var (
 		isPresent      bool
 		actionExecutor actions.ActionExecutor
-		inp            actions.Input
 		outputMap      actions.Output
 		outputB        []byte
+		actionErr      error
 		baseAction     actions.BaseAction
 		jobTemplate    *JobTemplate
 	)
-	if inp, err = job.GetInput(db); err != nil {
-		return
-	}
-
 	// Get job template
 	jobTemplate = &JobTemplate{}
 	if ex := db.Where("id = ?", job.JobTemplateID).First(jobTemplate); ex.Error != nil {
@@ -221,52 +479,88 @@ func (job *Job) ExecuteJobTemplate(db *gorm.DB) (output JobOutputT, err error) {
 	}
 	resultCh := make(chan result, 1)
 	timeout := time.Duration(job.JobTimeoutInSecs) * time.Second
+	// Actions supporting a context stop their work once the job times out
+	ctx, cancel := context.WithTimeout(job.executionContext().Context(), timeout)
+	defer cancel()
+	ctx = actions.ContextWithSecretRedactor(ctx, job.executionContext().AddSecretValue)
+	if _, isDocker := actionExecutor.(actions.DockerRegistryAction); isDocker {
+		var dockerLimits helpers.DockerLimits
+		if dockerLimits, err = job.dockerLimits(db); err != nil {
+			return
+		}
+		ctx = actions.ContextWithDockerLimits(ctx, dockerLimits)
+		ctx = actions.ContextWithRegistryCredentials(ctx, job.registryCredentialsGetter(db))
+	}
 
 	go func() {
-		out, execErr := baseAction.Execute(actionExecutor, inp)
+		out, execErr := baseAction.ExecuteContext(ctx, actionExecutor, inp, job.secretGetter(db))
 		resultCh <- result{output: out, err: execErr}
 	}()
 
 	select {
 	case res := <-resultCh:
-		if res.err != nil {
+		if res.err != nil && res.output == nil {
 			return "", res.err
 		}
-		outputMap = res.output
+		// Secrets the action obtained, eg. tokens, aren't passed on to the
+		// next jobs
+		outputMap = job.executionContext().RedactOutput(res.output)
+		// Failed actions with an output, eg. containers exiting with a
+		// non-zero code, have it recorded with the error
+		actionErr = res.err
 	case <-time.After(timeout):
-		return "", fmt.Errorf("job execution timed out after %d seconds", job.JobTimeoutInSecs)
+		return "", fmt.Errorf("%w after %d seconds", ErrJobTimedOut, job.JobTimeoutInSecs)
+	case <-job.executionContext().Context().Done():
+		return "", fmt.Errorf("%w: %w", ErrJobCancelled, job.executionContext().Context().Err())
 	}
 
 	if outputB, err = json.Marshal(outputMap); err != nil {
 		return
 	}
 	output = JobOutputT(string(outputB))
+	err = actionErr
 	return
 }
 
 func (job *Job) Execute(db *gorm.DB) (err error) {
 	var (
 		nextJob *Job
+		input   actions.Input
 		output  JobOutputT
+		execErr error
 
 		startTime, stopTime time.Time
 	)
 	log.Println("Executing Job", job.Name, "with ID", job.ID)
 
 	startTime = time.Now().UTC()
-	if output, err = job.ExecuteJobTemplate(db); err != nil {
-		return fmt.Errorf("failed to execute job %s (ID: %d): %w", job.Name, job.ID, err)
+	if ctxErr := job.executionContext().Context().Err(); ctxErr != nil {
+		execErr = fmt.Errorf("%w: %w", ErrJobSkipped, ctxErr)
+	} else if input, execErr = job.GetInput(db); execErr != nil {
+		// The input is only recorded once it's been resolved
+		input = nil
+	} else {
+		output, execErr = job.executeJobTemplateWithInput(db, input)
 	}
 	stopTime = time.Now().UTC()
 
-	if err = job.CreateJobExecution(db, startTime, stopTime, output); err != nil {
+	if err = job.CreateJobExecution(db, startTime, stopTime, input, output, execErr); err != nil {
 		return fmt.Errorf("failed to create job execution for job %s (ID: %d): %w", job.Name, job.ID, err)
 	}
+	if execErr != nil {
+		return fmt.Errorf("failed to execute job %s (ID: %d): %w", job.Name, job.ID, execErr)
+	}
 
 	job.InternalOutput = output
+	if err = job.executionContext().AddJobOutput(job.Name, output); err != nil {
+		return fmt.Errorf("failed to record output of job %s (ID: %d): %w", job.Name, job.ID, err)
+	}
 	if nextJob, err = job.Next(db); err != nil {
 		return fmt.Errorf("failed to get next job for job %s (ID: %d): %w", job.Name, job.ID, err)
 	}
+	if nextJob == nil {
+		return
+	}
 
 	if err = nextJob.Execute(db); err != nil {
 		return fmt.Errorf("failed to execute next job from %s (ID: %d): %w", job.Name, job.ID, err)
@@ -280,21 +574,27 @@ func (job *Job) Next(db *gorm.DB) (nextJob *Job, err error) {
 		nextJobID     uint
 		prevJobOutput actions.Output
 	)
-	condition = &Condition{}
 	nextJob = &Job{}
 	prevJobOutput = make(actions.Output)
 
-	if err = json.Unmarshal([]byte(job.Condition), condition); err != nil {
+	if condition, err = ParseCondition(job.Condition); err != nil {
 		err = fmt.Errorf("[Next] failed to unmarshal condition: %w", err)
 		return
 	}
+	if len(condition.Rules) == 0 {
+		// A job without any rules is the last job of the workflow
+		nextJob = nil
+		return
+	}
 	if err = json.Unmarshal([]byte(job.InternalOutput), &prevJobOutput); err != nil {
 		err = fmt.Errorf("[Next] failed to unmarshal job output: %w", err)
 		return
 	}
 	// The previous job's output is used to decide the next job
 	// in the workflow/pipeline depending on the condition provided
-	if nextJobID, err = condition.GetNextJobID(actions.Input(prevJobOutput)); err != nil {
+	execCtx := job.executionContext()
+	execCtx.PrevJobOutput = prevJobOutput
+	if nextJobID, err = condition.WithContext(execCtx).GetNextJobID(actions.Input(prevJobOutput)); err != nil {
 		err = fmt.Errorf("[Next] failed to get next job ID: %w", err)
 		return
 	}
@@ -302,6 +602,7 @@ func (job *Job) Next(db *gorm.DB) (nextJob *Job, err error) {
 		err = fmt.Errorf("[Next] failed to get next job with ID %d: %w", nextJobID, ex.Error)
 		return
 	}
+	nextJob.ExecutionContext = execCtx
 
 	return
 }
@@ -0,0 +1,232 @@
+package models
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cronny/core/actions"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func newRunExecutionContext(t *testing.T, db *gorm.DB, action *Action) *ExecutionContext {
+	run, err := NewWorkflowRun(db, action, nil)
+	require.NoError(t, err)
+	execCtx := NewExecutionContext(nil)
+	execCtx.WorkflowRun = run
+	return execCtx
+}
+
+// ==========================================================
+// TestJob_Execute_RecordsExecutions
+
+func TestJob_Execute_RecordsFailedExecution(t *testing.T) {
+	db := setupJobTestDB(t)
+	action := createTestAction(db, "Test Action")
+	template := createTestJobTemplate(db, "logger")
+
+	job := createTestJob(db, action.ID, template.ID, StaticJsonInput, `{invalid}`, true)
+	job.ExecutionContext = newRunExecutionContext(t, db, action)
+
+	assert.Error(t, job.Execute(db))
+
+	var jobExecution JobExecution
+	require.NoError(t, db.Where("job_id = ?", job.ID).First(&jobExecution).Error)
+	assert.Equal(t, FailedJobExecutionStatus, jobExecution.Status)
+	assert.NotEmpty(t, jobExecution.Error)
+	assert.Empty(t, jobExecution.Input, "Input couldn't be resolved")
+	assert.Equal(t, 0, jobExecution.OutputSize)
+
+	_, err := job.GetLatestJobExecution(db)
+	assert.Error(t, err, "Failed executions shouldn't be used as the latest output")
+}
+
+func TestJob_Execute_RecordsRedactedInput(t *testing.T) {
+	db := setupJobTestDB(t)
+	action := createTestAction(db, "Test Action")
+	template := createTestJobTemplate(db, "logger")
+
+	secret := &Secret{Name: "API_TOKEN", Value: "hunter2"}
+	secret.SetUserID(1)
+	require.NoError(t, db.Create(secret).Error)
+
+	job := createTestJob(db, action.ID, template.ID, JobInputAsGoTemplate,
+		`{"message": "token {{ secret "API_TOKEN" }}", "nested": {"auth": "Bearer {{ secret "API_TOKEN" }}"}}`, true)
+	job.ExecutionContext = newRunExecutionContext(t, db, action)
+
+	require.NoError(t, job.Execute(db))
+
+	var jobExecution JobExecution
+	require.NoError(t, db.Where("job_id = ?", job.ID).First(&jobExecution).Error)
+	assert.Equal(t, SucceededJobExecutionStatus, jobExecution.Status)
+	assert.NotContains(t, jobExecution.Input, "hunter2")
+	assert.JSONEq(t, `{"message": "token [REDACTED]", "nested": {"auth": "Bearer [REDACTED]"}}`, jobExecution.Input)
+	assert.Equal(t, len(jobExecution.Output), jobExecution.OutputSize)
+}
+
+func TestJob_Execute_ResolvesActionSecrets(t *testing.T) {
+	db := setupJobTestDB(t)
+	action := createTestAction(db, "Test Action")
+	template := createTestJobTemplate(db, "http")
+
+	secret := &Secret{Name: "WEBHOOK_KEY", Value: "hunter2"}
+	secret.SetUserID(1)
+	require.NoError(t, db.Create(secret).Error)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mac := hmac.New(sha256.New, []byte("hunter2"))
+		mac.Write([]byte(r.Header.Get("X-Cronny-Timestamp") + "." + string(body)))
+		if r.Header.Get("X-Cronny-Signature") != hex.EncodeToString(mac.Sum(nil)) {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer server.Close()
+
+	job := createTestJob(db, action.ID, template.ID, StaticJsonInput, fmt.Sprintf(
+		`{"url": %q, "method": "POST", "request_body": {"event": "ping"}, "expected_status": "200",
+		"signing": {"type": "hmac_sha256", "key_secret": "WEBHOOK_KEY"}}`, server.URL), true)
+	job.ExecutionContext = newRunExecutionContext(t, db, action)
+
+	require.NoError(t, job.Execute(db))
+
+	var jobExecution JobExecution
+	require.NoError(t, db.Where("job_id = ?", job.ID).First(&jobExecution).Error)
+	assert.Equal(t, SucceededJobExecutionStatus, jobExecution.Status)
+	assert.Contains(t, jobExecution.Input, "WEBHOOK_KEY")
+	assert.NotContains(t, jobExecution.Input, "hunter2")
+}
+
+func TestJob_Execute_RedactsOAuth2TokenFromOutput(t *testing.T) {
+	db := setupJobTestDB(t)
+	action := createTestAction(db, "Test Action")
+	template := createTestJobTemplate(db, "http")
+
+	secret := &Secret{Name: "CLIENT_SECRET", Value: "hunter2"}
+	secret.SetUserID(1)
+	require.NoError(t, db.Create(secret).Error)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			fmt.Fprint(w, `{"access_token": "redacted-token-1", "expires_in": 3600}`)
+			return
+		}
+		// The token is echoed back
+		fmt.Fprintf(w, `{"authorization": %q}`, r.Header.Get("Authorization"))
+	}))
+	defer server.Close()
+
+	job := createTestJob(db, action.ID, template.ID, StaticJsonInput, fmt.Sprintf(
+		`{"url": %q, "method": "GET", "auth": {"type": "oauth2", "token_url": %q, "client_id": "cronny",
+		"client_secret_secret": "CLIENT_SECRET"}}`, server.URL+"/api", server.URL+"/token"), true)
+	job.ExecutionContext = newRunExecutionContext(t, db, action)
+
+	require.NoError(t, job.Execute(db))
+
+	var jobExecution JobExecution
+	require.NoError(t, db.Where("job_id = ?", job.ID).First(&jobExecution).Error)
+	assert.Equal(t, SucceededJobExecutionStatus, jobExecution.Status)
+	assert.NotContains(t, string(jobExecution.Output), "redacted-token-1")
+	assert.Contains(t, string(jobExecution.Output), "Bearer "+RedactedSecretValue)
+	assert.Equal(t, "Bearer "+RedactedSecretValue, job.ExecutionContext.JobOutputs[job.Name]["authorization"])
+}
+
+// failingOutputAction fails like a container exiting with a non-zero code,
+// with the logs of the command as its output
+type failingOutputAction struct{}
+
+func (failingOutputAction) RequiredKeys() []actions.ActionKey { return nil }
+
+func (failingOutputAction) Execute(input actions.Input) (actions.Output, error) {
+	return actions.Output{"exit_code": 2, "stderr": "file not found"}, errors.New("Container exited with code 2: file not found")
+}
+
+func TestJob_Execute_RecordsOutputOfFailedExecution(t *testing.T) {
+	JobMaps["failing_output"] = failingOutputAction{}
+	t.Cleanup(func() { delete(JobMaps, "failing_output") })
+	db := setupJobTestDB(t)
+	action := createTestAction(db, "Test Action")
+	template := createTestJobTemplate(db, "failing_output")
+
+	job := createTestJob(db, action.ID, template.ID, StaticJsonInput, `{}`, true)
+	job.ExecutionContext = newRunExecutionContext(t, db, action)
+
+	assert.ErrorContains(t, job.Execute(db), "Container exited with code 2")
+
+	var jobExecution JobExecution
+	require.NoError(t, db.Where("job_id = ?", job.ID).First(&jobExecution).Error)
+	assert.Equal(t, FailedJobExecutionStatus, jobExecution.Status)
+	assert.Equal(t, "Container exited with code 2: file not found", jobExecution.Error)
+	assert.JSONEq(t, `{"exit_code": 2, "stderr": "file not found"}`, string(jobExecution.Output))
+	assert.Equal(t, len(jobExecution.Output), jobExecution.OutputSize)
+	assert.Empty(t, job.InternalOutput, "Failed outputs aren't passed on to the next jobs")
+}
+
+func TestJob_Execute_SkippedWhenCancelled(t *testing.T) {
+	db := setupJobTestDB(t)
+	action := createTestAction(db, "Test Action")
+	template := createTestJobTemplate(db, "logger")
+
+	job := createTestJob(db, action.ID, template.ID, StaticJsonInput, `{"message": "hi"}`, true)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	job.ExecutionContext = newRunExecutionContext(t, db, action)
+	job.ExecutionContext.Ctx = ctx
+
+	err := job.Execute(db)
+	assert.ErrorIs(t, err, ErrJobSkipped)
+
+	var jobExecution JobExecution
+	require.NoError(t, db.Where("job_id = ?", job.ID).First(&jobExecution).Error)
+	assert.Equal(t, SkippedJobExecutionStatus, jobExecution.Status)
+}
+
+func TestJob_CreateJobExecution_CountsAttempts(t *testing.T) {
+	db := setupJobTestDB(t)
+	action := createTestAction(db, "Test Action")
+	template := createTestJobTemplate(db, "logger")
+
+	job := createTestJob(db, action.ID, template.ID, StaticJsonInput, `{}`, false)
+	job.ExecutionContext = newRunExecutionContext(t, db, action)
+
+	now := time.Now().UTC()
+	require.NoError(t, job.CreateJobExecution(db, now, now, nil, "", errors.New("boom")))
+	require.NoError(t, job.CreateJobExecution(db, now, now, nil, `{}`, nil))
+
+	var jobExecutions []*JobExecution
+	require.NoError(t, db.Where("job_id = ?", job.ID).Order("id").Find(&jobExecutions).Error)
+	require.Len(t, jobExecutions, 2)
+	assert.Equal(t, 1, jobExecutions[0].Attempt)
+	assert.Equal(t, 2, jobExecutions[1].Attempt)
+}
+
+// ==========================================================
+// TestJobExecutionStatusForError
+
+func TestJobExecutionStatusForError(t *testing.T) {
+	testCases := []struct {
+		name     string
+		err      error
+		expected JobExecutionStatusT
+	}{
+		{name: "Failed", err: errors.New("boom"), expected: FailedJobExecutionStatus},
+		{name: "Timed out", err: fmt.Errorf("%w after 1 seconds", ErrJobTimedOut), expected: TimedOutJobExecutionStatus},
+		{name: "Cancelled", err: fmt.Errorf("%w: %w", ErrJobCancelled, context.Canceled), expected: CancelledJobExecutionStatus},
+		{name: "Skipped", err: fmt.Errorf("%w: %w", ErrJobSkipped, context.Canceled), expected: SkippedJobExecutionStatus},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, jobExecutionStatusForError(tc.err))
+		})
+	}
+}
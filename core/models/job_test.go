@@ -27,6 +27,9 @@ func setupJobTestDB(t *testing.T) *gorm.DB {
 		&JobExecution{},
 		&Action{},
 		&User{},
+		&Secret{},
+		&RegistryCredential{},
+		&WorkflowRun{},
 	)
 	assert.NoError(t, err, "Failed to auto-migrate models")
 
@@ -191,6 +194,26 @@ func TestJob_BeforeSave_ValidatesJobTemplateAssociation(t *testing.T) {
 	assert.Contains(t, err.Error(), "JobTemplate is nil", "Error message should mention JobTemplate")
 }
 
+func TestJob_BeforeSave_ValidatesCondition(t *testing.T) {
+	db := setupJobTestDB(t)
+	action := createTestAction(db, "Test Action")
+	template := createTestJobTemplate(db, "logger")
+
+	job := &Job{
+		Name:          "Test Job",
+		ActionID:      action.ID,
+		JobTemplateID: template.ID,
+		JobInputType:  StaticJsonInput,
+		JobInputValue: `{}`,
+		Condition:     `{"condition_rules": [{"filters": [{"name": "status", "comparison_type": "approximately"}], "job_id": 1}]}`,
+	}
+	job.SetUserID(1)
+
+	err := db.Create(job).Error
+	assert.Error(t, err, "Should error for an unknown comparison type")
+	assert.Contains(t, err.Error(), "No matching comparison type found", "Error should mention the comparison type")
+}
+
 // ==========================================================
 // TestJob_GetInput
 
@@ -468,28 +491,33 @@ func TestJob_GetLatestJobExecution_NoExecutions(t *testing.T) {
 // ==========================================================
 // TestJob_CreateJobExecution
 
-// NOTE: Job.CreateJobExecution() currently has a bug - it doesn't set UserID on the JobExecution,
-// causing the BaseModel.BeforeSave() validation to fail. This should be fixed in production code.
-// For now, tests verify the current (buggy) behavior.
-
-func TestJob_CreateJobExecution_FailsDueToMissingUserID(t *testing.T) {
+func TestJob_CreateJobExecution_SetsUserAndWorkflowRun(t *testing.T) {
 	db := setupJobTestDB(t)
 	action := createTestAction(db, "Test Action")
 	template := createTestJobTemplate(db, "logger")
 
 	job := createTestJob(db, action.ID, template.ID, StaticJsonInput, `{}`, false)
+	run, err := NewWorkflowRun(db, action, nil)
+	assert.NoError(t, err)
+	job.ExecutionContext = NewExecutionContext(nil)
+	job.ExecutionContext.WorkflowRun = run
 
 	startTime := time.Now().UTC()
 	stopTime := startTime.Add(5 * time.Second)
 	output := JobOutputT(`{"status": "completed"}`)
 
-	// BUG: This currently fails because CreateJobExecution doesn't set UserID
-	err := job.CreateJobExecution(db, startTime, stopTime, output)
-	assert.Error(t, err, "CreateJobExecution currently errors due to missing UserID (known bug)")
-	assert.Contains(t, err.Error(), "user ID is required", "Should fail with user ID validation error")
+	err = job.CreateJobExecution(db, startTime, stopTime, actions.Input{}, output, nil)
+	assert.NoError(t, err, "CreateJobExecution should not error")
+
+	var foundExec JobExecution
+	assert.NoError(t, db.Where("job_id = ?", job.ID).First(&foundExec).Error)
+	assert.Equal(t, job.UserID, foundExec.UserID, "Execution should belong to the job's user")
+	assert.Equal(t, run.ID, foundExec.WorkflowRunID, "Execution should be attached to the run")
+	assert.Equal(t, SucceededJobExecutionStatus, foundExec.Status)
+	assert.Equal(t, len(output), foundExec.OutputSize)
+	assert.Equal(t, 1, foundExec.Attempt)
 }
 
-// This test shows how CreateJobExecution should work once the bug is fixed
 func TestJobExecution_DirectCreation(t *testing.T) {
 	db := setupJobTestDB(t)
 	action := createTestAction(db, "Test Action")
@@ -795,7 +823,7 @@ func TestJob_Next_NextJobNotFound(t *testing.T) {
 // and dependency on ExecuteJobTemplate. These tests verify the flow without
 // infinite recursion by using simple logger templates and minimal conditions.
 
-func TestJob_Execute_FailsDueToCreateJobExecutionBug(t *testing.T) {
+func TestJob_Execute_TerminalJob(t *testing.T) {
 	db := setupJobTestDB(t)
 	action := createTestAction(db, "Test Action")
 	template := createTestJobTemplate(db, "logger")
@@ -805,13 +833,10 @@ func TestJob_Execute_FailsDueToCreateJobExecutionBug(t *testing.T) {
 	job.Condition = `{"rules": []}`
 	db.Save(job)
 
-	// NOTE: This currently fails due to CreateJobExecution bug (missing UserID)
-	// Once that's fixed, this test should verify that execution is created even if Next() fails
 	err := job.Execute(db)
-	assert.Error(t, err, "Execute currently fails due to CreateJobExecution bug")
+	assert.NoError(t, err, "Execute should stop at a job without any rules")
 
-	// Once CreateJobExecution bug is fixed, uncomment these lines:
-	// var execCount int64
-	// db.Model(&JobExecution{}).Where("job_id = ?", job.ID).Count(&execCount)
-	// assert.Greater(t, execCount, int64(0), "Should create job execution even if Next() fails")
+	var execCount int64
+	db.Model(&JobExecution{}).Where("job_id = ?", job.ID).Count(&execCount)
+	assert.Equal(t, int64(1), execCount, "Should create a job execution")
 }
@@ -2,6 +2,9 @@ package models
 
 import (
 	"time"
+
+	"github.com/cronny/core/actions"
+	"github.com/cronny/core/helpers"
 )
 
 type PlanType string
@@ -19,8 +22,15 @@ type Plan struct {
 	Price       float64   `json:"price"`
 	Description string    `json:"description"`
 	Features    []Feature `json:"features" gorm:"many2many:plan_features;"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+
+	// Docker jobs limits, 0 is the limit set by the admin
+	DockerMaxCpus     float64 `json:"docker_max_cpus"`
+	DockerMaxMemoryMB int64   `json:"docker_max_memory_mb"`
+	DockerMaxPids     int64   `json:"docker_max_pids"`
+	DockerMaxDiskMB   int64   `json:"docker_max_disk_mb"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
 }
 
 type Feature struct {
@@ -37,6 +47,17 @@ type PlanFeatures struct {
 	FeatureID uint `gorm:"primaryKey"`
 }
 
+// DockerLimits returns the most resources the Docker jobs of the plan's
+// users can use. The plan can't exceed the admin's limits.
+func (plan *Plan) DockerLimits(admin helpers.DockerLimits) (limits helpers.DockerLimits) {
+	limits = admin
+	limits.Cpus = actions.MinDockerLimit(admin.Cpus, plan.DockerMaxCpus)
+	limits.MemoryMB = actions.MinDockerLimit(admin.MemoryMB, plan.DockerMaxMemoryMB)
+	limits.Pids = actions.MinDockerLimit(admin.Pids, plan.DockerMaxPids)
+	limits.DiskMB = actions.MinDockerLimit(admin.DiskMB, plan.DockerMaxDiskMB)
+	return
+}
+
 // GetDefaultPlans returns the default plans with their features
 func GetDefaultPlans() []Plan {
 	return []Plan{
@@ -45,6 +66,10 @@ func GetDefaultPlans() []Plan {
 			Type:        PlanTypeStarter,
 			Price:       0,
 			Description: "Perfect for small projects",
+
+			DockerMaxCpus:     0.5,
+			DockerMaxMemoryMB: 256,
+			DockerMaxPids:     128,
 			Features: []Feature{
 				{Name: "Up to 10 jobs", Description: "Create and manage up to 10 jobs"},
 				{Name: "Basic scheduling", Description: "Basic scheduling capabilities"},
@@ -57,6 +82,10 @@ func GetDefaultPlans() []Plan {
 			Type:        PlanTypePro,
 			Price:       29,
 			Description: "For growing teams",
+
+			DockerMaxCpus:     1,
+			DockerMaxMemoryMB: 1024,
+			DockerMaxPids:     256,
 			Features: []Feature{
 				{Name: "Unlimited jobs", Description: "Create and manage unlimited jobs"},
 				{Name: "Advanced scheduling", Description: "Advanced scheduling capabilities"},
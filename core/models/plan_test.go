@@ -0,0 +1,48 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cronny/core/actions"
+	"github.com/cronny/core/helpers"
+)
+
+// ==========================================================
+// TestPlan_DockerLimits
+
+func TestPlan_DockerLimits(t *testing.T) {
+	admin := helpers.DockerLimits{Cpus: 1, MemoryMB: 512, Pids: 256, NetworkMode: "none", User: "65534:65534", ReadOnlyRootfs: true}
+
+	// The plan can lower the admin's limits but not raise them
+	plan := &Plan{DockerMaxCpus: 0.5, DockerMaxMemoryMB: 1024, DockerMaxDiskMB: 100}
+	assert.Equal(t, helpers.DockerLimits{Cpus: 0.5, MemoryMB: 512, Pids: 256, DiskMB: 100,
+		NetworkMode: "none", User: "65534:65534", ReadOnlyRootfs: true}, plan.DockerLimits(admin))
+
+	// A plan without limits has the admin's limits
+	assert.Equal(t, admin, (&Plan{}).DockerLimits(admin))
+}
+
+func TestJob_DockerLimits(t *testing.T) {
+	db := setupJobTestDB(t)
+	require.NoError(t, db.AutoMigrate(&Plan{}))
+	action := createTestAction(db, "Test Action")
+	template := createTestJobTemplate(db, "docker-registry")
+	job := createTestJob(db, action.ID, template.ID, StaticJsonInput, `{"image": "alpine"}`, true)
+
+	// Users which can't be found have the admin's limits
+	limits, err := job.dockerLimits(db)
+	require.NoError(t, err)
+	assert.Equal(t, actions.AdminDockerLimits(), limits)
+
+	plan := &Plan{Name: "Starter", Type: PlanTypeStarter, DockerMaxCpus: 0.1, DockerMaxMemoryMB: 64}
+	require.NoError(t, db.Create(plan).Error)
+	require.NoError(t, db.Create(&User{ID: job.UserID, Username: "alice", Email: "alice@example.com", PlanID: plan.ID}).Error)
+
+	limits, err = job.dockerLimits(db)
+	require.NoError(t, err)
+	assert.Equal(t, 0.1, limits.Cpus)
+	assert.Equal(t, int64(64), limits.MemoryMB)
+}
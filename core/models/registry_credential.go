@@ -0,0 +1,206 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"gorm.io/gorm"
+
+	"github.com/cronny/core/actions"
+	"github.com/cronny/core/config"
+	"github.com/cronny/core/helpers"
+)
+
+type (
+	// RegistryCredential is a named login to a container registry owned by
+	// a user, which Docker jobs refer to instead of having the username and
+	// password as part of their input. Only the encrypted password is stored
+	// and neither of them are returned via the API.
+	RegistryCredential struct {
+		BaseModel
+
+		Name string `json:"name" gorm:"index"`
+		// Registry is the host of the registry, eg. ghcr.io. The credential
+		// is only sent to it.
+		Registry string `json:"registry"`
+		Username string `json:"username"`
+
+		// Password is the plaintext password which is encrypted before saving
+		Password          string `json:"-" gorm:"-"`
+		EncryptedPassword string `json:"-"`
+
+		User *User `json:"user"`
+	}
+)
+
+// ==========================================================
+// RegistryCredentials
+
+func (credential *RegistryCredential) validate(db *gorm.DB) (err error) {
+	var (
+		count int64
+	)
+	if !secretNameRegex.MatchString(credential.Name) {
+		err = fmt.Errorf("Registry credential name %s should only contain letters, digits and underscores", credential.Name)
+		return
+	}
+	if credential.Registry == "" || credential.Username == "" {
+		err = fmt.Errorf("Registry credential %s should have a registry and a username", credential.Name)
+		return
+	}
+	if ex := db.Session(&gorm.Session{NewDB: true}).Model(&RegistryCredential{}).Where(
+		"user_id = ? AND name = ? AND id != ?", credential.UserID, credential.Name, credential.ID,
+	).Count(&count); ex.Error != nil {
+		err = ex.Error
+		return
+	}
+	if count > 0 {
+		err = fmt.Errorf("Registry credential with name %s already exists", credential.Name)
+		return
+	}
+	return
+}
+
+func (credential *RegistryCredential) BeforeSave(db *gorm.DB) (err error) {
+	if err = credential.ValidateUserID(); err != nil {
+		return
+	}
+	if err = credential.validate(db); err != nil {
+		return
+	}
+	if credential.Password == "" && credential.EncryptedPassword == "" {
+		err = fmt.Errorf("Registry credential %s has no password", credential.Name)
+		return
+	}
+	if credential.Password == "" {
+		return
+	}
+	if credential.EncryptedPassword, err = helpers.Encrypt(config.SecretsEncryptionKey, credential.Password); err != nil {
+		return
+	}
+	credential.Password = ""
+	return
+}
+
+// GetRegistryCredential returns the user's registry credential with its
+// plaintext password
+func GetRegistryCredential(db *gorm.DB, userID uint, name string) (credential *RegistryCredential, err error) {
+	credential = &RegistryCredential{}
+	if ex := db.Session(&gorm.Session{NewDB: true}).Where("user_id = ? AND name = ?", userID, name).First(credential); ex.Error != nil {
+		err = fmt.Errorf("failed to get registry credential %s: %w", name, ex.Error)
+		return
+	}
+	if credential.Password, err = helpers.Decrypt(config.SecretsEncryptionKey, credential.EncryptedPassword); err != nil {
+		err = fmt.Errorf("failed to decrypt registry credential %s: %w", name, err)
+		return
+	}
+	return
+}
+
+// MigrateRegistryCredentials moves the plaintext registry_username and
+// registry_password of Docker jobs to registry credentials of their users,
+// which the jobs then refer to with registry_credentials. Only static inputs
+// can be rewritten, the jobs rendering them from a template are logged.
+// It's run on every start and leaves the migrated jobs as they are.
+func MigrateRegistryCredentials(db *gorm.DB) (err error) {
+	var (
+		jobs []*Job
+	)
+	if ex := db.Joins("JOIN job_templates ON job_templates.id = jobs.job_template_id").Where(
+		"job_templates.name = ? AND jobs.job_input_value LIKE ?", "docker-registry", "%registry_password%",
+	).Find(&jobs); ex.Error != nil {
+		err = ex.Error
+		return
+	}
+	for _, job := range jobs {
+		if job.JobInputType != StaticJsonInput {
+			log.Printf("Job %s (ID: %d) has registry credentials in its %s input, they should be moved to registry_credentials", job.Name, job.ID, job.JobInputType)
+			continue
+		}
+		// The jobs which can't be migrated keep working with their
+		// plaintext credentials
+		if migrateErr := db.Transaction(func(tx *gorm.DB) error {
+			return migrateJobRegistryCredentials(tx, job)
+		}); migrateErr != nil {
+			log.Printf("Failed to migrate the registry credentials of job %s (ID: %d): %v", job.Name, job.ID, migrateErr)
+		}
+	}
+	return
+}
+
+// migrateJobRegistryCredentials replaces the plaintext credentials of the
+// job's input with the user's registry credential having the same login,
+// which is created when there's none
+func migrateJobRegistryCredentials(db *gorm.DB, job *Job) (err error) {
+	var (
+		input      actions.Input
+		inputB     []byte
+		credential *RegistryCredential
+	)
+	if err = json.Unmarshal([]byte(job.JobInputValue), &input); err != nil {
+		return
+	}
+	username, _ := input["registry_username"].(string)
+	password, _ := input["registry_password"].(string)
+	if username == "" || password == "" {
+		return
+	}
+	// The credentials were sent to Docker Hub when there's no registry
+	registry, _ := input["registry"].(string)
+	if registry == "" {
+		registry = "docker.io"
+	}
+
+	if credential, err = findRegistryCredential(db, job.UserID, registry, username, password); err != nil {
+		return
+	}
+	if credential == nil {
+		credential = &RegistryCredential{
+			Name:     fmt.Sprintf("JOB_%d_REGISTRY", job.ID),
+			Registry: registry,
+			Username: username,
+			Password: password,
+		}
+		credential.SetUserID(job.UserID)
+		if ex := db.Create(credential); ex.Error != nil {
+			err = ex.Error
+			return
+		}
+	}
+
+	delete(input, "registry_username")
+	delete(input, "registry_password")
+	input["registry_credentials"] = credential.Name
+	if inputB, err = json.Marshal(input); err != nil {
+		return
+	}
+	// The job is saved as is, the validations of its other fields don't
+	// apply to the migration
+	if ex := db.Model(&Job{}).Where("id = ?", job.ID).UpdateColumn("job_input_value", string(inputB)); ex.Error != nil {
+		err = ex.Error
+		return
+	}
+	log.Printf("Moved the registry credentials of job %s (ID: %d) to %s", job.Name, job.ID, credential.Name)
+	return
+}
+
+// findRegistryCredential returns the user's registry credential with the
+// login, nil when there's none
+func findRegistryCredential(db *gorm.DB, userID uint, registry, username, password string) (credential *RegistryCredential, err error) {
+	var (
+		credentials []*RegistryCredential
+	)
+	if ex := db.Where("user_id = ? AND registry = ? AND username = ?", userID, registry, username).Find(&credentials); ex.Error != nil {
+		err = ex.Error
+		return
+	}
+	for _, existing := range credentials {
+		decrypted, decryptErr := helpers.Decrypt(config.SecretsEncryptionKey, existing.EncryptedPassword)
+		if decryptErr == nil && decrypted == password {
+			credential = existing
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,125 @@
+package models
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ==========================================================
+// TestRegistryCredential_BeforeSave
+
+func TestRegistryCredential_BeforeSave_EncryptsPassword(t *testing.T) {
+	db := setupJobTestDB(t)
+
+	credential := &RegistryCredential{Name: "GHCR", Registry: "ghcr.io", Username: "cronny", Password: "s3cr3t"}
+	credential.SetUserID(1)
+	require.NoError(t, db.Create(credential).Error)
+
+	stored := &RegistryCredential{}
+	require.NoError(t, db.First(stored, credential.ID).Error)
+	assert.Empty(t, stored.Password, "Plaintext password shouldn't be stored")
+	assert.NotContains(t, stored.EncryptedPassword, "s3cr3t")
+
+	resolved, err := GetRegistryCredential(db, 1, "GHCR")
+	require.NoError(t, err)
+	assert.Equal(t, "ghcr.io", resolved.Registry)
+	assert.Equal(t, "cronny", resolved.Username)
+	assert.Equal(t, "s3cr3t", resolved.Password)
+
+	_, err = GetRegistryCredential(db, 2, "GHCR")
+	assert.Error(t, err, "Credentials of other users shouldn't be resolved")
+}
+
+func TestRegistryCredential_BeforeSave_Validations(t *testing.T) {
+	db := setupJobTestDB(t)
+
+	existing := &RegistryCredential{Name: "GHCR", Registry: "ghcr.io", Username: "cronny", Password: "s3cr3t"}
+	existing.SetUserID(1)
+	require.NoError(t, db.Create(existing).Error)
+
+	testCases := []struct {
+		name       string
+		credential *RegistryCredential
+		userID     uint
+	}{
+		{name: "Missing user", credential: &RegistryCredential{Name: "HUB", Registry: "docker.io", Username: "u", Password: "x"}},
+		{name: "Invalid name", credential: &RegistryCredential{Name: "docker-hub", Registry: "docker.io", Username: "u", Password: "x"}, userID: 1},
+		{name: "Missing registry", credential: &RegistryCredential{Name: "HUB", Username: "u", Password: "x"}, userID: 1},
+		{name: "Missing username", credential: &RegistryCredential{Name: "HUB", Registry: "docker.io", Password: "x"}, userID: 1},
+		{name: "Missing password", credential: &RegistryCredential{Name: "HUB", Registry: "docker.io", Username: "u"}, userID: 1},
+		{name: "Duplicate name", credential: &RegistryCredential{Name: "GHCR", Registry: "ghcr.io", Username: "u", Password: "x"}, userID: 1},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.credential.SetUserID(tc.userID)
+			assert.Error(t, db.Create(tc.credential).Error)
+		})
+	}
+}
+
+func TestJob_RegistryCredentialsGetter(t *testing.T) {
+	db := setupJobTestDB(t)
+	action := createTestAction(db, "Test Action")
+	template := createTestJobTemplate(db, "docker-registry")
+	job := createTestJob(db, action.ID, template.ID, StaticJsonInput, `{"image": "cronny/app", "registry_credentials": "GHCR"}`, true)
+
+	credential := &RegistryCredential{Name: "GHCR", Registry: "ghcr.io", Username: "cronny", Password: "s3cr3t"}
+	credential.SetUserID(job.UserID)
+	require.NoError(t, db.Create(credential).Error)
+
+	credentials, err := job.registryCredentialsGetter(db)("GHCR")
+	require.NoError(t, err)
+	assert.Equal(t, "ghcr.io", credentials.Registry)
+	assert.Equal(t, "s3cr3t", credentials.Password)
+	assert.Equal(t, "pulling as [REDACTED]", job.executionContext().Redact("pulling as s3cr3t"))
+}
+
+// ==========================================================
+// TestMigrateRegistryCredentials
+
+func TestMigrateRegistryCredentials(t *testing.T) {
+	db := setupJobTestDB(t)
+	action := createTestAction(db, "Test Action")
+	template := createTestJobTemplate(db, "docker-registry")
+
+	legacyInput := `{"image": "cronny/app", "registry": "ghcr.io", "registry_username": "cronny", "registry_password": "s3cr3t"}`
+	first := createTestJob(db, action.ID, template.ID, StaticJsonInput, legacyInput, true)
+	second := createTestJob(db, action.ID, template.ID, StaticJsonInput, legacyInput, false)
+	hub := createTestJob(db, action.ID, template.ID, StaticJsonInput, `{"image": "cronny/app", "registry_username": "cronny", "registry_password": "hunter2"}`, false)
+	templated := createTestJob(db, action.ID, template.ID, JobInputAsGoTemplate, legacyInput, false)
+
+	require.NoError(t, MigrateRegistryCredentials(db))
+
+	var migrated Job
+	require.NoError(t, db.First(&migrated, first.ID).Error)
+	assert.JSONEq(t, `{"image": "cronny/app", "registry": "ghcr.io", "registry_credentials": "JOB_`+fmt.Sprint(first.ID)+`_REGISTRY"}`, migrated.JobInputValue)
+	credential, err := GetRegistryCredential(db, first.UserID, fmt.Sprintf("JOB_%d_REGISTRY", first.ID))
+	require.NoError(t, err)
+	assert.Equal(t, "ghcr.io", credential.Registry)
+	assert.Equal(t, "cronny", credential.Username)
+	assert.Equal(t, "s3cr3t", credential.Password)
+
+	// Jobs with the same login share the credential
+	var shared Job
+	require.NoError(t, db.First(&shared, second.ID).Error)
+	assert.Contains(t, shared.JobInputValue, credential.Name)
+
+	// The credentials were sent to Docker Hub without a registry
+	credential, err = GetRegistryCredential(db, hub.UserID, fmt.Sprintf("JOB_%d_REGISTRY", hub.ID))
+	require.NoError(t, err)
+	assert.Equal(t, "docker.io", credential.Registry)
+	assert.Equal(t, "hunter2", credential.Password)
+
+	var unchanged Job
+	require.NoError(t, db.First(&unchanged, templated.ID).Error)
+	assert.Equal(t, legacyInput, unchanged.JobInputValue, "Templated inputs can't be rewritten")
+
+	// Migrating again changes nothing
+	require.NoError(t, MigrateRegistryCredentials(db))
+	var count int64
+	require.NoError(t, db.Model(&RegistryCredential{}).Count(&count).Error)
+	assert.Equal(t, int64(2), count)
+}
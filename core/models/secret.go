@@ -0,0 +1,99 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+
+	"gorm.io/gorm"
+
+	"github.com/cronny/core/config"
+	"github.com/cronny/core/helpers"
+)
+
+var (
+	secretNameRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+type (
+	// Secret is a named value owned by a user which jobs can refer to
+	// without it being part of the job's input. Only the encrypted
+	// value is stored and neither of them are returned via the API.
+	Secret struct {
+		BaseModel
+
+		Name string `json:"name" gorm:"index"`
+
+		// Value is the plaintext value which is encrypted before saving
+		Value          string `json:"-" gorm:"-"`
+		EncryptedValue string `json:"-"`
+
+		User *User `json:"user"`
+	}
+)
+
+// ==========================================================
+// Secrets
+
+func (secret *Secret) validateName(db *gorm.DB) (err error) {
+	var (
+		count int64
+	)
+	if !secretNameRegex.MatchString(secret.Name) {
+		err = fmt.Errorf("Secret name %s should only contain letters, digits and underscores", secret.Name)
+		return
+	}
+	if ex := db.Session(&gorm.Session{NewDB: true}).Model(&Secret{}).Where(
+		"user_id = ? AND name = ? AND id != ?", secret.UserID, secret.Name, secret.ID,
+	).Count(&count); ex.Error != nil {
+		err = ex.Error
+		return
+	}
+	if count > 0 {
+		err = fmt.Errorf("Secret with name %s already exists", secret.Name)
+		return
+	}
+	return
+}
+
+func (secret *Secret) BeforeSave(db *gorm.DB) (err error) {
+	if err = secret.ValidateUserID(); err != nil {
+		return
+	}
+	if err = secret.validateName(db); err != nil {
+		return
+	}
+	if secret.Value == "" && secret.EncryptedValue == "" {
+		err = fmt.Errorf("Secret %s has no value", secret.Name)
+		return
+	}
+	if secret.Value == "" {
+		return
+	}
+	if secret.EncryptedValue, err = helpers.Encrypt(config.SecretsEncryptionKey, secret.Value); err != nil {
+		return
+	}
+	secret.Value = ""
+	return
+}
+
+// Decrypt returns the plaintext value of the secret
+func (secret *Secret) Decrypt() (value string, err error) {
+	if value, err = helpers.Decrypt(config.SecretsEncryptionKey, secret.EncryptedValue); err != nil {
+		err = fmt.Errorf("failed to decrypt secret %s: %w", secret.Name, err)
+		return
+	}
+	return
+}
+
+// GetSecretValue returns the plaintext value of the user's secret
+func GetSecretValue(db *gorm.DB, userID uint, name string) (value string, err error) {
+	secret := &Secret{}
+	if ex := db.Session(&gorm.Session{NewDB: true}).Where("user_id = ? AND name = ?", userID, name).First(secret); ex.Error != nil {
+		err = fmt.Errorf("failed to get secret %s: %w", name, ex.Error)
+		return
+	}
+	if value, err = secret.Decrypt(); err != nil {
+		return
+	}
+	return
+}
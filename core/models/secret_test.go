@@ -0,0 +1,62 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ==========================================================
+// TestSecret_BeforeSave
+
+func TestSecret_BeforeSave_EncryptsValue(t *testing.T) {
+	db := setupJobTestDB(t)
+
+	secret := &Secret{Name: "API_TOKEN", Value: "s3cr3t"}
+	secret.SetUserID(1)
+	require.NoError(t, db.Create(secret).Error)
+
+	stored := &Secret{}
+	require.NoError(t, db.First(stored, secret.ID).Error)
+	assert.Empty(t, stored.Value, "Plaintext value shouldn't be stored")
+	assert.NotEmpty(t, stored.EncryptedValue)
+	assert.NotContains(t, stored.EncryptedValue, "s3cr3t")
+
+	value, err := GetSecretValue(db, 1, "API_TOKEN")
+	assert.NoError(t, err)
+	assert.Equal(t, "s3cr3t", value)
+
+	_, err = GetSecretValue(db, 2, "API_TOKEN")
+	assert.Error(t, err, "Secrets of other users shouldn't be resolved")
+}
+
+func TestSecret_BeforeSave_Validations(t *testing.T) {
+	db := setupJobTestDB(t)
+
+	existing := &Secret{Name: "API_TOKEN", Value: "s3cr3t"}
+	existing.SetUserID(1)
+	require.NoError(t, db.Create(existing).Error)
+
+	testCases := []struct {
+		name   string
+		secret *Secret
+		userID uint
+	}{
+		{name: "Missing user", secret: &Secret{Name: "TOKEN", Value: "x"}},
+		{name: "Invalid name", secret: &Secret{Name: "my-token", Value: "x"}, userID: 1},
+		{name: "Missing value", secret: &Secret{Name: "TOKEN"}, userID: 1},
+		{name: "Duplicate name", secret: &Secret{Name: "API_TOKEN", Value: "x"}, userID: 1},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.secret.SetUserID(tc.userID)
+			assert.Error(t, db.Create(tc.secret).Error)
+		})
+	}
+
+	// The same name can be used by a different user
+	other := &Secret{Name: "API_TOKEN", Value: "x"}
+	other.SetUserID(2)
+	assert.NoError(t, db.Create(other).Error)
+}
@@ -23,6 +23,13 @@ type (
 		Result            string   `json:"-"`
 		lastModifiedIndex int      `json:"-"`
 	}
+
+	// JobReference is a parsed "job__NAME__output__KEY" reference
+	// present in a JobInputTemplate
+	JobReference struct {
+		JobName   string `json:"job_name"`
+		OutputKey string `json:"output_key"`
+	}
 )
 
 func NewJobInputTemplate(db *gorm.DB, job *Job, searchPool string) (inpTemplate *JobInputTemplate, err error) {
@@ -60,31 +67,96 @@ func (inpTemplate *JobInputTemplate) validateElem(matchedStr string) (err error)
 	return
 }
 
+func (inpTemplate *JobInputTemplate) matchedStr(matchedElem []int) (matchedStr string) {
+	matchedStr = strings.TrimSpace(inpTemplate.SearchPool[matchedElem[2]:matchedElem[3]])
+	return
+}
+
+func (inpTemplate *JobInputTemplate) parseReference(matchedStr string) (ref *JobReference, err error) {
+	if err = inpTemplate.validateElem(matchedStr); err != nil {
+		return
+	}
+	matchedSp := strings.Split(matchedStr, KeywordDelimiter)
+	if len(matchedSp) < 4 {
+		err = fmt.Errorf("Output key missing for matched string %s", matchedStr)
+		return
+	}
+	ref = &JobReference{
+		JobName:   strings.TrimSpace(matchedSp[1]),
+		OutputKey: strings.TrimSpace(strings.Join(matchedSp[3:], KeywordDelimiter)),
+	}
+	return
+}
+
+// References returns all the job references present in the template
+// without resolving them
+func (inpTemplate *JobInputTemplate) References() (refs []*JobReference, err error) {
+	var (
+		matches [][]int
+		ref     *JobReference
+	)
+	if matches, err = inpTemplate.findMatchingIndexes(); err != nil {
+		return
+	}
+	for _, matchedElem := range matches {
+		if ref, err = inpTemplate.parseReference(inpTemplate.matchedStr(matchedElem)); err != nil {
+			return
+		}
+		refs = append(refs, ref)
+	}
+	return
+}
+
 func (inpTemplate *JobInputTemplate) findElem(matchedElem []int) (elemStr string, err error) {
 	var (
 		latestJobExec *JobExecution
 		jobOutput     actions.Output
+		ref           *JobReference
 	)
 	jobOutput = make(actions.Output)
-	matchedStr := inpTemplate.SearchPool[matchedElem[2]+1 : matchedElem[3]-1]
-	if inpTemplate.validateElem(matchedStr); err != nil {
+	if ref, err = inpTemplate.parseReference(inpTemplate.matchedStr(matchedElem)); err != nil {
 		return
 	}
-	matchedSp := strings.Split(matchedStr, KeywordDelimiter)
 	referredJob := &Job{}
 
 	if ex := inpTemplate.db.Where("action_id = ? AND name = ?",
-		inpTemplate.Job.ActionID, matchedSp[1]).First(referredJob); ex.Error != nil {
+		inpTemplate.Job.ActionID, ref.JobName).First(referredJob); ex.Error != nil {
 		err = ex.Error
 		return
 	}
-	if latestJobExec, err = referredJob.GetLatestJobExecution(inpTemplate.db); err != nil {
+	if latestJobExec, err = inpTemplate.Job.executionContext().LatestJobExecution(inpTemplate.db, referredJob); err != nil {
 		return
 	}
 	if err = json.Unmarshal([]byte(string(latestJobExec.Output)), &jobOutput); err != nil {
 		return
 	}
-	elemStr = jobOutput[strings.TrimSpace(matchedSp[3])].(string)
+	if elemStr, err = ref.Resolve(jobOutput); err != nil {
+		return
+	}
+	return
+}
+
+// Resolve finds the value referred to by the output key in the job output.
+// The output key can be a top level key or a path like "data.items[0].id".
+// Strings are substituted as is while other values are substituted as JSON.
+func (ref *JobReference) Resolve(jobOutput actions.Output) (elemStr string, err error) {
+	var (
+		elem      interface{}
+		isPresent bool
+		elemB     []byte
+	)
+	if elem, isPresent = lookupInput(actions.Input(jobOutput), ref.OutputKey); !isPresent {
+		err = fmt.Errorf("Output key %s not present in output of job %s", ref.OutputKey, ref.JobName)
+		return
+	}
+	if str, isStr := elem.(string); isStr {
+		elemStr = str
+		return
+	}
+	if elemB, err = json.Marshal(elem); err != nil {
+		return
+	}
+	elemStr = string(elemB)
 	return
 }
 
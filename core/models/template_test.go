@@ -0,0 +1,71 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// ==========================================================
+// TestJobInputTemplate_Parse
+
+func TestJobInputTemplate_Parse(t *testing.T) {
+	db := setupJobTestDB(t)
+	action := createTestAction(db, "Test Action")
+	template := createTestJobTemplate(db, "logger")
+	createJobWithExecution(db, action.ID, template.ID, "fetch", JobOutputT(`{
+		"title": "hello",
+		"count": 3,
+		"ok": true,
+		"data": {"items": [{"id": 7, "tags": ["a", "b"]}]}
+	}`))
+
+	testCases := []struct {
+		name           string
+		searchPool     string
+		expectedResult string
+		shouldError    bool
+	}{
+		{
+			name:           "Top level string",
+			searchPool:     `{"message": "<< job__fetch__output__title >>"}`,
+			expectedResult: `{"message": "hello"}`,
+		},
+		{
+			name:           "Non string values",
+			searchPool:     `{"count": << job__fetch__output__count >>, "ok": << job__fetch__output__ok >>}`,
+			expectedResult: `{"count": 3, "ok": true}`,
+		},
+		{
+			name:           "Nested path",
+			searchPool:     `{"id": << job__fetch__output__data.items[0].id >>}`,
+			expectedResult: `{"id": 7}`,
+		},
+		{
+			name:           "Nested array",
+			searchPool:     `{"tags": << job__fetch__output__$.data.items[0].tags >>}`,
+			expectedResult: `{"tags": ["a","b"]}`,
+		},
+		{
+			name:        "Missing key",
+			searchPool:  `{"message": "<< job__fetch__output__missing >>"}`,
+			shouldError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			job := createTestJob(db, action.ID, template.ID, JobInputAsTemplate, tc.searchPool, false)
+			inpTemplate, err := NewJobInputTemplate(db, job, tc.searchPool)
+			assert.NoError(t, err)
+
+			result, err := inpTemplate.Parse()
+			if tc.shouldError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedResult, result)
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"context"
 	"log"
 	"time"
 
@@ -59,8 +60,16 @@ func (trigger *Trigger) UpdateStatus(db *gorm.DB, status TriggerStatusT) (err er
 }
 
 func (trigger *Trigger) Execute(db *gorm.DB) (err error) {
+	return trigger.ExecuteContext(context.Background(), db)
+}
+
+// ExecuteContext executes the trigger's action. The jobs which haven't
+// finished executing when ctx is done are recorded as cancelled or skipped.
+func (trigger *Trigger) ExecuteContext(ctx context.Context, db *gorm.DB) (err error) {
 	log.Println("Executing Trigger for Schedule", trigger.Schedule.Name, "with ID", trigger.ScheduleID)
-	if err = trigger.Schedule.Action.Execute(db); err != nil {
+	execCtx := NewExecutionContext(trigger)
+	execCtx.Ctx = ctx
+	if err = trigger.Schedule.Action.ExecuteWithContext(db, execCtx); err != nil {
 		return
 	}
 	return
@@ -24,6 +24,8 @@ func setupTriggerTestDB(t *testing.T) *gorm.DB {
 		&Job{},
 		&JobTemplate{},
 		&User{},
+		&JobExecution{},
+		&WorkflowRun{},
 	)
 	assert.NoError(t, err, "Failed to auto-migrate models")
 
@@ -318,7 +320,7 @@ func TestTrigger_Execute_DelegatesToActionExecute(t *testing.T) {
 	template.SetUserID(1)
 	db.Create(template)
 
-	// Create a root job for the action (with condition that will fail, but that's okay)
+	// Create a terminal root job for the action
 	job := &Job{
 		Name:             "Root Job",
 		ActionID:         action.ID,
@@ -338,11 +340,15 @@ func TestTrigger_Execute_DelegatesToActionExecute(t *testing.T) {
 	// Reload trigger with associations
 	db.Preload("Schedule.Action").First(trigger, trigger.ID)
 
-	// Execute will fail (due to CreateJobExecution bug or Next() logic), but we're testing the delegation
 	err := trigger.Execute(db)
-
-	// We expect an error, but the important thing is that it attempted to execute
-	assert.Error(t, err, "Execute will error due to underlying job execution issues")
+	assert.NoError(t, err, "Execute should execute the action's jobs")
+
+	// The run should be attached to the trigger
+	var run WorkflowRun
+	assert.NoError(t, db.Preload("JobExecutions").Where("trigger_id = ?", trigger.ID).First(&run).Error)
+	assert.Equal(t, action.ID, run.ActionID)
+	assert.Equal(t, SucceededWorkflowRunStatus, run.Status)
+	assert.Len(t, run.JobExecutions, 1)
 }
 
 func TestTrigger_Execute_RequiresSchedulePreload(t *testing.T) {
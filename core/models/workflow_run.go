@@ -0,0 +1,89 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// Workflow Run Status
+	RunningWorkflowRunStatus   = WorkflowRunStatusT("running")
+	SucceededWorkflowRunStatus = WorkflowRunStatusT("succeeded")
+	FailedWorkflowRunStatus    = WorkflowRunStatusT("failed")
+)
+
+type (
+	WorkflowRunStatusT string
+
+	// WorkflowRun is a single execution of the jobs of an Action, usually
+	// for a Trigger. Every JobExecution of the run is attached to it so that
+	// jobs only read the outputs of the jobs executed in the same run.
+	WorkflowRun struct {
+		BaseModel
+
+		ActionID uint    `json:"action_id" gorm:"index"`
+		Action   *Action `json:"action,omitempty"`
+
+		// TriggerID is 0 for runs which weren't started by a Trigger
+		TriggerID uint     `json:"trigger_id" gorm:"index"`
+		Trigger   *Trigger `json:"trigger,omitempty"`
+
+		Status WorkflowRunStatusT `json:"status" gorm:"index"`
+		Error  string             `json:"error"`
+
+		StartedAt  time.Time `json:"started_at" gorm:"type:TIMESTAMP;null;default:null"`
+		FinishedAt time.Time `json:"finished_at" gorm:"type:TIMESTAMP;null;default:null"`
+
+		JobExecutions []*JobExecution `json:"job_executions"`
+
+		User *User `json:"user,omitempty"`
+	}
+)
+
+// ==========================================================
+// WorkflowRuns
+
+func NewWorkflowRun(db *gorm.DB, action *Action, trigger *Trigger) (run *WorkflowRun, err error) {
+	run = &WorkflowRun{
+		ActionID:  action.ID,
+		Status:    RunningWorkflowRunStatus,
+		StartedAt: time.Now().UTC(),
+	}
+	run.SetUserID(action.UserID)
+	if trigger != nil {
+		run.TriggerID = trigger.ID
+	}
+	if ex := db.Create(run); ex.Error != nil {
+		err = ex.Error
+		return
+	}
+	return
+}
+
+// Finish marks the run as succeeded or failed depending on the error
+// returned while executing its jobs. The secrets resolved in the execution
+// context are redacted from the error, like they are for the executions.
+func (run *WorkflowRun) Finish(db *gorm.DB, execCtx *ExecutionContext, execErr error) (err error) {
+	run.Status = SucceededWorkflowRunStatus
+	run.FinishedAt = time.Now().UTC()
+	if execErr != nil {
+		run.Status = FailedWorkflowRunStatus
+		run.Error = execCtx.Redact(execErr.Error())
+	}
+	if ex := db.Model(run).Select("status", "error", "finished_at").Updates(run); ex.Error != nil {
+		err = ex.Error
+		return
+	}
+	return
+}
+
+// GetLatestJobExecution returns the latest successful execution of the job in the run
+func (run *WorkflowRun) GetLatestJobExecution(db *gorm.DB, job *Job) (jobExecution *JobExecution, err error) {
+	jobExecution = &JobExecution{}
+	if ex := db.Where("job_id = ? AND workflow_run_id = ? AND status = ?", job.ID, run.ID, SucceededJobExecutionStatus).Order("id desc").Limit(1).First(jobExecution); ex.Error != nil {
+		err = ex.Error
+		return
+	}
+	return
+}
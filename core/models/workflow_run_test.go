@@ -0,0 +1,105 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// ==========================================================
+// Test Helpers
+
+func createRunJobExecution(db *gorm.DB, run *WorkflowRun, jobID uint, output JobOutputT) {
+	exec := createTestJobExecution(db, jobID, output)
+	exec.WorkflowRunID = run.ID
+	db.Save(exec)
+}
+
+// ==========================================================
+// TestWorkflowRun
+
+func TestAction_Execute_CreatesWorkflowRunWithAllExecutions(t *testing.T) {
+	db := setupJobTestDB(t)
+	action := createTestAction(db, "Test Action")
+	template := createTestJobTemplate(db, "logger")
+
+	root := createTestJob(db, action.ID, template.ID, StaticJsonInput, `{"message": "first"}`, true)
+	second := createTestJob(db, action.ID, template.ID, JobOutputAsInput, fmt.Sprintf("%d", root.ID), false)
+	setCondition(db, root, conditionTo(second.ID))
+
+	require.NoError(t, action.Execute(db))
+
+	var run WorkflowRun
+	require.NoError(t, db.Preload("JobExecutions").Where("action_id = ?", action.ID).First(&run).Error)
+	assert.Equal(t, SucceededWorkflowRunStatus, run.Status)
+	assert.Equal(t, uint(0), run.TriggerID, "Run wasn't started by a trigger")
+	assert.False(t, run.FinishedAt.Before(run.StartedAt))
+	assert.Len(t, run.JobExecutions, 2)
+	for _, exec := range run.JobExecutions {
+		assert.Equal(t, action.UserID, exec.UserID)
+	}
+}
+
+func TestJob_GetInput_ResolvesWithinWorkflowRun(t *testing.T) {
+	db := setupJobTestDB(t)
+	action := createTestAction(db, "Test Action")
+	template := createTestJobTemplate(db, "logger")
+
+	fetch := createTestJob(db, action.ID, template.ID, StaticJsonInput, `{}`, true)
+	fetch.Name = "fetch"
+	db.Save(fetch)
+
+	firstRun, err := NewWorkflowRun(db, action, nil)
+	require.NoError(t, err)
+	secondRun, err := NewWorkflowRun(db, action, nil)
+	require.NoError(t, err)
+	emptyRun, err := NewWorkflowRun(db, action, nil)
+	require.NoError(t, err)
+
+	// The second run executes after the first, so its output is the latest one globally
+	createRunJobExecution(db, firstRun, fetch.ID, JobOutputT(`{"title": "first"}`))
+	createRunJobExecution(db, secondRun, fetch.ID, JobOutputT(`{"title": "second"}`))
+
+	testCases := []struct {
+		name       string
+		inputType  JobInputT
+		inputValue string
+	}{
+		{name: "Job output as input", inputType: JobOutputAsInput, inputValue: fmt.Sprintf("%d", fetch.ID)},
+		{name: "Job input template", inputType: JobInputAsTemplate, inputValue: `{"title": "<< job__fetch__output__title >>"}`},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			job := createTestJob(db, action.ID, template.ID, tc.inputType, tc.inputValue, false)
+
+			job.ExecutionContext = &ExecutionContext{WorkflowRun: firstRun}
+			input, err := job.GetInput(db)
+			assert.NoError(t, err)
+			assert.Equal(t, "first", input["title"], "Should read the output of its own run")
+
+			job.ExecutionContext = &ExecutionContext{WorkflowRun: emptyRun}
+			_, err = job.GetInput(db)
+			assert.Error(t, err, "Should not read outputs of other runs")
+		})
+	}
+}
+
+func TestWorkflowRun_Finish_RedactsError(t *testing.T) {
+	db := setupJobTestDB(t)
+	action := createTestAction(db, "Test Action")
+	execCtx := NewExecutionContext(nil)
+	execCtx.AddSecretValue("hunter2")
+
+	run, err := NewWorkflowRun(db, action, nil)
+	require.NoError(t, err)
+	require.NoError(t, run.Finish(db, execCtx, errors.New("login failed for hunter2")))
+
+	var stored WorkflowRun
+	require.NoError(t, db.First(&stored, run.ID).Error)
+	assert.Equal(t, FailedWorkflowRunStatus, stored.Status)
+	assert.Equal(t, "login failed for "+RedactedSecretValue, stored.Error)
+}
@@ -0,0 +1,402 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// Workflow Issue Severities
+	ErrorIssueSeverity   = IssueSeverityT("error")
+	WarningIssueSeverity = IssueSeverityT("warning")
+
+	// Workflow Issue Codes
+	MissingRootJobIssue        = IssueCodeT("missing_root_job")
+	MultipleRootJobsIssue      = IssueCodeT("multiple_root_jobs")
+	InvalidConditionIssue      = IssueCodeT("invalid_condition")
+	MissingRuleTargetIssue     = IssueCodeT("missing_rule_target")
+	DeletedRuleTargetIssue     = IssueCodeT("deleted_rule_target")
+	ForeignRuleTargetIssue     = IssueCodeT("foreign_rule_target")
+	UnresolvedReferenceIssue   = IssueCodeT("unresolved_reference")
+	UnreachableJobIssue        = IssueCodeT("unreachable_job")
+	UnboundedCycleIssue        = IssueCodeT("unbounded_cycle")
+	InvalidInputReferenceIssue = IssueCodeT("invalid_input_reference")
+	InvalidInputIssue          = IssueCodeT("invalid_input")
+	MissingAssociationIssue    = IssueCodeT("missing_association")
+)
+
+var (
+	ErrInvalidWorkflow = errors.New("workflow validation failed")
+)
+
+type (
+	IssueSeverityT string
+	IssueCodeT     string
+
+	// WorkflowIssue describes a single problem found in the job graph
+	// of an Action. JobID is 0 for issues concerning the Action as a whole.
+	WorkflowIssue struct {
+		JobID    uint           `json:"job_id"`
+		JobName  string         `json:"job_name"`
+		Code     IssueCodeT     `json:"code"`
+		Severity IssueSeverityT `json:"severity"`
+		Message  string         `json:"message"`
+	}
+
+	// JobValidationError is returned when a job fails the validation done
+	// before it's saved. It's an ErrInvalidWorkflow described by Issue.
+	JobValidationError struct {
+		Issue *WorkflowIssue
+	}
+
+	// WorkflowValidator validates the graph formed by the jobs of an Action,
+	// where each ConditionRule of a job is an edge to the job it points at.
+	WorkflowValidator struct {
+		db     *gorm.DB
+		action *Action
+
+		jobs       []*Job
+		jobsByID   map[uint]*Job
+		jobsByName map[string]*Job
+
+		// edges holds the targets of all the rules of a job which
+		// are part of the same action
+		edges map[uint][]uint
+		// unconditionalEdges holds the target of the first rule of a job
+		// if that rule is a wildcard, ie. the job always proceeds to it
+		unconditionalEdges map[uint]uint
+
+		issues []*WorkflowIssue
+	}
+)
+
+func newJobValidationError(job *Job, code IssueCodeT, err error) *JobValidationError {
+	return &JobValidationError{
+		Issue: &WorkflowIssue{
+			JobID:    job.ID,
+			JobName:  job.Name,
+			Code:     code,
+			Severity: ErrorIssueSeverity,
+			Message:  err.Error(),
+		},
+	}
+}
+
+func (validationErr *JobValidationError) Error() string {
+	return validationErr.Issue.Message
+}
+
+func (validationErr *JobValidationError) Unwrap() error {
+	return ErrInvalidWorkflow
+}
+
+func NewWorkflowValidator(db *gorm.DB, action *Action) (validator *WorkflowValidator, err error) {
+	validator = &WorkflowValidator{
+		db:                 db.Session(&gorm.Session{}),
+		action:             action,
+		jobsByID:           make(map[uint]*Job),
+		jobsByName:         make(map[string]*Job),
+		edges:              make(map[uint][]uint),
+		unconditionalEdges: make(map[uint]uint),
+	}
+	if ex := validator.db.Where("action_id = ?", action.ID).Order("id").Find(&validator.jobs); ex.Error != nil {
+		err = ex.Error
+		return
+	}
+	for _, job := range validator.jobs {
+		validator.jobsByID[job.ID] = job
+		validator.jobsByName[job.Name] = job
+	}
+	return
+}
+
+func (validator *WorkflowValidator) addIssue(job *Job, code IssueCodeT, severity IssueSeverityT, message string) {
+	issue := &WorkflowIssue{
+		Code:     code,
+		Severity: severity,
+		Message:  message,
+	}
+	if job != nil {
+		issue.JobID = job.ID
+		issue.JobName = job.Name
+	}
+	validator.issues = append(validator.issues, issue)
+}
+
+func (validator *WorkflowValidator) rootJobs() (rootJobs []*Job) {
+	for _, job := range validator.jobs {
+		if job.IsRootJob {
+			rootJobs = append(rootJobs, job)
+		}
+	}
+	return
+}
+
+func (validator *WorkflowValidator) validateRootJob() (err error) {
+	rootJobs := validator.rootJobs()
+	if len(rootJobs) == 0 {
+		validator.addIssue(nil, MissingRootJobIssue, ErrorIssueSeverity,
+			fmt.Sprintf("Action %s has no root job", validator.action.Name))
+		return
+	}
+	if len(rootJobs) > 1 {
+		for _, job := range rootJobs {
+			validator.addIssue(job, MultipleRootJobsIssue, ErrorIssueSeverity,
+				fmt.Sprintf("Action %s has %d root jobs, only one is allowed", validator.action.Name, len(rootJobs)))
+		}
+	}
+	return
+}
+
+func (validator *WorkflowValidator) validateRuleTarget(job *Job, targetID uint) (isValid bool, err error) {
+	if _, isPresent := validator.jobsByID[targetID]; isPresent {
+		isValid = true
+		return
+	}
+	// Jobs of other users are reported as missing so that their IDs can't
+	// be probed
+	target := &Job{}
+	if ex := validator.db.Unscoped().Where("id = ? AND user_id = ?", targetID, validator.action.UserID).Limit(1).Find(target); ex.Error != nil {
+		err = ex.Error
+		return
+	}
+	switch {
+	case target.ID == 0:
+		validator.addIssue(job, MissingRuleTargetIssue, ErrorIssueSeverity,
+			fmt.Sprintf("Condition rule points at job %d which doesn't exist", targetID))
+	case target.DeletedAt.Valid:
+		validator.addIssue(job, DeletedRuleTargetIssue, ErrorIssueSeverity,
+			fmt.Sprintf("Condition rule points at job %d which has been deleted", targetID))
+	default:
+		validator.addIssue(job, ForeignRuleTargetIssue, ErrorIssueSeverity,
+			fmt.Sprintf("Condition rule points at job %d which belongs to a different action", targetID))
+	}
+	return
+}
+
+func (validator *WorkflowValidator) validateCondition(job *Job) (err error) {
+	var (
+		condition *Condition
+		isValid   bool
+	)
+	if condition, err = ParseCondition(job.Condition); err != nil {
+		validator.addIssue(job, InvalidConditionIssue, ErrorIssueSeverity, err.Error())
+		err = nil
+		return
+	}
+	if err = condition.Validate(); err != nil {
+		validator.addIssue(job, InvalidConditionIssue, ErrorIssueSeverity, err.Error())
+		err = nil
+		return
+	}
+	for idx, rule := range condition.Rules {
+		if isValid, err = validator.validateRuleTarget(job, rule.JobID); err != nil {
+			return
+		}
+		if !isValid {
+			continue
+		}
+		validator.edges[job.ID] = append(validator.edges[job.ID], rule.JobID)
+		if idx == 0 && rule.IsWildcard() {
+			validator.unconditionalEdges[job.ID] = rule.JobID
+		}
+	}
+	return
+}
+
+func (validator *WorkflowValidator) validateInputReferences(job *Job) (err error) {
+	switch job.JobInputType {
+	case JobOutputAsInput:
+		var prevJobID int
+		if prevJobID, err = strconv.Atoi(job.JobInputValue); err != nil {
+			validator.addIssue(job, InvalidInputReferenceIssue, ErrorIssueSeverity,
+				fmt.Sprintf("Job input %s is not a valid job ID", job.JobInputValue))
+			err = nil
+			return
+		}
+		if _, isPresent := validator.jobsByID[uint(prevJobID)]; !isPresent {
+			validator.addIssue(job, UnresolvedReferenceIssue, ErrorIssueSeverity,
+				fmt.Sprintf("Job input refers to job %d which isn't part of the action", prevJobID))
+		}
+	case JobInputAsTemplate:
+		var (
+			jobInpTemplate *JobInputTemplate
+			refs           []*JobReference
+		)
+		if jobInpTemplate, err = NewJobInputTemplate(validator.db, job, job.JobInputValue); err != nil {
+			return
+		}
+		if refs, err = jobInpTemplate.References(); err != nil {
+			validator.addIssue(job, UnresolvedReferenceIssue, ErrorIssueSeverity, err.Error())
+			err = nil
+			return
+		}
+		for _, ref := range refs {
+			if _, isPresent := validator.jobsByName[ref.JobName]; !isPresent {
+				validator.addIssue(job, UnresolvedReferenceIssue, ErrorIssueSeverity,
+					fmt.Sprintf("Job input template refers to job %s which isn't part of the action", ref.JobName))
+			}
+		}
+	case JobInputAsGoTemplate:
+		var (
+			goTemplate *GoTemplate
+		)
+		if goTemplate, err = NewGoTemplate(nil, job, job.JobInputValue); err != nil {
+			validator.addIssue(job, InvalidInputIssue, ErrorIssueSeverity, err.Error())
+			err = nil
+			return
+		}
+		for _, jobName := range goTemplate.JobReferences() {
+			if _, isPresent := validator.jobsByName[jobName]; !isPresent {
+				validator.addIssue(job, UnresolvedReferenceIssue, ErrorIssueSeverity,
+					fmt.Sprintf("Job input template refers to job %s which isn't part of the action", jobName))
+			}
+		}
+	}
+	// Expression inputs and the filters of conditions only read the output
+	// of the previous job, they can't refer to other jobs
+	return
+}
+
+func (validator *WorkflowValidator) validateReachability() (err error) {
+	rootJobs := validator.rootJobs()
+	if len(rootJobs) == 0 {
+		// Reachability can't be determined without a root job, which
+		// is already reported by validateRootJob
+		return
+	}
+	visited := make(map[uint]bool)
+	queue := []uint{}
+	for _, job := range rootJobs {
+		visited[job.ID] = true
+		queue = append(queue, job.ID)
+	}
+	for len(queue) > 0 {
+		jobID := queue[0]
+		queue = queue[1:]
+		for _, nextJobID := range validator.edges[jobID] {
+			if visited[nextJobID] {
+				continue
+			}
+			visited[nextJobID] = true
+			queue = append(queue, nextJobID)
+		}
+	}
+	for _, job := range validator.jobs {
+		if !visited[job.ID] {
+			validator.addIssue(job, UnreachableJobIssue, WarningIssueSeverity,
+				fmt.Sprintf("Job %s can't be reached from the root job", job.Name))
+		}
+	}
+	return
+}
+
+// validateCycles reports cycles which can never be exited. A job whose first
+// rule is a wildcard always proceeds to that rule's job, so a cycle made up
+// only of such rules loops forever once entered.
+func (validator *WorkflowValidator) validateCycles() (err error) {
+	reported := make(map[uint]bool)
+	for _, job := range validator.jobs {
+		var (
+			path    []uint
+			onPath  = make(map[uint]int)
+			current = job.ID
+		)
+		for {
+			if _, isPresent := onPath[current]; isPresent {
+				for _, cycleJobID := range path[onPath[current]:] {
+					if reported[cycleJobID] {
+						continue
+					}
+					reported[cycleJobID] = true
+					validator.addIssue(validator.jobsByID[cycleJobID], UnboundedCycleIssue, ErrorIssueSeverity,
+						fmt.Sprintf("Job %s is part of a cycle without any exit condition", validator.jobsByID[cycleJobID].Name))
+				}
+				break
+			}
+			nextJobID, isPresent := validator.unconditionalEdges[current]
+			if !isPresent || reported[current] {
+				break
+			}
+			onPath[current] = len(path)
+			path = append(path, current)
+			current = nextJobID
+		}
+	}
+	return
+}
+
+func (validator *WorkflowValidator) Validate() (issues []*WorkflowIssue, err error) {
+	validator.issues = []*WorkflowIssue{}
+	if err = validator.validateRootJob(); err != nil {
+		return
+	}
+	for _, job := range validator.jobs {
+		if err = validator.validateCondition(job); err != nil {
+			return
+		}
+		if err = validator.validateInputReferences(job); err != nil {
+			return
+		}
+	}
+	if err = validator.validateReachability(); err != nil {
+		return
+	}
+	if err = validator.validateCycles(); err != nil {
+		return
+	}
+	issues = validator.issues
+	return
+}
+
+// ==========================================================
+// Actions
+
+func (action *Action) ValidateWorkflow(db *gorm.DB) (issues []*WorkflowIssue, err error) {
+	var (
+		validator *WorkflowValidator
+	)
+	if validator, err = NewWorkflowValidator(db, action); err != nil {
+		return
+	}
+	if issues, err = validator.Validate(); err != nil {
+		return
+	}
+	return
+}
+
+// ==========================================================
+// Jobs
+
+// ValidateWorkflow validates the workflow of the job's action and returns
+// the error issues which concern the job. Issues of other jobs and warnings,
+// like unreachable jobs, are expected while a workflow is being built up
+// and are left to be checked via the Action.
+func (job *Job) ValidateWorkflow(db *gorm.DB) (issues []*WorkflowIssue, err error) {
+	var (
+		action       *Action
+		actionIssues []*WorkflowIssue
+	)
+	action = &Action{}
+	if ex := db.Session(&gorm.Session{}).Where("id = ?", job.ActionID).First(action); ex.Error != nil {
+		err = fmt.Errorf("failed to get action with ID %d: %w", job.ActionID, ex.Error)
+		return
+	}
+	if actionIssues, err = action.ValidateWorkflow(db); err != nil {
+		return
+	}
+	issues = []*WorkflowIssue{}
+	for _, issue := range actionIssues {
+		if issue.JobID == job.ID && issue.Severity == ErrorIssueSeverity {
+			issues = append(issues, issue)
+		}
+	}
+	if len(issues) > 0 {
+		err = ErrInvalidWorkflow
+		return
+	}
+	return
+}
@@ -0,0 +1,283 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+// ==========================================================
+// Test Helpers
+
+func conditionTo(jobIDs ...uint) string {
+	condition := &Condition{}
+	for _, jobID := range jobIDs {
+		condition.Rules = append(condition.Rules, &ConditionRule{JobID: jobID})
+	}
+	conditionB, _ := json.Marshal(condition)
+	return string(conditionB)
+}
+
+func setCondition(db *gorm.DB, job *Job, condition string) {
+	job.Condition = condition
+	db.Save(job)
+}
+
+func issueCodes(issues []*WorkflowIssue) (codes []IssueCodeT) {
+	for _, issue := range issues {
+		codes = append(codes, issue.Code)
+	}
+	return
+}
+
+// ==========================================================
+// TestAction_ValidateWorkflow
+
+func TestAction_ValidateWorkflow_ValidChain(t *testing.T) {
+	db := setupJobTestDB(t)
+	action := createTestAction(db, "Test Action")
+	template := createTestJobTemplate(db, "logger")
+
+	root := createTestJob(db, action.ID, template.ID, StaticJsonInput, `{}`, true)
+	second := createTestJob(db, action.ID, template.ID, StaticJsonInput, `{}`, false)
+	setCondition(db, root, conditionTo(second.ID))
+
+	issues, err := action.ValidateWorkflow(db)
+	assert.NoError(t, err)
+	assert.Empty(t, issues, "A linear chain should have no issues")
+}
+
+func TestAction_ValidateWorkflow_MissingRootJob(t *testing.T) {
+	db := setupJobTestDB(t)
+	action := createTestAction(db, "Test Action")
+	template := createTestJobTemplate(db, "logger")
+	createTestJob(db, action.ID, template.ID, StaticJsonInput, `{}`, false)
+
+	issues, err := action.ValidateWorkflow(db)
+	assert.NoError(t, err)
+	assert.Equal(t, []IssueCodeT{MissingRootJobIssue}, issueCodes(issues))
+	assert.Equal(t, ErrorIssueSeverity, issues[0].Severity)
+}
+
+func TestAction_ValidateWorkflow_MultipleRootJobs(t *testing.T) {
+	db := setupJobTestDB(t)
+	action := createTestAction(db, "Test Action")
+	template := createTestJobTemplate(db, "logger")
+	createTestJob(db, action.ID, template.ID, StaticJsonInput, `{}`, true)
+	createTestJob(db, action.ID, template.ID, StaticJsonInput, `{}`, true)
+
+	issues, err := action.ValidateWorkflow(db)
+	assert.NoError(t, err)
+	assert.Equal(t, []IssueCodeT{MultipleRootJobsIssue, MultipleRootJobsIssue}, issueCodes(issues))
+}
+
+func TestAction_ValidateWorkflow_RuleTargets(t *testing.T) {
+	db := setupJobTestDB(t)
+	action := createTestAction(db, "Test Action")
+	otherAction := createTestAction(db, "Other Action")
+	template := createTestJobTemplate(db, "logger")
+
+	foreignJob := createTestJob(db, otherAction.ID, template.ID, StaticJsonInput, `{}`, true)
+	deletedJob := createTestJob(db, action.ID, template.ID, StaticJsonInput, `{}`, false)
+	db.Delete(deletedJob)
+	otherUserJob := createTestJob(db, otherAction.ID, template.ID, StaticJsonInput, `{}`, false)
+	db.Model(otherUserJob).UpdateColumn("user_id", 2)
+	deletedOtherUserJob := createTestJob(db, otherAction.ID, template.ID, StaticJsonInput, `{}`, false)
+	db.Model(deletedOtherUserJob).UpdateColumn("user_id", 2)
+	db.Delete(deletedOtherUserJob)
+
+	testCases := []struct {
+		name         string
+		targetID     uint
+		expectedCode IssueCodeT
+	}{
+		{name: "Job in a different action", targetID: foreignJob.ID, expectedCode: ForeignRuleTargetIssue},
+		{name: "Deleted job", targetID: deletedJob.ID, expectedCode: DeletedRuleTargetIssue},
+		{name: "Non-existent job", targetID: 99999, expectedCode: MissingRuleTargetIssue},
+		{name: "Job of another user", targetID: otherUserJob.ID, expectedCode: MissingRuleTargetIssue},
+		{name: "Deleted job of another user", targetID: deletedOtherUserJob.ID, expectedCode: MissingRuleTargetIssue},
+	}
+
+	root := createTestJob(db, action.ID, template.ID, StaticJsonInput, `{}`, true)
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			setCondition(db, root, conditionTo(tc.targetID))
+
+			issues, err := action.ValidateWorkflow(db)
+			assert.NoError(t, err)
+			assert.Equal(t, []IssueCodeT{tc.expectedCode}, issueCodes(issues))
+			assert.Equal(t, root.ID, issues[0].JobID)
+		})
+	}
+}
+
+func TestAction_ValidateWorkflow_InvalidCondition(t *testing.T) {
+	db := setupJobTestDB(t)
+	action := createTestAction(db, "Test Action")
+	template := createTestJobTemplate(db, "logger")
+	root := createTestJob(db, action.ID, template.ID, StaticJsonInput, `{}`, true)
+
+	for _, condition := range []string{
+		`{invalid json}`,
+		`{"condition_rules": [{"filters": [{"name": "status", "comparison_type": "unknown"}]}]}`,
+	} {
+		// Bypass the BeforeSave hook to mimic conditions saved before it validated them
+		db.Model(root).UpdateColumn("condition", condition)
+
+		issues, err := action.ValidateWorkflow(db)
+		assert.NoError(t, err)
+		assert.Equal(t, []IssueCodeT{InvalidConditionIssue}, issueCodes(issues))
+	}
+}
+
+func TestAction_ValidateWorkflow_UnreachableJob(t *testing.T) {
+	db := setupJobTestDB(t)
+	action := createTestAction(db, "Test Action")
+	template := createTestJobTemplate(db, "logger")
+	createTestJob(db, action.ID, template.ID, StaticJsonInput, `{}`, true)
+	orphan := createTestJob(db, action.ID, template.ID, StaticJsonInput, `{}`, false)
+
+	issues, err := action.ValidateWorkflow(db)
+	assert.NoError(t, err)
+	assert.Equal(t, []IssueCodeT{UnreachableJobIssue}, issueCodes(issues))
+	assert.Equal(t, orphan.ID, issues[0].JobID)
+	assert.Equal(t, WarningIssueSeverity, issues[0].Severity)
+}
+
+func TestAction_ValidateWorkflow_UnboundedCycle(t *testing.T) {
+	db := setupJobTestDB(t)
+	action := createTestAction(db, "Test Action")
+	template := createTestJobTemplate(db, "logger")
+
+	root := createTestJob(db, action.ID, template.ID, StaticJsonInput, `{}`, true)
+	first := createTestJob(db, action.ID, template.ID, StaticJsonInput, `{}`, false)
+	second := createTestJob(db, action.ID, template.ID, StaticJsonInput, `{}`, false)
+	setCondition(db, root, conditionTo(first.ID))
+	setCondition(db, first, conditionTo(second.ID))
+	setCondition(db, second, conditionTo(first.ID))
+
+	issues, err := action.ValidateWorkflow(db)
+	assert.NoError(t, err)
+	assert.Equal(t, []IssueCodeT{UnboundedCycleIssue, UnboundedCycleIssue}, issueCodes(issues))
+	assert.ElementsMatch(t, []uint{first.ID, second.ID}, []uint{issues[0].JobID, issues[1].JobID})
+}
+
+func TestAction_ValidateWorkflow_CycleWithExitCondition(t *testing.T) {
+	db := setupJobTestDB(t)
+	action := createTestAction(db, "Test Action")
+	template := createTestJobTemplate(db, "logger")
+
+	root := createTestJob(db, action.ID, template.ID, StaticJsonInput, `{}`, true)
+	exit := createTestJob(db, action.ID, template.ID, StaticJsonInput, `{}`, false)
+
+	// The root job loops back to itself until the status is "done"
+	condition := &Condition{
+		Rules: []*ConditionRule{
+			{
+				Filters: []*Filter{{Name: "status", Value: "done", ComparisonType: EqualityComparison, ShouldMatch: true}},
+				JobID:   exit.ID,
+			},
+			{JobID: root.ID},
+		},
+	}
+	conditionB, _ := json.Marshal(condition)
+	setCondition(db, root, string(conditionB))
+
+	issues, err := action.ValidateWorkflow(db)
+	assert.NoError(t, err)
+	assert.Empty(t, issues, "A cycle with an exit condition should be allowed")
+}
+
+func TestAction_ValidateWorkflow_InputReferences(t *testing.T) {
+	db := setupJobTestDB(t)
+	action := createTestAction(db, "Test Action")
+	template := createTestJobTemplate(db, "logger")
+
+	root := createJobWithExecution(db, action.ID, template.ID, "fetch", JobOutputT(`{"title": "x"}`))
+	root.IsRootJob = true
+	db.Save(root)
+
+	testCases := []struct {
+		name          string
+		inputType     JobInputT
+		inputValue    string
+		expectedCodes []IssueCodeT
+	}{
+		{
+			name:       "Resolvable template reference",
+			inputType:  JobInputAsTemplate,
+			inputValue: `{"message": "<< job__fetch__output__title >>"}`,
+		},
+		{
+			name:          "Unresolvable template reference",
+			inputType:     JobInputAsTemplate,
+			inputValue:    `{"message": "<< job__missing__output__title >>"}`,
+			expectedCodes: []IssueCodeT{UnresolvedReferenceIssue},
+		},
+		{
+			name:       "Resolvable Go template reference",
+			inputType:  JobInputAsGoTemplate,
+			inputValue: `{"message": "{{ .Jobs.fetch.title }} {{ index $.Jobs "fetch" }}"}`,
+		},
+		{
+			name:          "Unresolvable Go template reference",
+			inputType:     JobInputAsGoTemplate,
+			inputValue:    `{"message": "{{ if .Jobs.missing }}{{ .Jobs.fetch.title }}{{ end }}"}`,
+			expectedCodes: []IssueCodeT{UnresolvedReferenceIssue},
+		},
+		{
+			name:          "Unresolvable Go template reference by index",
+			inputType:     JobInputAsGoTemplate,
+			inputValue:    `{"message": "{{ get (index .Jobs "missing") "title" }}"}`,
+			expectedCodes: []IssueCodeT{UnresolvedReferenceIssue},
+		},
+		{
+			name:       "Job output from the same action",
+			inputType:  JobOutputAsInput,
+			inputValue: fmt.Sprintf("%d", root.ID),
+		},
+		{
+			name:          "Job output from an unknown job",
+			inputType:     JobOutputAsInput,
+			inputValue:    "99999",
+			expectedCodes: []IssueCodeT{UnresolvedReferenceIssue},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			job := createTestJob(db, action.ID, template.ID, tc.inputType, tc.inputValue, false)
+			setCondition(db, root, conditionTo(job.ID))
+			defer db.Delete(job)
+
+			issues, err := action.ValidateWorkflow(db)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedCodes, issueCodes(issues))
+		})
+	}
+}
+
+// ==========================================================
+// TestJob_ValidateWorkflow
+
+func TestJob_ValidateWorkflow_OnlyReturnsErrorsOfJob(t *testing.T) {
+	db := setupJobTestDB(t)
+	action := createTestAction(db, "Test Action")
+	template := createTestJobTemplate(db, "logger")
+
+	root := createTestJob(db, action.ID, template.ID, StaticJsonInput, `{}`, true)
+	// An unreachable job is only a warning and shouldn't block saving it
+	unreachable := createTestJob(db, action.ID, template.ID, StaticJsonInput, `{}`, false)
+	setCondition(db, root, conditionTo(99999))
+
+	issues, err := unreachable.ValidateWorkflow(db)
+	assert.NoError(t, err)
+	assert.Empty(t, issues)
+
+	issues, err = root.ValidateWorkflow(db)
+	assert.ErrorIs(t, err, ErrInvalidWorkflow)
+	assert.Equal(t, []IssueCodeT{MissingRuleTargetIssue}, issueCodes(issues))
+}
@@ -53,7 +53,7 @@ func (te *TriggerExecutor) ProcessOne(trigger *models.Trigger) (err error) {
 		return
 	}
 	// Execute the trigger
-	if err = trigger.Execute(te.db); err != nil {
+	if err = trigger.ExecuteContext(te.ctx, te.db); err != nil {
 		triggerExecStatus = models.FailedTriggerStatus
 	}
 	// Update the trigger's executed status